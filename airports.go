@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/quantonganh/nearby-cities/nearbycities"
+	"github.com/rs/zerolog"
+)
+
+// runAirports runs the airports subcommand, which loads the OurAirports
+// airports.csv file at the path given in args into the configured
+// database, replacing the airports imported before.
+func runAirports(cfg config, logger zerolog.Logger, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: %s airports airports.csv", os.Args[0])
+	}
+
+	f, err := os.Open(args[0])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	airports, err := nearbycities.ReadAirports(f)
+	if err != nil {
+		return err
+	}
+
+	store, err := openStorage(cfg, logger)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	if err := store.MigrateUp(ctx); err != nil {
+		return err
+	}
+
+	if err := store.ImportAirports(ctx, airports); err != nil {
+		return err
+	}
+
+	fmt.Printf("%d airports imported\n", len(airports))
+	return nil
+}
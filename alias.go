@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/quantonganh/nearby-cities/nearbycities"
+	"github.com/rs/zerolog"
+)
+
+// runAlias runs the alias subcommand, which makes the city with the dataset
+// ID given in args known by the alias in the configured database, e.g.
+// a former name or an abbreviation. Adding an alias again points it to the
+// new city.
+func runAlias(cfg config, logger zerolog.Logger, args []string) error {
+	if len(args) != 2 || nearbycities.Slugify(args[0]) == "" {
+		return fmt.Errorf("usage: %s alias NYC 1840034016", os.Args[0])
+	}
+	alias, id := args[0], args[1]
+
+	store, err := openStorage(cfg, logger)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	if err := store.MigrateUp(ctx); err != nil {
+		return err
+	}
+
+	if err := store.AddAlias(ctx, alias, id); err != nil {
+		if errors.Is(err, nearbycities.ErrNotFound) {
+			return fmt.Errorf("no city with ID %s", id)
+		}
+		return err
+	}
+
+	city, err := store.CityByAlias(ctx, alias)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%s now stands for %s, %s\n", alias, city.City, city.Country)
+	return nil
+}
@@ -0,0 +1,514 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/quantonganh/httperror"
+	"github.com/quantonganh/nearby-cities/nearbycities"
+)
+
+// apiVersion describes how one version of the JSON API marshals its
+// responses. A schema change ships as a new version so that clients of the
+// older ones keep getting the fields they expect.
+type apiVersion struct {
+	Name string
+
+	// City marshals the city, with its distance in kilometers and, if
+	// the unit is miles, in miles as well.
+	City func(c nearbycities.City, u distanceUnit) any
+}
+
+var apiV1 = apiVersion{
+	Name: "v1",
+	City: func(c nearbycities.City, u distanceUnit) any {
+		return newCityResponse(c, u)
+	},
+}
+
+// apiVersions lists the versions served under /api/{version}.
+var apiVersions = []apiVersion{apiV1}
+
+func (v apiVersion) cities(cities []nearbycities.City, u distanceUnit) []any {
+	resp := make([]any, 0, len(cities))
+	for _, c := range cities {
+		resp = append(resp, v.City(c, u))
+	}
+
+	return resp
+}
+
+// registerAPI mounts the endpoints of every API version on the router.
+func registerAPI(r *httperror.Router, svc *nearbycities.Service, versions ...apiVersion) {
+	for _, v := range versions {
+		prefix := "/api/" + v.Name
+		r.Add(prefix+"/search", apiSearchHandler(svc, v))
+		r.Add(prefix+"/cities/nearby", apiNearbyHandler(svc, v))
+		r.Add(prefix+"/ip", apiIPHandler(svc))
+		r.Add(prefix+"/airports/nearby", apiAirportsHandler(svc))
+		r.Add(prefix+"/country/", apiCountryHandler(svc, v, prefix+"/country/"))
+	}
+}
+
+func apiSearchHandler(svc *nearbycities.Service, v apiVersion) httperror.Handler {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		fromCity, cityID := r.FormValue("city"), r.FormValue("city_id")
+		if fromCity == "" && cityID == "" {
+			return httperror.New(http.StatusBadRequest, "city or city_id is required")
+		}
+
+		unit, err := parseUnit(r)
+		if err != nil {
+			return err
+		}
+
+		radius, err := parseRadius(r, unit)
+		if err != nil {
+			return err
+		}
+
+		capitals, err := parseCapitals(r)
+		if err != nil {
+			return err
+		}
+
+		k, err := parseK(r)
+		if err != nil {
+			return err
+		}
+
+		format, err := apiFormat(r, formatGeoJSON)
+		if err != nil {
+			return err
+		}
+
+		var cities []nearbycities.City
+		if k > 0 {
+			_, cities, err = searchNearest(r.Context(), svc, fromCity, cityID, k, keepCapitals(capitals))
+		} else {
+			_, cities, err = searchCity(r.Context(), svc, fromCity, cityID, radius)
+		}
+		if err != nil {
+			var ambiguous *nearbycities.AmbiguousError
+			if errors.As(err, &ambiguous) {
+				return writeJSONStatus(w, http.StatusMultipleChoices, newAmbiguousResponse(ambiguous))
+			}
+			if errors.Is(err, nearbycities.ErrNotFound) {
+				if suggestions := svc.DidYouMean(fromCity, maxDidYouMean); len(suggestions) > 0 {
+					return writeJSONStatus(w, http.StatusNotFound, newNoMatchResponse(suggestions))
+				}
+				return httperror.New(http.StatusNotFound, "no matching city found")
+			}
+			return err
+		}
+
+		cities, err = paginate(w, r, filterCapitals(cities, capitals))
+		if err != nil {
+			return err
+		}
+		return writeAPICities(w, format, v, cities, unit)
+	}
+}
+
+// apiFormat returns the format of the cities of an API response: one of the
+// supported ones when the format parameter or the Accept header asks for
+// it, and JSON otherwise, since the API does not answer in HTML. A format
+// parameter naming another format is answered 406.
+func apiFormat(r *http.Request, supported ...string) (string, error) {
+	if f := responseFormat(r); slices.Contains(supported, f) {
+		return f, nil
+	}
+	if f := r.URL.Query().Get("format"); f != "" && !strings.EqualFold(f, formatJSON) {
+		return "", httperror.New(http.StatusNotAcceptable, "format must be json or "+strings.Join(supported, " or "))
+	}
+
+	return formatJSON, nil
+}
+
+// writeAPICities writes the cities in the format, JSON or GeoJSON.
+func writeAPICities(w http.ResponseWriter, format string, v apiVersion, cities []nearbycities.City, u distanceUnit) error {
+	if format == formatGeoJSON {
+		return writeGeoJSON(w, cities, u)
+	}
+	return writeJSON(w, v.cities(cities, u))
+}
+
+// searchCity finds the city with the dataset ID when one is given, e.g.
+// picked among namesakes, or else the one matching the query, and the
+// cities within radius kilometers of it.
+func searchCity(ctx context.Context, svc *nearbycities.Service, query, id string, radius float64) (nearbycities.City, []nearbycities.City, error) {
+	if id != "" {
+		if _, err := strconv.ParseInt(id, 10, 64); err != nil {
+			return nearbycities.City{}, nil, nearbycities.ErrNotFound
+		}
+		return svc.NearbyCityByID(ctx, id, radius)
+	}
+
+	return svc.NearbyCity(ctx, query, radius)
+}
+
+// searchNearest is searchCity for the k cities closest to the city found,
+// among the ones keep keeps.
+func searchNearest(ctx context.Context, svc *nearbycities.Service, query, id string, k int, keep func(nearbycities.City) bool) (nearbycities.City, []nearbycities.City, error) {
+	if id != "" {
+		if _, err := strconv.ParseInt(id, 10, 64); err != nil {
+			return nearbycities.City{}, nil, nearbycities.ErrNotFound
+		}
+		return svc.NearestCityByID(ctx, id, k, keep)
+	}
+
+	return svc.NearestCity(ctx, query, k, keep)
+}
+
+// apiNearbyHandler finds the cities around the latitude and longitude, or
+// around the center of the geohash cell given instead. With k, it finds the
+// k closest ones however far they are.
+func apiNearbyHandler(svc *nearbycities.Service, v apiVersion) httperror.Handler {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		lat, lng, err := parseOrigin(r)
+		if err != nil {
+			return err
+		}
+
+		unit, err := parseUnit(r)
+		if err != nil {
+			return err
+		}
+
+		radius, err := parseRadius(r, unit)
+		if err != nil {
+			return err
+		}
+
+		capitals, err := parseCapitals(r)
+		if err != nil {
+			return err
+		}
+
+		k, err := parseK(r)
+		if err != nil {
+			return err
+		}
+
+		format, err := apiFormat(r, formatGeoJSON, formatNDJSON)
+		if err != nil {
+			return err
+		}
+
+		// Streamed, the cities within the radius are not sorted by distance.
+		if format == formatNDJSON && k == 0 {
+			keep := keepCapitals(capitals)
+			return streamCities(w, r, v, unit, func(fn func(nearbycities.City) error) error {
+				return svc.EachNearbyLatLng(r.Context(), lat, lng, radius, func(c nearbycities.City) error {
+					if keep != nil && !keep(c) {
+						return nil
+					}
+					return fn(c)
+				})
+			})
+		}
+
+		var cities []nearbycities.City
+		if k > 0 {
+			cities, err = svc.NearestLatLng(r.Context(), lat, lng, k, keepCapitals(capitals))
+		} else {
+			cities, err = svc.NearbyLatLng(r.Context(), lat, lng, radius)
+		}
+		if err != nil {
+			return err
+		}
+
+		if format == formatNDJSON {
+			return streamCities(w, r, v, unit, func(fn func(nearbycities.City) error) error {
+				return eachCity(cities, fn)
+			})
+		}
+		cities, err = paginate(w, r, filterCapitals(cities, capitals))
+		if err != nil {
+			return err
+		}
+		return writeAPICities(w, format, v, cities, unit)
+	}
+}
+
+func apiAirportsHandler(svc *nearbycities.Service) httperror.Handler {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		lat, lng, err := parseOrigin(r)
+		if err != nil {
+			return err
+		}
+
+		unit, err := parseUnit(r)
+		if err != nil {
+			return err
+		}
+
+		radius, err := parseRadius(r, unit)
+		if err != nil {
+			return err
+		}
+
+		airports, err := svc.NearbyAirports(r.Context(), lat, lng, radius, r.FormValue("scheduled") == "true")
+		if err != nil {
+			return err
+		}
+
+		resp := make([]airportResponse, 0, len(airports))
+		for _, a := range airports {
+			resp = append(resp, newAirportResponse(a, unit))
+		}
+
+		return writeJSON(w, resp)
+	}
+}
+
+// apiIPHandler locates the address given by the ip parameter, or the one of
+// the client when it is missing.
+func apiIPHandler(svc *nearbycities.Service) httperror.Handler {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		ip := r.FormValue("ip")
+		if ip == "" {
+			var err error
+			ip, err = httperror.GetIP(r)
+			if err != nil {
+				return err
+			}
+		} else if net.ParseIP(ip) == nil {
+			return httperror.New(http.StatusBadRequest, "ip must be an IP address")
+		}
+
+		loc, err := svc.LocateIP(r.Context(), ip)
+		if err != nil {
+			if errors.Is(err, nearbycities.ErrNotFound) {
+				return httperror.New(http.StatusNotFound, "the address could not be located")
+			}
+			return err
+		}
+
+		return writeJSON(w, newIPLocationResponse(ip, loc))
+	}
+}
+
+const (
+	defaultCountryLimit = 50
+	maxCountryLimit     = 500
+)
+
+// apiCountryHandler serves {prefix}{iso2}: the country and a page of its
+// cities, most populated first or by name with sort=name, or all its cities
+// as JSON lines.
+func apiCountryHandler(svc *nearbycities.Service, v apiVersion, prefix string) httperror.Handler {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		iso2, ok := pathParam(r.URL.Path, prefix, "")
+		if !ok {
+			return httperror.New(http.StatusNotFound, "page not found")
+		}
+
+		country, ok := nearbycities.LookupCountry(iso2)
+		if !ok {
+			return httperror.New(http.StatusNotFound, "no such country")
+		}
+
+		sort := nearbycities.ByPopulation
+		switch s := r.FormValue("sort"); s {
+		case "", string(nearbycities.ByPopulation):
+		case string(nearbycities.ByName):
+			sort = nearbycities.ByName
+		default:
+			return httperror.New(http.StatusBadRequest, "sort must be population or name")
+		}
+
+		// Streamed, every city of the country is written, one per line.
+		if isStreamed(r) {
+			return streamCities(w, r, v, unitKm, func(fn func(nearbycities.City) error) error {
+				return svc.EachCountryCity(r.Context(), country.Iso2, sort, fn)
+			})
+		}
+
+		limit, err := parseCount(r, "limit", defaultCountryLimit)
+		if err != nil {
+			return err
+		}
+		if limit == 0 || limit > maxCountryLimit {
+			return httperror.New(http.StatusBadRequest, fmt.Sprintf("limit must be in the range [1, %d]", maxCountryLimit))
+		}
+
+		offset, err := parseCount(r, "offset", 0)
+		if err != nil {
+			return err
+		}
+
+		cities, total, err := svc.CountryCities(r.Context(), country.Iso2, sort, offset, limit)
+		if err != nil {
+			return err
+		}
+
+		resp := countryResponse{
+			Iso2:        country.Iso2,
+			Iso3:        country.Iso3,
+			Name:        country.Name,
+			Flag:        country.Flag(),
+			Continent:   country.Continent,
+			Currency:    country.Currency,
+			CallingCode: country.CallingCode,
+			TLD:         country.TLD,
+			Total:       total,
+			Offset:      offset,
+			Limit:       limit,
+			Cities:      v.cities(cities, unitKm),
+		}
+		if offset+len(cities) < total {
+			q := r.URL.Query()
+			q.Set("offset", strconv.Itoa(offset+len(cities)))
+			resp.Next = r.URL.Path + "?" + q.Encode()
+		}
+
+		return writeJSON(w, resp)
+	}
+}
+
+// parseCount returns the non-negative integer of the parameter, or def when
+// it is missing.
+func parseCount(r *http.Request, name string, def int) (int, error) {
+	s := r.FormValue(name)
+	if s == "" {
+		return def, nil
+	}
+
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return 0, httperror.New(http.StatusBadRequest, name+" must be a non-negative integer")
+	}
+
+	return n, nil
+}
+
+func parseOrigin(r *http.Request) (float64, float64, error) {
+	if r.FormValue("latitude") == "" && r.FormValue("lat") != "" {
+		// lat and lng, which the airports endpoint took first, are accepted
+		// too.
+		lat, err := parseCoordinate(r, "lat", -90, 90)
+		if err != nil {
+			return 0, 0, err
+		}
+		lng, err := parseCoordinate(r, "lng", -180, 180)
+		if err != nil {
+			return 0, 0, err
+		}
+		return lat, lng, nil
+	}
+
+	if hash := r.FormValue("geohash"); hash != "" {
+		lat, lng, ok := nearbycities.DecodeGeohash(hash)
+		if !ok {
+			return 0, 0, httperror.New(http.StatusBadRequest, "geohash must be made of 1 to 12 geohash characters")
+		}
+		return lat, lng, nil
+	}
+
+	lat, err := parseCoordinate(r, "latitude", -90, 90)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	lng, err := parseCoordinate(r, "longitude", -180, 180)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return lat, lng, nil
+}
+
+func parseCoordinate(r *http.Request, name string, min, max float64) (float64, error) {
+	v, err := strconv.ParseFloat(r.FormValue(name), 64)
+	if err != nil || math.IsNaN(v) || v < min || v > max {
+		return 0, httperror.New(http.StatusBadRequest, fmt.Sprintf("%s must be a number in the range [%v, %v]", name, min, max))
+	}
+
+	return v, nil
+}
+
+// parseRadius returns the radius parameter, in the unit, as kilometers.
+func parseRadius(r *http.Request, u distanceUnit) (float64, error) {
+	s := r.FormValue("radius")
+	if s == "" {
+		return defaultRadius, nil
+	}
+
+	radius, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(radius) || radius <= 0 || u.toKm(radius) > maxRadius {
+		return 0, httperror.New(http.StatusBadRequest, fmt.Sprintf("radius must be a positive number of kilometers up to %.0f, or of miles up to %.0f with unit=mi", maxRadius, unitMi.fromKm(maxRadius)))
+	}
+
+	return u.toKm(radius), nil
+}
+
+// maxK bounds the number of closest cities a request can ask for.
+const maxK = 1000
+
+// parseK returns the number of closest cities asked for by the k parameter,
+// or 0 when it is missing. It cannot be combined with a radius.
+func parseK(r *http.Request) (int, error) {
+	s := r.FormValue("k")
+	if s == "" {
+		return 0, nil
+	}
+
+	k, err := strconv.Atoi(s)
+	if err != nil || k <= 0 || k > maxK {
+		return 0, httperror.New(http.StatusBadRequest, fmt.Sprintf("k must be a number of cities between 1 and %d", maxK))
+	}
+	if r.FormValue("radius") != "" {
+		return 0, httperror.New(http.StatusBadRequest, "k and radius cannot be combined")
+	}
+
+	return k, nil
+}
+
+// parseCapitals returns the kinds of capital listed by the capital parameter,
+// e.g. primary,admin, or nil when it is missing.
+func parseCapitals(r *http.Request) ([]string, error) {
+	capitals := splitList(r.FormValue("capital"))
+	for _, c := range capitals {
+		switch c {
+		case "primary", "admin", "minor":
+		default:
+			return nil, httperror.New(http.StatusBadRequest, "capital must be primary, admin or minor")
+		}
+	}
+
+	return capitals, nil
+}
+
+// keepCapitals returns the filter keeping the capitals of the kinds, or nil
+// to keep every city when there are none.
+func keepCapitals(capitals []string) func(nearbycities.City) bool {
+	if len(capitals) == 0 {
+		return nil
+	}
+
+	return func(c nearbycities.City) bool {
+		return slices.Contains(capitals, c.Capital)
+	}
+}
+
+// filterCapitals keeps the cities that are one of the kinds of capital:
+// primary for the national capitals, admin for those of the first-level
+// divisions and minor for the lower-level ones. All the cities are kept when
+// capitals is empty.
+func filterCapitals(cities []nearbycities.City, capitals []string) []nearbycities.City {
+	if len(capitals) == 0 {
+		return cities
+	}
+
+	return slices.DeleteFunc(cities, func(c nearbycities.City) bool {
+		return !slices.Contains(capitals, c.Capital)
+	})
+}
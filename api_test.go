@@ -0,0 +1,85 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseCoordinate(t *testing.T) {
+	tests := []struct {
+		value string
+		want  float64
+		ok    bool
+	}{
+		{"21.0283", 21.0283, true},
+		{"-90", -90, true},
+		{"90", 90, true},
+		{"90.1", 0, false},
+		{"", 0, false},
+		{"north", 0, false},
+		{"NaN", 0, false},
+		{"Inf", 0, false},
+		{"-Inf", 0, false},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/?lat="+tt.value, nil)
+		got, err := parseCoordinate(r, "lat", -90, 90)
+		if got != tt.want || (err == nil) != tt.ok {
+			t.Errorf("lat=%s: got %v, %v, want %v, ok %v", tt.value, got, err, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestParseRadius(t *testing.T) {
+	tests := []struct {
+		query string
+		unit  distanceUnit
+		want  float64
+		ok    bool
+	}{
+		{"", unitKm, defaultRadius, true},
+		{"radius=50", unitKm, 50, true},
+		{"radius=10", unitMi, 16.09344, true},
+		{"radius=20038", unitKm, maxRadius, true},
+		{"radius=20039", unitKm, 0, false},
+		{"radius=12452", unitMi, 0, false},
+		{"radius=0", unitKm, 0, false},
+		{"radius=-5", unitKm, 0, false},
+		{"radius=NaN", unitKm, 0, false},
+		{"radius=Inf", unitKm, 0, false},
+		{"radius=far", unitKm, 0, false},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/?"+tt.query, nil)
+		got, err := parseRadius(r, tt.unit)
+		if got != tt.want || (err == nil) != tt.ok {
+			t.Errorf("%s in %s: got %v, %v, want %v, ok %v", tt.query, tt.unit, got, err, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestAPIFormat(t *testing.T) {
+	tests := []struct {
+		query  string
+		accept string
+		want   string
+		ok     bool
+	}{
+		{"", "", formatJSON, true},
+		{"", "text/html,application/xhtml+xml,*/*;q=0.8", formatJSON, true},
+		{"", "application/geo+json", formatGeoJSON, true},
+		{"", "application/x-ndjson", formatJSON, true},
+		{"format=geojson", "", formatGeoJSON, true},
+		{"format=json", "application/geo+json", formatJSON, true},
+		{"format=csv", "", "", false},
+		{"format=ndjson", "", "", false},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/?"+tt.query, nil)
+		r.Header.Set("Accept", tt.accept)
+		got, err := apiFormat(r, formatGeoJSON)
+		if got != tt.want || (err == nil) != tt.ok {
+			t.Errorf("%q, Accept %q: got %q, %v, want %q, ok %v", tt.query, tt.accept, got, err, tt.want, tt.ok)
+		}
+	}
+}
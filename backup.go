@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/quantonganh/nearby-cities/nearbycities"
+	"github.com/rs/zerolog"
+)
+
+// runBackup runs the backup subcommand, which copies the configured SQLite
+// database, the dataset along with the custom imports, to a file or to an
+// s3://bucket/key URL while the server keeps running.
+func runBackup(cfg config, logger zerolog.Logger, args []string) error {
+	dst, err := parseBackupArgs("backup", args)
+	if err != nil {
+		return err
+	}
+	obj, isS3, err := parseS3URL(dst)
+	if err != nil {
+		return err
+	}
+
+	store, err := openSQLiteStorage(cfg, logger, "backup")
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	if !isS3 {
+		// The backup is written aside, leaving a previous one whole until it
+		// is complete.
+		tmp := dst + ".tmp"
+		if err := store.Backup(ctx, tmp); err != nil {
+			os.Remove(tmp)
+			return err
+		}
+		if err := os.Rename(tmp, dst); err != nil {
+			return err
+		}
+		fmt.Printf("Backed up the database to %s.\n", dst)
+		return nil
+	}
+
+	client, err := s3ClientFromEnv()
+	if err != nil {
+		return err
+	}
+	tmp, err := tempPath("nearby-cities-backup-*.db")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+
+	if err := store.Backup(ctx, tmp); err != nil {
+		return err
+	}
+	if err := client.upload(ctx, obj, tmp); err != nil {
+		return fmt.Errorf("error uploading the backup: %w", err)
+	}
+	fmt.Printf("Backed up the database to %s.\n", dst)
+	return nil
+}
+
+// runRestore runs the restore subcommand, which replaces the content of the
+// configured SQLite database with a backup from a file or an s3://bucket/key
+// URL. The server is to be stopped meanwhile, as it does not reload the
+// database.
+func runRestore(cfg config, logger zerolog.Logger, args []string) error {
+	src, err := parseBackupArgs("restore", args)
+	if err != nil {
+		return err
+	}
+	obj, isS3, err := parseS3URL(src)
+	if err != nil {
+		return err
+	}
+
+	path := src
+	ctx := context.Background()
+	if isS3 {
+		client, err := s3ClientFromEnv()
+		if err != nil {
+			return err
+		}
+		if path, err = tempPath("nearby-cities-restore-*.db"); err != nil {
+			return err
+		}
+		defer os.Remove(path)
+
+		if err := client.download(ctx, obj, path); err != nil {
+			return fmt.Errorf("error downloading the backup: %w", err)
+		}
+	}
+
+	store, err := openSQLiteStorage(cfg, logger, "restore")
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	if err := store.Restore(ctx, path); err != nil {
+		return err
+	}
+	fmt.Printf("Restored the database from %s.\n", src)
+	return nil
+}
+
+// parseBackupArgs returns the file or the s3://bucket/key URL given to cmd,
+// backup or restore. A path starting with a dash is refused, being more
+// likely a mistyped flag than a file.
+func parseBackupArgs(cmd string, args []string) (string, error) {
+	usage := fmt.Sprintf("usage: %s %s nearby-cities.db|s3://bucket/key", os.Args[0], cmd)
+	fs := flag.NewFlagSet(cmd, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), usage)
+	}
+	if err := fs.Parse(args); err != nil {
+		return "", err
+	}
+	if fs.NArg() != 1 || strings.HasPrefix(fs.Arg(0), "-") {
+		return "", errors.New(usage)
+	}
+	return fs.Arg(0), nil
+}
+
+// openSQLiteStorage opens the configured database for cmd, which only
+// SQLite databases support.
+func openSQLiteStorage(cfg config, logger zerolog.Logger, cmd string) (*nearbycities.SQLiteStore, error) {
+	store, err := openStorage(cfg, logger)
+	if err != nil {
+		return nil, err
+	}
+	sqlite, ok := store.(*nearbycities.SQLiteStore)
+	if !ok {
+		store.Close()
+		return nil, fmt.Errorf("%s supports the SQLite databases only, use the tools of the database server otherwise, e.g. pg_dump or mysqldump", cmd)
+	}
+	if cfg.Database.URL == ":memory:" {
+		store.Close()
+		return nil, errors.New("an in-memory database cannot be backed up or restored")
+	}
+	return sqlite, nil
+}
+
+// tempPath returns the path of a new empty file in the temporary directory,
+// named after pattern as os.CreateTemp does.
+func tempPath(pattern string) (string, error) {
+	f, err := os.CreateTemp("", pattern)
+	if err != nil {
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+	return f.Name(), nil
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"errors"
+	"html/template"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/quantonganh/httperror"
+	"github.com/quantonganh/nearby-cities/nearbycities"
+)
+
+// RegionsPage lists the regions of a country.
+type RegionsPage struct {
+	locale
+	theme
+	Country nearbycities.Country
+	Regions []nearbycities.Region
+}
+
+// RegionPage lists the cities of a region.
+type RegionPage struct {
+	locale
+	theme
+	Country nearbycities.Country
+	Region  nearbycities.Region
+	Cities  []nearbycities.City
+}
+
+// CityPage shows a city and the cities around it. Canonical is the URL that
+// search engines should index. FromCity, NearbyCities and Message are read
+// by the results template.
+type CityPage struct {
+	PageData
+	City           nearbycities.City
+	Canonical      string
+	NearestAirport *nearbycities.Airport
+}
+
+// UnitURL returns the URL of the page with the distances in the unit.
+func (p CityPage) UnitURL(unit string) template.URL {
+	return template.URL(cityURL(p.City.ID) + "?unit=" + url.QueryEscape(unit))
+}
+
+// MoreURL returns the URL of the rows of the page after these ones.
+func (p CityPage) MoreURL() template.URL {
+	v := url.Values{"offset": {strconv.Itoa(p.Offset + resultsPerPage)}}
+	if p.Unit == unitMi {
+		v.Set("unit", string(p.Unit))
+	}
+	return template.URL(cityURL(p.City.ID) + "?" + v.Encode())
+}
+
+type regionResponse struct {
+	ID     int64  `json:"id"`
+	Name   string `json:"name"`
+	Cities int    `json:"cities"`
+}
+
+// countryRegionsHandler serves /country/{iso2}/regions.
+func countryRegionsHandler(store nearbycities.Storage, tmpl *page) httperror.Handler {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		iso2, ok := pathParam(r.URL.Path, "/country/", "/regions")
+		if !ok {
+			return httperror.New(http.StatusNotFound, "page not found")
+		}
+
+		country, ok := nearbycities.LookupCountry(iso2)
+		if !ok {
+			return httperror.New(http.StatusNotFound, "no such country")
+		}
+
+		regions, err := store.Regions(r.Context(), country.Iso2)
+		if err != nil {
+			return err
+		}
+
+		if responseFormat(r) == formatJSON {
+			resp := make([]regionResponse, 0, len(regions))
+			for _, region := range regions {
+				resp = append(resp, regionResponse{ID: region.ID, Name: region.Name, Cities: region.Cities})
+			}
+			return writeJSON(w, resp)
+		}
+
+		return tmpl.ExecuteTemplate(w, "base", RegionsPage{locale: requestLocale(w, r), theme: requestTheme(r), Country: country, Regions: regions})
+	}
+}
+
+// regionCitiesHandler serves /region/{id}/cities.
+func regionCitiesHandler(store nearbycities.Storage, tmpl *page) httperror.Handler {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		param, ok := pathParam(r.URL.Path, "/region/", "/cities")
+		if !ok {
+			return httperror.New(http.StatusNotFound, "page not found")
+		}
+
+		id, err := strconv.ParseInt(param, 10, 64)
+		if err != nil {
+			return httperror.New(http.StatusNotFound, "no such region")
+		}
+
+		region, cities, err := store.RegionCities(r.Context(), id)
+		if err != nil {
+			if errors.Is(err, nearbycities.ErrNotFound) {
+				return httperror.New(http.StatusNotFound, "no such region")
+			}
+			return err
+		}
+
+		if responseFormat(r) == formatJSON {
+			return writeJSON(w, apiV1.cities(cities, unitKm))
+		}
+
+		country, _ := nearbycities.LookupCountry(region.Iso2)
+		return tmpl.ExecuteTemplate(w, "base", RegionPage{locale: requestLocale(w, r), theme: requestTheme(r), Country: country, Region: region, Cities: cities})
+	}
+}
+
+// cityHandler serves /city/{id}, the page of a city by its ID, which stays
+// the same across dataset releases.
+func cityHandler(svc *nearbycities.Service, store nearbycities.Storage, tmpl *page) httperror.Handler {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		id, ok := pathParam(r.URL.Path, "/city/", "")
+		if !ok {
+			return httperror.New(http.StatusNotFound, "page not found")
+		}
+
+		if _, err := strconv.ParseInt(id, 10, 64); err != nil {
+			return httperror.New(http.StatusNotFound, "no such city")
+		}
+
+		return serveCity(w, r, svc, store, tmpl, id)
+	}
+}
+
+// slugCityHandler serves /nearby/{slug}, the page of a city by its slug,
+// e.g. /nearby/hanoi-vietnam.
+func slugCityHandler(svc *nearbycities.Service, store nearbycities.Storage, tmpl *page) httperror.Handler {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		slug, ok := pathParam(r.URL.Path, "/nearby/", "")
+		if !ok {
+			return httperror.New(http.StatusNotFound, "page not found")
+		}
+
+		id, ok := citySlugs.id(slug)
+		if !ok {
+			return httperror.New(http.StatusNotFound, "no such city")
+		}
+
+		return serveCity(w, r, svc, store, tmpl, id)
+	}
+}
+
+// serveCity writes the page of the city with the ID.
+func serveCity(w http.ResponseWriter, r *http.Request, svc *nearbycities.Service, store nearbycities.Storage, tmpl *page, id string) error {
+	unit, err := preferredUnit(w, r)
+	if err != nil {
+		return err
+	}
+
+	offset, err := parseCount(r, "offset", 0)
+	if err != nil {
+		return err
+	}
+
+	city, err := store.CityByID(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, nearbycities.ErrNotFound) {
+			return httperror.New(http.StatusNotFound, "no such city")
+		}
+		return err
+	}
+
+	nearby, err := svc.NearbyLatLng(r.Context(), city.Lat, city.Lng, defaultRadius)
+	if err != nil {
+		return err
+	}
+	nearby = slices.DeleteFunc(nearby, func(c nearbycities.City) bool {
+		return c.ID == city.ID
+	})
+
+	var airport *nearbycities.Airport
+	if a, err := svc.NearestAirport(r.Context(), city.Lat, city.Lng); err == nil {
+		airport = &a
+	} else if !errors.Is(err, nearbycities.ErrNotFound) {
+		return err
+	}
+
+	if responseFormat(r) == formatJSON {
+		return writeJSON(w, newCityDetailResponse(city, airport, nearby, unit))
+	}
+
+	data := PageData{
+		locale:       requestLocale(w, r),
+		theme:        requestTheme(r),
+		FromCity:     city.City + ", " + city.Country,
+		CityID:       city.ID,
+		NearbyCities: nearby,
+		Offset:       offset,
+		Unit:         unit,
+	}
+	data.Message = data.T("No other city within %s.", data.Distance(defaultRadius))
+
+	p := CityPage{
+		PageData:       data,
+		City:           city,
+		Canonical:      baseURL(r) + cityURL(city.ID),
+		NearestAirport: airport,
+	}
+	if r.Header.Get("HX-Request") == "true" && offset > 0 {
+		return tmpl.ExecuteTemplate(w, "rows", p)
+	}
+	return tmpl.ExecuteTemplate(w, "base", p)
+}
+
+// pathParam returns the segment of path between prefix and suffix, e.g. VN
+// in /country/VN/regions.
+func pathParam(path, prefix, suffix string) (string, bool) {
+	rest, ok := strings.CutPrefix(path, prefix)
+	if !ok {
+		return "", false
+	}
+
+	param, ok := strings.CutSuffix(rest, suffix)
+	if !ok || param == "" || strings.Contains(param, "/") {
+		return "", false
+	}
+
+	return param, true
+}
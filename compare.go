@@ -0,0 +1,270 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/quantonganh/httperror"
+	"github.com/quantonganh/nearby-cities/nearbycities"
+	"github.com/rs/zerolog/hlog"
+)
+
+// comparison compares two cities and lists the cities around either of them.
+type comparison struct {
+	A, B nearbycities.City
+
+	// Distance is the distance in kilometers from A to B, and Bearing the
+	// initial bearing, in degrees, of the way there.
+	Distance  float64
+	Bearing   float64
+	Direction string
+
+	// PopulationRatio is how many times as populated A is as B, 0 when the
+	// population of either is unknown.
+	PopulationRatio float64
+
+	// TimeDifference is how far the time of B is ahead of the one of A,
+	// nil when the timezone of either is unknown.
+	TimeDifference *time.Duration
+
+	// Nearby are the cities within the radius of A or B, but them, the
+	// closest to either first.
+	Nearby []comparedCity
+}
+
+// comparedCity is a city around A or B, with its distance to both.
+type comparedCity struct {
+	nearbycities.City
+	DistanceA, DistanceB float64
+}
+
+func compareCities(svc *nearbycities.Service, a, b nearbycities.City, nearA, nearB []nearbycities.City) comparison {
+	bearing := nearbycities.Bearing(a.Lat, a.Lng, b.Lat, b.Lng)
+	cmp := comparison{
+		A:         a,
+		B:         b,
+		Distance:  svc.Distance(a.Lat, a.Lng, b.Lat, b.Lng),
+		Bearing:   math.Mod(math.Round(bearing), 360),
+		Direction: nearbycities.CompassPoint(bearing),
+	}
+
+	if a.Population != nil && b.Population != nil && *b.Population > 0 {
+		cmp.PopulationRatio = math.Round(float64(*a.Population)/float64(*b.Population)*100) / 100
+	}
+
+	ta, okA := cityTime(a.Timezone)
+	tb, okB := cityTime(b.Timezone)
+	if okA && okB {
+		_, offsetA := ta.Zone()
+		_, offsetB := tb.Zone()
+		diff := time.Duration(offsetB-offsetA) * time.Second
+		cmp.TimeDifference = &diff
+	}
+
+	seen := map[string]bool{a.ID: true, b.ID: true}
+	for _, cities := range [][]nearbycities.City{nearA, nearB} {
+		for _, c := range cities {
+			if c.ID == "" || seen[c.ID] {
+				continue
+			}
+			seen[c.ID] = true
+
+			cc := comparedCity{
+				City:      c,
+				DistanceA: svc.Distance(a.Lat, a.Lng, c.Lat, c.Lng),
+				DistanceB: svc.Distance(b.Lat, b.Lng, c.Lat, c.Lng),
+			}
+			// The distance and bearing of the city are the ones from the
+			// nearer of A and B.
+			from := a
+			if cc.DistanceB < cc.DistanceA {
+				from = b
+			}
+			cc.Distance = min(cc.DistanceA, cc.DistanceB)
+			cc.Bearing = math.Mod(math.Round(nearbycities.Bearing(from.Lat, from.Lng, c.Lat, c.Lng)), 360)
+			cmp.Nearby = append(cmp.Nearby, cc)
+		}
+	}
+	sort.SliceStable(cmp.Nearby, func(i, j int) bool {
+		return cmp.Nearby[i].Distance < cmp.Nearby[j].Distance
+	})
+
+	return cmp
+}
+
+// ComparePage compares two cities, or offers the namesakes of one of them
+// to pick from.
+type ComparePage struct {
+	PageData
+
+	// A and B are the names searched for, AID and BID the IDs of the
+	// cities picked.
+	A, B, AID, BID string
+
+	Comparison *comparison
+
+	// Side is a or b, the one whose namesakes are offered.
+	Side string
+}
+
+// query returns the parameters of the comparison.
+func (p ComparePage) query() url.Values {
+	v := url.Values{}
+	for _, param := range []struct{ key, value string }{
+		{"a", p.A}, {"a_id", p.AID}, {"b", p.B}, {"b_id", p.BID},
+	} {
+		if param.value != "" {
+			v.Set(param.key, param.value)
+		}
+	}
+	if p.Radius > 0 {
+		v.Set("radius", strconv.FormatFloat(p.Unit.fromKm(p.Radius), 'f', -1, 64))
+	}
+	if p.Unit == unitMi {
+		v.Set("unit", string(p.Unit))
+	}
+
+	return v
+}
+
+// PickURL returns the URL of the comparison with the namesake of the ID
+// picked for the side.
+func (p ComparePage) PickURL(id string) template.URL {
+	v := p.query()
+	v.Del(p.Side)
+	v.Set(p.Side+"_id", id)
+	return template.URL("/compare?" + v.Encode())
+}
+
+// UnitURL returns the URL of the comparison with the distances in the unit.
+func (p ComparePage) UnitURL(unit string) template.URL {
+	u := distanceUnit(unit)
+	v := p.query()
+	if p.Radius > 0 {
+		v.Set("radius", strconv.FormatFloat(u.fromKm(p.Radius), 'f', -1, 64))
+	}
+	v.Set("unit", unit)
+	return template.URL("/compare?" + v.Encode())
+}
+
+// TimeDifference writes how far the time of B is ahead of the one of A,
+// e.g. "+1 h 30 min".
+func (p ComparePage) TimeDifference() string {
+	d := *p.Comparison.TimeDifference
+	sign := "+"
+	switch {
+	case d == 0:
+		sign = ""
+	case d < 0:
+		sign, d = "−", -d
+	}
+
+	s := sign + strconv.Itoa(int(d.Hours())) + " h"
+	if m := int(d.Minutes()) % 60; m != 0 {
+		s += " " + strconv.Itoa(m) + " min"
+	}
+	return s
+}
+
+// compareHandler serves /compare?a=Hanoi&b=Bangkok, the distance and bearing
+// from a to b, their populations and the difference between their times,
+// and the cities around either of them, as HTML or JSON. a_id and b_id pick
+// a city by its ID instead, e.g. among namesakes.
+func compareHandler(svc *nearbycities.Service, store nearbycities.Storage, tmpl *page) httperror.Handler {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		html := responseFormat(r) != formatJSON
+
+		data := ComparePage{A: r.FormValue("a"), B: r.FormValue("b"), AID: r.FormValue("a_id"), BID: r.FormValue("b_id")}
+		unit, err := preferredUnit(w, r)
+		if err != nil {
+			return renderCompareError(w, r, tmpl, data, http.StatusBadRequest, "unit must be km or mi")
+		}
+		data.Unit = unit
+
+		radius, err := pageRadius(r)
+		if err != nil {
+			return renderCompareError(w, r, tmpl, data, http.StatusBadRequest, err.Error())
+		}
+		if radius != defaultRadius {
+			data.Radius = radius
+		}
+
+		if (data.A == "" && data.AID == "") || (data.B == "" && data.BID == "") {
+			if html {
+				data.locale = requestLocale(w, r)
+				data.theme = requestTheme(r)
+				return tmpl.ExecuteTemplate(w, "base", data)
+			}
+			return httperror.New(http.StatusBadRequest, "a or a_id and b or b_id are required")
+		}
+
+		sides := []struct {
+			side, query, id string
+			city            nearbycities.City
+			nearby          []nearbycities.City
+		}{
+			{side: "a", query: data.A, id: data.AID},
+			{side: "b", query: data.B, id: data.BID},
+		}
+		for i := range sides {
+			s := &sides[i]
+			s.city, s.nearby, err = searchCity(r.Context(), svc, s.query, s.id, radius)
+			if err == nil && s.city.ID != "" && s.city.Timezone == "" {
+				// The cities matching a name come without their timezone.
+				s.city, err = store.CityByID(r.Context(), s.city.ID)
+			}
+			if err == nil {
+				continue
+			}
+
+			var ambiguous *nearbycities.AmbiguousError
+			switch {
+			case errors.As(err, &ambiguous):
+				if !html {
+					resp := newAmbiguousResponse(ambiguous)
+					resp.Message = fmt.Sprintf("several cities are named %s, pick one by its %s_id", ambiguous.Query, s.side)
+					return writeJSONStatus(w, http.StatusMultipleChoices, resp)
+				}
+				data.locale = requestLocale(w, r)
+				data.theme = requestTheme(r)
+				data.Side, data.FromCity, data.Namesakes = s.side, ambiguous.Query, ambiguous.Cities
+				return tmpl.ExecuteTemplate(w, "base", data)
+			case errors.Is(err, nearbycities.ErrNotFound):
+				return renderCompareError(w, r, tmpl, data, http.StatusNotFound, "No matching city found.")
+			default:
+				hlog.FromRequest(r).Err(err).Msg("")
+				return renderCompareError(w, r, tmpl, data, http.StatusInternalServerError, "Oops! Something went wrong. Please try again later.")
+			}
+		}
+
+		cmp := compareCities(svc, sides[0].city, sides[1].city, sides[0].nearby, sides[1].nearby)
+		if !html {
+			return writeJSON(w, newCompareResponse(cmp, unit))
+		}
+
+		data.locale = requestLocale(w, r)
+		data.theme = requestTheme(r)
+		data.Comparison = &cmp
+		return tmpl.ExecuteTemplate(w, "base", data)
+	}
+}
+
+// renderCompareError shows the message on the comparison page, or returns it
+// with the status code in JSON.
+func renderCompareError(w http.ResponseWriter, r *http.Request, tmpl *page, data ComparePage, status int, message string) error {
+	if responseFormat(r) == formatJSON {
+		return httperror.New(status, message)
+	}
+
+	data.locale = requestLocale(w, r)
+	data.theme = requestTheme(r)
+	data.Message = message
+	return tmpl.ExecuteTemplate(w, "base", data)
+}
@@ -0,0 +1,617 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// config holds the settings of the server. They are read from the YAML file
+// given by -config or NEARBY_CONFIG, then overridden by the environment
+// variables and last by the command-line flags.
+type config struct {
+	// Addr lists the addresses the server listens on, host:port or :port.
+	Addr addrList `yaml:"addr"`
+
+	// Dev serves the templates and the static assets from the working
+	// directory rather than from the binary, parsing a page again once its
+	// templates change.
+	Dev bool `yaml:"dev"`
+
+	// DataDir is the directory of the SQLite database, unless the database
+	// path says otherwise, and of the downloads being imported.
+	DataDir string `yaml:"data_dir"`
+
+	Socket      socketConfig      `yaml:"socket"`
+	Database    databaseConfig    `yaml:"database"`
+	Litestream  litestreamConfig  `yaml:"litestream"`
+	IP2Location ip2LocationConfig `yaml:"ip2location"`
+	Elevation   elevationConfig   `yaml:"elevation"`
+	Search      searchConfig      `yaml:"search"`
+	Geocoders   geocodersConfig   `yaml:"geocoders"`
+	IPLocator   ipLocatorConfig   `yaml:"ip_locator"`
+	Log         logConfig         `yaml:"log"`
+	HTTP        httpConfig        `yaml:"http"`
+	CORS        corsConfig        `yaml:"cors"`
+	RateLimit   rateLimitConfig   `yaml:"rate_limit"`
+	Session     sessionConfig     `yaml:"session"`
+	Jobs        jobsConfig        `yaml:"jobs"`
+	Admin       adminConfig       `yaml:"admin"`
+	Pprof       pprofConfig       `yaml:"pprof"`
+}
+
+// addrList is a list of addresses, which a single one can be given for in
+// the configuration file.
+type addrList []string
+
+func (l *addrList) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*l = splitList(value.Value)
+		return nil
+	}
+	return value.Decode((*[]string)(l))
+}
+
+type socketConfig struct {
+	// Path is the unix socket the server also listens on, none if empty.
+	Path string `yaml:"path"`
+
+	// Mode holds the octal permissions of the socket, e.g. 0660 for the
+	// users of its group to connect.
+	Mode string `yaml:"mode"`
+}
+
+type databaseConfig struct {
+	// URL is a postgres:// URL, a mysql:// DSN or :memory:, the SQLite
+	// database at Path being used when it is empty.
+	URL string `yaml:"url"`
+	// ReadURL is the read replica of the server database at URL, in the same
+	// format, which answers the lookups while the imports go to URL.
+	ReadURL string `yaml:"read_url"`
+	// Path is nearby_cities.db in the data directory when it is empty.
+	Path string `yaml:"path"`
+
+	// PrebuiltURL is an http(s):// or s3:// URL of a SQLite database
+	// downloaded to Path on start when there is no file there yet, which
+	// spares the import. Its SHA-256 is PrebuiltSHA256, or the checksum
+	// published next to it as PrebuiltURL.sha256 when it is empty.
+	PrebuiltURL    string `yaml:"prebuilt_url"`
+	PrebuiltSHA256 string `yaml:"prebuilt_sha256"`
+}
+
+type litestreamConfig struct {
+	// ReplicaURL is the Litestream replica the SQLite database is
+	// continuously replicated to, e.g. s3://bucket/nearby-cities, by a
+	// litestream replicate process the server supervises. There is none
+	// when it is empty.
+	ReplicaURL string `yaml:"replica_url"`
+	// Binary is the litestream executable, looked up in the PATH unless it
+	// is a path.
+	Binary string `yaml:"binary"`
+	// Restore restores the database from the replica on start when there
+	// is no file at the database path yet.
+	Restore bool `yaml:"restore"`
+}
+
+type ip2LocationConfig struct {
+	Token           string        `yaml:"token"`
+	DB              string        `yaml:"db"`
+	RefreshInterval time.Duration `yaml:"refresh_interval"`
+}
+
+type elevationConfig struct {
+	// SRTMDir is the directory of the SRTM tiles the elevation of the
+	// cities is read from, which is not imported when it is empty.
+	SRTMDir string `yaml:"srtm_dir"`
+}
+
+type searchConfig struct {
+	// Radius is the distance, in kilometers, the nearby cities are searched
+	// within when the request does not give one.
+	Radius          float64       `yaml:"radius"`
+	Ranking         string        `yaml:"ranking"`
+	DistanceMethod  string        `yaml:"distance_method"`
+	SpatialIndex    string        `yaml:"spatial_index"`
+	H3Resolution    int           `yaml:"h3_resolution"`
+	ResultCacheSize int           `yaml:"result_cache_size"`
+	ResultCacheTTL  time.Duration `yaml:"result_cache_ttl"`
+}
+
+type geocodersConfig struct {
+	// Fallbacks lists the geocoders asked in order for the places the
+	// dataset does not know: pelias, nominatim or google.
+	Fallbacks []string `yaml:"fallbacks"`
+	Pelias    struct {
+		URL    string `yaml:"url"`
+		APIKey string `yaml:"api_key"`
+	} `yaml:"pelias"`
+	Nominatim struct {
+		URL       string `yaml:"url"`
+		UserAgent string `yaml:"user_agent"`
+	} `yaml:"nominatim"`
+	Google struct {
+		APIKey string `yaml:"api_key"`
+	} `yaml:"google"`
+}
+
+type ipLocatorConfig struct {
+	// Kind is maxmind to locate the addresses with the MaxMind database at
+	// MaxMindDBPath rather than with the IP2Location ranges.
+	Kind          string `yaml:"kind"`
+	MaxMindDBPath string `yaml:"maxmind_db_path"`
+
+	// Fallback is remote to ask the service at RemoteURL for the addresses
+	// the main locator cannot locate.
+	Fallback  string `yaml:"fallback"`
+	RemoteURL string `yaml:"remote_url"`
+}
+
+// jobsConfig schedules the background jobs of the server.
+type jobsConfig struct {
+	// RefreshIPRanges downloads the IP2Location database again, every
+	// refresh interval of the IP2Location settings when it has no
+	// schedule.
+	RefreshIPRanges jobConfig `yaml:"refresh_ip_ranges"`
+	// WarmCache fills the result cache with the cities around the most
+	// populated ones.
+	WarmCache jobConfig `yaml:"warm_cache"`
+	// Vacuum reclaims the space of the deleted rows and refreshes the
+	// statistics of the database.
+	Vacuum jobConfig `yaml:"vacuum"`
+	// RefreshCities applies the world cities release at its source, as the
+	// update command does, and rebuilds the in-memory indexes.
+	RefreshCities refreshCitiesConfig `yaml:"refresh_cities"`
+}
+
+type refreshCitiesConfig struct {
+	jobConfig `yaml:",inline"`
+	// Source is the path or the http(s) URL of the worldcities.csv
+	// release.
+	Source string `yaml:"source"`
+}
+
+type jobConfig struct {
+	// Schedule is a crontab schedule, e.g. "0 3 * * *", or @hourly,
+	// @daily, @weekly, @monthly or "@every 6h". The job does not run when
+	// it is empty.
+	Schedule string `yaml:"schedule"`
+	// Jitter delays every run by a random duration up to it, so that the
+	// instances sharing a schedule do not run the job at once.
+	Jitter time.Duration `yaml:"jitter"`
+}
+
+type httpConfig struct {
+	// RequestTimeout is how long a request may take before its queries are
+	// cancelled, without limit when it is 0.
+	RequestTimeout time.Duration `yaml:"request_timeout"`
+
+	// CacheMaxAge and CacheStaticMaxAge are how long the browsers and the
+	// CDNs may reuse the API responses and the static assets.
+	CacheMaxAge       time.Duration `yaml:"cache_max_age"`
+	CacheStaticMaxAge time.Duration `yaml:"cache_static_max_age"`
+
+	// TrustedProxies lists the networks, e.g. 10.0.0.0/8, or the addresses
+	// of the reverse proxies telling the address of the clients in
+	// X-Forwarded-For or X-Real-IP.
+	TrustedProxies []string `yaml:"trusted_proxies"`
+}
+
+type corsConfig struct {
+	AllowedOrigins []string `yaml:"allowed_origins"`
+	AllowedMethods []string `yaml:"allowed_methods"`
+	AllowedHeaders []string `yaml:"allowed_headers"`
+}
+
+type rateLimitConfig struct {
+	// RPS is the number of requests a client may make per second, in
+	// bursts of up to Burst, without limit when it is 0.
+	RPS   float64 `yaml:"rps"`
+	Burst int     `yaml:"burst"`
+
+	// The clients presenting one of APIKeys are limited to APIKeyRPS and
+	// APIKeyBurst, the limits of the other clients when they are not set,
+	// rather than sharing the limit of their address. An APIKeyRPS of 0
+	// leaves them unlimited.
+	APIKeys     []string `yaml:"api_keys"`
+	APIKeyRPS   *float64 `yaml:"api_key_rps"`
+	APIKeyBurst *int     `yaml:"api_key_burst"`
+}
+
+type sessionConfig struct {
+	// Secret signs the cookie of the recent searches, a random key being
+	// used when it is empty.
+	Secret string `yaml:"secret"`
+}
+
+type pprofConfig struct {
+	// Addr is the address the runtime profiles are served on, apart from
+	// the public listener. They are not served when it is empty.
+	Addr string `yaml:"addr"`
+}
+
+type adminConfig struct {
+	// Token is the bearer token of the admin endpoints and of the metrics,
+	// which answer 404 when it is empty.
+	Token string `yaml:"token"`
+}
+
+type logConfig struct {
+	// Level is the least severe level logged: debug, info, warn or error.
+	Level string `yaml:"level"`
+
+	// Format is json, or pretty for colored lines meant for a terminal.
+	Format string `yaml:"format"`
+
+	// File is the file the logs are appended to instead of the standard
+	// output. It is rotated once it reaches MaxSize megabytes, the last
+	// MaxBackups ones being kept.
+	File       string `yaml:"file"`
+	MaxSize    int    `yaml:"max_size"`
+	MaxBackups int    `yaml:"max_backups"`
+
+	// SkipPaths lists the path prefixes of the requests kept out of the
+	// access log.
+	SkipPaths []string `yaml:"skip_paths"`
+}
+
+func defaultConfig() config {
+	cfg := config{Addr: addrList{":8080"}}
+	cfg.Socket.Mode = "0660"
+	cfg.Litestream.Binary = "litestream"
+	cfg.Search.Radius = 100
+	cfg.Search.H3Resolution = 7
+	cfg.Search.ResultCacheTTL = 10 * time.Minute
+	cfg.Log.Level = "info"
+	cfg.Log.Format = "json"
+	cfg.Log.MaxSize = 100
+	cfg.Log.MaxBackups = 5
+	cfg.Log.SkipPaths = []string{"/static"}
+	cfg.HTTP.RequestTimeout = 10 * time.Second
+	cfg.HTTP.CacheMaxAge = 5 * time.Minute
+	cfg.HTTP.CacheStaticMaxAge = 24 * time.Hour
+	cfg.CORS.AllowedMethods = []string{http.MethodGet, http.MethodHead, http.MethodOptions}
+	cfg.CORS.AllowedHeaders = []string{"Accept", "Content-Type"}
+	cfg.RateLimit.Burst = 20
+	return cfg
+}
+
+// setting is a setting that can be overridden by an environment variable
+// and a flag.
+type setting struct {
+	flag, env, usage string
+	value            flag.Value
+}
+
+// settings lists the settings of cfg with their flag and environment
+// variable. The variables predating the configuration file keep their name.
+func (cfg *config) settings() []setting {
+	return []setting{
+		{"addr", "NEARBY_ADDR", "comma-separated addresses to listen on", listValue{(*[]string)(&cfg.Addr)}},
+		{"dev", "NEARBY_DEV", "serve the templates and static assets from the working directory, reloading them", boolValue{&cfg.Dev}},
+		{"socket-path", "NEARBY_SOCKET", "unix socket to listen on as well", stringValue{&cfg.Socket.Path}},
+		{"socket-mode", "NEARBY_SOCKET_MODE", "octal permissions of the unix socket", stringValue{&cfg.Socket.Mode}},
+		{"data-dir", "NEARBY_DATA_DIR", "directory of the SQLite database and the downloads, the platform data directory by default", stringValue{&cfg.DataDir}},
+		{"database-url", "DATABASE_URL", "postgres:// URL, mysql:// DSN or :memory:, SQLite at database-path otherwise", stringValue{&cfg.Database.URL}},
+		{"database-read-url", "DATABASE_READ_URL", "postgres:// URL or mysql:// DSN of a read replica answering the lookups", stringValue{&cfg.Database.ReadURL}},
+		{"database-path", "NEARBY_DATABASE_PATH", "path of the SQLite database, nearby_cities.db in the data directory by default", stringValue{&cfg.Database.Path}},
+		{"database-prebuilt-url", "NEARBY_PREBUILT_URL", "http(s):// or s3:// URL of a prebuilt SQLite database to download when there is none", stringValue{&cfg.Database.PrebuiltURL}},
+		{"database-prebuilt-sha256", "NEARBY_PREBUILT_SHA256", "SHA-256 of the prebuilt database, read from its URL with .sha256 appended if empty", stringValue{&cfg.Database.PrebuiltSHA256}},
+		{"litestream-replica-url", "LITESTREAM_REPLICA_URL", "Litestream replica to replicate the SQLite database to, e.g. s3://bucket/path", stringValue{&cfg.Litestream.ReplicaURL}},
+		{"litestream-binary", "LITESTREAM_BINARY", "litestream executable to run", stringValue{&cfg.Litestream.Binary}},
+		{"litestream-restore", "LITESTREAM_RESTORE", "restore the SQLite database from the replica when there is none", boolValue{&cfg.Litestream.Restore}},
+		{"ip2location-token", "IP2LOCATION_TOKEN", "token to download the IP2Location database", stringValue{&cfg.IP2Location.Token}},
+		{"ip2location-db", "IP2LOCATION_DB", "IP2Location database to download: DB5, DB9 or DB11", stringValue{&cfg.IP2Location.DB}},
+		{"ip2location-refresh-interval", "IP2LOCATION_REFRESH_INTERVAL", "how often to download the IP2Location database again, never if 0", durationValue{&cfg.IP2Location.RefreshInterval}},
+		{"elevation-srtm-dir", "ELEVATION_SRTM_DIR", "directory of the SRTM tiles to import the elevations from", stringValue{&cfg.Elevation.SRTMDir}},
+		{"search-radius", "NEARBY_RADIUS", "radius of the nearby searches, in kilometers, when the request gives none", floatValue{&cfg.Search.Radius}},
+		{"search-ranking", "SEARCH_RANKING", "ranking of the name matches: population or relevance", stringValue{&cfg.Search.Ranking}},
+		{"search-distance-method", "DISTANCE_METHOD", "distance computation: haversine or geodesic", stringValue{&cfg.Search.DistanceMethod}},
+		{"search-spatial-index", "SPATIAL_INDEX", "in-memory spatial index: kdtree, s2 or h3", stringValue{&cfg.Search.SpatialIndex}},
+		{"search-h3-resolution", "H3_RESOLUTION", "resolution of the h3 spatial index", intValue{&cfg.Search.H3Resolution}},
+		{"search-result-cache-size", "RESULT_CACHE_SIZE", "number of results to cache, none if 0", intValue{&cfg.Search.ResultCacheSize}},
+		{"search-result-cache-ttl", "RESULT_CACHE_TTL", "how long to cache the results", durationValue{&cfg.Search.ResultCacheTTL}},
+		{"geocoders-fallbacks", "GEOCODER_FALLBACKS", "comma-separated geocoders to ask for unknown places: pelias, nominatim, google", listValue{&cfg.Geocoders.Fallbacks}},
+		{"geocoders-pelias-url", "PELIAS_URL", "base URL of the Pelias geocoder", stringValue{&cfg.Geocoders.Pelias.URL}},
+		{"geocoders-pelias-api-key", "PELIAS_API_KEY", "API key of the Pelias geocoder", stringValue{&cfg.Geocoders.Pelias.APIKey}},
+		{"geocoders-nominatim-url", "NOMINATIM_URL", "base URL of the Nominatim geocoder", stringValue{&cfg.Geocoders.Nominatim.URL}},
+		{"geocoders-nominatim-user-agent", "NOMINATIM_USER_AGENT", "User-Agent sent to the Nominatim geocoder", stringValue{&cfg.Geocoders.Nominatim.UserAgent}},
+		{"geocoders-google-api-key", "GOOGLE_GEOCODING_API_KEY", "API key of the Google geocoder", stringValue{&cfg.Geocoders.Google.APIKey}},
+		{"ip-locator", "IP_LOCATOR", "maxmind to locate the addresses with a MaxMind database", stringValue{&cfg.IPLocator.Kind}},
+		{"ip-locator-maxmind-db-path", "MAXMIND_DB_PATH", "path of the MaxMind database", stringValue{&cfg.IPLocator.MaxMindDBPath}},
+		{"ip-locator-fallback", "IP_LOCATOR_FALLBACK", "remote to ask a remote service for the addresses not located", stringValue{&cfg.IPLocator.Fallback}},
+		{"ip-locator-remote-url", "IP_LOCATOR_REMOTE_URL", "URL of the remote IP locator", stringValue{&cfg.IPLocator.RemoteURL}},
+		{"jobs-refresh-ip-ranges-schedule", "JOB_REFRESH_IP_RANGES_SCHEDULE", "when to download the IP2Location database again, e.g. @monthly", stringValue{&cfg.Jobs.RefreshIPRanges.Schedule}},
+		{"jobs-refresh-ip-ranges-jitter", "JOB_REFRESH_IP_RANGES_JITTER", "random delay of the IP2Location refreshes, up to the duration", durationValue{&cfg.Jobs.RefreshIPRanges.Jitter}},
+		{"jobs-warm-cache-schedule", "JOB_WARM_CACHE_SCHEDULE", "when to fill the result cache with the most populated cities, e.g. @hourly", stringValue{&cfg.Jobs.WarmCache.Schedule}},
+		{"jobs-warm-cache-jitter", "JOB_WARM_CACHE_JITTER", "random delay of the cache warmups, up to the duration", durationValue{&cfg.Jobs.WarmCache.Jitter}},
+		{"jobs-vacuum-schedule", "JOB_VACUUM_SCHEDULE", "when to vacuum the database, e.g. 0 4 * * 0", stringValue{&cfg.Jobs.Vacuum.Schedule}},
+		{"jobs-vacuum-jitter", "JOB_VACUUM_JITTER", "random delay of the vacuums, up to the duration", durationValue{&cfg.Jobs.Vacuum.Jitter}},
+		{"jobs-refresh-cities-schedule", "JOB_REFRESH_CITIES_SCHEDULE", "when to apply the world cities release of the source again, e.g. @weekly", stringValue{&cfg.Jobs.RefreshCities.Schedule}},
+		{"jobs-refresh-cities-jitter", "JOB_REFRESH_CITIES_JITTER", "random delay of the cities refreshes, up to the duration", durationValue{&cfg.Jobs.RefreshCities.Jitter}},
+		{"jobs-refresh-cities-source", "JOB_REFRESH_CITIES_SOURCE", "path or http(s) URL of the worldcities.csv release the cities are refreshed from", stringValue{&cfg.Jobs.RefreshCities.Source}},
+		{"http-request-timeout", "REQUEST_TIMEOUT", "how long a request may take, without limit if 0", durationValue{&cfg.HTTP.RequestTimeout}},
+		{"http-cache-max-age", "HTTP_CACHE_MAX_AGE", "how long the API responses may be cached", durationValue{&cfg.HTTP.CacheMaxAge}},
+		{"http-cache-static-max-age", "HTTP_CACHE_STATIC_MAX_AGE", "how long the static assets may be cached", durationValue{&cfg.HTTP.CacheStaticMaxAge}},
+		{"http-trusted-proxies", "TRUSTED_PROXIES", "comma-separated networks of the reverse proxies whose X-Forwarded-For is trusted", listValue{&cfg.HTTP.TrustedProxies}},
+		{"cors-allowed-origins", "CORS_ALLOWED_ORIGINS", "comma-separated origins allowed to call the API, or *", listValue{&cfg.CORS.AllowedOrigins}},
+		{"cors-allowed-methods", "CORS_ALLOWED_METHODS", "comma-separated methods allowed to cross-origin requests", listValue{&cfg.CORS.AllowedMethods}},
+		{"cors-allowed-headers", "CORS_ALLOWED_HEADERS", "comma-separated headers allowed to cross-origin requests", listValue{&cfg.CORS.AllowedHeaders}},
+		{"rate-limit-rps", "RATE_LIMIT_RPS", "requests per second allowed to a client, without limit if 0", floatValue{&cfg.RateLimit.RPS}},
+		{"rate-limit-burst", "RATE_LIMIT_BURST", "requests a client may make at once", intValue{&cfg.RateLimit.Burst}},
+		{"rate-limit-api-keys", "API_KEYS", "comma-separated API keys limited on their own", listValue{&cfg.RateLimit.APIKeys}},
+		{"rate-limit-api-key-rps", "RATE_LIMIT_API_KEY_RPS", "requests per second allowed to an API key, without limit if 0, rate-limit-rps if unset", optionalFloatValue{&cfg.RateLimit.APIKeyRPS}},
+		{"rate-limit-api-key-burst", "RATE_LIMIT_API_KEY_BURST", "requests an API key may make at once, rate-limit-burst if unset", optionalIntValue{&cfg.RateLimit.APIKeyBurst}},
+		{"session-secret", "SESSION_SECRET", "secret signing the cookie of the recent searches, random if empty", stringValue{&cfg.Session.Secret}},
+		{"admin-token", "ADMIN_TOKEN", "bearer token of the admin endpoints and the metrics, disabled if empty", stringValue{&cfg.Admin.Token}},
+		{"pprof-addr", "PPROF_ADDR", "address to serve the runtime profiles on, none if empty", stringValue{&cfg.Pprof.Addr}},
+		{"log-level", "LOG_LEVEL", "least severe level logged: debug, info, warn or error", stringValue{&cfg.Log.Level}},
+		{"log-format", "LOG_FORMAT", "log format: json or pretty", stringValue{&cfg.Log.Format}},
+		{"log-file", "LOG_FILE", "file to write the logs to instead of the standard output", stringValue{&cfg.Log.File}},
+		{"log-max-size", "LOG_MAX_SIZE", "size, in megabytes, the log file is rotated at, never if 0", intValue{&cfg.Log.MaxSize}},
+		{"log-max-backups", "LOG_MAX_BACKUPS", "number of rotated log files to keep", intValue{&cfg.Log.MaxBackups}},
+		{"log-skip-paths", "LOG_SKIP_PATHS", "comma-separated path prefixes of the requests kept out of the access log", listValue{&cfg.Log.SkipPaths}},
+	}
+}
+
+// flagSet returns the flags setting cfg, along with -config.
+func (cfg *config) flagSet(configPath *string) *flag.FlagSet {
+	fs := flag.NewFlagSet("nearby-cities", flag.ContinueOnError)
+	fs.StringVar(configPath, "config", *configPath, "YAML configuration file, also NEARBY_CONFIG")
+	for _, s := range cfg.settings() {
+		fs.Var(s.value, s.flag, s.usage+" ("+s.env+")")
+	}
+	return fs
+}
+
+// loadConfig reads the configuration file, then applies the environment
+// variables and the flags among args on top of it.
+func loadConfig(args []string) (config, error) {
+	// The file is read before the other flags are applied, so -config is
+	// looked up first on a throwaway configuration.
+	path := os.Getenv("NEARBY_CONFIG")
+	scratch := defaultConfig()
+	fs := scratch.flagSet(&path)
+	fs.SetOutput(io.Discard)
+	fs.Parse(args)
+
+	cfg := defaultConfig()
+	if path != "" {
+		if err := cfg.readFile(path); err != nil {
+			return config{}, err
+		}
+	}
+
+	fs = cfg.flagSet(&path)
+	for _, s := range cfg.settings() {
+		if v := os.Getenv(s.env); v != "" {
+			if err := fs.Set(s.flag, v); err != nil {
+				return config{}, fmt.Errorf("invalid %s: %w", s.env, err)
+			}
+		}
+	}
+	if err := fs.Parse(args); err != nil {
+		return config{}, err
+	}
+	if fs.NArg() > 0 {
+		return config{}, fmt.Errorf("unexpected argument: %s", fs.Arg(0))
+	}
+	if len(cfg.Addr) == 0 && cfg.Socket.Path == "" {
+		return config{}, errors.New("no address to listen on")
+	}
+	if cfg.DataDir == "" {
+		cfg.DataDir = defaultDataDir()
+	}
+	if cfg.Database.Path == "" {
+		cfg.Database.Path = filepath.Join(cfg.DataDir, "nearby_cities.db")
+	}
+
+	return cfg, nil
+}
+
+// legacyDataDir is where the database was kept before the data directory
+// could be configured, relative to the working directory.
+const legacyDataDir = "./db"
+
+// defaultDataDir returns the data directory of the platform: the
+// nearby-cities directory of $XDG_DATA_HOME, ~/.local/share by default, on
+// Unix, of ~/Library/Application Support on macOS and of %LocalAppData% on
+// Windows. A database left in ./db by an earlier release is kept there, as
+// is the data when there is no home directory.
+func defaultDataDir() string {
+	if _, err := os.Stat(filepath.Join(legacyDataDir, "nearby_cities.db")); err == nil {
+		return legacyDataDir
+	}
+
+	var base string
+	switch runtime.GOOS {
+	case "windows":
+		base = os.Getenv("LocalAppData")
+	case "darwin", "ios":
+		if home, err := os.UserHomeDir(); err == nil {
+			base = filepath.Join(home, "Library", "Application Support")
+		}
+	default:
+		base = os.Getenv("XDG_DATA_HOME")
+		if !filepath.IsAbs(base) {
+			// The XDG specification has relative paths ignored.
+			base = ""
+			if home, err := os.UserHomeDir(); err == nil {
+				base = filepath.Join(home, ".local", "share")
+			}
+		}
+	}
+	if base == "" {
+		return legacyDataDir
+	}
+
+	return filepath.Join(base, "nearby-cities")
+}
+
+// readFile decodes the YAML file at path into cfg, rejecting the keys it does
+// not know so that a misspelt setting is not silently ignored.
+func (cfg *config) readFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("error reading configuration: %w", err)
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("invalid configuration %s: %w", path, err)
+	}
+
+	return nil
+}
+
+type stringValue struct{ p *string }
+
+func (v stringValue) String() string {
+	if v.p == nil {
+		return ""
+	}
+	return *v.p
+}
+
+func (v stringValue) Set(s string) error {
+	*v.p = s
+	return nil
+}
+
+type boolValue struct{ p *bool }
+
+func (v boolValue) String() string {
+	if v.p == nil {
+		return ""
+	}
+	return strconv.FormatBool(*v.p)
+}
+
+func (v boolValue) Set(s string) error {
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		return err
+	}
+	*v.p = b
+	return nil
+}
+
+func (v boolValue) IsBoolFlag() bool { return true }
+
+type floatValue struct{ p *float64 }
+
+func (v floatValue) String() string {
+	if v.p == nil {
+		return ""
+	}
+	return fmt.Sprint(*v.p)
+}
+
+func (v floatValue) Set(s string) error {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return err
+	}
+	*v.p = f
+	return nil
+}
+
+type intValue struct{ p *int }
+
+func (v intValue) String() string {
+	if v.p == nil {
+		return ""
+	}
+	return fmt.Sprint(*v.p)
+}
+
+func (v intValue) Set(s string) error {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return err
+	}
+	*v.p = n
+	return nil
+}
+
+type durationValue struct{ p *time.Duration }
+
+func (v durationValue) String() string {
+	if v.p == nil {
+		return ""
+	}
+	return v.p.String()
+}
+
+func (v durationValue) Set(s string) error {
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*v.p = d
+	return nil
+}
+
+// listValue is a comma-separated list.
+type listValue struct{ p *[]string }
+
+func (v listValue) String() string {
+	if v.p == nil {
+		return ""
+	}
+	return strings.Join(*v.p, ",")
+}
+
+func (v listValue) Set(s string) error {
+	*v.p = splitList(s)
+	return nil
+}
+
+// optionalFloatValue is a number that is nil until it is set.
+type optionalFloatValue struct{ p **float64 }
+
+func (v optionalFloatValue) String() string {
+	if v.p == nil || *v.p == nil {
+		return ""
+	}
+	return fmt.Sprint(**v.p)
+}
+
+func (v optionalFloatValue) Set(s string) error {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return err
+	}
+	*v.p = &f
+	return nil
+}
+
+// optionalIntValue is an integer that is nil until it is set.
+type optionalIntValue struct{ p **int }
+
+func (v optionalIntValue) String() string {
+	if v.p == nil || *v.p == nil {
+		return ""
+	}
+	return fmt.Sprint(**v.p)
+}
+
+func (v optionalIntValue) Set(s string) error {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return err
+	}
+	*v.p = &n
+	return nil
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"encoding/csv"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/quantonganh/nearby-cities/nearbycities"
+)
+
+// writeCSV streams the cities as a CSV attachment, one row per city.
+func writeCSV(w http.ResponseWriter, cities []nearbycities.City) error {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="nearby_cities.csv"`)
+	return writeCitiesCSV(w, cities)
+}
+
+// writeCitiesCSV writes the cities to w as CSV, one row per city.
+func writeCitiesCSV(w io.Writer, cities []nearbycities.City) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"city", "country", "lat", "lng", "distance_km"}); err != nil {
+		return err
+	}
+
+	for _, c := range cities {
+		record := []string{
+			c.City,
+			c.Country,
+			strconv.FormatFloat(c.Lat, 'f', -1, 64),
+			strconv.FormatFloat(c.Lng, 'f', -1, 64),
+			strconv.FormatFloat(c.Distance, 'f', -1, 64),
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
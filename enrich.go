@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/quantonganh/nearby-cities/nearbycities"
+	"github.com/rs/zerolog"
+)
+
+// runEnrich runs the enrich subcommand, which links the cities of the
+// configured database that are not linked yet to their Wikidata item.
+// It can be stopped and run again to carry on.
+func runEnrich(cfg config, logger zerolog.Logger, args []string) error {
+	fs := flag.NewFlagSet("enrich", flag.ContinueOnError)
+	limit := fs.Int("limit", 0, "maximum number of cities to enrich, 0 for all")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	store, err := openStorage(cfg, logger)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	if err := store.MigrateUp(ctx); err != nil {
+		return err
+	}
+
+	var pending []nearbycities.City
+	err = store.EachCity(ctx, func(c nearbycities.City) error {
+		if c.Wikidata == nil && (*limit == 0 || len(pending) < *limit) {
+			pending = append(pending, c)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	matcher := &nearbycities.WikidataMatcher{
+		URL:       os.Getenv("WIKIDATA_SPARQL_URL"),
+		UserAgent: os.Getenv("WIKIDATA_USER_AGENT"),
+	}
+
+	linked := 0
+	for i, c := range pending {
+		link, err := matcher.Match(c)
+		if err != nil {
+			return fmt.Errorf("%s, %s: %w", c.City, c.Country, err)
+		}
+
+		if err := store.SetWikidata(ctx, c.ID, link); err != nil {
+			return err
+		}
+
+		if link.QID != "" {
+			linked++
+		}
+		if (i+1)%100 == 0 {
+			fmt.Printf("%d/%d cities enriched\n", i+1, len(pending))
+		}
+	}
+
+	fmt.Printf("%d of %d cities linked to Wikidata\n", linked, len(pending))
+	return nil
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/quantonganh/geohash"
+	"github.com/quantonganh/nearby-cities/nearbycities"
+	"github.com/rs/zerolog"
+)
+
+// runExport runs the export subcommand, which writes the cities of the
+// configured database, or of one country, to a file or the standard output
+// as they are read: as a world cities CSV file, which the import and update
+// subcommands read back, or as JSON lines in the format of the API.
+func runExport(cfg config, logger zerolog.Logger, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	format := fs.String("format", "csv", "output format: csv or ndjson")
+	country := fs.String("country", "", "ISO 3166-1 alpha-2 code of the country to export, all of them if empty")
+	output := fs.String("o", "", "file to write to, the standard output if empty")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var write func(w io.Writer) (func(nearbycities.City) error, func() error)
+	switch *format {
+	case "csv":
+		write = exportCSV
+	case "ndjson":
+		write = exportJSONLines
+	default:
+		return fmt.Errorf("unknown export format: %s", *format)
+	}
+
+	store, err := openStorage(cfg, logger)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	var out io.Writer = os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+	buf := bufio.NewWriter(out)
+
+	fn, flush := write(buf)
+	each := func(c nearbycities.City) error {
+		c.Geohash = geohash.Encode(c.Lat, c.Lng)
+		return fn(c)
+	}
+
+	ctx := context.Background()
+	if err := store.MigrateUp(ctx); err != nil {
+		return err
+	}
+	if *country != "" {
+		err = store.EachCountryCity(ctx, strings.ToUpper(*country), nearbycities.ByPopulation, each)
+	} else {
+		err = store.EachCity(ctx, each)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := flush(); err != nil {
+		return err
+	}
+	return buf.Flush()
+}
+
+// exportCSV returns the functions writing the cities to w in the columns of
+// the world cities file, the header first, and flushing them.
+func exportCSV(w io.Writer) (func(nearbycities.City) error, func() error) {
+	cw := csv.NewWriter(w)
+	// An error writing the header is reported by the flush, as csv.Writer
+	// buffers the rows.
+	cw.Write([]string{"city", "city_ascii", "lat", "lng", "country", "iso2", "iso3", "admin_name", "capital", "population", "id"})
+
+	write := func(c nearbycities.City) error {
+		var population string
+		if c.Population != nil {
+			population = strconv.FormatInt(*c.Population, 10)
+		}
+		return cw.Write([]string{
+			c.City,
+			c.CityAscii,
+			strconv.FormatFloat(c.Lat, 'f', -1, 64),
+			strconv.FormatFloat(c.Lng, 'f', -1, 64),
+			c.Country,
+			c.Iso2,
+			c.Iso3,
+			c.AdminName,
+			c.Capital,
+			population,
+			c.ID,
+		})
+	}
+	flush := func() error {
+		cw.Flush()
+		return cw.Error()
+	}
+
+	return write, flush
+}
+
+// exportJSONLines returns the functions writing the cities to w as JSON
+// lines in the format of the latest API version.
+func exportJSONLines(w io.Writer) (func(nearbycities.City) error, func() error) {
+	enc := json.NewEncoder(w)
+	v := apiVersions[len(apiVersions)-1]
+
+	write := func(c nearbycities.City) error {
+		return enc.Encode(v.City(c, unitKm))
+	}
+	flush := func() error {
+		return nil
+	}
+
+	return write, flush
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/quantonganh/httperror"
+	"github.com/quantonganh/nearby-cities/nearbycities"
+)
+
+const (
+	formatHTML    = "html"
+	formatJSON    = "json"
+	formatGeoJSON = "geojson"
+	formatCSV     = "csv"
+	formatGPX     = "gpx"
+	formatKML     = "kml"
+	formatNDJSON  = "ndjson"
+)
+
+// mediaTypes maps the supported formats to their media types, in order of
+// preference when the client accepts several of them equally.
+var mediaTypes = []struct {
+	format    string
+	mediaType string
+}{
+	{formatHTML, "text/html"},
+	{formatJSON, "application/json"},
+	{formatGeoJSON, "application/geo+json"},
+	{formatCSV, "text/csv"},
+	{formatGPX, "application/gpx+xml"},
+	{formatKML, "application/vnd.google-earth.kml+xml"},
+	{formatNDJSON, "application/x-ndjson"},
+}
+
+// responseFormat returns the output format requested by the client, either
+// through the format query parameter or the Accept header.
+func responseFormat(r *http.Request) string {
+	if f := strings.ToLower(r.URL.Query().Get("format")); f != "" {
+		for _, mt := range mediaTypes {
+			if mt.format == f {
+				return f
+			}
+		}
+	}
+
+	return negotiate(r.Header.Get("Accept"))
+}
+
+// varyAccept tells the caches that the responses depend on the Accept
+// header, which picks their format, so that a shared cache does not serve
+// the CSV asked for by a client to a browser. The static assets and the
+// probes do not depend on it.
+func varyAccept(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isProbePath(r.URL.Path) && !strings.HasPrefix(r.URL.Path, "/static/") {
+			w.Header().Add("Vary", "Accept")
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// negotiate picks the supported format with the highest quality value in
+// the Accept header. Browsers and clients that do not care get HTML.
+func negotiate(accept string) string {
+	if accept == "" {
+		return formatHTML
+	}
+
+	best, bestQ := formatHTML, 0.0
+	for _, mt := range mediaTypes {
+		if q := acceptQuality(accept, mt.mediaType); q > bestQ {
+			best, bestQ = mt.format, q
+		}
+	}
+
+	return best
+}
+
+// acceptQuality returns the quality value the Accept header gives to the
+// media type, preferring exact matches over wildcards.
+func acceptQuality(accept, mediaType string) float64 {
+	typ, _, _ := strings.Cut(mediaType, "/")
+
+	q, specificity := 0.0, -1
+	for _, part := range strings.Split(accept, ",") {
+		fields := strings.Split(part, ";")
+		rangeType := strings.ToLower(strings.TrimSpace(fields[0]))
+
+		var s int
+		switch rangeType {
+		case mediaType:
+			s = 2
+		case typ + "/*":
+			s = 1
+		case "*/*":
+			s = 0
+		default:
+			continue
+		}
+
+		if s < specificity {
+			continue
+		}
+
+		rangeQ := 1.0
+		for _, param := range fields[1:] {
+			k, v, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if k == "q" {
+				if f, err := strconv.ParseFloat(v, 64); err == nil {
+					rangeQ = f
+				}
+			}
+		}
+
+		q, specificity = rangeQ, s
+	}
+
+	return q
+}
+
+// render writes the page data in the format requested by the client.
+func render(w http.ResponseWriter, r *http.Request, tmpl *page, data PageData) error {
+	switch responseFormat(r) {
+	case formatJSON:
+		return writeJSON(w, apiV1.cities(data.NearbyCities, data.Unit))
+	case formatGeoJSON:
+		return writeGeoJSON(w, data.NearbyCities, data.Unit)
+	case formatCSV:
+		return writeCSV(w, data.NearbyCities)
+	case formatGPX:
+		return writeGPX(w, data.NearbyCities)
+	case formatKML:
+		return writeKML(w, data.NearbyCities)
+	case formatNDJSON:
+		return streamCities(w, r, apiV1, data.Unit, func(fn func(nearbycities.City) error) error {
+			return eachCity(data.NearbyCities, fn)
+		})
+	default:
+		return renderHTML(w, r, tmpl, data)
+	}
+}
+
+// renderHTML renders the whole page, or only the results fragment when the
+// request comes from htmx updating the page in place, or only the next rows
+// of the results when it loads them past the offset.
+func renderHTML(w http.ResponseWriter, r *http.Request, tmpl *page, data PageData) error {
+	data.locale = requestLocale(w, r)
+	data.theme = requestTheme(r)
+	if r.Header.Get("HX-Request") == "true" {
+		if data.Offset > 0 {
+			return tmpl.ExecuteTemplate(w, "rows", data)
+		}
+		return tmpl.ExecuteTemplate(w, "results", data)
+	}
+
+	return tmpl.ExecuteTemplate(w, "base", data)
+}
+
+// renderNamesakes offers the cities bearing the name searched for to pick
+// from, on the HTML page of the search data or in JSON. The other formats
+// only get the error.
+func renderNamesakes(w http.ResponseWriter, r *http.Request, tmpl *page, data PageData, e *nearbycities.AmbiguousError) error {
+	switch responseFormat(r) {
+	case formatHTML:
+		data.FromCity, data.Namesakes = e.Query, e.Cities
+		return renderHTML(w, r, tmpl, data)
+	case formatJSON:
+		return writeJSONStatus(w, http.StatusMultipleChoices, newAmbiguousResponse(e))
+	default:
+		return httperror.New(http.StatusMultipleChoices, "several cities are named "+e.Query+", pick one by its city_id")
+	}
+}
+
+// renderNoMatch tells that the search matched no city and suggests the names
+// spelt close to it, on the HTML page of the search data or in JSON. The
+// other formats only get the error.
+func renderNoMatch(w http.ResponseWriter, r *http.Request, tmpl *page, data PageData, suggestions []string) error {
+	switch {
+	case responseFormat(r) == formatHTML:
+		data.Message, data.Suggestions = "No matching city found.", suggestions
+		return renderHTML(w, r, tmpl, data)
+	case responseFormat(r) == formatJSON && len(suggestions) > 0:
+		return writeJSONStatus(w, http.StatusNotFound, newNoMatchResponse(suggestions))
+	default:
+		return httperror.New(http.StatusNotFound, "No matching city found.")
+	}
+}
+
+// renderError shows the message on the HTML page, or returns it with the
+// given status code for machine-readable formats.
+func renderError(w http.ResponseWriter, r *http.Request, tmpl *page, status int, message string) error {
+	if responseFormat(r) != formatHTML {
+		return httperror.New(status, message)
+	}
+
+	return renderHTML(w, r, tmpl, PageData{Message: message})
+}
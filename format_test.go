@@ -0,0 +1,93 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   string
+	}{
+		{"", formatHTML},
+		{"*/*", formatHTML},
+		{"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", formatHTML},
+		{"application/json", formatJSON},
+		{"TEXT/CSV", formatCSV},
+		{"application/geo+json", formatGeoJSON},
+		{"application/x-ndjson", formatNDJSON},
+		{"application/*", formatJSON},
+		{"text/csv;q=0.9, application/json;q=0.5", formatCSV},
+		{"application/json;q=0.5, */*;q=0.1", formatJSON},
+		{"text/html;q=0, */*", formatJSON},
+		{"image/png", formatHTML},
+	}
+	for _, tt := range tests {
+		if got := negotiate(tt.accept); got != tt.want {
+			t.Errorf("negotiate(%q) = %s, want %s", tt.accept, got, tt.want)
+		}
+	}
+}
+
+func TestAcceptQuality(t *testing.T) {
+	tests := []struct {
+		accept, mediaType string
+		want              float64
+	}{
+		{"text/csv", "text/csv", 1},
+		{"text/html", "application/json", 0},
+		{"*/*;q=0.2", "application/json", 0.2},
+		{"text/*;q=0.3, text/csv;q=0.7", "text/csv", 0.7},
+		{"text/csv;q=0.7, text/*;q=0.3", "text/csv", 0.7},
+		{"text/csv;q=0.7, */*;q=1", "text/csv", 0.7},
+		{"application/json; q=0.5", "application/json", 0.5},
+		{"application/json;q=bogus", "application/json", 1},
+	}
+	for _, tt := range tests {
+		if got := acceptQuality(tt.accept, tt.mediaType); got != tt.want {
+			t.Errorf("acceptQuality(%q, %q) = %v, want %v", tt.accept, tt.mediaType, got, tt.want)
+		}
+	}
+}
+
+func TestResponseFormat(t *testing.T) {
+	tests := []struct {
+		target, accept string
+		want           string
+	}{
+		{"/search?city=Hanoi", "", formatHTML},
+		{"/search?city=Hanoi&format=CSV", "application/json", formatCSV},
+		{"/search?city=Hanoi&format=xml", "application/json", formatJSON},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", tt.target, nil)
+		if tt.accept != "" {
+			r.Header.Set("Accept", tt.accept)
+		}
+		if got := responseFormat(r); got != tt.want {
+			t.Errorf("responseFormat(%s, Accept: %s) = %s, want %s", tt.target, tt.accept, got, tt.want)
+		}
+	}
+}
+
+func TestVaryAccept(t *testing.T) {
+	handler := varyAccept(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/api/v1/search", "Accept"},
+		{"/search", "Accept"},
+		{"/static/style.css", ""},
+		{"/healthz", ""},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+		if got := w.Header().Get("Vary"); got != tt.want {
+			t.Errorf("Vary of %s = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/quantonganh/httperror"
+	"github.com/quantonganh/nearby-cities/nearbycities"
+	"github.com/rs/zerolog/hlog"
+)
+
+type featureCollection struct {
+	Type     string    `json:"type"`
+	Features []feature `json:"features"`
+}
+
+type feature struct {
+	Type       string            `json:"type"`
+	Geometry   geometry          `json:"geometry"`
+	Properties featureProperties `json:"properties"`
+}
+
+type geometry struct {
+	Type        string    `json:"type"`
+	Coordinates []float64 `json:"coordinates"`
+}
+
+type featureProperties struct {
+	ID             string   `json:"id,omitempty"`
+	URL            string   `json:"url,omitempty"`
+	Origin         bool     `json:"origin,omitempty"`
+	City           string   `json:"city"`
+	AdminName      string   `json:"admin_name,omitempty"`
+	Country        string   `json:"country"`
+	Iso2           string   `json:"iso2,omitempty"`
+	Iso3           string   `json:"iso3,omitempty"`
+	Flag           string   `json:"flag,omitempty"`
+	Continent      string   `json:"continent,omitempty"`
+	Capital        string   `json:"capital,omitempty"`
+	Population     *int64   `json:"population,omitempty"`
+	Geohash        string   `json:"geohash,omitempty"`
+	H3             string   `json:"h3,omitempty"`
+	Elevation      *int     `json:"elevation_m,omitempty"`
+	Distance       float64  `json:"distance_km"`
+	DistanceMi     *float64 `json:"distance_mi,omitempty"`
+	DistanceMethod string   `json:"distance_method,omitempty"`
+	Bearing        *float64 `json:"bearing_deg,omitempty"`
+	Direction      string   `json:"direction,omitempty"`
+}
+
+func newFeatureCollection(cities []nearbycities.City, u distanceUnit) featureCollection {
+	fc := featureCollection{
+		Type:     "FeatureCollection",
+		Features: make([]feature, 0, len(cities)),
+	}
+
+	for _, c := range cities {
+		fc.Features = append(fc.Features, newFeature(c, u))
+	}
+
+	return fc
+}
+
+func newFeature(c nearbycities.City, u distanceUnit) feature {
+	var url string
+	if c.ID != "" {
+		url = cityURL(c.ID)
+	}
+
+	f := feature{
+		Type: "Feature",
+		Geometry: geometry{
+			Type:        "Point",
+			Coordinates: []float64{c.Lng, c.Lat},
+		},
+		Properties: featureProperties{
+			ID:             c.ID,
+			URL:            url,
+			City:           c.City,
+			AdminName:      c.AdminName,
+			Country:        c.Country,
+			Iso2:           c.Iso2,
+			Iso3:           c.Iso3,
+			Flag:           nearbycities.FlagEmoji(c.Iso2),
+			Continent:      continentOf(c.Iso2),
+			Capital:        c.Capital,
+			Population:     c.Population,
+			Geohash:        c.Geohash,
+			H3:             c.H3,
+			Elevation:      c.Elevation,
+			Distance:       c.Distance,
+			DistanceMi:     u.miles(c.Distance),
+			DistanceMethod: string(c.DistanceMethod),
+		},
+	}
+	f.Properties.Bearing, f.Properties.Direction = cityBearing(c)
+
+	return f
+}
+
+func writeGeoJSON(w http.ResponseWriter, cities []nearbycities.City, u distanceUnit) error {
+	w.Header().Set("Content-Type", "application/geo+json")
+	return json.NewEncoder(w).Encode(newFeatureCollection(cities, u))
+}
+
+// mapHandler serves the city searched for, as /search does, or the
+// coordinates, as /nearby does, and the cities within the radius as GeoJSON
+// for the map of the results, the searched city being the first feature,
+// flagged as the origin and not repeated among the others.
+func mapHandler(svc *nearbycities.Service) httperror.Handler {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		unit, err := preferredUnit(w, r)
+		if err != nil {
+			return err
+		}
+
+		radius, err := pageRadius(r)
+		if err != nil {
+			return err
+		}
+
+		var from nearbycities.City
+		var cities []nearbycities.City
+		if r.FormValue("lat") != "" || r.FormValue("lng") != "" {
+			var at coordinates
+			if at, err = parseCoordinates(r); err != nil {
+				return err
+			}
+			from = nearbycities.City{City: requestLocale(w, r).T("Your location"), Lat: at.Lat, Lng: at.Lng}
+			cities, err = svc.NearbyLatLng(r.Context(), at.Lat, at.Lng, radius)
+		} else {
+			from, cities, err = searchCity(r.Context(), svc, r.FormValue("city"), r.FormValue("city_id"), radius)
+		}
+		if err != nil {
+			var ambiguous *nearbycities.AmbiguousError
+			switch {
+			case errors.As(err, &ambiguous):
+				return httperror.New(http.StatusMultipleChoices, "several cities are named "+ambiguous.Query+", pick one by its city_id")
+			case errors.Is(err, nearbycities.ErrNotFound):
+				return httperror.New(http.StatusNotFound, "No matching city found.")
+			default:
+				hlog.FromRequest(r).Err(err).Msg("")
+				return httperror.New(http.StatusInternalServerError, "Oops! Something went wrong. Please try again later.")
+			}
+		}
+
+		origin := newFeature(from, unit)
+		origin.Properties.Origin = true
+		fc := featureCollection{Type: "FeatureCollection", Features: []feature{origin}}
+		for _, c := range cities {
+			// The searched city is among the results too, at 0 km.
+			if c.ID != "" && c.ID == from.ID {
+				continue
+			}
+			fc.Features = append(fc.Features, newFeature(c, unit))
+		}
+
+		w.Header().Set("Content-Type", "application/geo+json")
+		return json.NewEncoder(w).Encode(fc)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+
+	"github.com/quantonganh/nearby-cities/nearbycities"
+)
+
+type gpx struct {
+	XMLName   xml.Name      `xml:"gpx"`
+	Xmlns     string        `xml:"xmlns,attr"`
+	Version   string        `xml:"version,attr"`
+	Creator   string        `xml:"creator,attr"`
+	Waypoints []gpxWaypoint `xml:"wpt"`
+}
+
+type gpxWaypoint struct {
+	Lat  float64 `xml:"lat,attr"`
+	Lon  float64 `xml:"lon,attr"`
+	Name string  `xml:"name"`
+	Desc string  `xml:"desc,omitempty"`
+}
+
+// writeGPX writes the cities as GPX 1.1 waypoints.
+func writeGPX(w http.ResponseWriter, cities []nearbycities.City) error {
+	doc := gpx{
+		Xmlns:     "http://www.topografix.com/GPX/1/1",
+		Version:   "1.1",
+		Creator:   "nearby-cities",
+		Waypoints: make([]gpxWaypoint, 0, len(cities)),
+	}
+
+	for _, c := range cities {
+		doc.Waypoints = append(doc.Waypoints, gpxWaypoint{
+			Lat:  c.Lat,
+			Lon:  c.Lng,
+			Name: c.City,
+			Desc: fmt.Sprintf("%s, %s (%v km)", c.AdminName, c.Country, c.Distance),
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/gpx+xml")
+	w.Header().Set("Content-Disposition", `attachment; filename="nearby_cities.gpx"`)
+
+	return writeXML(w, doc)
+}
+
+func writeXML(w http.ResponseWriter, v any) error {
+	if _, err := w.Write([]byte(xml.Header)); err != nil {
+		return err
+	}
+
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return err
+	}
+
+	return enc.Close()
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/quantonganh/httperror"
+	"github.com/quantonganh/nearby-cities/nearbycities"
+)
+
+// healthzHandler reports whether the process is up and the storage still
+// answers a ping.
+func healthzHandler(store nearbycities.Storage) httperror.Handler {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+		defer cancel()
+
+		if err := store.Ping(ctx); err != nil {
+			return httperror.New(http.StatusServiceUnavailable, "database is unavailable")
+		}
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		_, err := w.Write([]byte("ok\n"))
+		return err
+	}
+}
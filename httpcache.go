@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// httpCacheOptions sets how long browsers and CDNs may reuse the responses
+// before revalidating them.
+type httpCacheOptions struct {
+	APIMaxAge    time.Duration
+	StaticMaxAge time.Duration
+}
+
+// newHTTPCacheOptions returns the lifetimes of c.
+func newHTTPCacheOptions(c httpConfig) httpCacheOptions {
+	return httpCacheOptions{
+		APIMaxAge:    c.CacheMaxAge,
+		StaticMaxAge: c.CacheStaticMaxAge,
+	}
+}
+
+// datasetVersion records when the dataset was last imported by the server,
+// which is when the API responses last changed.
+type datasetVersion struct {
+	modified atomic.Int64
+}
+
+func (v *datasetVersion) touch() {
+	v.modified.Store(time.Now().Truncate(time.Second).UnixNano())
+}
+
+// lastModified returns the zero time until the dataset is imported.
+func (v *datasetVersion) lastModified() time.Time {
+	modified := v.modified.Load()
+	if modified == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, modified)
+}
+
+// bufferedResponse holds a response until it is known whether the client
+// already has it.
+type bufferedResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (b *bufferedResponse) Header() http.Header {
+	return b.header
+}
+
+func (b *bufferedResponse) WriteHeader(status int) {
+	if b.status == 0 {
+		b.status = status
+	}
+}
+
+func (b *bufferedResponse) Write(p []byte) (int, error) {
+	if b.status == 0 {
+		b.status = http.StatusOK
+	}
+	return b.body.Write(p)
+}
+
+// cacheHandler adds Cache-Control and an ETag hashed from the body to the
+// successful GET and HEAD responses of the API and the static assets, and
+// Last-Modified to the API ones, answering 304 Not Modified to the clients
+// whose copy is still current. The location of the client itself is not
+// cached, as it differs for every client, and neither are the streamed
+// responses, which would have to be held whole.
+func cacheHandler(opts httpCacheOptions, dataset *datasetVersion) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			api := strings.HasPrefix(r.URL.Path, "/api/")
+			static := strings.HasPrefix(r.URL.Path, "/static/")
+			if (r.Method != http.MethodGet && r.Method != http.MethodHead) || (!api && !static) || isClientIPLookup(r) || isStreamed(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// The body of a HEAD response is needed for its ETag, and left
+			// out by ServeContent.
+			get := r
+			if r.Method == http.MethodHead {
+				get = r.Clone(r.Context())
+				get.Method = http.MethodGet
+			}
+
+			buf := &bufferedResponse{header: w.Header()}
+			next.ServeHTTP(buf, get)
+			if buf.status == 0 {
+				buf.status = http.StatusOK
+			}
+			if buf.status != http.StatusOK {
+				w.WriteHeader(buf.status)
+				w.Write(buf.body.Bytes())
+				return
+			}
+
+			maxAge, modified := opts.StaticMaxAge, time.Time{}
+			if api {
+				maxAge, modified = opts.APIMaxAge, dataset.lastModified()
+			}
+
+			sum := sha256.Sum256(buf.body.Bytes())
+			w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:16])+`"`)
+			w.Header().Set("Cache-Control", "public, max-age="+strconv.Itoa(int(maxAge.Seconds())))
+			http.ServeContent(w, r, "", modified, bytes.NewReader(buf.body.Bytes()))
+		})
+	}
+}
+
+// isClientIPLookup reports whether the request asks for the location of the
+// client rather than of a given address.
+func isClientIPLookup(r *http.Request) bool {
+	return strings.HasSuffix(r.URL.Path, "/ip") && r.URL.Query().Get("ip") == ""
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/quantonganh/nearby-cities/nearbycities"
+	"github.com/rs/zerolog"
+)
+
+// runImport runs the import subcommand, which loads a CSV file of places
+// into the configured database. Importing the same source again
+// replaces its places with those of the file. Without a file, it imports the
+// dataset as the server does on start, e.g. to build the database ahead of
+// a deployment.
+func runImport(cfg config, logger zerolog.Logger, args []string) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	file := fs.String("file", "", "CSV file of the places to import, the dataset being imported without one")
+	source := fs.String("source", "custom", "name of the set of places, which a later import of the same name replaces")
+	columns := fs.String("columns", "", "comma-separated column=header pairs mapping the dataset columns, e.g. city,lat,lng, to the header of the file")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *file == "" {
+		store, err := openStorage(cfg, logger)
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+		return importDataset(cfg, store, logger)
+	}
+
+	if *source == "" {
+		return errors.New("the source of the places cannot be empty")
+	}
+
+	mapping, err := parseColumns(*columns)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(*file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	places, err := nearbycities.ReadCities(f, mapping)
+	if err != nil {
+		return err
+	}
+
+	store, err := openStorage(cfg, logger)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	if err := store.MigrateUp(ctx); err != nil {
+		return err
+	}
+
+	changes, err := store.UpdateCities(ctx, *source, places)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(changes)
+	return nil
+}
+
+// parseColumns parses a list of column=header pairs.
+func parseColumns(s string) (map[string]string, error) {
+	columns := make(map[string]string)
+	for _, pair := range splitList(s) {
+		column, header, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid column mapping: %s", pair)
+		}
+		columns[strings.TrimSpace(column)] = strings.TrimSpace(header)
+	}
+
+	return columns, nil
+}
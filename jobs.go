@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/quantonganh/nearby-cities/nearbycities"
+	"github.com/rs/zerolog"
+)
+
+// job is a background job the server runs on a schedule.
+type job struct {
+	name     string
+	schedule schedule
+	jitter   time.Duration
+	run      func(ctx context.Context, run *jobRun) error
+}
+
+// scheduledJobs returns the jobs of cfg that have a schedule. refreshed is
+// called with the changes of every refresh of the cities, once svc answers
+// from them.
+func scheduledJobs(cfg config, store nearbycities.Storage, svc *nearbycities.Service, rows *datasetCollector, refreshed func(nearbycities.CityChanges)) ([]job, error) {
+	var jobs []job
+	add := func(name string, jc jobConfig, run func(ctx context.Context, run *jobRun) error) error {
+		if jc.Schedule == "" {
+			return nil
+		}
+		sched, err := parseSchedule(jc.Schedule)
+		if err != nil {
+			return fmt.Errorf("job %s: %w", name, err)
+		}
+		jobs = append(jobs, job{name: name, schedule: sched, jitter: jc.Jitter, run: run})
+		return nil
+	}
+
+	refresh := cfg.Jobs.RefreshIPRanges
+	if refresh.Schedule == "" && cfg.IP2Location.RefreshInterval > 0 {
+		refresh.Schedule = "@every " + cfg.IP2Location.RefreshInterval.String()
+	}
+	err := add("refresh_ip_ranges", refresh, func(ctx context.Context, run *jobRun) error {
+		if err := store.RefreshIPRanges(cfg.IP2Location.Token); err != nil {
+			return err
+		}
+		return rows.refresh(ctx)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.Jobs.WarmCache.Schedule != "" && cfg.Search.ResultCacheSize <= 0 {
+		return nil, errors.New("job warm_cache: there is no result cache to warm, set RESULT_CACHE_SIZE")
+	}
+	err = add("warm_cache", cfg.Jobs.WarmCache, func(ctx context.Context, run *jobRun) error {
+		return warmCache(ctx, store, svc, min(warmCities, cfg.Search.ResultCacheSize), run)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = add("vacuum", cfg.Jobs.Vacuum, func(ctx context.Context, run *jobRun) error {
+		return store.Optimize(ctx)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	cities := cfg.Jobs.RefreshCities
+	if cities.Schedule != "" && cities.Source == "" {
+		return nil, errors.New("job refresh_cities: there is no release to refresh the cities from, set JOB_REFRESH_CITIES_SOURCE")
+	}
+	err = add("refresh_cities", cities.jobConfig, func(ctx context.Context, run *jobRun) error {
+		changes, err := refreshCities(ctx, store, cities.Source)
+		if err != nil {
+			return err
+		}
+		// The indexes and the counts are of the previous release until
+		// rebuilt.
+		if err := buildIndexes(cfg, store, svc, run); err != nil {
+			return err
+		}
+		svc.PurgeCache()
+		if err := rows.refresh(ctx); err != nil {
+			return err
+		}
+		refreshed(changes)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return jobs, nil
+}
+
+// refreshCities applies the world cities release at source, a path or an
+// http(s) URL, to store.
+func refreshCities(ctx context.Context, store nearbycities.Storage, source string) (nearbycities.CityChanges, error) {
+	var in io.ReadCloser
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, source, nil)
+		if err != nil {
+			return nearbycities.CityChanges{}, err
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return nearbycities.CityChanges{}, fmt.Errorf("error downloading the cities: %w", err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nearbycities.CityChanges{}, fmt.Errorf("error downloading the cities: %s answered %s", source, resp.Status)
+		}
+		in = resp.Body
+	} else {
+		f, err := os.Open(source)
+		if err != nil {
+			return nearbycities.CityChanges{}, err
+		}
+		in = f
+	}
+	defer in.Close()
+
+	release, err := nearbycities.ReadWorldCities(in)
+	if err != nil {
+		return nearbycities.CityChanges{}, err
+	}
+
+	return store.UpdateCities(ctx, "", release)
+}
+
+// runJobs runs every job on its schedule until ctx is done, recording the
+// runs in tracker. A job is not started again while it runs, and a failed
+// run is logged and waits for the next one.
+func runJobs(ctx context.Context, jobs []job, tracker *jobTracker, logger zerolog.Logger) {
+	for _, j := range jobs {
+		go j.loop(ctx, tracker, logger)
+	}
+}
+
+func (j job) loop(ctx context.Context, tracker *jobTracker, logger zerolog.Logger) {
+	for {
+		next := j.schedule.next(time.Now())
+		if j.jitter > 0 {
+			next = next.Add(time.Duration(rand.Int63n(int64(j.jitter))))
+		}
+		tracker.scheduleNext(j.name, next)
+		logger.Debug().Str("job", j.name).Time("next_run", next).Msg("scheduled job")
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		start := time.Now()
+		run := tracker.start(j.name)
+		err := j.run(ctx, run)
+		if ctx.Err() != nil {
+			run.finish(ctx.Err())
+			return
+		}
+		run.finish(err)
+		if err != nil {
+			logger.Err(err).Str("job", j.name).Dur("duration", time.Since(start)).Msg("job failed")
+			continue
+		}
+		logger.Info().Str("job", j.name).Dur("duration", time.Since(start)).Msg("job completed")
+	}
+}
+
+// warmCities bounds the cities the result cache is warmed with.
+const warmCities = 100
+
+// warmCache caches the cities around the n most populated cities, within
+// the default radius, which the searches of a fresh instance are the most
+// likely to ask for, reporting its progress to run.
+func warmCache(ctx context.Context, store nearbycities.Storage, svc *nearbycities.Service, n int, run *jobRun) error {
+	var top []nearbycities.City
+	err := store.EachCity(ctx, func(c nearbycities.City) error {
+		if c.Population == nil {
+			return nil
+		}
+		// The n most populated are kept sorted, the least populated last.
+		i := len(top)
+		for i > 0 && *top[i-1].Population < *c.Population {
+			i--
+		}
+		if i >= n {
+			return nil
+		}
+		if len(top) < n {
+			top = append(top, nearbycities.City{})
+		}
+		copy(top[i+1:], top[i:])
+		top[i] = c
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for i, c := range top {
+		if _, _, err := svc.NearbyCityByID(ctx, c.ID, defaultRadius); err != nil {
+			return fmt.Errorf("error warming the cache with %s: %w", c.City, err)
+		}
+		run.setProgress(i+1, len(top))
+	}
+	return nil
+}
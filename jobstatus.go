@@ -0,0 +1,219 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/quantonganh/httperror"
+)
+
+// maxJobRuns bounds the finished runs the tracker remembers.
+const maxJobRuns = 50
+
+// jobState is the state of a run of a background job.
+type jobState string
+
+const (
+	jobRunning   jobState = "running"
+	jobSucceeded jobState = "succeeded"
+	jobFailed    jobState = "failed"
+)
+
+// jobTracker records the runs of the background jobs, the imports and index
+// rebuilds of the start along with the scheduled ones, for the operators to
+// see what ran and how it went.
+type jobTracker struct {
+	mu        sync.Mutex
+	nextID    int
+	runs      []*jobRun
+	scheduled map[string]time.Time
+}
+
+func newJobTracker() *jobTracker {
+	return &jobTracker{scheduled: make(map[string]time.Time)}
+}
+
+// jobRun is a run of a job.
+type jobRun struct {
+	t *jobTracker
+
+	id       int
+	name     string
+	state    jobState
+	progress *float64
+	started  time.Time
+	finished time.Time
+	err      error
+}
+
+// start records the start of a run of the job with the name.
+func (t *jobTracker) start(name string) *jobRun {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.nextID++
+	run := &jobRun{t: t, id: t.nextID, name: name, state: jobRunning, started: time.Now()}
+	t.runs = append(t.runs, run)
+
+	// The oldest finished runs are forgotten first, the running ones being
+	// kept whatever their number.
+	finished := 0
+	for _, r := range t.runs {
+		if r.state != jobRunning {
+			finished++
+		}
+	}
+	for i := 0; finished > maxJobRuns; {
+		if t.runs[i].state == jobRunning {
+			i++
+			continue
+		}
+		t.runs = slices.Delete(t.runs, i, i+1)
+		finished--
+	}
+
+	return run
+}
+
+// scheduleNext records when the job with the name runs next.
+func (t *jobTracker) scheduleNext(name string, next time.Time) {
+	t.mu.Lock()
+	t.scheduled[name] = next
+	t.mu.Unlock()
+}
+
+// setProgress records that done of the total units of work of the run are
+// done.
+func (r *jobRun) setProgress(done, total int) {
+	if total <= 0 {
+		return
+	}
+	percent := float64(done) * 100 / float64(total)
+
+	r.t.mu.Lock()
+	r.progress = &percent
+	r.t.mu.Unlock()
+}
+
+// finish records the end of the run, which failed with err if it is not
+// nil.
+func (r *jobRun) finish(err error) {
+	r.t.mu.Lock()
+	defer r.t.mu.Unlock()
+
+	r.finished = time.Now()
+	r.err = err
+	r.state = jobSucceeded
+	if err != nil {
+		r.state = jobFailed
+		return
+	}
+	done := 100.0
+	r.progress = &done
+}
+
+type jobRunJSON struct {
+	ID       int        `json:"id"`
+	Name     string     `json:"name"`
+	State    jobState   `json:"state"`
+	Progress *float64   `json:"progress,omitempty"`
+	Started  time.Time  `json:"started_at"`
+	Finished *time.Time `json:"finished_at,omitempty"`
+	Duration float64    `json:"duration_seconds"`
+	Error    string     `json:"error,omitempty"`
+}
+
+type scheduledJobJSON struct {
+	Name    string    `json:"name"`
+	NextRun time.Time `json:"next_run"`
+}
+
+type jobsJSON struct {
+	Runs      []jobRunJSON       `json:"runs"`
+	Scheduled []scheduledJobJSON `json:"scheduled"`
+}
+
+// snapshot returns the runs, the latest first, and the next runs of the
+// scheduled jobs.
+func (t *jobTracker) snapshot(now time.Time) jobsJSON {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	out := jobsJSON{Runs: []jobRunJSON{}, Scheduled: []scheduledJobJSON{}}
+	for i := len(t.runs) - 1; i >= 0; i-- {
+		run := t.runs[i]
+		j := jobRunJSON{
+			ID:       run.id,
+			Name:     run.name,
+			State:    run.state,
+			Progress: run.progress,
+			Started:  run.started.UTC(),
+			Duration: now.Sub(run.started).Seconds(),
+		}
+		if !run.finished.IsZero() {
+			finished := run.finished.UTC()
+			j.Finished = &finished
+			j.Duration = run.finished.Sub(run.started).Seconds()
+		}
+		if run.err != nil {
+			j.Error = run.err.Error()
+		}
+		out.Runs = append(out.Runs, j)
+	}
+	names := make([]string, 0, len(t.scheduled))
+	for name := range t.scheduled {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		out.Scheduled = append(out.Scheduled, scheduledJobJSON{Name: name, NextRun: t.scheduled[name].UTC()})
+	}
+
+	return out
+}
+
+// adminJobsHandler lists the runs of the background jobs, running and
+// recent, to the requests bearing the admin token. None is listed without a
+// token.
+func adminJobsHandler(tracker *jobTracker, token string) httperror.Handler {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		if err := checkAdminToken(w, r, token); err != nil {
+			return err
+		}
+
+		w.Header().Set("Cache-Control", "no-store")
+		return writeJSON(w, tracker.snapshot(time.Now()))
+	}
+}
+
+// adminOnly serves next to the requests bearing the admin token only.
+func adminOnly(token string, next http.Handler) httperror.Handler {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		if err := checkAdminToken(w, r, token); err != nil {
+			return err
+		}
+
+		next.ServeHTTP(w, r)
+		return nil
+	}
+}
+
+// checkAdminToken returns an error unless r bears the admin token, a 404 one
+// when there is no token, as the admin endpoints are then disabled.
+func checkAdminToken(w http.ResponseWriter, r *http.Request, token string) error {
+	if token == "" {
+		return httperror.New(http.StatusNotFound, "the admin endpoints are disabled, set ADMIN_TOKEN to enable them")
+	}
+	bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(bearer), []byte(token)) != 1 {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+		return httperror.New(http.StatusUnauthorized, "a valid admin token is required")
+	}
+
+	return nil
+}
@@ -0,0 +1,354 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/quantonganh/nearby-cities/nearbycities"
+)
+
+type cityResponse struct {
+	Name           string   `json:"name"`
+	Lat            float64  `json:"lat"`
+	Lng            float64  `json:"lng"`
+	AdminName      string   `json:"admin_name,omitempty"`
+	Country        string   `json:"country"`
+	Iso2           string   `json:"iso2,omitempty"`
+	Iso3           string   `json:"iso3,omitempty"`
+	Flag           string   `json:"flag,omitempty"`
+	Continent      string   `json:"continent,omitempty"`
+	Currency       string   `json:"currency,omitempty"`
+	CallingCode    string   `json:"calling_code,omitempty"`
+	TLD            string   `json:"tld,omitempty"`
+	Capital        string   `json:"capital,omitempty"`
+	Population     *int64   `json:"population,omitempty"`
+	Geohash        string   `json:"geohash,omitempty"`
+	H3             string   `json:"h3,omitempty"`
+	Elevation      *int     `json:"elevation_m,omitempty"`
+	Distance       float64  `json:"distance_km"`
+	DistanceMi     *float64 `json:"distance_mi,omitempty"`
+	DistanceMethod string   `json:"distance_method,omitempty"`
+	Bearing        *float64 `json:"bearing_deg,omitempty"`
+	Direction      string   `json:"direction,omitempty"`
+	Timezone       string   `json:"timezone,omitempty"`
+	LocalTime      string   `json:"local_time,omitempty"`
+	UTCOffset      string   `json:"utc_offset,omitempty"`
+}
+
+func newCityResponse(c nearbycities.City, u distanceUnit) cityResponse {
+	country, _ := nearbycities.LookupCountry(c.Iso2)
+	resp := cityResponse{
+		Name:           c.City,
+		Lat:            c.Lat,
+		Lng:            c.Lng,
+		AdminName:      c.AdminName,
+		Country:        c.Country,
+		Iso2:           c.Iso2,
+		Iso3:           c.Iso3,
+		Flag:           nearbycities.FlagEmoji(c.Iso2),
+		Continent:      country.Continent,
+		Currency:       country.Currency,
+		CallingCode:    country.CallingCode,
+		TLD:            country.TLD,
+		Capital:        c.Capital,
+		Population:     c.Population,
+		Geohash:        c.Geohash,
+		H3:             c.H3,
+		Elevation:      c.Elevation,
+		Distance:       c.Distance,
+		DistanceMi:     u.miles(c.Distance),
+		DistanceMethod: string(c.DistanceMethod),
+		Timezone:       c.Timezone,
+	}
+	resp.Bearing, resp.Direction = cityBearing(c)
+
+	if t, ok := cityTime(c.Timezone); ok {
+		resp.LocalTime = t.Format(time.RFC3339)
+		resp.UTCOffset = t.Format("-07:00")
+	}
+
+	return resp
+}
+
+// cityBearing returns the bearing of the city from the origin of the search
+// and the point of the compass it lies at, none for the origin itself and
+// for the cities not found by a nearby search.
+func cityBearing(c nearbycities.City) (*float64, string) {
+	if c.DistanceMethod == "" || c.Distance == 0 {
+		return nil, ""
+	}
+	bearing := c.Bearing
+	return &bearing, nearbycities.CompassPoint(bearing)
+}
+
+type cityDetailResponse struct {
+	ID             string           `json:"id"`
+	Name           string           `json:"name"`
+	Lat            float64          `json:"lat"`
+	Lng            float64          `json:"lng"`
+	AdminName      string           `json:"admin_name,omitempty"`
+	Country        string           `json:"country"`
+	Iso2           string           `json:"iso2,omitempty"`
+	Iso3           string           `json:"iso3,omitempty"`
+	Flag           string           `json:"flag,omitempty"`
+	Continent      string           `json:"continent,omitempty"`
+	Currency       string           `json:"currency,omitempty"`
+	CallingCode    string           `json:"calling_code,omitempty"`
+	TLD            string           `json:"tld,omitempty"`
+	Capital        string           `json:"capital,omitempty"`
+	Population     *int64           `json:"population,omitempty"`
+	Geohash        string           `json:"geohash"`
+	Elevation      *int             `json:"elevation_m,omitempty"`
+	Timezone       string           `json:"timezone,omitempty"`
+	LocalTime      string           `json:"local_time,omitempty"`
+	UTCOffset      string           `json:"utc_offset,omitempty"`
+	WikidataID     string           `json:"wikidata_id,omitempty"`
+	WikipediaURL   string           `json:"wikipedia_url,omitempty"`
+	ThumbnailURL   string           `json:"thumbnail_url,omitempty"`
+	NearestAirport *airportResponse `json:"nearest_airport,omitempty"`
+	Nearby         []any            `json:"nearby"`
+}
+
+func newCityDetailResponse(c nearbycities.City, airport *nearbycities.Airport, nearby []nearbycities.City, u distanceUnit) cityDetailResponse {
+	country, _ := nearbycities.LookupCountry(c.Iso2)
+	resp := cityDetailResponse{
+		ID:          c.ID,
+		Name:        c.City,
+		Lat:         c.Lat,
+		Lng:         c.Lng,
+		AdminName:   c.AdminName,
+		Country:     c.Country,
+		Iso2:        c.Iso2,
+		Iso3:        c.Iso3,
+		Flag:        nearbycities.FlagEmoji(c.Iso2),
+		Continent:   country.Continent,
+		Currency:    country.Currency,
+		CallingCode: country.CallingCode,
+		TLD:         country.TLD,
+		Capital:     c.Capital,
+		Population:  c.Population,
+		Geohash:     c.Geohash,
+		Elevation:   c.Elevation,
+		Timezone:    c.Timezone,
+		Nearby:      apiV1.cities(nearby, u),
+	}
+
+	if t, ok := cityTime(c.Timezone); ok {
+		resp.LocalTime = t.Format(time.RFC3339)
+		resp.UTCOffset = t.Format("-07:00")
+	}
+
+	if w := c.Wikidata; w != nil {
+		resp.WikidataID = w.QID
+		resp.WikipediaURL = w.WikipediaURL
+		resp.ThumbnailURL = w.ThumbnailURL
+	}
+
+	if airport != nil {
+		a := newAirportResponse(*airport, u)
+		resp.NearestAirport = &a
+	}
+
+	return resp
+}
+
+// namesakeResponse is one of the cities offered to pick from when several
+// bear the name searched for.
+type namesakeResponse struct {
+	ID         string  `json:"id"`
+	Name       string  `json:"name"`
+	AdminName  string  `json:"admin_name,omitempty"`
+	Country    string  `json:"country"`
+	Iso2       string  `json:"iso2,omitempty"`
+	Flag       string  `json:"flag,omitempty"`
+	Population *int64  `json:"population,omitempty"`
+	Lat        float64 `json:"lat"`
+	Lng        float64 `json:"lng"`
+}
+
+type ambiguousResponse struct {
+	Message string             `json:"message"`
+	Cities  []namesakeResponse `json:"cities"`
+}
+
+func newAmbiguousResponse(e *nearbycities.AmbiguousError) ambiguousResponse {
+	resp := ambiguousResponse{
+		Message: fmt.Sprintf("several cities are named %s, pick one by its city_id", e.Query),
+		Cities:  make([]namesakeResponse, 0, len(e.Cities)),
+	}
+	for _, c := range e.Cities {
+		resp.Cities = append(resp.Cities, namesakeResponse{
+			ID:         c.ID,
+			Name:       c.City,
+			AdminName:  c.AdminName,
+			Country:    c.Country,
+			Iso2:       c.Iso2,
+			Flag:       nearbycities.FlagEmoji(c.Iso2),
+			Population: c.Population,
+			Lat:        c.Lat,
+			Lng:        c.Lng,
+		})
+	}
+
+	return resp
+}
+
+// noMatchResponse answers a search matching no city with the names spelt
+// close to it.
+type noMatchResponse struct {
+	Message     string   `json:"message"`
+	Suggestions []string `json:"suggestions"`
+}
+
+func newNoMatchResponse(suggestions []string) noMatchResponse {
+	msg := "no matching city found"
+	if len(suggestions) > 0 {
+		msg += ", did you mean " + strings.Join(suggestions, " or ") + "?"
+	}
+
+	return noMatchResponse{Message: msg, Suggestions: suggestions}
+}
+
+type countryResponse struct {
+	Iso2        string `json:"iso2"`
+	Iso3        string `json:"iso3,omitempty"`
+	Name        string `json:"name"`
+	Flag        string `json:"flag,omitempty"`
+	Continent   string `json:"continent,omitempty"`
+	Currency    string `json:"currency,omitempty"`
+	CallingCode string `json:"calling_code,omitempty"`
+	TLD         string `json:"tld,omitempty"`
+	Total       int    `json:"total"`
+	Offset      int    `json:"offset"`
+	Limit       int    `json:"limit"`
+	Cities      []any  `json:"cities"`
+	Next        string `json:"next,omitempty"`
+}
+
+type airportResponse struct {
+	Ident        string   `json:"ident"`
+	IATA         string   `json:"iata,omitempty"`
+	Name         string   `json:"name"`
+	Type         string   `json:"type"`
+	Municipality string   `json:"municipality,omitempty"`
+	Iso2         string   `json:"iso2"`
+	Lat          float64  `json:"lat"`
+	Lng          float64  `json:"lng"`
+	Elevation    *int     `json:"elevation_m,omitempty"`
+	Scheduled    bool     `json:"scheduled_service"`
+	Distance     float64  `json:"distance_km"`
+	DistanceMi   *float64 `json:"distance_mi,omitempty"`
+}
+
+func newAirportResponse(a nearbycities.Airport, u distanceUnit) airportResponse {
+	return airportResponse{
+		Ident:        a.Ident,
+		IATA:         a.IATA,
+		Name:         a.Name,
+		Type:         a.Type,
+		Municipality: a.Municipality,
+		Iso2:         a.Iso2,
+		Lat:          a.Lat,
+		Lng:          a.Lng,
+		Elevation:    a.Elevation,
+		Scheduled:    a.Scheduled,
+		Distance:     a.Distance,
+		DistanceMi:   u.miles(a.Distance),
+	}
+}
+
+type compareNearbyResponse struct {
+	cityResponse
+	DistanceA   float64  `json:"distance_a_km"`
+	DistanceAMi *float64 `json:"distance_a_mi,omitempty"`
+	DistanceB   float64  `json:"distance_b_km"`
+	DistanceBMi *float64 `json:"distance_b_mi,omitempty"`
+}
+
+type compareResponse struct {
+	A                   cityResponse            `json:"a"`
+	B                   cityResponse            `json:"b"`
+	Distance            float64                 `json:"distance_km"`
+	DistanceMi          *float64                `json:"distance_mi,omitempty"`
+	Bearing             float64                 `json:"bearing_deg"`
+	Direction           string                  `json:"direction"`
+	PopulationRatio     float64                 `json:"population_ratio,omitempty"`
+	TimeDifferenceHours *float64                `json:"time_difference_hours,omitempty"`
+	Nearby              []compareNearbyResponse `json:"nearby"`
+}
+
+func newCompareResponse(cmp comparison, u distanceUnit) compareResponse {
+	resp := compareResponse{
+		A:               newCityResponse(cmp.A, unitKm),
+		B:               newCityResponse(cmp.B, unitKm),
+		Distance:        cmp.Distance,
+		DistanceMi:      u.miles(cmp.Distance),
+		Bearing:         cmp.Bearing,
+		Direction:       cmp.Direction,
+		PopulationRatio: cmp.PopulationRatio,
+		Nearby:          make([]compareNearbyResponse, 0, len(cmp.Nearby)),
+	}
+	if d := cmp.TimeDifference; d != nil {
+		hours := d.Hours()
+		resp.TimeDifferenceHours = &hours
+	}
+
+	for _, c := range cmp.Nearby {
+		resp.Nearby = append(resp.Nearby, compareNearbyResponse{
+			cityResponse: newCityResponse(c.City, u),
+			DistanceA:    c.DistanceA,
+			DistanceAMi:  u.miles(c.DistanceA),
+			DistanceB:    c.DistanceB,
+			DistanceBMi:  u.miles(c.DistanceB),
+		})
+	}
+
+	return resp
+}
+
+type ipLocationResponse struct {
+	IP        string  `json:"ip"`
+	City      string  `json:"city"`
+	Region    string  `json:"region,omitempty"`
+	Country   string  `json:"country"`
+	Iso2      string  `json:"iso2,omitempty"`
+	Lat       float64 `json:"lat"`
+	Lng       float64 `json:"lng"`
+	Zip       string  `json:"zip_code,omitempty"`
+	UTCOffset string  `json:"utc_offset,omitempty"`
+}
+
+func newIPLocationResponse(ip string, loc nearbycities.IPLocation) ipLocationResponse {
+	return ipLocationResponse{
+		IP:        ip,
+		City:      loc.City,
+		Region:    loc.Region,
+		Country:   loc.Country,
+		Iso2:      loc.Iso2,
+		Lat:       loc.Lat,
+		Lng:       loc.Lng,
+		Zip:       loc.Zip,
+		UTCOffset: loc.UTCOffset,
+	}
+}
+
+// continentOf returns the continent of the country, if it is known.
+func continentOf(iso2 string) string {
+	country, _ := nearbycities.LookupCountry(iso2)
+	return country.Continent
+}
+
+func writeJSON(w http.ResponseWriter, v any) error {
+	return writeJSONStatus(w, http.StatusOK, v)
+}
+
+func writeJSONStatus(w http.ResponseWriter, status int, v any) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "    ")
+	return enc.Encode(v)
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+
+	"github.com/quantonganh/nearby-cities/nearbycities"
+)
+
+type kml struct {
+	XMLName  xml.Name    `xml:"kml"`
+	Xmlns    string      `xml:"xmlns,attr"`
+	Document kmlDocument `xml:"Document"`
+}
+
+type kmlDocument struct {
+	Name       string         `xml:"name"`
+	Placemarks []kmlPlacemark `xml:"Placemark"`
+}
+
+type kmlPlacemark struct {
+	Name        string   `xml:"name"`
+	Description string   `xml:"description,omitempty"`
+	Point       kmlPoint `xml:"Point"`
+}
+
+type kmlPoint struct {
+	Coordinates string `xml:"coordinates"`
+}
+
+// writeKML writes the cities as KML placemarks.
+func writeKML(w http.ResponseWriter, cities []nearbycities.City) error {
+	doc := kml{
+		Xmlns: "http://www.opengis.net/kml/2.2",
+		Document: kmlDocument{
+			Name:       "Nearby cities",
+			Placemarks: make([]kmlPlacemark, 0, len(cities)),
+		},
+	}
+
+	for _, c := range cities {
+		doc.Document.Placemarks = append(doc.Document.Placemarks, kmlPlacemark{
+			Name:        c.City,
+			Description: fmt.Sprintf("%s, %s (%v km)", c.AdminName, c.Country, c.Distance),
+			Point: kmlPoint{
+				// KML coordinates are longitude first.
+				Coordinates: fmt.Sprintf("%v,%v", c.Lng, c.Lat),
+			},
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/vnd.google-earth.kml+xml")
+	w.Header().Set("Content-Disposition", `attachment; filename="nearby_cities.kml"`)
+
+	return writeXML(w, doc)
+}
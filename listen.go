@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+)
+
+// listen opens a TCP listener on each of addrs, and one on the unix socket
+// if it has a path, closing the ones already open if one fails, so that a
+// taken port stops the server on start.
+func listen(addrs []string, socket socketConfig) ([]net.Listener, error) {
+	var listeners []net.Listener
+	closeAll := func() {
+		for _, ln := range listeners {
+			ln.Close()
+		}
+	}
+
+	for _, addr := range addrs {
+		ln, err := net.Listen("tcp", addr)
+		if err != nil {
+			closeAll()
+			return nil, fmt.Errorf("error listening on %s: %w", addr, err)
+		}
+		listeners = append(listeners, ln)
+	}
+
+	if socket.Path != "" {
+		ln, err := listenUnix(socket)
+		if err != nil {
+			closeAll()
+			return nil, err
+		}
+		listeners = append(listeners, ln)
+	}
+
+	return listeners, nil
+}
+
+// listenUnix listens on the unix socket at the path of socket with its
+// permissions. A socket left behind by a server that did not stop cleanly is
+// removed first, but any other file at the path is an error.
+func listenUnix(socket socketConfig) (net.Listener, error) {
+	mode, err := strconv.ParseUint(socket.Mode, 8, 32)
+	if err != nil || mode > 0o777 {
+		return nil, fmt.Errorf("invalid socket mode: %s", socket.Mode)
+	}
+
+	if fi, err := os.Lstat(socket.Path); err == nil {
+		if fi.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("error listening on %s: not a socket", socket.Path)
+		}
+		if err := os.Remove(socket.Path); err != nil {
+			return nil, fmt.Errorf("error removing stale socket: %w", err)
+		}
+	}
+
+	ln, err := net.Listen("unix", socket.Path)
+	if err != nil {
+		return nil, fmt.Errorf("error listening on %s: %w", socket.Path, err)
+	}
+	if err := os.Chmod(socket.Path, os.FileMode(mode)); err != nil {
+		ln.Close()
+		return nil, fmt.Errorf("error setting the permissions of %s: %w", socket.Path, err)
+	}
+
+	return ln, nil
+}
+
+// serve serves server on every listener until it is shut down.
+func serve(server *http.Server, listeners []net.Listener) {
+	for _, ln := range listeners {
+		go func(ln net.Listener) {
+			fmt.Printf("Server is listening on %s...\n", ln.Addr())
+			if err := server.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Fatal(err)
+			}
+		}(ln)
+	}
+}
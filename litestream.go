@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// litestreamStopTimeout is how long litestream is given to ship the last
+// changes once asked to stop, after which it is killed.
+const litestreamStopTimeout = 10 * time.Second
+
+// restoreLitestream restores the SQLite database of cfg from its
+// Litestream replica when restoring is enabled and there is no database yet.
+// A replica holding nothing yet is not an error, leaving the database to be
+// downloaded or imported.
+func restoreLitestream(ctx context.Context, cfg config, logger zerolog.Logger) error {
+	ls := cfg.Litestream
+	if ls.ReplicaURL == "" || !ls.Restore {
+		return nil
+	}
+	if _, err := os.Stat(cfg.Database.Path); err == nil {
+		return nil
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	start := time.Now()
+	cmd := exec.CommandContext(ctx, ls.Binary, "restore", "-if-db-not-exists", "-if-replica-exists", "-o", cfg.Database.Path, ls.ReplicaURL)
+	cmd.Stdout, cmd.Stderr = os.Stderr, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("error restoring the database from %s: %w", ls.ReplicaURL, err)
+	}
+
+	if _, err := os.Stat(cfg.Database.Path); err == nil {
+		logger.Info().Str("replica", ls.ReplicaURL).Dur("duration", time.Since(start)).Msg("restored database from litestream replica")
+	}
+	return nil
+}
+
+// superviseLitestream runs litestream replicate on the SQLite database of
+// cfg until ctx is done, starting it again, after a growing delay, each time
+// it exits. Once ctx is done, litestream is interrupted to ship the last
+// changes and the returned channel is closed when it has exited.
+func superviseLitestream(ctx context.Context, cfg config, logger zerolog.Logger) <-chan struct{} {
+	done := make(chan struct{})
+	ls := cfg.Litestream
+
+	go func() {
+		defer close(done)
+
+		backoff := time.Second
+		for {
+			start := time.Now()
+			cmd := exec.CommandContext(ctx, ls.Binary, "replicate", cfg.Database.Path, ls.ReplicaURL)
+			cmd.Stdout, cmd.Stderr = os.Stderr, os.Stderr
+			cmd.Cancel = func() error {
+				return cmd.Process.Signal(os.Interrupt)
+			}
+			cmd.WaitDelay = litestreamStopTimeout
+
+			logger.Info().Str("replica", ls.ReplicaURL).Msg("starting litestream")
+			err := cmd.Run()
+			if ctx.Err() != nil {
+				return
+			}
+
+			// A replication that ran for a while starts over quickly.
+			if time.Since(start) > time.Minute {
+				backoff = time.Second
+			}
+			logger.Error().Err(err).Dur("retry_in", backoff).Msg("litestream exited")
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+			backoff = min(2*backoff, time.Minute)
+		}
+	}()
+
+	return done
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+	"golang.org/x/text/message/catalog"
+	"golang.org/x/text/number"
+)
+
+// The translations of the strings of the pages, one file per language named
+// by its tag, e.g. vi.json, each mapping an English string to its
+// translation.
+//
+//go:embed locales/*.json
+var localesFS embed.FS
+
+const (
+	langCookie    = "lang"
+	langCookieAge = 365 * 24 * time.Hour
+)
+
+var (
+	// languages are the languages of the pages, English first as the
+	// fallback.
+	translations, languages = loadTranslations()
+
+	languageMatcher = language.NewMatcher(languages)
+)
+
+// loadTranslations builds the catalog of the embedded translations and
+// returns it with their languages, after English, whose strings are their
+// own translation.
+func loadTranslations() (*catalog.Builder, []language.Tag) {
+	b := catalog.NewBuilder(catalog.Fallback(language.English))
+	tags := []language.Tag{language.English}
+
+	files, err := localesFS.ReadDir("locales")
+	if err != nil {
+		panic(err)
+	}
+	for _, f := range files {
+		tag := language.MustParse(strings.TrimSuffix(f.Name(), path.Ext(f.Name())))
+		tags = append(tags, tag)
+
+		data, err := localesFS.ReadFile("locales/" + f.Name())
+		if err != nil {
+			panic(err)
+		}
+		var messages map[string]string
+		if err := json.Unmarshal(data, &messages); err != nil {
+			panic(fmt.Errorf("error reading the %s translations: %w", tag, err))
+		}
+		for key, msg := range messages {
+			if err := b.SetString(tag, key, msg); err != nil {
+				panic(fmt.Errorf("error reading the %s translations: %w", tag, err))
+			}
+		}
+	}
+
+	return b, tags
+}
+
+// locale translates the strings of a page and formats its numbers in the
+// language of the visitor. The zero locale is English.
+type locale struct {
+	tag     language.Tag
+	printer *message.Printer
+}
+
+func newLocale(tag language.Tag) locale {
+	return locale{tag: tag, printer: message.NewPrinter(tag, message.Catalog(translations))}
+}
+
+// requestLocale returns the locale of the visitor: the language asked for by
+// the lang parameter, which is remembered in a cookie for the next pages, or
+// else the one remembered, or else the best match of the Accept-Language
+// header.
+func requestLocale(w http.ResponseWriter, r *http.Request) locale {
+	w.Header().Add("Vary", "Accept-Language")
+
+	var tags []language.Tag
+	if lang := r.FormValue("lang"); lang != "" {
+		if tag, err := language.Parse(lang); err == nil {
+			tags = []language.Tag{tag}
+			_, i, _ := languageMatcher.Match(tag)
+			http.SetCookie(w, &http.Cookie{
+				Name:     langCookie,
+				Value:    languages[i].String(),
+				Path:     "/",
+				MaxAge:   int(langCookieAge.Seconds()),
+				Secure:   r.TLS != nil,
+				SameSite: http.SameSiteLaxMode,
+			})
+		}
+	}
+	if c, err := r.Cookie(langCookie); err == nil && len(tags) == 0 {
+		if tag, err := language.Parse(c.Value); err == nil {
+			tags = []language.Tag{tag}
+		}
+	}
+	if len(tags) == 0 {
+		tags, _, _ = language.ParseAcceptLanguage(r.Header.Get("Accept-Language"))
+	}
+
+	// The matched tag may carry the region of the visitor, e.g. fr-u-rg-cazzzz,
+	// which the catalog does not know.
+	_, i, _ := languageMatcher.Match(tags...)
+	return newLocale(languages[i])
+}
+
+// Lang returns the tag of the language, e.g. "vi", for the lang attribute of
+// the page.
+func (l locale) Lang() string {
+	if l.printer == nil {
+		return language.English.String()
+	}
+	return l.tag.String()
+}
+
+// T returns the translation of the English string, formatted with the
+// arguments as by fmt.Sprintf.
+func (l locale) T(key string, args ...any) string {
+	if l.printer == nil {
+		return fmt.Sprintf(key, args...)
+	}
+	return l.printer.Sprintf(key, args...)
+}
+
+// capitalKinds are the names of the kinds of capital of the dataset.
+var capitalKinds = map[string]string{
+	"primary": "National capital",
+	"admin":   "Regional capital",
+	"minor":   "Local capital",
+}
+
+// Capital names the kind of capital, e.g. "National capital" for primary.
+func (l locale) Capital(kind string) string {
+	name, ok := capitalKinds[kind]
+	if !ok {
+		return kind
+	}
+	return l.T(name)
+}
+
+// Number formats the number, or the number pointed to, with the separators
+// of the language, e.g. 8 053 663 in French.
+func (l locale) Number(n any) string {
+	switch v := n.(type) {
+	case *int64:
+		if v == nil {
+			return ""
+		}
+		n = *v
+	case *int:
+		if v == nil {
+			return ""
+		}
+		n = *v
+	}
+
+	if l.printer == nil {
+		return fmt.Sprint(n)
+	}
+	return l.printer.Sprint(number.Decimal(n))
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/quantonganh/nearby-cities/nearbycities"
+	"github.com/rs/zerolog"
+)
+
+// runLocodes runs the locodes subcommand, which loads the UN/LOCODE CSV files
+// at the paths given in args, e.g. the three parts of a release, into the
+// configured database. The entries of the countries in the files
+// replace the imported ones.
+func runLocodes(cfg config, logger zerolog.Logger, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: %s locodes CodeListPart1.csv [CodeListPart2.csv ...]", os.Args[0])
+	}
+
+	var locodes []nearbycities.Locode
+	for _, path := range args {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+
+		l, err := nearbycities.ReadLocodes(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		locodes = append(locodes, l...)
+	}
+
+	store, err := openStorage(cfg, logger)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	if err := store.MigrateUp(ctx); err != nil {
+		return err
+	}
+
+	if err := store.ImportLocodes(ctx, locodes); err != nil {
+		return err
+	}
+
+	fmt.Printf("%d UN/LOCODE entries imported\n", len(locodes))
+	return nil
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// newLogger returns the logger writing at the level and in the format of cfg
+// to its file, or to the standard output if it has none.
+func newLogger(cfg logConfig) (zerolog.Logger, error) {
+	level, err := zerolog.ParseLevel(cfg.Level)
+	if err != nil {
+		return zerolog.Logger{}, fmt.Errorf("invalid log level: %w", err)
+	}
+
+	var w io.Writer = os.Stdout
+	if cfg.File != "" {
+		f, err := openRotatingFile(cfg.File, int64(cfg.MaxSize)<<20, cfg.MaxBackups)
+		if err != nil {
+			return zerolog.Logger{}, err
+		}
+		w = f
+	}
+
+	switch cfg.Format {
+	case "", "json":
+	case "pretty":
+		w = zerolog.ConsoleWriter{Out: w, NoColor: cfg.File != ""}
+	default:
+		return zerolog.Logger{}, fmt.Errorf("unknown log format: %s", cfg.Format)
+	}
+
+	return zerolog.New(w).Level(level).With().Timestamp().Logger(), nil
+}
+
+// logImportStep returns a function logging the steps of the dataset import
+// as they complete, the first import taking a while.
+func logImportStep(logger zerolog.Logger) func(step string, d time.Duration) {
+	return func(step string, d time.Duration) {
+		logger.Info().Str("step", step).Dur("duration", d).Msg("imported dataset step")
+	}
+}
+
+// isLogged tells whether the requests to path are written to the access log,
+// which they are not if it starts with one of the skipped prefixes.
+func isLogged(path string, skipped []string) bool {
+	for _, prefix := range skipped {
+		if strings.HasPrefix(path, prefix) {
+			return false
+		}
+	}
+	return true
+}
+
+// rotatingFile is a log file that is renamed with a .1 suffix once it
+// reaches its maximum size, the older ones being shifted to .2 and so on,
+// and the ones beyond the backups kept removed.
+type rotatingFile struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+
+	mu   sync.Mutex
+	f    *os.File
+	size int64
+}
+
+// openRotatingFile opens the log file at path to append to it, never
+// rotating it if maxSize is 0.
+func openRotatingFile(path string, maxSize int64, maxBackups int) (*rotatingFile, error) {
+	rf := &rotatingFile{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := rf.open(); err != nil {
+		return nil, err
+	}
+	return rf, nil
+}
+
+func (rf *rotatingFile) open() error {
+	f, err := os.OpenFile(rf.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("error opening log file: %w", err)
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("error opening log file: %w", err)
+	}
+
+	rf.f, rf.size = f, fi.Size()
+	return nil
+}
+
+func (rf *rotatingFile) Write(p []byte) (int, error) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	if rf.maxSize > 0 && rf.size > 0 && rf.size+int64(len(p)) > rf.maxSize {
+		if err := rf.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := rf.f.Write(p)
+	rf.size += int64(n)
+	return n, err
+}
+
+// rotate shifts the backups, renames the current file to the first one and
+// opens a new one.
+func (rf *rotatingFile) rotate() error {
+	if err := rf.f.Close(); err != nil {
+		return err
+	}
+
+	backup := func(i int) string {
+		return rf.path + "." + strconv.Itoa(i)
+	}
+	if rf.maxBackups <= 0 {
+		os.Remove(rf.path)
+	} else {
+		os.Remove(backup(rf.maxBackups))
+		for i := rf.maxBackups - 1; i >= 1; i-- {
+			os.Rename(backup(i), backup(i+1))
+		}
+		if err := os.Rename(rf.path, backup(1)); err != nil {
+			return fmt.Errorf("error rotating log file: %w", err)
+		}
+	}
+
+	return rf.open()
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"math"
+	"net"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/quantonganh/nearby-cities/nearbycities"
+	"github.com/rs/zerolog"
+)
+
+// runLookup runs the lookup subcommand, which prints the city matching the
+// query given in args, or the location of an IP address, and the cities
+// around it, searching the configured database as the server does. They are
+// printed as a table, or as the JSON or CSV of the API for scripts.
+func runLookup(cfg config, logger zerolog.Logger, args []string) error {
+	fs := flag.NewFlagSet("lookup", flag.ContinueOnError)
+	id := fs.String("id", "", "dataset ID of the city, to pick one of several namesakes")
+	radius := fs.Float64("radius", defaultRadius, "radius to search the cities within, in kilometers")
+	format := fs.String("format", "table", "output format: table, json or csv")
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 && *id == "" {
+		return fmt.Errorf("usage: %s lookup [-radius 50] [-format table|json|csv] 'Da Nang'|8.8.8.8", os.Args[0])
+	}
+	if math.IsNaN(*radius) || *radius <= 0 || *radius > maxRadius {
+		return fmt.Errorf("the radius must be a positive number of kilometers up to %.0f", maxRadius)
+	}
+	switch *format {
+	case "table", "json", "csv":
+	default:
+		return fmt.Errorf("unknown lookup format: %s", *format)
+	}
+	query := strings.Join(positional, " ")
+
+	store, err := openStorage(cfg, logger)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	if err := store.MigrateUp(ctx); err != nil {
+		return err
+	}
+	populated, err := store.Populated(ctx)
+	if err != nil {
+		return err
+	}
+	if !populated {
+		return fmt.Errorf("the database holds no dataset yet, run %s import first", os.Args[0])
+	}
+
+	svc, closeService, err := newService(cfg, store)
+	if err != nil {
+		return err
+	}
+	defer closeService()
+
+	var (
+		origin string
+		nearby []nearbycities.City
+	)
+	if ip := net.ParseIP(query); ip != nil && *id == "" {
+		var loc nearbycities.IPLocation
+		loc, nearby, err = svc.NearbyIP(ctx, ip.String(), *radius)
+		if errors.Is(err, nearbycities.ErrNotFound) {
+			return fmt.Errorf("no location is known for %s", ip)
+		}
+		if err != nil {
+			return err
+		}
+		origin = fmt.Sprintf("%s is in %s (%g, %g)", ip, placeName(loc.City, loc.Region, loc.Country), loc.Lat, loc.Lng)
+	} else {
+		var from nearbycities.City
+		from, nearby, err = searchCity(ctx, svc, query, *id, *radius)
+		var ambiguous *nearbycities.AmbiguousError
+		if errors.As(err, &ambiguous) {
+			// The namesakes go to the standard error, keeping the JSON and
+			// CSV output clean.
+			w := tabwriter.NewWriter(os.Stderr, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "ID\tCITY")
+			for _, c := range ambiguous.Cities {
+				fmt.Fprintf(w, "%s\t%s\n", c.ID, placeName(c.City, c.AdminName, c.Country))
+			}
+			w.Flush()
+			return fmt.Errorf("%d cities are named %s, pick one with -id or add its country", len(ambiguous.Cities), query)
+		}
+		if errors.Is(err, nearbycities.ErrNotFound) {
+			return fmt.Errorf("no city matches %s", query)
+		}
+		if err != nil {
+			return err
+		}
+		origin = fmt.Sprintf("%s (%g, %g)", placeName(from.City, from.AdminName, from.Country), from.Lat, from.Lng)
+	}
+
+	switch *format {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "    ")
+		return enc.Encode(apiVersions[len(apiVersions)-1].cities(nearby, unitKm))
+	case "csv":
+		return writeCitiesCSV(os.Stdout, nearby)
+	}
+
+	fmt.Println(origin)
+	if len(nearby) == 0 {
+		fmt.Printf("No other city within %g km.\n", *radius)
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "KM\tCITY\tREGION\tCOUNTRY\tLAT\tLNG")
+	for _, c := range nearby {
+		fmt.Fprintf(w, "%.1f\t%s\t%s\t%s\t%g\t%g\n", c.Distance, c.City, c.AdminName, c.Country, c.Lat, c.Lng)
+	}
+	return w.Flush()
+}
+
+// parseInterspersed parses the flags of fs among args, which the flag
+// package stops at the first argument that is not one, e.g. in
+// lookup 'Da Nang' -radius 50, and returns the other arguments.
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		if fs.NArg() == 0 {
+			return positional, nil
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
+
+// placeName joins the names of a place and the areas it is in, leaving out
+// the empty and repeated ones.
+func placeName(names ...string) string {
+	var parts []string
+	for _, name := range names {
+		if name != "" && (len(parts) == 0 || parts[len(parts)-1] != name) {
+			parts = append(parts, name)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
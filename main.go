@@ -1,39 +1,36 @@
 package main
 
 import (
-	"archive/zip"
 	"context"
-	"database/sql"
 	"embed"
+	"errors"
+	"flag"
 	"fmt"
 	"html/template"
-	"io"
 	"log"
-	"math"
-	"net"
 	"net/http"
+	"net/url"
 	"os"
-	"os/exec"
-	"os/signal"
-	"path/filepath"
-	"regexp"
-	"sort"
+	"strconv"
 	"strings"
-	"syscall"
 	"time"
 
-	_ "github.com/mattn/go-sqlite3"
-	"github.com/quantonganh/geohash"
 	"github.com/quantonganh/httperror"
+	"github.com/quantonganh/nearby-cities/nearbycities"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/hlog"
 )
 
-const (
-	ip2LocationFileName    = "IP2LOCATION-LITE-DB5.CSV"
-	ip2LocationZipFileName = ip2LocationFileName + ".zip"
-	dbPath                 = "./db/nearby_cities.db"
-)
+// maxDidYouMean bounds the names suggested for a search matching no city.
+const maxDidYouMean = 3
+
+// defaultRadius is the radius, in kilometers, of the nearby searches not
+// giving one, set from the configuration on start.
+var defaultRadius = 100.0
+
+// maxRadius bounds the radius, in kilometers, of the nearby searches: half
+// the circumference of the Earth, within which every city already is.
+const maxRadius = 20038.0
 
 //go:embed templates/*.html
 var htmlFS embed.FS
@@ -41,489 +38,579 @@ var htmlFS embed.FS
 //go:embed static
 var staticFS embed.FS
 
-//go:embed worldcities.csv
-var worldCitiesCSV string
-
 func main() {
-	if err := os.MkdirAll(filepath.Dir(dbPath), 0755); err != nil {
-		fmt.Printf("Error creating directories: %v\n", err)
-		return
+	args := os.Args[1:]
+	cmd := "serve"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		cmd, args = args[0], args[1:]
 	}
 
-	db, err := sql.Open("sqlite3", dbPath)
-	if err != nil {
-		log.Fatal(err)
+	// The server takes the settings as flags, while the other commands have
+	// flags of their own and read them from the configuration file given by
+	// NEARBY_CONFIG and the environment.
+	var settings []string
+	if cmd == "serve" {
+		settings, args = args, nil
 	}
-
-	if err := prepare(db); err != nil {
-		log.Fatal(err)
+	cfg, err := loadConfig(settings)
+	if errors.Is(err, flag.ErrHelp) {
+		return
 	}
-
-	zlog := zerolog.New(os.Stdout).With().
-		Timestamp().
-		Logger()
-
-	r := httperror.NewRouter()
-	r.Use(hlog.NewHandler(zlog))
-	r.Use(hlog.AccessHandler(func(r *http.Request, status, size int, duration time.Duration) {
-		if !strings.HasPrefix(r.URL.Path, "/static") {
-			hlog.FromRequest(r).Info().
-				Str("method", r.Method).
-				Stringer("url", r.URL).
-				Int("status", status).
-				Int("size", size).
-				Dur("duration", duration).
-				Msg("")
-		}
-	}))
-	r.Use(httperror.RealIPHandler("ip"))
-	r.Use(hlog.UserAgentHandler("user_agent"))
-	r.Use(hlog.RefererHandler("referer"))
-	r.Use(hlog.RequestIDHandler("req_id", "Request-Id"))
-	r.Add("/static/", func(w http.ResponseWriter, r *http.Request) error {
-		http.FileServer(http.FS(staticFS)).ServeHTTP(w, r)
-		return nil
-	})
-
-	tmpl, err := template.New("index.html").ParseFS(htmlFS, "templates/*.html")
 	if err != nil {
 		log.Fatal(err)
 	}
+	defaultRadius = cfg.Search.Radius
 
-	r.Add("/", indexHandler(db, tmpl))
-	r.Add("/search", searchHandler(db, tmpl))
-	server := httperror.NewServer(r.Mux, ":8080")
-
-	go func() {
-		fmt.Printf("Server is listening on port %s...\n", server.Addr)
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatal(err)
-		}
-	}()
-
-	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
-	<-c
-
-	fmt.Println("\nShutting down server...")
-	if err := server.Shutdown(context.Background()); err != nil {
+	logger, err := newLogger(cfg.Log)
+	if err != nil {
 		log.Fatal(err)
 	}
 
-	if err := db.Close(); err != nil {
+	switch cmd {
+	case "serve":
+		err = runServe(cfg, logger)
+	case "migrate":
+		err = runMigrate(cfg, logger, args)
+	case "update":
+		err = runUpdate(cfg, logger, args)
+	case "import":
+		err = runImport(cfg, logger, args)
+	case "postcodes":
+		err = runPostcodes(cfg, logger, args)
+	case "airports":
+		err = runAirports(cfg, logger, args)
+	case "locodes":
+		err = runLocodes(cfg, logger, args)
+	case "alias":
+		err = runAlias(cfg, logger, args)
+	case "enrich":
+		err = runEnrich(cfg, logger, args)
+	case "lookup":
+		err = runLookup(cfg, logger, args)
+	case "export":
+		err = runExport(cfg, logger, args)
+	case "backup":
+		err = runBackup(cfg, logger, args)
+	case "restore":
+		err = runRestore(cfg, logger, args)
+	default:
+		err = fmt.Errorf("unknown command: %s", cmd)
+	}
+	if err != nil && !errors.Is(err, flag.ErrHelp) {
 		log.Fatal(err)
 	}
-
-	fmt.Println("Server has stopped.")
 }
 
-func prepare(db *sql.DB) error {
-	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS migrations (name TEXT PRIMARY KEY);`); err != nil {
-		return fmt.Errorf("error creating migrations table: %w", err)
+// openStorage opens the PostgreSQL database when the database URL is a
+// postgres:// URL, the MySQL one when it is a mysql:// DSN, an in-memory
+// SQLite database when it is :memory:, and the SQLite database at the
+// database path otherwise. The lookups of the first two go to the read
+// replica of the database, if one is configured.
+func openStorage(cfg config, logger zerolog.Logger) (nearbycities.Storage, error) {
+	progress := logImportStep(logger)
+
+	dsn := cfg.Database.URL
+	ipDB := nearbycities.IP2LocationDB(cfg.IP2Location.DB)
+	switch ipDB {
+	case "", nearbycities.IP2LocationDB5, nearbycities.IP2LocationDB9, nearbycities.IP2LocationDB11:
+	default:
+		return nil, fmt.Errorf("unknown IP2Location database: %s", ipDB)
 	}
 
-	var migrationApplied bool
-	err := db.QueryRow(`
-		SELECT EXISTS (SELECT 1 from migrations WHERE name = 'cities_table')
-	`).Scan(&migrationApplied)
-	if err != nil {
-		return fmt.Errorf("error checking migration status: %w", err)
+	var relevanceOnly bool
+	switch ranking := cfg.Search.Ranking; ranking {
+	case "", "population":
+	case "relevance":
+		relevanceOnly = true
+	default:
+		return nil, fmt.Errorf("unknown search ranking: %s", ranking)
 	}
 
-	if !migrationApplied {
-		if err := downloadIP2LocationDB(); err != nil {
-			return err
+	readDSN := cfg.Database.ReadURL
+	if mysqlDSN, ok := strings.CutPrefix(dsn, "mysql://"); ok {
+		readMySQLDSN, ok := strings.CutPrefix(readDSN, "mysql://")
+		if readDSN != "" && !ok {
+			return nil, errors.New("the read replica of a MySQL database is a mysql:// DSN")
 		}
-
-		cmd := exec.Command("sqlite3", dbPath, "-cmd", fmt.Sprintf(".import --csv --skip 1 %s ip2location", ip2LocationFileName))
-		output, err := cmd.CombinedOutput()
+		store, err := nearbycities.OpenMySQLWithReplica(mysqlDSN, readMySQLDSN)
 		if err != nil {
-			return fmt.Errorf("error importing CSV data into ip2location table: %s: %w", string(output), err)
+			return nil, err
 		}
-		defer os.Remove(ip2LocationFileName)
+		store.Observe = observeQuery
+		store.ImportProgress = progress
+		store.IPDatabase = ipDB
+		store.DownloadDir = cfg.DataDir
+		store.RelevanceOnly = relevanceOnly
+		return store, nil
+	}
 
-		worldCitiesFile, err := os.CreateTemp("", "worldcities*.csv")
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		if readDSN != "" && !strings.HasPrefix(readDSN, "postgres://") && !strings.HasPrefix(readDSN, "postgresql://") {
+			return nil, errors.New("the read replica of a PostgreSQL database is a postgres:// URL")
+		}
+		store, err := nearbycities.OpenPostgresWithReplica(dsn, readDSN)
 		if err != nil {
-			return fmt.Errorf("error creating temp file: %w", err)
+			return nil, err
 		}
-		defer os.Remove(worldCitiesFile.Name())
+		store.Observe = observeQuery
+		store.ImportProgress = progress
+		store.IPDatabase = ipDB
+		store.DownloadDir = cfg.DataDir
+		store.RelevanceOnly = relevanceOnly
+		return store, nil
+	}
 
-		if _, err := worldCitiesFile.Write([]byte(worldCitiesCSV)); err != nil {
-			return fmt.Errorf("error writing the embedded CSV content: %w", err)
+	if readDSN != "" {
+		return nil, errors.New("read replicas are for the PostgreSQL and MySQL databases, not SQLite")
+	}
+	pragmas, err := sqlitePragmasFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Litestream.ReplicaURL != "" {
+		// Litestream ships the write-ahead log, and checkpoints it once it
+		// has, unless told otherwise.
+		if !strings.EqualFold(pragmas.JournalMode, "WAL") {
+			return nil, fmt.Errorf("litestream needs the WAL journal mode, not %s", pragmas.JournalMode)
 		}
-
-		_, err = db.Exec(`
-		CREATE TABLE IF NOT EXISTS ip2location (
-			start_ip TEXT,
-			end_ip TEXT,
-			iso2 TEXT,
-			country TEXT,
-			city TEXT,
-			region TEXT,
-			lat TEXT,
-			lng TEXT
-		);
-		`)
-		if err != nil {
-			return fmt.Errorf("error creating ip2location table: %w", err)
+		if os.Getenv("SQLITE_WAL_AUTOCHECKPOINT") == "" {
+			pragmas.WALAutocheckpoint = 0
 		}
+	}
+	open := func() (*nearbycities.SQLiteStore, error) {
+		return nearbycities.OpenWithPragmas(cfg.Database.Path, pragmas)
+	}
+	if dsn == ":memory:" {
+		open = nearbycities.OpenMemory
+	}
 
-		cmd = exec.Command("sqlite3", dbPath, "-cmd", ".mode csv", fmt.Sprintf(".import %s cities", worldCitiesFile.Name()))
-		output, err = cmd.CombinedOutput()
-		if err != nil {
-			return fmt.Errorf("error importing CSV data into cities table: %s: %w", string(output), err)
-		}
+	store, err := open()
+	if err != nil {
+		return nil, err
+	}
+	store.Observe = observeQuery
+	store.ImportProgress = progress
+	store.IPDatabase = ipDB
+	store.DownloadDir = cfg.DataDir
+	store.RelevanceOnly = relevanceOnly
+	return store, nil
+}
 
-		_, err = db.Exec(`
-		CREATE TABLE IF NOT EXISTS geospatial_index (
-			geohash TEXT,
-			city_id INTEGER UNIQUE,
-			FOREIGN KEY(city_id) REFERENCES cities(id)
-		)
-		`)
+// sqlitePragmasFromEnv overrides the default SQLite pragmas with
+// SQLITE_JOURNAL_MODE, SQLITE_SYNCHRONOUS, SQLITE_BUSY_TIMEOUT, a duration,
+// SQLITE_CACHE_SIZE and SQLITE_MMAP_SIZE, in bytes, and
+// SQLITE_WAL_AUTOCHECKPOINT, in pages.
+func sqlitePragmasFromEnv() (nearbycities.SQLitePragmas, error) {
+	pragmas := nearbycities.DefaultSQLitePragmas
+	if v := os.Getenv("SQLITE_JOURNAL_MODE"); v != "" {
+		pragmas.JournalMode = v
+	}
+	if v := os.Getenv("SQLITE_SYNCHRONOUS"); v != "" {
+		pragmas.Synchronous = v
+	}
+	if v := os.Getenv("SQLITE_BUSY_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
 		if err != nil {
-			return fmt.Errorf("error creating goepatial_index table: %w", err)
+			return pragmas, fmt.Errorf("invalid SQLITE_BUSY_TIMEOUT: %w", err)
 		}
-
-		_, err = db.Exec(`
-			CREATE VIRTUAL TABLE cities_fts USING fts5(
-				city,
-				city_ascii,
-				lat,
-				lng,
-				country,
-				iso2,
-				iso3,
-				admin_name,
-				capital,
-				population,
-				id,
-				content='cities',
-				tokenize='unicode61'
-			);
-		`)
-		if err != nil {
-			return fmt.Errorf("error creating cities_fts table: %w", err)
+		pragmas.BusyTimeout = d
+	}
+	for key, size := range map[string]*int64{
+		"SQLITE_CACHE_SIZE": &pragmas.CacheSize,
+		"SQLITE_MMAP_SIZE":  &pragmas.MmapSize,
+	} {
+		if v := os.Getenv(key); v != "" {
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				return pragmas, fmt.Errorf("invalid %s: %w", key, err)
+			}
+			*size = n
 		}
-
-		_, err = db.Exec(`
-			INSERT INTO cities_fts(city, city_ascii, lat, lng, country, iso2, iso3, admin_name, capital, population, id)
-			SELECT city, city_ascii, lat, lng, country, iso2, iso3, admin_name, capital, population, id FROM cities;
-		`)
+	}
+	if v := os.Getenv("SQLITE_WAL_AUTOCHECKPOINT"); v != "" {
+		n, err := strconv.Atoi(v)
 		if err != nil {
-			return fmt.Errorf("error populating the virtual table cities_fts: %w", err)
+			return pragmas, fmt.Errorf("invalid SQLITE_WAL_AUTOCHECKPOINT: %w", err)
 		}
+		pragmas.WALAutocheckpoint = n
+	}
 
-		tx, err := db.Begin()
-		if err != nil {
-			return fmt.Errorf("error starting transaction: %w", err)
-		}
-		defer tx.Rollback()
+	return pragmas, nil
+}
 
-		rows, err := tx.Query(`
-		SELECT id, lat, lng FROM cities
-		`)
-		if err != nil {
-			return fmt.Errorf("error selecting lat, lng from cities table: %w", err)
+// buildSpatialIndex loads the cities into the in-memory index named by the
+// spatial index of cfg, kdtree, s2 or h3. It returns nil when there is none,
+// leaving nearby queries to the storage.
+func buildSpatialIndex(cfg searchConfig, store nearbycities.Storage) (nearbycities.SpatialIndex, error) {
+	switch kind := cfg.SpatialIndex; kind {
+	case "":
+		return nil, nil
+	case "kdtree":
+		return nearbycities.BuildKDTree(context.Background(), store)
+	case "s2":
+		return nearbycities.BuildS2Index(context.Background(), store)
+	case "h3":
+		return nearbycities.BuildH3Index(context.Background(), store, cfg.H3Resolution)
+	default:
+		return nil, fmt.Errorf("unknown spatial index: %s", kind)
+	}
+}
+
+// fallbackGeocoders returns the fallback geocoders of cfg, which are asked in
+// order for the places the dataset does not know.
+func fallbackGeocoders(cfg geocodersConfig) ([]nearbycities.Geocoder, error) {
+	var geocoders []nearbycities.Geocoder
+	for _, name := range cfg.Fallbacks {
+		switch name {
+		case "pelias":
+			geocoders = append(geocoders, &nearbycities.PeliasGeocoder{
+				BaseURL: cfg.Pelias.URL,
+				APIKey:  cfg.Pelias.APIKey,
+			})
+		case "nominatim":
+			geocoders = append(geocoders, &nearbycities.NominatimGeocoder{
+				BaseURL:   cfg.Nominatim.URL,
+				UserAgent: cfg.Nominatim.UserAgent,
+			})
+		case "google":
+			geocoders = append(geocoders, &nearbycities.GoogleGeocoder{
+				APIKey: cfg.Google.APIKey,
+			})
+		default:
+			return nil, fmt.Errorf("unknown geocoder: %s", name)
 		}
-		defer rows.Close()
-
-		for rows.Next() {
-			var (
-				id       int
-				lat, lng float64
-			)
-			if err := rows.Scan(&id, &lat, &lng); err != nil {
-				return fmt.Errorf("error scanning: %w", err)
-			}
+	}
 
-			gh := geohash.Encode(lat, lng)
+	return geocoders, nil
+}
 
-			_, err = tx.Exec(`
-			INSERT INTO geospatial_index (geohash, city_id)
-			VALUES (?, ?)
-		`, gh, id)
-			if err != nil {
-				return fmt.Errorf("error inserting into geospatial_index: %w", err)
-			}
-		}
+type PageData struct {
+	// locale is the language of the page and theme its colors, set when it
+	// is rendered.
+	locale
+	theme
 
-		if err := rows.Err(); err != nil {
-			return fmt.Errorf("error during iteration: %w", err)
-		}
+	FromCity string
+	CityID   string
 
-		_, err = tx.Exec("INSERT INTO migrations (name) VALUES ('cities_table')")
-		if err != nil {
-			return fmt.Errorf("error marking migration as applied: %w", err)
-		}
+	// Coordinates are the ones searched around instead of a city, e.g. the
+	// location of the browser.
+	Coordinates *coordinates
 
-		if err := tx.Commit(); err != nil {
-			return fmt.Errorf("error committing transaction: %w", err)
-		}
-	}
+	// Radius is the radius of the search in kilometers, 0 for the default
+	// one.
+	Radius float64
 
-	return nil
+	NearbyCities []nearbycities.City
+
+	// Offset is the first of the NearbyCities the results table shows,
+	// resultsPerPage at a time, the next ones being loaded on demand.
+	Offset int
+
+	Namesakes   []nearbycities.City
+	Message     string
+	Suggestions []string
+
+	// Unit is the unit the distances are shown in, kilometers if empty.
+	Unit distanceUnit
+
+	// RecentSearches are the last searches of the visitor, shown on the
+	// index page to repeat them.
+	RecentSearches []string
 }
 
-func downloadIP2LocationDB() error {
-	token := os.Getenv("IP2LOCATION_TOKEN")
-	resp, err := http.Get(fmt.Sprintf("https://www.ip2location.com/download/?token=%s&file=DB5LITE", token))
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
+type coordinates struct {
+	Lat, Lng float64
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+// SearchPath returns the path of the search, /nearby around coordinates and
+// /search around a city.
+func (d PageData) SearchPath() string {
+	if d.Coordinates != nil {
+		return "/nearby"
 	}
+	return "/search"
+}
 
-	file, err := os.Create(ip2LocationZipFileName)
-	if err != nil {
-		return fmt.Errorf("error creating ip2Location file: %w", err)
-	}
-	defer file.Close()
+// SearchQuery returns the query string of the search, to link to its results
+// in the other formats.
+func (d PageData) SearchQuery() template.URL {
+	return template.URL(d.query(d.Unit).Encode())
+}
 
-	_, err = io.Copy(file, resp.Body)
-	if err != nil {
-		return err
+// query returns the parameters of the search, its radius being written in
+// the unit along with unit=mi, so that the URL tells the whole search
+// whatever the unit the visitor prefers.
+func (d PageData) query(u distanceUnit) url.Values {
+	v := url.Values{}
+	switch {
+	case d.Coordinates != nil:
+		v.Set("lat", strconv.FormatFloat(d.Coordinates.Lat, 'f', -1, 64))
+		v.Set("lng", strconv.FormatFloat(d.Coordinates.Lng, 'f', -1, 64))
+	case d.CityID != "":
+		v.Set("city_id", d.CityID)
+	default:
+		v.Set("city", d.FromCity)
 	}
-
-	r, err := zip.OpenReader(ip2LocationZipFileName)
-	if err != nil {
-		return err
+	if d.Radius > 0 {
+		v.Set("radius", strconv.FormatFloat(u.fromKm(d.Radius), 'f', -1, 64))
+	}
+	if u == unitMi {
+		v.Set("unit", string(u))
 	}
-	defer r.Close()
 
-	for _, file := range r.File {
-		if file.Name != ip2LocationFileName {
-			continue
-		}
+	return v
+}
 
-		outFile, err := os.Create(ip2LocationFileName)
-		if err != nil {
-			return err
-		}
-		defer outFile.Close()
+// SearchURL returns the URL of the search with the parameter set to the
+// value instead of the city, e.g. to pick one of the namesakes, keeping the
+// radius.
+func (d PageData) SearchURL(key, value string) template.URL {
+	v := d.query(d.Unit)
+	v.Del("city")
+	v.Del("city_id")
+	v.Set(key, value)
+	return template.URL("/search?" + v.Encode())
+}
 
-		rc, err := file.Open()
-		if err != nil {
-			return err
-		}
-		defer rc.Close()
+// RadiusValue returns the radius of the search in the unit of the page, for
+// the search form.
+func (d PageData) RadiusValue() float64 {
+	return d.Unit.fromKm(d.Radius)
+}
 
-		_, err = io.Copy(outFile, rc)
-		if err != nil {
-			return err
-		}
-	}
+// DefaultRadius returns the radius of the searches not giving one in the
+// unit of the page.
+func (d PageData) DefaultRadius() float64 {
+	return d.Unit.fromKm(defaultRadius)
+}
 
-	if err := os.Remove(ip2LocationZipFileName); err != nil {
-		return err
+// Distance writes the kilometers in the unit and the language of the page,
+// e.g. "62.14 mi".
+func (d PageData) Distance(km float64) string {
+	u := d.Unit
+	if u == "" {
+		u = unitKm
 	}
+	return d.Number(u.fromKm(km)) + " " + string(u)
+}
 
-	return nil
+// UnitURL returns the URL of the results with the distances in the unit.
+func (d PageData) UnitURL(unit string) template.URL {
+	v := d.query(distanceUnit(unit))
+	v.Set("unit", unit)
+	return template.URL(d.SearchPath() + "?" + v.Encode())
 }
 
-type IP2LocationData struct {
-	StartIP uint32
-	EndIP   uint32
-	Country string
-	Region  string
-	City    string
-	Lat     float64
-	Lng     float64
+// Rows returns the nearby cities the results table shows, from the offset
+// on.
+func (d PageData) Rows() []nearbycities.City {
+	start := min(d.Offset, len(d.NearbyCities))
+	return d.NearbyCities[start:min(start+resultsPerPage, len(d.NearbyCities))]
 }
 
-type city struct {
-	City       string
-	CityAscii  string
-	Lat        float64
-	Lng        float64
-	Country    string
-	Iso2       string
-	Iso3       string
-	AdminName  string
-	Capital    string
-	Population string
-	ID         string
-	Geohash    string
-	Distance   float64
+// MoreRows returns how many nearby cities are left after the rows.
+func (d PageData) MoreRows() int {
+	return max(len(d.NearbyCities)-d.Offset-resultsPerPage, 0)
 }
 
-type PageData struct {
-	FromCity     string
-	Radius       string
-	NearbyCities []city
-	Message      string
+// MoreURL returns the URL of the rows after these ones.
+func (d PageData) MoreURL() template.URL {
+	v := d.query(d.Unit)
+	v.Set("offset", strconv.Itoa(d.Offset+resultsPerPage))
+	return template.URL(d.SearchPath() + "?" + v.Encode())
 }
 
-func indexHandler(db *sql.DB, tmpl *template.Template) httperror.Handler {
+func indexHandler(svc *nearbycities.Service, tmpl *page, sess *sessions) httperror.Handler {
 	return func(w http.ResponseWriter, r *http.Request) error {
-		ip, err := httperror.GetIP(r)
+		unit, err := preferredUnit(w, r)
 		if err != nil {
-			return tmpl.ExecuteTemplate(w, "base", PageData{})
+			return renderError(w, r, tmpl, http.StatusBadRequest, "unit must be km or mi")
 		}
+		data := PageData{RecentSearches: sess.recent(r), Unit: unit}
 
-		if isPrivateIP(net.ParseIP(ip)) {
-			return tmpl.ExecuteTemplate(w, "base", PageData{})
+		ip, err := httperror.GetIP(r)
+		if err != nil {
+			return render(w, r, tmpl, data)
 		}
 
-		ipInteger, err := ipToInteger(ip)
+		loc, cities, err := svc.NearbyIP(r.Context(), ip, defaultRadius)
 		if err != nil {
-			return tmpl.ExecuteTemplate(w, "base", PageData{})
+			return render(w, r, tmpl, data)
 		}
 
-		row := db.QueryRow(`
-			SELECT start_ip, end_ip, country, region, city, lat, lng FROM ip2location WHERE ? BETWEEN start_ip AND end_ip ORDER BY end_ip LIMIT 1
-			`, ipInteger)
-		var ip2Loc IP2LocationData
-		if err = row.Scan(&ip2Loc.StartIP, &ip2Loc.EndIP, &ip2Loc.Country, &ip2Loc.Region, &ip2Loc.City, &ip2Loc.Lat, &ip2Loc.Lng); err != nil {
-			return tmpl.ExecuteTemplate(w, "base", PageData{})
+		data.FromCity = fmt.Sprintf("%s, %s", loc.City, loc.Country)
+		data.NearbyCities = cities
+
+		return render(w, r, tmpl, data)
+	}
+}
+
+// searchHandler serves /search?city=Hanoi&radius=100, the whole search being
+// told by the URL so that it can be bookmarked and shared. A search posted
+// as a form is redirected to its URL.
+func searchHandler(svc *nearbycities.Service, tmpl *page, sess *sessions) httperror.Handler {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		if r.Method == http.MethodPost {
+			return redirectSearch(w, r)
 		}
 
-		cities, err := findNearbyCitiesByLatLng(db, ip2Loc.Lat, ip2Loc.Lng)
+		unit, err := preferredUnit(w, r)
 		if err != nil {
-			return tmpl.ExecuteTemplate(w, "base", PageData{})
+			return renderError(w, r, tmpl, http.StatusBadRequest, "unit must be km or mi")
 		}
 
-		data := PageData{
-			FromCity:     fmt.Sprintf("%s, %s", ip2Loc.City, ip2Loc.Country),
-			NearbyCities: cities,
+		radius, err := pageRadius(r)
+		if err != nil {
+			return renderError(w, r, tmpl, http.StatusBadRequest, err.Error())
 		}
 
-		return tmpl.ExecuteTemplate(w, "base", data)
-	}
-}
-
-func isPrivateIP(ip net.IP) bool {
-	privateIPv4Ranges := []struct {
-		start net.IP
-		end   net.IP
-	}{
-		{
-			net.ParseIP("10.0.0.0"),
-			net.ParseIP("10.255.255.255"),
-		},
-		{
-			net.ParseIP("172.16.0.0"),
-			net.ParseIP("172.31.255.255"),
-		},
-		{
-			net.ParseIP("192.168.0.0"),
-			net.ParseIP("192.168.255.255"),
-		},
-	}
-
-	for _, r := range privateIPv4Ranges {
-		if bytesWithinRange(ip.To4(), r.start.To4(), r.end.To4()) {
-			return true
+		offset, err := parseCount(r, "offset", 0)
+		if err != nil {
+			return renderError(w, r, tmpl, http.StatusBadRequest, err.Error())
 		}
-	}
 
-	return false
-}
+		fromCity, cityID := r.FormValue("city"), r.FormValue("city_id")
+		data := PageData{
+			FromCity: fromCity,
+			CityID:   cityID,
+			Offset:   offset,
+			Unit:     unit,
+		}
+		if radius != defaultRadius {
+			data.Radius = radius
+		}
 
-func bytesWithinRange(b, start, end []byte) bool {
-	for i := 0; i < len(b); i++ {
-		if b[i] < start[i] || b[i] > end[i] {
-			return false
+		from, nearbyCities, err := searchCity(r.Context(), svc, fromCity, cityID, radius)
+		if err != nil {
+			var ambiguous *nearbycities.AmbiguousError
+			if errors.As(err, &ambiguous) {
+				return renderNamesakes(w, r, tmpl, data, ambiguous)
+			}
+			if errors.Is(err, nearbycities.ErrNotFound) {
+				return renderNoMatch(w, r, tmpl, data, svc.DidYouMean(fromCity, maxDidYouMean))
+			} else {
+				hlog.FromRequest(r).Err(err).Msg("")
+				return renderError(w, r, tmpl, http.StatusInternalServerError, "Oops! Something went wrong. Please try again later.")
+			}
 		}
-	}
-	return true
-}
 
-func ipToInteger(ipAddr string) (uint32, error) {
-	parsedIP := net.ParseIP(ipAddr)
-	if parsedIP == nil {
-		return 0, fmt.Errorf("invalid IP address: %s", ipAddr)
-	}
+		data.NearbyCities = nearbyCities
+		if cityID != "" {
+			data.FromCity = fmt.Sprintf("%s, %s, %s", from.City, from.AdminName, from.Country)
+		}
+		if offset == 0 {
+			sess.remember(w, r, data.FromCity)
+		}
 
-	ipBytes := parsedIP.To4()
-	if ipBytes == nil {
-		return 0, fmt.Errorf("not an IPv4 address: %s", ipAddr)
+		return render(w, r, tmpl, data)
 	}
-
-	ipInteger := uint32(ipBytes[0])<<24 | uint32(ipBytes[1])<<16 | uint32(ipBytes[2])<<8 | uint32(ipBytes[3])
-
-	return ipInteger, nil
 }
 
-func searchHandler(db *sql.DB, tmpl *template.Template) httperror.Handler {
+// nearbyHandler serves /nearby?lat=21.0285&lng=105.8542, the cities around
+// the coordinates, e.g. the ones the browser located the visitor at, which
+// are closer than the location of their IP address behind a VPN or a
+// carrier-grade NAT.
+func nearbyHandler(svc *nearbycities.Service, tmpl *page) httperror.Handler {
 	return func(w http.ResponseWriter, r *http.Request) error {
-		fromCity := r.FormValue("city")
-		nearbyCities, err := findNearbyCities(db, fromCity)
+		unit, err := preferredUnit(w, r)
 		if err != nil {
-			if err == sql.ErrNoRows {
-				data := PageData{
-					Message: "No matching city found.",
-				}
+			return renderError(w, r, tmpl, http.StatusBadRequest, "unit must be km or mi")
+		}
 
-				return tmpl.ExecuteTemplate(w, "base", data)
-			} else {
-				hlog.FromRequest(r).Err(err).Msg("")
-				data := PageData{
-					Message: "Oops! Something went wrong. Please try again later.",
-				}
+		radius, err := pageRadius(r)
+		if err != nil {
+			return renderError(w, r, tmpl, http.StatusBadRequest, err.Error())
+		}
 
-				return tmpl.ExecuteTemplate(w, "base", data)
-			}
+		at, err := parseCoordinates(r)
+		if err != nil {
+			return renderError(w, r, tmpl, http.StatusBadRequest, err.Error())
+		}
+
+		offset, err := parseCount(r, "offset", 0)
+		if err != nil {
+			return renderError(w, r, tmpl, http.StatusBadRequest, err.Error())
+		}
+
+		cities, err := svc.NearbyLatLng(r.Context(), at.Lat, at.Lng, radius)
+		if err != nil {
+			hlog.FromRequest(r).Err(err).Msg("")
+			return renderError(w, r, tmpl, http.StatusInternalServerError, "Oops! Something went wrong. Please try again later.")
 		}
 
 		data := PageData{
-			FromCity:     fromCity,
-			NearbyCities: nearbyCities,
+			Coordinates:  &at,
+			NearbyCities: cities,
+			Offset:       offset,
+			Unit:         unit,
+			Message:      "No city found around your location.",
+		}
+		if radius != defaultRadius {
+			data.Radius = radius
 		}
 
-		return tmpl.ExecuteTemplate(w, "base", data)
+		return render(w, r, tmpl, data)
 	}
 }
 
-func findNearbyCities(db *sql.DB, fromCity string) ([]city, error) {
-	normalizedCity := normalizeQuery(fromCity)
-	row := db.QueryRow(`
-			SELECT city, lat, lng, country FROM cities_fts WHERE cities_fts MATCH ? 
-			`, normalizedCity)
-	var c city
-	err := row.Scan(&c.City, &c.Lat, &c.Lng, &c.Country)
+// parseCoordinates returns the coordinates of the lat and lng parameters.
+func parseCoordinates(r *http.Request) (coordinates, error) {
+	lat, err := parseCoordinate(r, "lat", -90, 90)
 	if err != nil {
-		return nil, err
+		return coordinates{}, err
 	}
 
-	return findNearbyCitiesByLatLng(db, c.Lat, c.Lng)
-}
-
-func findNearbyCitiesByLatLng(db *sql.DB, lat, lng float64) ([]city, error) {
-	hash := geohash.Encode(lat, lng)
-	length := geohash.EstimateLengthRequired(100)
-	rows, err := db.Query(`
-			SELECT c.city, c.lat, c.lng, c.admin_name, c.country, g.geohash
-			FROM cities c JOIN geospatial_index g ON g.city_id = c.id
-			WHERE g.geohash LIKE ?;
-		`, fmt.Sprintf("%s%%", hash[:length]))
+	lng, err := parseCoordinate(r, "lng", -180, 180)
 	if err != nil {
-		return nil, err
+		return coordinates{}, err
 	}
 
-	cities := make([]city, 0)
-	for rows.Next() {
-		var toCity city
-		if err := rows.Scan(&toCity.City, &toCity.Lat, &toCity.Lng, &toCity.AdminName, &toCity.Country, &toCity.Geohash); err != nil {
-			return nil, err
-		}
+	return coordinates{Lat: lat, Lng: lng}, nil
+}
 
-		distance := geohash.Distance(lat, lng, toCity.Lat, toCity.Lng)
-		toCity.Distance = math.Round(distance*100) / 100
-		cities = append(cities, toCity)
+// embedHandler serves /embed, the search page without its footer to embed
+// in an iframe of another site. Like the rest of the pages, it searches
+// around the city of city or city_id, or around lat and lng, within radius,
+// or else around the location of the IP address of the visitor.
+func embedHandler(svc *nearbycities.Service, tmpl *page, sess *sessions) httperror.Handler {
+	index, search, nearby := indexHandler(svc, tmpl, sess), searchHandler(svc, tmpl, sess), nearbyHandler(svc, tmpl)
+	return func(w http.ResponseWriter, r *http.Request) error {
+		switch {
+		case r.FormValue("city") != "" || r.FormValue("city_id") != "":
+			return search(w, r)
+		case r.FormValue("lat") != "" || r.FormValue("lng") != "":
+			return nearby(w, r)
+		default:
+			return index(w, r)
+		}
 	}
+}
 
-	sort.Slice(cities, func(i, j int) bool {
-		return cities[i].Distance < cities[j].Distance
-	})
-
-	return cities, nil
+// pageRadius returns the radius of a search of the pages in kilometers: the
+// radius parameter, in miles with unit=mi, or the default radius. Unlike the
+// distances shown, it does not follow the unit the visitor prefers, so that
+// the URL means the same search to everyone.
+func pageRadius(r *http.Request) (float64, error) {
+	unit, err := parseUnit(r)
+	if err != nil {
+		return 0, err
+	}
+	return parseRadius(r, unit)
 }
 
-func normalizeQuery(query string) string {
-	re := regexp.MustCompile(`[\p{P}]`)
-	return re.ReplaceAllString(query, "")
+// redirectSearch redirects a search posted as a form to its URL.
+func redirectSearch(w http.ResponseWriter, r *http.Request) error {
+	if err := r.ParseForm(); err != nil {
+		return httperror.New(http.StatusBadRequest, err.Error())
+	}
+
+	v := url.Values{}
+	for _, key := range []string{"city", "city_id", "radius", "unit"} {
+		if value := r.PostForm.Get(key); value != "" {
+			v.Set(key, value)
+		}
+	}
+	http.Redirect(w, r, "/search?"+v.Encode(), http.StatusSeeOther)
+	return nil
 }
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/quantonganh/nearby-cities/nearbycities"
+)
+
+var (
+	httpRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "nearby_cities_http_requests_total",
+		Help: "Number of HTTP requests by route, method and status code.",
+	}, []string{"route", "method", "code"})
+
+	httpRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "nearby_cities_http_request_duration_seconds",
+		Help:    "HTTP request latencies by route.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route"})
+
+	dbQueryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "nearby_cities_db_query_duration_seconds",
+		Help:    "SQLite query latencies by query name.",
+		Buckets: []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+	}, []string{"query"})
+)
+
+// observeQuery records how long the named query took.
+func observeQuery(name string, d time.Duration) {
+	dbQueryDuration.WithLabelValues(name).Observe(d.Seconds())
+}
+
+// datasetCollector reports the number of rows of the dataset tables. They
+// are counted once the dataset is imported or refreshed rather than at
+// scrape time, since counting the IP ranges takes a while.
+type datasetCollector struct {
+	store nearbycities.Storage
+	desc  *prometheus.Desc
+
+	mu     sync.RWMutex
+	counts map[string]int64
+}
+
+func newDatasetCollector(store nearbycities.Storage) *datasetCollector {
+	return &datasetCollector{
+		store: store,
+		desc: prometheus.NewDesc(
+			"nearby_cities_dataset_rows",
+			"Number of rows in the dataset tables.",
+			[]string{"table"}, nil,
+		),
+	}
+}
+
+func (c *datasetCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+// refresh counts the rows of the dataset tables again.
+func (c *datasetCollector) refresh(ctx context.Context) error {
+	counts, err := c.store.Counts(ctx)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.counts = counts
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *datasetCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for table, n := range c.counts {
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(n), table)
+	}
+}
+
+// cacheCollector reports the use of the result caches of the service at
+// scrape time, if it has any.
+type cacheCollector struct {
+	svc       *nearbycities.Service
+	entries   *prometheus.Desc
+	hits      *prometheus.Desc
+	misses    *prometheus.Desc
+	evictions *prometheus.Desc
+}
+
+func newCacheCollector(svc *nearbycities.Service) *cacheCollector {
+	return &cacheCollector{
+		svc:       svc,
+		entries:   prometheus.NewDesc("nearby_cities_cache_entries", "Number of results held by the cache.", []string{"cache"}, nil),
+		hits:      prometheus.NewDesc("nearby_cities_cache_hits_total", "Number of lookups answered by the cache.", []string{"cache"}, nil),
+		misses:    prometheus.NewDesc("nearby_cities_cache_misses_total", "Number of lookups the cache could not answer.", []string{"cache"}, nil),
+		evictions: prometheus.NewDesc("nearby_cities_cache_evictions_total", "Number of results evicted to make room for newer ones.", []string{"cache"}, nil),
+	}
+}
+
+func (c *cacheCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.entries
+	ch <- c.hits
+	ch <- c.misses
+	ch <- c.evictions
+}
+
+func (c *cacheCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, stats := range c.svc.CacheStats() {
+		ch <- prometheus.MustNewConstMetric(c.entries, prometheus.GaugeValue, float64(stats.Entries), stats.Name)
+		ch <- prometheus.MustNewConstMetric(c.hits, prometheus.CounterValue, float64(stats.Hits), stats.Name)
+		ch <- prometheus.MustNewConstMetric(c.misses, prometheus.CounterValue, float64(stats.Misses), stats.Name)
+		ch <- prometheus.MustNewConstMetric(c.evictions, prometheus.CounterValue, float64(stats.Evictions), stats.Name)
+	}
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (rec *statusRecorder) WriteHeader(status int) {
+	rec.status = status
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// Hijack lets websocket connections be upgraded through the recorder. The
+// access log only passes Hijack on to a writer that also has Flush, ReadFrom
+// and CloseNotify, which the recorder therefore has too.
+func (rec *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	rec.status = http.StatusSwitchingProtocols
+	return http.NewResponseController(rec.ResponseWriter).Hijack()
+}
+
+func (rec *statusRecorder) Flush() {
+	http.NewResponseController(rec.ResponseWriter).Flush()
+}
+
+func (rec *statusRecorder) ReadFrom(src io.Reader) (int64, error) {
+	return io.Copy(rec.ResponseWriter, src)
+}
+
+// CloseNotify is deprecated, but asked for by the access log.
+func (rec *statusRecorder) CloseNotify() <-chan bool {
+	if cn, ok := rec.ResponseWriter.(http.CloseNotifier); ok {
+		return cn.CloseNotify()
+	}
+	return make(chan bool)
+}
+
+// metricsHandler counts and times the requests served by mux, labelled by
+// the pattern they were routed to rather than the raw path.
+func metricsHandler(mux *http.ServeMux) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, route := mux.Handler(r)
+			if route == "" {
+				route = "unmatched"
+			}
+
+			start := time.Now()
+			rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(rec, r)
+
+			httpRequestDuration.WithLabelValues(route).Observe(time.Since(start).Seconds())
+			httpRequestsTotal.WithLabelValues(route, r.Method, strconv.Itoa(rec.status)).Inc()
+		})
+	}
+}
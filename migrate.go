@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/quantonganh/nearby-cities/nearbycities"
+	"github.com/rs/zerolog"
+)
+
+// runMigrate runs the migrate subcommand against the configured
+// database: status lists the schema migrations, up applies the pending
+// ones and down reverts the last one.
+func runMigrate(cfg config, logger zerolog.Logger, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: %s migrate status|up|down", os.Args[0])
+	}
+
+	store, err := openStorage(cfg, logger)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	switch args[0] {
+	case "status":
+		return printMigrations(ctx, store)
+	case "up":
+		if err := store.MigrateUp(ctx); err != nil {
+			return err
+		}
+	case "down":
+		if err := store.MigrateDown(ctx); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown migrate command: %s", args[0])
+	}
+
+	return printMigrations(ctx, store)
+}
+
+func printMigrations(ctx context.Context, store nearbycities.Storage) error {
+	migrations, err := store.Migrations(ctx)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+	for _, m := range migrations {
+		appliedAt := "pending"
+		if m.Applied() {
+			appliedAt = m.AppliedAt.Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%04d\t%s\t%s\n", m.Version, m.Name, appliedAt)
+	}
+
+	return w.Flush()
+}
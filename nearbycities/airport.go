@@ -0,0 +1,162 @@
+package nearbycities
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Airport is an airport of the OurAirports dataset. Ident is its ICAO code,
+// or the local one if it has none, and IATA is empty for the airports
+// without one. Type is large_airport, medium_airport or small_airport.
+// Elevation is in meters, nil if unknown. Scheduled reports whether the
+// airport has scheduled airline service. Distance is only set on airports
+// returned by a nearby search; it is in kilometers.
+type Airport struct {
+	Ident        string
+	IATA         string
+	Name         string
+	Type         string
+	Municipality string
+	Iso2         string
+	Lat          float64
+	Lng          float64
+	Elevation    *int
+	Scheduled    bool
+	Distance     float64
+}
+
+// City returns the location of the airport, named after it, so that the
+// cities around it can be searched for.
+func (a Airport) City() City {
+	c := City{
+		City: a.Name,
+		Lat:  a.Lat,
+		Lng:  a.Lng,
+		Iso2: a.Iso2,
+	}
+	if country, ok := LookupCountry(a.Iso2); ok {
+		c.Country = country.Name
+		c.Iso3 = country.Iso3
+	}
+
+	return c
+}
+
+// AirportGeocoder returns the Geocoder resolving the IATA and ICAO codes of
+// the airports imported into store, e.g. SGN or VVTS, to their location. A
+// Service asks it after the StorageGeocoder, so that a city bearing the code
+// as its name wins.
+func AirportGeocoder(store Storage) Geocoder {
+	return GeocoderFunc(func(ctx context.Context, query string) (City, error) {
+		code := strings.ToUpper(strings.TrimSpace(query))
+		if !isAirportCode(code) {
+			return City{}, ErrNotFound
+		}
+
+		a, err := store.AirportByCode(ctx, code)
+		if err != nil {
+			return City{}, err
+		}
+
+		return a.City(), nil
+	})
+}
+
+// isAirportCode reports whether the code looks like an IATA code, three
+// letters, or an ICAO one, four letters or digits.
+func isAirportCode(code string) bool {
+	if len(code) != 3 && len(code) != 4 {
+		return false
+	}
+	for i, r := range code {
+		letter := r >= 'A' && r <= 'Z'
+		// ICAO codes start with a letter, e.g. K for the United States.
+		digit := r >= '0' && r <= '9' && len(code) == 4 && i > 0
+		if !letter && !digit {
+			return false
+		}
+	}
+
+	return true
+}
+
+// airportTypes are the types of the OurAirports entries that are imported;
+// heliports, seaplane bases and closed airports are left out.
+var airportTypes = map[string]bool{
+	"large_airport":  true,
+	"medium_airport": true,
+	"small_airport":  true,
+}
+
+// ReadAirports reads the airports.csv file of OurAirports.
+func ReadAirports(in io.Reader) ([]Airport, error) {
+	r := csv.NewReader(in)
+
+	header, err := r.Read()
+	if err != nil {
+		return nil, fmt.Errorf("error reading airports header: %w", err)
+	}
+
+	index := make(map[string]int, len(header))
+	for i, name := range header {
+		index[name] = i
+	}
+
+	for _, name := range []string{"ident", "type", "name", "latitude_deg", "longitude_deg", "elevation_ft", "iso_country", "municipality", "scheduled_service", "iata_code"} {
+		if _, ok := index[name]; !ok {
+			return nil, fmt.Errorf("missing airports column: %s", name)
+		}
+	}
+
+	var airports []Airport
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			return airports, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading airports: %w", err)
+		}
+
+		field := func(name string) string {
+			return record[index[name]]
+		}
+
+		if !airportTypes[field("type")] {
+			continue
+		}
+
+		lat, err := strconv.ParseFloat(field("latitude_deg"), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid latitude for airport %s: %w", field("ident"), err)
+		}
+
+		lng, err := strconv.ParseFloat(field("longitude_deg"), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid longitude for airport %s: %w", field("ident"), err)
+		}
+
+		a := Airport{
+			Ident:        field("ident"),
+			IATA:         field("iata_code"),
+			Name:         field("name"),
+			Type:         field("type"),
+			Municipality: field("municipality"),
+			Iso2:         field("iso_country"),
+			Lat:          lat,
+			Lng:          lng,
+			Scheduled:    field("scheduled_service") == "yes",
+		}
+		if feet, err := strconv.ParseFloat(field("elevation_ft"), 64); err == nil {
+			meters := int(math.Round(feet * 0.3048))
+			a.Elevation = &meters
+		}
+
+		airports = append(airports, a)
+	}
+}
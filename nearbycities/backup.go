@@ -0,0 +1,86 @@
+package nearbycities
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"os"
+	"time"
+)
+
+// backupPages is how many pages a step of a backup or a restore copies,
+// between which the writers can take the lock.
+const backupPages = 1024
+
+// sqliteBackup is a copy between two SQLite databases with the online
+// backup API of the driver.
+type sqliteBackup interface {
+	// step copies up to n pages and reports whether all are copied.
+	step(n int) (bool, error)
+	finish() error
+}
+
+// Backup copies the database to a new SQLite file at path with the online
+// backup API, a few pages at a time so that the store keeps serving and
+// writing meanwhile. The copy is consistent: if a write changes the
+// database midway, the copy starts over. A file at path is overwritten.
+func (s *SQLiteStore) Backup(ctx context.Context, path string) error {
+	if err := s.copyDatabase(ctx, path, false); err != nil {
+		return fmt.Errorf("error backing up the database: %w", err)
+	}
+	return nil
+}
+
+// Restore replaces the content of the database with the one of the SQLite
+// file at path, e.g. made by Backup. It is meant for a database no server
+// is using, as the stores that have it open do not reload what they keep in
+// memory, such as the IP ranges.
+func (s *SQLiteStore) Restore(ctx context.Context, path string) error {
+	// SQLite would create a missing file, and restore it as an empty
+	// database.
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("error restoring the database: %w", err)
+	}
+	if err := s.copyDatabase(ctx, path, true); err != nil {
+		return fmt.Errorf("error restoring the database: %w", err)
+	}
+	return nil
+}
+
+// copyDatabase copies the database to the file at path, or the file to
+// the database when restore is set.
+func (s *SQLiteStore) copyDatabase(ctx context.Context, path string, restore bool) error {
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return conn.Raw(func(dc any) error {
+		b, err := newSQLiteBackup(dc.(driver.Conn), path, restore)
+		if err != nil {
+			return err
+		}
+
+		for {
+			if err := ctx.Err(); err != nil {
+				b.finish()
+				return err
+			}
+
+			done, err := b.step(backupPages)
+			if err != nil {
+				b.finish()
+				return err
+			}
+			if done {
+				break
+			}
+
+			// The pause lets the writers waiting for the lock in.
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		return b.finish()
+	})
+}
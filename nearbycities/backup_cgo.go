@@ -0,0 +1,56 @@
+//go:build !purego
+
+package nearbycities
+
+import (
+	"database/sql/driver"
+	"fmt"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// cgoBackup is a backup with the CGo driver, which holds the connection to
+// the other database.
+type cgoBackup struct {
+	b     *sqlite3.SQLiteBackup
+	other *sqlite3.SQLiteConn
+}
+
+func newSQLiteBackup(conn driver.Conn, path string, restore bool) (sqliteBackup, error) {
+	c, ok := conn.(*sqlite3.SQLiteConn)
+	if !ok {
+		return nil, fmt.Errorf("unexpected SQLite connection: %T", conn)
+	}
+
+	oc, err := (&sqlite3.SQLiteDriver{}).Open(path)
+	if err != nil {
+		return nil, err
+	}
+	other := oc.(*sqlite3.SQLiteConn)
+
+	// The destination of the copy is the connection Backup is called on.
+	var b *sqlite3.SQLiteBackup
+	if restore {
+		b, err = c.Backup("main", other, "main")
+	} else {
+		b, err = other.Backup("main", c, "main")
+	}
+	if err != nil {
+		other.Close()
+		return nil, err
+	}
+
+	return &cgoBackup{b: b, other: other}, nil
+}
+
+func (b *cgoBackup) step(n int) (bool, error) {
+	return b.b.Step(n)
+}
+
+func (b *cgoBackup) finish() error {
+	err := b.b.Finish()
+	if closeErr := b.other.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,46 @@
+//go:build purego
+
+package nearbycities
+
+import (
+	"database/sql/driver"
+	"fmt"
+
+	"modernc.org/sqlite"
+)
+
+// puregoBackup is a backup with the pure-Go driver, which opens and closes
+// the connection to the other database itself.
+type puregoBackup struct {
+	b *sqlite.Backup
+}
+
+func newSQLiteBackup(conn driver.Conn, path string, restore bool) (sqliteBackup, error) {
+	c, ok := conn.(interface {
+		NewBackup(dstURI string) (*sqlite.Backup, error)
+		NewRestore(srcURI string) (*sqlite.Backup, error)
+	})
+	if !ok {
+		return nil, fmt.Errorf("unexpected SQLite connection: %T", conn)
+	}
+
+	newBackup := c.NewBackup
+	if restore {
+		newBackup = c.NewRestore
+	}
+	b, err := newBackup(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &puregoBackup{b: b}, nil
+}
+
+func (b *puregoBackup) step(n int) (bool, error) {
+	more, err := b.b.Step(int32(n))
+	return !more, err
+}
+
+func (b *puregoBackup) finish() error {
+	return b.b.Finish()
+}
@@ -0,0 +1,105 @@
+package nearbycities
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// CacheStats reports the use of one of the result caches of a Service.
+type CacheStats struct {
+	Name      string
+	Entries   int
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+}
+
+// lruCache keeps up to size values for ttl, evicting the least recently
+// used one when it is full.
+type lruCache[V any] struct {
+	name string
+	size int
+	ttl  time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List
+	stats   CacheStats
+}
+
+type cacheEntry[V any] struct {
+	key     string
+	value   V
+	expires time.Time
+}
+
+func newLRUCache[V any](name string, size int, ttl time.Duration) *lruCache[V] {
+	return &lruCache[V]{
+		name:    name,
+		size:    size,
+		ttl:     ttl,
+		entries: make(map[string]*list.Element, size),
+		order:   list.New(),
+	}
+}
+
+func (c *lruCache[V]) get(key string) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.entries[key]; ok {
+		entry := e.Value.(*cacheEntry[V])
+		if time.Now().Before(entry.expires) {
+			c.order.MoveToFront(e)
+			c.stats.Hits++
+			return entry.value, true
+		}
+		c.order.Remove(e)
+		delete(c.entries, key)
+	}
+	c.stats.Misses++
+
+	var zero V
+	return zero, false
+}
+
+func (c *lruCache[V]) add(key string, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expires := time.Now().Add(c.ttl)
+	if e, ok := c.entries[key]; ok {
+		e.Value = &cacheEntry[V]{key: key, value: value, expires: expires}
+		c.order.MoveToFront(e)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&cacheEntry[V]{key: key, value: value, expires: expires})
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry[V]).key)
+		c.stats.Evictions++
+	}
+}
+
+// purge drops every value, e.g. once the answers may have changed.
+func (c *lruCache[V]) purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	clear(c.entries)
+	c.order.Init()
+}
+
+func (c *lruCache[V]) snapshot() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := c.stats
+	stats.Name = c.name
+	stats.Entries = c.order.Len()
+
+	return stats
+}
@@ -0,0 +1,88 @@
+package nearbycities
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrNotFound is returned when no city matches a query, or no location is
+// known for an IP address.
+var ErrNotFound = errors.New("nearbycities: not found")
+
+// AmbiguousError is returned when several cities bear the name searched for
+// and none stands out, so that the user can pick one of the Cities, the most
+// populated first.
+type AmbiguousError struct {
+	Query  string
+	Cities []City
+}
+
+func (e *AmbiguousError) Error() string {
+	return fmt.Sprintf("nearbycities: %d cities are named %q", len(e.Cities), e.Query)
+}
+
+// City is a row of the world cities dataset, or a place imported from
+// another source, which Source names; it is empty for the world cities.
+// Population is nil if unknown. Timezone is an IANA timezone ID, e.g.
+// Europe/Paris. Elevation is in meters, nil if unknown. Wikidata is nil
+// until the city is enriched. H3 is only set by the H3Index. Distance,
+// Bearing and DistanceMethod are only set on cities returned by a nearby
+// search; Distance is in kilometers and Bearing is the initial bearing from
+// the origin, in whole degrees clockwise from the north.
+type City struct {
+	City       string
+	CityAscii  string
+	Lat        float64
+	Lng        float64
+	Country    string
+	Iso2       string
+	Iso3       string
+	AdminName  string
+	Capital    string
+	Population *int64
+	ID         string
+	Timezone   string
+	Elevation  *int
+	Source     string
+	Wikidata   *WikidataLink
+	Geohash    string
+	H3         string
+	Distance   float64
+	Bearing    float64
+
+	DistanceMethod DistanceMethod
+}
+
+// CitySort is an order in which the cities of a country are listed.
+type CitySort string
+
+const (
+	ByPopulation CitySort = "population" // most populated first
+	ByName       CitySort = "name"       // alphabetically by ASCII name
+)
+
+// Region is a first-level administrative division of a country, e.g. a
+// province or a state, as named by the admin_name of its cities.
+type Region struct {
+	ID     int64
+	Iso2   string
+	Name   string
+	Cities int
+}
+
+// IPLocation is the location of an IP range according to IP2Location.
+type IPLocation struct {
+	StartIP uint32
+	EndIP   uint32
+	Iso2    string
+	Country string
+	Region  string
+	City    string
+	Lat     float64
+	Lng     float64
+
+	// Zip and UTCOffset, e.g. "+07:00", are empty when the locator does not
+	// know them; IP2Location only has them from DB9 and DB11 respectively.
+	Zip       string
+	UTCOffset string
+}
@@ -0,0 +1,83 @@
+package nearbycities
+
+import (
+	_ "embed"
+	"encoding/csv"
+	"strings"
+	"sync"
+)
+
+//go:embed countries.csv
+var countriesCSV string
+
+// Country holds the metadata of a country from the table bundled with the
+// package.
+type Country struct {
+	Iso2      string
+	Iso3      string
+	Name      string
+	Continent string
+
+	Currency    string // ISO 4217 code
+	CallingCode string // e.g. +84
+	TLD         string // e.g. .vn, empty if it has none
+}
+
+var (
+	countriesOnce sync.Once
+	countries     map[string]Country
+)
+
+// LookupCountry returns the country with the ISO 3166-1 alpha-2 code.
+func LookupCountry(iso2 string) (Country, bool) {
+	countriesOnce.Do(loadCountries)
+
+	c, ok := countries[strings.ToUpper(iso2)]
+	return c, ok
+}
+
+func loadCountries() {
+	records, err := csv.NewReader(strings.NewReader(countriesCSV)).ReadAll()
+	if err != nil {
+		// The table is embedded: a parse error is a bug.
+		panic("nearbycities: invalid countries.csv: " + err.Error())
+	}
+
+	countries = make(map[string]Country, len(records))
+	for _, r := range records[1:] {
+		countries[r[0]] = Country{
+			Iso2:        r[0],
+			Iso3:        r[1],
+			Name:        r[2],
+			Continent:   r[3],
+			Currency:    r[4],
+			CallingCode: r[5],
+			TLD:         r[6],
+		}
+	}
+}
+
+// Flag returns the flag emoji of the country, made of the regional
+// indicator symbols of its ISO code.
+func (c Country) Flag() string {
+	return FlagEmoji(c.Iso2)
+}
+
+// FlagEmoji returns the flag emoji of the ISO 3166-1 alpha-2 code, or an
+// empty string if it is not made of two letters.
+func FlagEmoji(iso2 string) string {
+	iso2 = strings.ToUpper(iso2)
+	if len(iso2) != 2 {
+		return ""
+	}
+
+	var b strings.Builder
+	for _, r := range iso2 {
+		if r < 'A' || r > 'Z' {
+			return ""
+		}
+		b.WriteRune(0x1F1E6 + r - 'A')
+	}
+
+	return b.String()
+}
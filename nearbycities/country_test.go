@@ -0,0 +1,39 @@
+package nearbycities
+
+import "testing"
+
+func TestFlagEmoji(t *testing.T) {
+	tests := []struct {
+		iso2, want string
+	}{
+		{"VN", "🇻🇳"},
+		{"us", "🇺🇸"},
+		{"Gb", "🇬🇧"},
+		{"", ""},
+		{"V", ""},
+		{"VNM", ""},
+		{"V1", ""},
+	}
+	for _, tt := range tests {
+		if got := FlagEmoji(tt.iso2); got != tt.want {
+			t.Errorf("FlagEmoji(%q) = %q, want %q", tt.iso2, got, tt.want)
+		}
+	}
+}
+
+func TestLookupCountry(t *testing.T) {
+	c, ok := LookupCountry("vn")
+	if !ok {
+		t.Fatal("Vietnam not found")
+	}
+	if c.Iso3 != "VNM" || c.Name != "Vietnam" || c.Continent != "Asia" {
+		t.Errorf("got %+v, want VNM, Vietnam in Asia", c)
+	}
+	if c.Flag() != "🇻🇳" {
+		t.Errorf("Flag = %q, want 🇻🇳", c.Flag())
+	}
+
+	if _, ok := LookupCountry("XX"); ok {
+		t.Error("XX found, want no country")
+	}
+}
@@ -0,0 +1,371 @@
+package nearbycities
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// insertBatchSize is the number of rows inserted per statement by
+// insertBatches.
+const insertBatchSize = 500
+
+// readWorldCities parses the world cities CSV bundled with the package and
+// finds the timezone of every city.
+func readWorldCities() ([]City, error) {
+	return ReadWorldCities(strings.NewReader(worldCitiesCSV))
+}
+
+// cityColumns are the columns of a world cities CSV file used by the
+// dataset. Releases may have more, which are ignored.
+var cityColumns = []string{"city", "city_ascii", "lat", "lng", "country", "iso2", "iso3", "admin_name", "capital", "population", "id"}
+
+// ReadWorldCities parses a release of the SimpleMaps world cities CSV file
+// and finds the timezone of every city.
+func ReadWorldCities(in io.Reader) ([]City, error) {
+	return readCities(in, nil, cityColumns)
+}
+
+// ReadCities parses a CSV file of places, e.g. offices or warehouses, and
+// finds their timezone. The columns are those of the world cities file,
+// found in the header under the names mapped by columns, or their own names
+// otherwise. Only city, lat and lng are required: city_ascii defaults to
+// city, country to the name of the iso2 country, and id to a number derived
+// from the name and coordinates of the place.
+func ReadCities(in io.Reader, columns map[string]string) ([]City, error) {
+	for column := range columns {
+		if !slices.Contains(cityColumns, column) {
+			return nil, fmt.Errorf("unknown column: %s", column)
+		}
+	}
+
+	cities, err := readCities(in, columns, []string{"city", "lat", "lng"})
+	if err != nil {
+		return nil, err
+	}
+
+	for i, c := range cities {
+		if c.CityAscii == "" {
+			c.CityAscii = c.City
+		}
+		if country, ok := LookupCountry(c.Iso2); ok {
+			if c.Country == "" {
+				c.Country = country.Name
+			}
+			if c.Iso3 == "" {
+				c.Iso3 = country.Iso3
+			}
+		}
+		if c.ID == "" {
+			c.ID = placeID(c)
+		}
+		cities[i] = c
+	}
+
+	return cities, nil
+}
+
+// placeID derives the ID of a place from its name and coordinates. The IDs
+// of the world cities have 10 digits, and these have 13 so as not to clash.
+func placeID(c City) string {
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%s\x00%v\x00%v", c.City, c.Lat, c.Lng)
+	return strconv.FormatUint(1e12+h.Sum64()%9e12, 10)
+}
+
+// readCities parses a CSV file of cities whose header names the columns,
+// under the names mapped by columns or their own, failing if one of the
+// required ones is missing.
+func readCities(in io.Reader, columns map[string]string, required []string) ([]City, error) {
+	// The timezones take longer to load than the file to parse.
+	type finder struct {
+		timezoneOf timezoneFinder
+		err        error
+	}
+	finders := make(chan finder, 1)
+	go func() {
+		timezoneOf, err := newTimezoneFinder()
+		finders <- finder{timezoneOf, err}
+	}()
+
+	r := csv.NewReader(in)
+	r.ReuseRecord = true
+
+	header, err := r.Read()
+	if err != nil {
+		return nil, fmt.Errorf("error reading cities header: %w", err)
+	}
+
+	index := make(map[string]int, len(header))
+	for i, name := range header {
+		index[name] = i
+	}
+
+	positions := make([]int, len(cityColumns))
+	for i, column := range cityColumns {
+		name := column
+		if mapped, ok := columns[column]; ok {
+			name = mapped
+		}
+
+		j, ok := index[name]
+		if !ok {
+			if slices.Contains(required, column) {
+				return nil, fmt.Errorf("missing cities column: %s", name)
+			}
+			j = -1
+		}
+		positions[i] = j
+	}
+
+	field := func(record []string, i int) string {
+		if positions[i] < 0 {
+			return ""
+		}
+		return record[positions[i]]
+	}
+
+	var cities []City
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading cities: %w", err)
+		}
+
+		lat, err := strconv.ParseFloat(field(record, 2), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid latitude for city %s: %w", field(record, 0), err)
+		}
+
+		lng, err := strconv.ParseFloat(field(record, 3), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid longitude for city %s: %w", field(record, 0), err)
+		}
+
+		// The population is empty when it is unknown, and written with
+		// decimals in the world cities dataset, e.g. 108860.00.
+		var population *int64
+		if v := field(record, 9); v != "" {
+			p, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid population for city %s: %w", field(record, 0), err)
+			}
+			n := int64(p)
+			population = &n
+		}
+
+		cities = append(cities, City{
+			City:       field(record, 0),
+			CityAscii:  field(record, 1),
+			Lat:        lat,
+			Lng:        lng,
+			Country:    field(record, 4),
+			Iso2:       field(record, 5),
+			Iso3:       field(record, 6),
+			AdminName:  field(record, 7),
+			Capital:    field(record, 8),
+			Population: population,
+			ID:         field(record, 10),
+		})
+	}
+
+	f := <-finders
+	if f.err != nil {
+		return nil, f.err
+	}
+	parallelize(len(cities), func(i int) {
+		cities[i].Timezone = f.timezoneOf(cities[i].Lat, cities[i].Lng)
+	})
+
+	return cities, nil
+}
+
+// ReadPostalCodes reads a GeoNames postal code file, e.g. allCountries.txt
+// or one of the country files, whose tab-separated columns are: country
+// code, postal code, place name, admin name1, admin code1, admin name2, admin
+// code2, admin name3, admin code3, latitude, longitude, accuracy.
+func ReadPostalCodes(in io.Reader) ([]PostalCode, error) {
+	r := csv.NewReader(in)
+	r.Comma = '\t'
+	r.LazyQuotes = true
+	r.FieldsPerRecord = -1
+
+	var codes []PostalCode
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			return codes, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading postal codes: %w", err)
+		}
+
+		if len(record) < 11 {
+			return nil, fmt.Errorf("unexpected number of postal code columns: %d", len(record))
+		}
+
+		lat, err := strconv.ParseFloat(record[9], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid latitude for postal code %s: %w", record[1], err)
+		}
+
+		lng, err := strconv.ParseFloat(record[10], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid longitude for postal code %s: %w", record[1], err)
+		}
+
+		codes = append(codes, PostalCode{
+			Iso2:      record[0],
+			Code:      record[1],
+			Place:     record[2],
+			AdminName: record[3],
+			Lat:       lat,
+			Lng:       lng,
+		})
+	}
+}
+
+// readIP2Location calls fn for every range of an IP2Location DB5 CSV file,
+// whose columns are: ip_from, ip_to, country_code, country_name, region_name,
+// city_name, latitude, longitude. The zip_code and time_zone columns that DB9
+// and DB11 add after them are read when present.
+func readIP2Location(path string, fn func(IPLocation) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.ReuseRecord = true
+
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("error reading %s: %w", path, err)
+		}
+
+		if len(record) < 8 {
+			return fmt.Errorf("unexpected number of columns in %s: %d", path, len(record))
+		}
+
+		startIP, err := strconv.ParseUint(record[0], 10, 32)
+		if err != nil {
+			return fmt.Errorf("invalid start IP %q: %w", record[0], err)
+		}
+
+		endIP, err := strconv.ParseUint(record[1], 10, 32)
+		if err != nil {
+			return fmt.Errorf("invalid end IP %q: %w", record[1], err)
+		}
+
+		lat, _ := strconv.ParseFloat(record[6], 64)
+		lng, _ := strconv.ParseFloat(record[7], 64)
+
+		loc := IPLocation{
+			StartIP: uint32(startIP),
+			EndIP:   uint32(endIP),
+			Iso2:    record[2],
+			Country: record[3],
+			Region:  record[4],
+			City:    record[5],
+			Lat:     lat,
+			Lng:     lng,
+		}
+		// Unknown values are written as "-".
+		if len(record) > 8 && record[8] != "-" {
+			loc.Zip = record[8]
+		}
+		if len(record) > 9 && record[9] != "-" {
+			loc.UTCOffset = record[9]
+		}
+		if err := fn(loc); err != nil {
+			return err
+		}
+	}
+}
+
+// errStopped stops reading a file once its rows are no longer wanted.
+var errStopped = errors.New("stopped")
+
+// readIP2LocationBatches calls fn with the rows of the ranges of the
+// IP2Location CSV file at path, insertBatchSize at a time, each row being the
+// columns start_ip, end_ip, iso2, country, region, city, lat, lng, zip and
+// utc_offset. The file is parsed by another goroutine while fn inserts the
+// previous batch.
+func readIP2LocationBatches(path string, fn func(rows [][]any) error) error {
+	batches := make(chan [][]any, 1)
+	parsed := make(chan error, 1)
+	stop := make(chan struct{})
+	go func() {
+		defer close(batches)
+
+		send := func(rows [][]any) error {
+			select {
+			case batches <- rows:
+				return nil
+			case <-stop:
+				return errStopped
+			}
+		}
+
+		rows := make([][]any, 0, insertBatchSize)
+		err := readIP2Location(path, func(loc IPLocation) error {
+			rows = append(rows, []any{loc.StartIP, loc.EndIP, loc.Iso2, loc.Country, loc.Region, loc.City, loc.Lat, loc.Lng, loc.Zip, loc.UTCOffset})
+			if len(rows) < insertBatchSize {
+				return nil
+			}
+			batch := rows
+			rows = make([][]any, 0, insertBatchSize)
+			return send(batch)
+		})
+		if err == nil && len(rows) > 0 {
+			err = send(rows)
+		}
+		parsed <- err
+	}()
+
+	for rows := range batches {
+		if err := fn(rows); err != nil {
+			close(stop)
+			<-parsed
+			return err
+		}
+	}
+
+	return <-parsed
+}
+
+// insertBatches inserts rows into table with multi-row INSERT statements,
+// placeholder being the VALUES tuple of one row.
+func insertBatches(tx *sql.Tx, table, placeholder string, rows [][]any) error {
+	for start := 0; start < len(rows); start += insertBatchSize {
+		end := min(start+insertBatchSize, len(rows))
+		batch := rows[start:end]
+
+		var args []any
+		for _, row := range batch {
+			args = append(args, row...)
+		}
+
+		query := fmt.Sprintf("INSERT INTO %s VALUES %s", table, strings.TrimSuffix(strings.Repeat(placeholder+", ", len(batch)), ", "))
+		if _, err := tx.Exec(query, args...); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,134 @@
+package nearbycities
+
+import (
+	"math"
+
+	"github.com/quantonganh/geohash"
+)
+
+// DistanceMethod is the way distances between cities are computed.
+type DistanceMethod string
+
+const (
+	// Haversine computes great-circle distances on a sphere, which is off
+	// by up to 0.5% from the actual distance.
+	Haversine DistanceMethod = "haversine"
+	// Geodesic computes distances on the WGS84 ellipsoid with Vincenty's
+	// formulae, accurate to within a millimeter.
+	Geodesic DistanceMethod = "geodesic"
+)
+
+// WGS84 ellipsoid.
+const (
+	wgs84A = 6378137.0         // semi-major axis, in meters
+	wgs84F = 1 / 298.257223563 // flattening
+	wgs84B = wgs84A * (1 - wgs84F)
+)
+
+// Distance returns the distance in kilometers between two coordinates.
+func (m DistanceMethod) Distance(lat1, lng1, lat2, lng2 float64) float64 {
+	if m == Geodesic {
+		return GeodesicDistance(lat1, lng1, lat2, lng2)
+	}
+
+	return geohash.Distance(lat1, lng1, lat2, lng2)
+}
+
+// GeodesicDistance returns the distance in kilometers between two
+// coordinates on the WGS84 ellipsoid, using the inverse Vincenty formula.
+// Nearly antipodal points, for which the formula does not converge, fall
+// back to the Haversine distance.
+func GeodesicDistance(lat1, lng1, lat2, lng2 float64) float64 {
+	const maxIterations = 200
+
+	l := (lng2 - lng1) * math.Pi / 180
+	u1 := math.Atan((1 - wgs84F) * math.Tan(lat1*math.Pi/180))
+	u2 := math.Atan((1 - wgs84F) * math.Tan(lat2*math.Pi/180))
+	sinU1, cosU1 := math.Sincos(u1)
+	sinU2, cosU2 := math.Sincos(u2)
+
+	lambda := l
+	for i := 0; i < maxIterations; i++ {
+		sinLambda, cosLambda := math.Sincos(lambda)
+		sinSigma := math.Hypot(cosU2*sinLambda, cosU1*sinU2-sinU1*cosU2*cosLambda)
+		if sinSigma == 0 {
+			return 0 // coincident points
+		}
+		cosSigma := sinU1*sinU2 + cosU1*cosU2*cosLambda
+		sigma := math.Atan2(sinSigma, cosSigma)
+		sinAlpha := cosU1 * cosU2 * sinLambda / sinSigma
+		cosSqAlpha := 1 - sinAlpha*sinAlpha
+
+		// Both points are on the equator when cosSqAlpha is 0.
+		var cos2SigmaM float64
+		if cosSqAlpha != 0 {
+			cos2SigmaM = cosSigma - 2*sinU1*sinU2/cosSqAlpha
+		}
+
+		c := wgs84F / 16 * cosSqAlpha * (4 + wgs84F*(4-3*cosSqAlpha))
+		prev := lambda
+		lambda = l + (1-c)*wgs84F*sinAlpha*(sigma+c*sinSigma*(cos2SigmaM+c*cosSigma*(-1+2*cos2SigmaM*cos2SigmaM)))
+
+		if math.Abs(lambda-prev) < 1e-12 {
+			uSq := cosSqAlpha * (wgs84A*wgs84A - wgs84B*wgs84B) / (wgs84B * wgs84B)
+			a := 1 + uSq/16384*(4096+uSq*(-768+uSq*(320-175*uSq)))
+			b := uSq / 1024 * (256 + uSq*(-128+uSq*(74-47*uSq)))
+			deltaSigma := b * sinSigma * (cos2SigmaM + b/4*(cosSigma*(-1+2*cos2SigmaM*cos2SigmaM)-
+				b/6*cos2SigmaM*(-3+4*sinSigma*sinSigma)*(-3+4*cos2SigmaM*cos2SigmaM)))
+
+			return wgs84B * a * (sigma - deltaSigma) / 1000
+		}
+	}
+
+	return geohash.Distance(lat1, lng1, lat2, lng2)
+}
+
+// Bearing returns the initial bearing, in degrees clockwise from the north
+// in [0, 360), of the great circle from the first coordinates to the second.
+func Bearing(lat1, lng1, lat2, lng2 float64) float64 {
+	phi1, phi2 := lat1*math.Pi/180, lat2*math.Pi/180
+	dLambda := (lng2 - lng1) * math.Pi / 180
+
+	y := math.Sin(dLambda) * math.Cos(phi2)
+	x := math.Cos(phi1)*math.Sin(phi2) - math.Sin(phi1)*math.Cos(phi2)*math.Cos(dLambda)
+	bearing := math.Atan2(y, x) * 180 / math.Pi
+
+	return math.Mod(bearing+360, 360)
+}
+
+// compassPoints are the 16 points of the compass, clockwise from the north.
+var compassPoints = [16]string{"N", "NNE", "NE", "ENE", "E", "ESE", "SE", "SSE", "S", "SSW", "SW", "WSW", "W", "WNW", "NW", "NNW"}
+
+// CompassPoint returns the point of the 16-point compass closest to the
+// bearing in degrees, e.g. "NE" for 45 or "SSW" for 200.
+func CompassPoint(bearing float64) string {
+	i := int(math.Round(math.Mod(bearing, 360)/22.5)) % 16
+	if i < 0 {
+		i += 16
+	}
+	return compassPoints[i]
+}
+
+// box is a range of coordinates, from south-west to north-east.
+type box struct {
+	minLat, minLng, maxLat, maxLng float64
+}
+
+// boundingBoxes returns the boxes holding the circle of radius kilometers
+// around the coordinates: one, or two on each side of the antimeridian when
+// the circle crosses it. Near a pole, the box spans every longitude.
+func boundingBoxes(lat, lng, radius float64) []box {
+	minLat, minLng, maxLat, maxLng := geohash.BoundingBox(lat, lng, radius)
+	minLat, maxLat = math.Max(minLat, -90), math.Min(maxLat, 90)
+
+	switch {
+	case minLat == -90 || maxLat == 90 || maxLng-minLng >= 360:
+		return []box{{minLat, -180, maxLat, 180}}
+	case minLng < -180:
+		return []box{{minLat, minLng + 360, maxLat, 180}, {minLat, -180, maxLat, maxLng}}
+	case maxLng > 180:
+		return []box{{minLat, minLng, maxLat, 180}, {minLat, -180, maxLat, maxLng - 360}}
+	default:
+		return []box{{minLat, minLng, maxLat, maxLng}}
+	}
+}
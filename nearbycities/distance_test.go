@@ -0,0 +1,136 @@
+package nearbycities
+
+import (
+	"math"
+	"testing"
+)
+
+func TestBoundingBoxes(t *testing.T) {
+	tests := []struct {
+		name     string
+		lat, lng float64
+		radius   float64
+		want     []box
+	}{
+		{"Hanoi", 21, 105, 100, []box{{20.1, 104.0, 21.9, 106.0}}},
+		{"east of the antimeridian", 0, -179.5, 111.2, []box{{-1, 179.5, 1, 180}, {-1, -180, 1, -178.5}}},
+		{"west of the antimeridian", 0, 179.5, 111.2, []box{{-1, 178.5, 1, 180}, {-1, -180, 1, -179.5}}},
+		{"north pole", 89.5, 10, 100, []box{{88.6, -180, 90, 180}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := boundingBoxes(tt.lat, tt.lng, tt.radius)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d boxes %v, want %v", len(got), got, tt.want)
+			}
+			for i := range got {
+				if !near(got[i].minLat, tt.want[i].minLat, 0.05) || !near(got[i].minLng, tt.want[i].minLng, 0.05) ||
+					!near(got[i].maxLat, tt.want[i].maxLat, 0.05) || !near(got[i].maxLng, tt.want[i].maxLng, 0.05) {
+					t.Errorf("got box %v, want %v", got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func near(got, want, tolerance float64) bool {
+	return got >= want-tolerance && got <= want+tolerance
+}
+
+func TestGeodesicDistance(t *testing.T) {
+	tests := []struct {
+		name                   string
+		lat1, lng1, lat2, lng2 float64
+		want                   float64 // km
+	}{
+		{"same point", 21.0283, 105.8542, 21.0283, 105.8542, 0},
+		// The example of Vincenty's paper, from Flinders Peak to Buninyong.
+		{"Flinders Peak to Buninyong", -(37 + 57/60.0 + 3.72030/3600), 144 + 25/60.0 + 29.52440/3600, -(37 + 39/60.0 + 10.15610/3600), 143 + 55/60.0 + 35.38390/3600, 54.972271},
+		{"a degree of the equator", 0, 0, 0, 1, 111.319491},
+		{"across the antimeridian", 0, 179.5, 0, -179.5, 111.319491},
+		{"equator to pole", 0, 0, 90, 0, 10001.965729},
+		{"pole to pole", 90, 0, -90, 0, 20003.931459},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := GeodesicDistance(tt.lat1, tt.lng1, tt.lat2, tt.lng2); !near(got, tt.want, 1e-5) {
+				t.Errorf("GeodesicDistance = %.6f km, want %.6f", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGeodesicDistanceAntipodes(t *testing.T) {
+	// Vincenty's formula does not converge for nearly antipodal points, which
+	// fall back to the Haversine distance, half the circumference.
+	got := GeodesicDistance(0, 0, 0.5, 179.7)
+	if math.IsNaN(got) || !near(got, Haversine.Distance(0, 0, 0.5, 179.7), 1e-9) {
+		t.Errorf("GeodesicDistance = %v km, want the Haversine distance, %v", got, Haversine.Distance(0, 0, 0.5, 179.7))
+	}
+}
+
+func TestDistanceMethod(t *testing.T) {
+	// A degree of the equator is 111.195 km on the sphere of the mean radius
+	// and 111.319 km on the ellipsoid.
+	if got := Haversine.Distance(0, 0, 0, 1); !near(got, 111.195, 1e-3) {
+		t.Errorf("Haversine.Distance = %.6f km, want 111.195", got)
+	}
+	if got := Geodesic.Distance(0, 0, 0, 1); !near(got, 111.319491, 1e-5) {
+		t.Errorf("Geodesic.Distance = %.6f km, want 111.319491", got)
+	}
+	if got := DistanceMethod("").Distance(0, 0, 0, 1); got != Haversine.Distance(0, 0, 0, 1) {
+		t.Errorf("the default method gives %.6f km, want the Haversine distance", got)
+	}
+}
+
+func TestBearing(t *testing.T) {
+	tests := []struct {
+		name                   string
+		lat1, lng1, lat2, lng2 float64
+		want                   float64
+	}{
+		{"north", 0, 0, 10, 0, 0},
+		{"east", 0, 0, 0, 10, 90},
+		{"south", 10, 0, 0, 0, 180},
+		{"west", 0, 10, 0, 0, 270},
+		{"east across the antimeridian", 0, 179, 0, -179, 90},
+		{"west across the antimeridian", 0, -179, 0, 179, 270},
+		// The great circle from Hanoi to London leaves to the north-west.
+		{"Hanoi to London", 21.0283, 105.8542, 51.5074, -0.1278, 322.93},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Bearing(tt.lat1, tt.lng1, tt.lat2, tt.lng2)
+			if got < 0 || got >= 360 {
+				t.Fatalf("Bearing = %v, want it in [0, 360)", got)
+			}
+			if !near(got, tt.want, 0.01) {
+				t.Errorf("Bearing = %.2f, want %.2f", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompassPoint(t *testing.T) {
+	tests := []struct {
+		bearing float64
+		want    string
+	}{
+		{0, "N"},
+		{11.24, "N"},
+		{11.25, "NNE"},
+		{45, "NE"},
+		{90, "E"},
+		{200, "SSW"},
+		{348.74, "NNW"},
+		{348.75, "N"},
+		{359.9, "N"},
+		{360, "N"},
+		{-90, "W"},
+	}
+	for _, tt := range tests {
+		if got := CompassPoint(tt.bearing); got != tt.want {
+			t.Errorf("CompassPoint(%v) = %q, want %q", tt.bearing, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,25 @@
+// Package nearbycities finds the cities near a place, a coordinate or an IP
+// address.
+//
+// A Storage holds the dataset: the world cities, their geohash index and the
+// IP2Location ranges. The SQLite implementation is created with Open and
+// filled once with Import. A Service answers the lookups on top of a
+// Storage, and cancels their queries when their context is done, e.g. when
+// the client of a request goes away:
+//
+//	store, err := nearbycities.Open("./db/nearby_cities.db")
+//	if err != nil {
+//		return err
+//	}
+//	defer store.Close()
+//
+//	if err := store.Import(os.Getenv("IP2LOCATION_TOKEN")); err != nil {
+//		return err
+//	}
+//
+//	svc := nearbycities.NewService(store)
+//	from, cities, err := svc.NearbyCity(ctx, "Hanoi", 100)
+//
+// The default SQLite driver uses CGo and needs the fts5 build tag. Building
+// with the purego tag selects a pure-Go driver instead.
+package nearbycities
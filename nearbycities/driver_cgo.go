@@ -0,0 +1,8 @@
+//go:build !purego
+
+package nearbycities
+
+import _ "github.com/mattn/go-sqlite3"
+
+// sqliteDriver is the CGo SQLite driver, which needs the fts5 build tag.
+const sqliteDriver = "sqlite3"
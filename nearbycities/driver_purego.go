@@ -0,0 +1,9 @@
+//go:build purego
+
+package nearbycities
+
+import _ "modernc.org/sqlite"
+
+// sqliteDriver is the pure-Go SQLite driver, selected with the purego build
+// tag so that the binary can be built with CGO_ENABLED=0.
+const sqliteDriver = "sqlite"
@@ -0,0 +1,157 @@
+package nearbycities
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// ElevationSource returns the elevation, in meters, of coordinates. It
+// returns ErrNotFound if it has no data for them.
+type ElevationSource interface {
+	Elevation(lat, lng float64) (int, error)
+}
+
+// srtmVoid marks the cells of an SRTM tile without data.
+const srtmVoid = -32768
+
+// SRTMTiles reads elevations from a directory of SRTM .hgt tiles, named
+// after their south-west corner like N21E105.hgt. Both the 1 and 3
+// arc-second resolutions are supported. Tiles are opened on first use and
+// kept open until Close.
+type SRTMTiles struct {
+	Dir string
+
+	mu    sync.Mutex
+	tiles map[string]*srtmTile
+}
+
+type srtmTile struct {
+	f    *os.File
+	size int // samples per row and column
+}
+
+// Elevation returns the elevation of the sample nearest to the coordinates.
+func (t *SRTMTiles) Elevation(lat, lng float64) (int, error) {
+	south, west := math.Floor(lat), math.Floor(lng)
+	tile, err := t.tile(srtmTileName(south, west))
+	if err != nil {
+		return 0, err
+	}
+
+	// Rows go from the north edge to the south one, columns from west to
+	// east, and the edges are shared with the neighboring tiles.
+	row := int(math.Round((south + 1 - lat) * float64(tile.size-1)))
+	col := int(math.Round((lng - west) * float64(tile.size-1)))
+
+	var b [2]byte
+	if _, err := tile.f.ReadAt(b[:], int64(2*(row*tile.size+col))); err != nil {
+		return 0, fmt.Errorf("error reading %s: %w", tile.f.Name(), err)
+	}
+
+	elevation := int(int16(binary.BigEndian.Uint16(b[:])))
+	if elevation == srtmVoid {
+		return 0, ErrNotFound
+	}
+
+	return elevation, nil
+}
+
+// tile returns the opened tile, or ErrNotFound if there is no such file.
+func (t *SRTMTiles) tile(name string) (*srtmTile, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if tile, ok := t.tiles[name]; ok {
+		if tile == nil {
+			return nil, ErrNotFound
+		}
+		return tile, nil
+	}
+
+	if t.tiles == nil {
+		t.tiles = make(map[string]*srtmTile)
+	}
+
+	f, err := os.Open(filepath.Join(t.Dir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		// Most of the world is ocean: remember the missing tiles.
+		t.tiles[name] = nil
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	var size int
+	switch fi.Size() {
+	case 2 * 1201 * 1201:
+		size = 1201
+	case 2 * 3601 * 3601:
+		size = 3601
+	default:
+		f.Close()
+		return nil, fmt.Errorf("%s is not an SRTM tile: unexpected size %d", name, fi.Size())
+	}
+
+	tile := &srtmTile{f: f, size: size}
+	t.tiles[name] = tile
+
+	return tile, nil
+}
+
+// Close closes the opened tiles.
+func (t *SRTMTiles) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var errs []error
+	for _, tile := range t.tiles {
+		if tile != nil {
+			errs = append(errs, tile.f.Close())
+		}
+	}
+	t.tiles = nil
+
+	return errors.Join(errs...)
+}
+
+func srtmTileName(south, west float64) string {
+	ns, ew := 'N', 'E'
+	if south < 0 {
+		ns = 'S'
+	}
+	if west < 0 {
+		ew = 'W'
+	}
+
+	return fmt.Sprintf("%c%02d%c%03d.hgt", ns, int(math.Abs(south)), ew, int(math.Abs(west)))
+}
+
+// elevationsOf looks the cities up in src, leaving the elevation of the
+// ones it has no data for nil.
+func elevationsOf(src ElevationSource, cities []City) ([]City, error) {
+	for i, c := range cities {
+		elevation, err := src.Elevation(c.Lat, c.Lng)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		cities[i].Elevation = &elevation
+	}
+
+	return cities, nil
+}
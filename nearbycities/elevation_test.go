@@ -0,0 +1,39 @@
+package nearbycities
+
+import (
+	"testing"
+)
+
+// oceanElevations has data for the northern hemisphere only, and counts the
+// coordinates it is asked for.
+type oceanElevations struct {
+	lookups int
+}
+
+func (e *oceanElevations) Elevation(lat, lng float64) (int, error) {
+	e.lookups++
+	if lat < 0 {
+		return 0, ErrNotFound
+	}
+	return 10, nil
+}
+
+func TestImportElevationOnce(t *testing.T) {
+	store, cities := openTestStore(t)
+
+	src := &oceanElevations{}
+	if err := store.ImportElevation(src); err != nil {
+		t.Fatal(err)
+	}
+	if src.lookups != len(cities) {
+		t.Errorf("got %d lookups, want one per city, %d", src.lookups, len(cities))
+	}
+
+	src.lookups = 0
+	if err := store.ImportElevation(src); err != nil {
+		t.Fatal(err)
+	}
+	if src.lookups != 0 {
+		t.Errorf("got %d lookups again, want none", src.lookups)
+	}
+}
@@ -0,0 +1,210 @@
+package nearbycities
+
+import (
+	"context"
+	"sort"
+)
+
+// FuzzyIndex is an in-memory index of the city names that finds the ones
+// close to a misspelt query, e.g. Hanoi for Hanio. The candidates are the
+// names sharing trigrams with the query, ranked by their edit distance to it.
+type FuzzyIndex struct {
+	cities     []City
+	keys       []string
+	population []float64
+	trigrams   map[string][]int32
+}
+
+// BuildFuzzyIndex loads the names of every city of store into a new index.
+func BuildFuzzyIndex(ctx context.Context, store Storage) (*FuzzyIndex, error) {
+	var cities []City
+	err := store.EachCity(ctx, func(c City) error {
+		cities = append(cities, c)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return NewFuzzyIndex(cities), nil
+}
+
+// NewFuzzyIndex builds an index over the names of the cities.
+func NewFuzzyIndex(cities []City) *FuzzyIndex {
+	x := &FuzzyIndex{
+		cities:     cities,
+		keys:       make([]string, len(cities)),
+		population: make([]float64, len(cities)),
+		trigrams:   make(map[string][]int32),
+	}
+
+	for i, c := range cities {
+		name := c.CityAscii
+		if name == "" {
+			name = c.City
+		}
+		x.keys[i] = Slugify(name)
+		x.population[i] = population(c)
+
+		for _, t := range trigrams(x.keys[i]) {
+			// A name repeating a trigram is listed once.
+			if ids := x.trigrams[t]; len(ids) == 0 || ids[len(ids)-1] != int32(i) {
+				x.trigrams[t] = append(ids, int32(i))
+			}
+		}
+	}
+
+	return x
+}
+
+// maxEdits returns the number of typos tolerated in a query of n letters:
+// none for the short ones, which are too close to many names.
+func maxEdits(n int) int {
+	switch {
+	case n < 4:
+		return 0
+	case n < 8:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// Search returns up to limit cities whose name is within a few typos of the
+// query, the closest first and the most populated among equally close ones.
+func (x *FuzzyIndex) Search(query string, limit int) []City {
+	key := Slugify(query)
+	edits := maxEdits(len(key))
+	if edits == 0 || limit <= 0 {
+		return []City{}
+	}
+
+	matches := x.matches(key, edits)
+	cities := make([]City, 0, min(limit, len(matches)))
+	for _, i := range matches[:min(limit, len(matches))] {
+		cities = append(cities, x.cities[i])
+	}
+
+	return cities
+}
+
+// Suggest returns up to limit names of cities spelt close to the query, the
+// closest first, to ask whether it was meant. It tolerates more typos than
+// Search, about one letter in three.
+func (x *FuzzyIndex) Suggest(query string, limit int) []string {
+	key := Slugify(query)
+	edits := (len(key) + 2) / 3
+	if len(key) < 3 || limit <= 0 {
+		return []string{}
+	}
+
+	seen := make(map[string]bool)
+	names := make([]string, 0, limit)
+	for _, i := range x.matches(key, edits) {
+		if len(names) == limit {
+			break
+		}
+		// Namesakes are told apart once the name is searched for.
+		if name := x.cities[i].City; !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
+
+// matches returns the index of the cities whose name is within edits of the
+// key, the closest first and the most populated among equally close ones.
+func (x *FuzzyIndex) matches(key string, edits int) []int32 {
+	shared := make(map[int32]int)
+	for _, t := range trigrams(key) {
+		for _, i := range x.trigrams[t] {
+			shared[i]++
+		}
+	}
+
+	type match struct {
+		index    int32
+		distance int
+	}
+	var matches []match
+	for i := range shared {
+		k := x.keys[i]
+		if len(k)-len(key) > edits || len(key)-len(k) > edits {
+			continue
+		}
+		if d := editDistance(key, k); d <= edits {
+			matches = append(matches, match{index: i, distance: d})
+		}
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		a, b := matches[i], matches[j]
+		if a.distance != b.distance {
+			return a.distance < b.distance
+		}
+		if pa, pb := x.population[a.index], x.population[b.index]; pa != pb {
+			return pa > pb
+		}
+		return a.index < b.index
+	})
+
+	indexes := make([]int32, len(matches))
+	for i, m := range matches {
+		indexes[i] = m.index
+	}
+
+	return indexes
+}
+
+// Geocode returns the city closest to the misspelt query, or ErrNotFound if
+// none is within a few typos of it.
+func (x *FuzzyIndex) Geocode(_ context.Context, query string) (City, error) {
+	cities := x.Search(query, 1)
+	if len(cities) == 0 {
+		return City{}, ErrNotFound
+	}
+
+	return cities[0], nil
+}
+
+// trigrams returns the three-letter sequences of the key, padded so that its
+// first and last letters weigh as much as the others.
+func trigrams(key string) []string {
+	padded := "  " + key + " "
+	t := make([]string, 0, len(padded)-2)
+	for i := 0; i+3 <= len(padded); i++ {
+		t = append(t, padded[i:i+3])
+	}
+
+	return t
+}
+
+// editDistance returns the number of insertions, deletions, substitutions
+// and transpositions of adjacent letters turning a into b.
+func editDistance(a, b string) int {
+	prev2 := make([]int, len(b)+1)
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				cur[j] = min(cur[j], prev2[j-2]+1)
+			}
+		}
+		prev2, prev, cur = prev, cur, prev2
+	}
+
+	return prev[len(b)]
+}
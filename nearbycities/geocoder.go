@@ -0,0 +1,85 @@
+package nearbycities
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Geocoder resolves a place name to a location. It returns ErrNotFound if it
+// knows no such place.
+type Geocoder interface {
+	Geocode(ctx context.Context, query string) (City, error)
+}
+
+// GeocoderFunc adapts a function to the Geocoder interface.
+type GeocoderFunc func(ctx context.Context, query string) (City, error)
+
+// Geocode calls f.
+func (f GeocoderFunc) Geocode(ctx context.Context, query string) (City, error) {
+	return f(ctx, query)
+}
+
+// StorageGeocoder returns the Geocoder searching the cities of store, which
+// a Service asks by default after the PostalCodeGeocoder.
+func StorageGeocoder(store Storage) Geocoder {
+	return GeocoderFunc(store.SearchCity)
+}
+
+// PrefixGeocoder returns the Geocoder taking the query for the beginning of
+// a city name, e.g. krak for Kraków, and picking the best of the cities whose
+// name starts with it. A Service asks it after the StorageGeocoder.
+func PrefixGeocoder(store Storage) Geocoder {
+	return GeocoderFunc(func(ctx context.Context, query string) (City, error) {
+		// A single letter starts too many names to pick one.
+		if utf8.RuneCountInString(strings.TrimSpace(normalizeQuery(query))) < 2 {
+			return City{}, ErrNotFound
+		}
+
+		cities, err := store.SuggestCities(ctx, query, 1)
+		if err != nil {
+			return City{}, err
+		}
+		if len(cities) == 0 {
+			return City{}, ErrNotFound
+		}
+
+		return cities[0], nil
+	})
+}
+
+// PhoneticGeocoder returns the Geocoder picking the most populated of the
+// cities whose name sounds like the query, e.g. Philadelphia for Filadelfia.
+// A Service asks it last, before the fallbacks.
+func PhoneticGeocoder(store Storage) Geocoder {
+	return GeocoderFunc(func(ctx context.Context, query string) (City, error) {
+		if len(strings.ReplaceAll(phoneticKey(query), " ", "")) < minPhoneticKey {
+			return City{}, ErrNotFound
+		}
+
+		return store.SearchPhonetic(ctx, query)
+	})
+}
+
+// geocoderChain tries each Geocoder in turn until one knows the place.
+type geocoderChain []Geocoder
+
+func (c geocoderChain) Geocode(ctx context.Context, query string) (City, error) {
+	for _, g := range c {
+		city, err := g.Geocode(ctx, query)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		return city, err
+	}
+
+	return City{}, ErrNotFound
+}
+
+// defaultHTTPClient is used by the remote providers unless one is given.
+var defaultHTTPClient = &http.Client{
+	Timeout: 5 * time.Second,
+}
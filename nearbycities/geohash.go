@@ -0,0 +1,83 @@
+package nearbycities
+
+import (
+	"context"
+	"math"
+	"strings"
+
+	"github.com/quantonganh/geohash"
+)
+
+// geohashCells returns the geohash prefix of the given length of the cell
+// holding the coordinates, followed by the ones of its 8 neighbors, so that
+// an origin near the edge of a cell also finds the cities across it. Cells
+// that the neighbors share near the poles are returned once.
+func geohashCells(lat, lng float64, length int) []string {
+	// Bits alternate between longitude and latitude, starting with the
+	// longitude.
+	bits := 5 * length
+	height := 180 / math.Pow(2, float64(bits/2))
+	width := 360 / math.Pow(2, float64(bits-bits/2))
+
+	cells := make([]string, 0, 9)
+	seen := make(map[string]bool, 9)
+	for _, dLat := range []float64{0, -height, height} {
+		for _, dLng := range []float64{0, -width, width} {
+			nLat := lat + dLat
+			if nLat < -90 || nLat > 90 {
+				continue
+			}
+
+			nLng := lng + dLng
+			if nLng < -180 {
+				nLng += 360
+			} else if nLng >= 180 {
+				nLng -= 360
+			}
+
+			cell := geohash.Encode(nLat, nLng)[:length]
+			if !seen[cell] {
+				seen[cell] = true
+				cells = append(cells, cell)
+			}
+		}
+	}
+
+	return cells
+}
+
+// DecodeGeohash returns the coordinates of the center of the geohash cell,
+// e.g. w7er8u, and whether hash is a geohash of 1 to 12 characters.
+func DecodeGeohash(hash string) (float64, float64, bool) {
+	hash = strings.ToLower(hash)
+	if hash == "" || len(hash) > 12 || geohash.ParseGeohash(hash) != nil {
+		return 0, 0, false
+	}
+
+	// geohash.Decode reads the hash as a 12 characters one: padding it
+	// with the lowest and highest characters gives the corners of the cell.
+	minLat, minLng := geohash.Decode(hash + strings.Repeat("0", 12-len(hash)))
+	maxLat, maxLng := geohash.Decode(hash + strings.Repeat("z", 12-len(hash)))
+
+	return (minLat + maxLat) / 2, (minLng + maxLng) / 2, true
+}
+
+// GeohashGeocoder returns the Geocoder taking the queries that look like a
+// geohash, e.g. w7er8u, for the center of their cell. To be told apart from
+// the names, they must have 4 characters or more, of which a digit and a
+// letter. A Service asks it after the PrefixGeocoder.
+func GeohashGeocoder() Geocoder {
+	return GeocoderFunc(func(_ context.Context, query string) (City, error) {
+		hash := strings.ToLower(strings.TrimSpace(query))
+		if len(hash) < 4 || !strings.ContainsAny(hash, "0123456789") || strings.Trim(hash, "0123456789") == "" {
+			return City{}, ErrNotFound
+		}
+
+		lat, lng, ok := DecodeGeohash(hash)
+		if !ok {
+			return City{}, ErrNotFound
+		}
+
+		return City{City: hash, Lat: lat, Lng: lng, Geohash: hash}, nil
+	})
+}
@@ -0,0 +1,36 @@
+package nearbycities
+
+import (
+	"testing"
+
+	"github.com/quantonganh/geohash"
+)
+
+func TestGeohashCells(t *testing.T) {
+	tests := []struct {
+		name     string
+		lat, lng float64
+		length   int
+		want     int
+	}{
+		{"Hanoi", 21.0283, 105.8542, 5, 9},
+		{"antimeridian", 10, 179.99, 4, 9},
+		{"north pole", 89.99, 10, 3, 6},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cells := geohashCells(tt.lat, tt.lng, tt.length)
+			if len(cells) != tt.want {
+				t.Fatalf("got %d cells %v, want %d", len(cells), cells, tt.want)
+			}
+			if want := geohash.Encode(tt.lat, tt.lng)[:tt.length]; cells[0] != want {
+				t.Errorf("got %s as the first cell, want the one of the origin, %s", cells[0], want)
+			}
+			for _, cell := range cells {
+				if len(cell) != tt.length {
+					t.Errorf("got cell %s, want %d characters", cell, tt.length)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package nearbycities
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// GoogleGeocoder geocodes with the Google Maps Geocoding API.
+type GoogleGeocoder struct {
+	APIKey string
+	Client *http.Client
+}
+
+type googleGeocodeResponse struct {
+	Status  string `json:"status"`
+	Results []struct {
+		AddressComponents []struct {
+			LongName  string   `json:"long_name"`
+			ShortName string   `json:"short_name"`
+			Types     []string `json:"types"`
+		} `json:"address_components"`
+		Geometry struct {
+			Location struct {
+				Lat float64 `json:"lat"`
+				Lng float64 `json:"lng"`
+			} `json:"location"`
+		} `json:"geometry"`
+	} `json:"results"`
+}
+
+// Geocode returns the first result of Google for the query.
+func (g *GoogleGeocoder) Geocode(ctx context.Context, query string) (City, error) {
+	params := url.Values{}
+	params.Set("address", query)
+	params.Set("key", g.APIKey)
+
+	var resp googleGeocodeResponse
+	if err := getJSON(ctx, g.Client, "https://maps.googleapis.com/maps/api/geocode/json?"+params.Encode(), &resp); err != nil {
+		return City{}, fmt.Errorf("google: %w", err)
+	}
+
+	switch resp.Status {
+	case "OK":
+	case "ZERO_RESULTS":
+		return City{}, ErrNotFound
+	default:
+		return City{}, fmt.Errorf("google: unexpected status: %s", resp.Status)
+	}
+
+	result := resp.Results[0]
+	c := City{
+		Lat: result.Geometry.Location.Lat,
+		Lng: result.Geometry.Location.Lng,
+	}
+
+	for _, component := range result.AddressComponents {
+		for _, typ := range component.Types {
+			switch typ {
+			case "locality":
+				c.City = component.LongName
+			case "administrative_area_level_1":
+				c.AdminName = component.LongName
+			case "country":
+				c.Country = component.LongName
+				c.Iso2 = component.ShortName
+			}
+		}
+	}
+
+	if c.City == "" {
+		c.City = query
+	}
+
+	return c, nil
+}
@@ -0,0 +1,109 @@
+//go:build !purego
+
+package nearbycities
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	"github.com/golang/geo/s1"
+	"github.com/golang/geo/s2"
+	"github.com/quantonganh/geohash"
+	"github.com/uber/h3-go/v4"
+)
+
+// h3MaxRadiusInEdges bounds the radius of a query, in hexagon edges, at the
+// resolution its grid disk is taken at, so that the disk stays small.
+const h3MaxRadiusInEdges = 8
+
+// H3Index is an in-memory index of the cities by H3 cell, answering radius
+// queries exactly. The cities it returns carry their cell at the resolution
+// of the index, to be joined with other H3-indexed data. It needs CGo.
+type H3Index struct {
+	resolution int
+	cities     []City
+	// buckets holds, for each resolution up to the one of the index, the
+	// cities in every cell.
+	buckets []map[h3.Cell][]int
+}
+
+// BuildH3Index loads every city of store into a new index at the resolution,
+// between 0 and 15.
+func BuildH3Index(ctx context.Context, store Storage, resolution int) (*H3Index, error) {
+	var cities []City
+	err := store.EachCity(ctx, func(c City) error {
+		c.Geohash = geohash.Encode(c.Lat, c.Lng)
+		cities = append(cities, c)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return NewH3Index(cities, resolution)
+}
+
+// NewH3Index builds an index over the cities at the resolution, between 0
+// and 15.
+func NewH3Index(cities []City, resolution int) (*H3Index, error) {
+	if resolution < 0 || resolution > 15 {
+		return nil, fmt.Errorf("H3 resolution must be between 0 and 15: %d", resolution)
+	}
+
+	idx := &H3Index{
+		resolution: resolution,
+		cities:     cities,
+		buckets:    make([]map[h3.Cell][]int, resolution+1),
+	}
+	for res := range idx.buckets {
+		idx.buckets[res] = make(map[h3.Cell][]int)
+	}
+
+	for i := range cities {
+		cell := h3.LatLngToCell(h3.NewLatLng(cities[i].Lat, cities[i].Lng), resolution)
+		cities[i].H3 = cell.String()
+		for res := resolution; res >= 0; res-- {
+			parent := cell.Parent(res)
+			idx.buckets[res][parent] = append(idx.buckets[res][parent], i)
+		}
+	}
+
+	return idx, nil
+}
+
+// Len returns the number of cities in the index.
+func (idx *H3Index) Len() int {
+	return len(idx.cities)
+}
+
+// NearbyByLatLng returns the cities within radius kilometers of the
+// coordinates, sorted by distance. The cells within the grid distance that
+// covers the radius are looked up, at the finest resolution that keeps it
+// small, and their cities are checked against the circle.
+func (idx *H3Index) NearbyByLatLng(_ context.Context, lat, lng, radius float64) ([]City, error) {
+	res := idx.resolution
+	for res > 0 && radius > h3MaxRadiusInEdges*h3.HexagonEdgeLengthAvgKm(res) {
+		res--
+	}
+
+	// Neighbors are about 1.5 edges apart; halving that leaves room for the
+	// cells that are smaller than the average.
+	k := int(math.Ceil(radius/(0.5*h3.HexagonEdgeLengthAvgKm(res)))) + 1
+
+	center := s2.PointFromLatLng(s2.LatLngFromDegrees(lat, lng))
+	circle := s2.CapFromCenterAngle(center, s1.Angle(radius/earthRadius))
+
+	var found []int
+	origin := h3.LatLngToCell(h3.NewLatLng(lat, lng), res)
+	for _, cell := range origin.GridDisk(k) {
+		for _, i := range idx.buckets[res][cell] {
+			c := idx.cities[i]
+			if circle.ContainsPoint(s2.PointFromLatLng(s2.LatLngFromDegrees(c.Lat, c.Lng))) {
+				found = append(found, i)
+			}
+		}
+	}
+
+	return withDistances(idx.cities, lat, lng, found), nil
+}
@@ -0,0 +1,33 @@
+//go:build purego
+
+package nearbycities
+
+import (
+	"context"
+	"errors"
+)
+
+// H3Index is not available without CGo.
+type H3Index struct{}
+
+var errH3Unavailable = errors.New("nearbycities: the H3 index needs CGo; build without the purego tag")
+
+// BuildH3Index returns an error as the H3 library needs CGo.
+func BuildH3Index(ctx context.Context, store Storage, resolution int) (*H3Index, error) {
+	return nil, errH3Unavailable
+}
+
+// NewH3Index returns an error as the H3 library needs CGo.
+func NewH3Index(cities []City, resolution int) (*H3Index, error) {
+	return nil, errH3Unavailable
+}
+
+// Len returns 0.
+func (idx *H3Index) Len() int {
+	return 0
+}
+
+// NearbyByLatLng returns an error as the H3 library needs CGo.
+func (idx *H3Index) NearbyByLatLng(_ context.Context, lat, lng, radius float64) ([]City, error) {
+	return nil, errH3Unavailable
+}
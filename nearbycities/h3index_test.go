@@ -0,0 +1,41 @@
+//go:build !purego
+
+package nearbycities
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestH3IndexNearbyByLatLng(t *testing.T) {
+	cities := randomCities(5000)
+	for _, resolution := range []int{0, 7, 15} {
+		idx, err := NewH3Index(cities, resolution)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, q := range spatialQueries {
+			t.Run(fmt.Sprintf("%s at resolution %d", q.name, resolution), func(t *testing.T) {
+				got, err := idx.NearbyByLatLng(context.Background(), q.lat, q.lng, q.radius)
+				if err != nil {
+					t.Fatal(err)
+				}
+				checkNearby(t, got, nearbyIDs(cities, q.lat, q.lng, q.radius))
+				for _, c := range got {
+					if c.H3 == "" {
+						t.Fatalf("city %s has no H3 cell", c.ID)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestNewH3IndexResolution(t *testing.T) {
+	for _, resolution := range []int{-1, 16} {
+		if _, err := NewH3Index(nil, resolution); err == nil {
+			t.Errorf("NewH3Index at resolution %d succeeded, want an error", resolution)
+		}
+	}
+}
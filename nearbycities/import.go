@@ -0,0 +1,1063 @@
+package nearbycities
+
+import (
+	"archive/zip"
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/quantonganh/geohash"
+)
+
+// IP2LocationDB is the IP2Location LITE product whose ranges are
+// downloaded. The larger ones add columns to those of DB5.
+type IP2LocationDB string
+
+const (
+	IP2LocationDB5  IP2LocationDB = "DB5"  // country, region, city and coordinates
+	IP2LocationDB9  IP2LocationDB = "DB9"  // DB5 and the zip code
+	IP2LocationDB11 IP2LocationDB = "DB11" // DB9 and the UTC offset
+)
+
+//go:embed worldcities.csv
+var worldCitiesCSV string
+
+// Import applies the pending schema migrations and imports the dataset on
+// first use: the world cities bundled with the package and the IP2Location
+// LITE database, which is downloaded with the given token. The tables that
+// already hold data are left as they are.
+//
+// The ranges are downloaded and parsed while the cities are imported, but
+// SQLite has a single writer, so the steps writing to the database take
+// turns.
+func (s *SQLiteStore) Import(ip2LocationToken string) error {
+	start := time.Now()
+	if err := s.MigrateUp(context.Background()); err != nil {
+		return err
+	}
+	s.progress("migrations", start)
+
+	hasRanges, err := s.hasRows("ip2location")
+	if err != nil {
+		return err
+	}
+
+	var write sync.Mutex
+	ranges := make(chan error, 1)
+	// An in-memory database is rebuilt on every start, so it can do without
+	// IP lookups rather than download the ranges each time.
+	if !hasRanges && (!s.memory || ip2LocationToken != "") {
+		go func() {
+			ranges <- s.importIPRanges(ip2LocationToken, &write)
+		}()
+	} else {
+		ranges <- nil
+	}
+
+	// The ranges are waited for even if the cities fail, so that the file
+	// they are read from is removed.
+	err = s.importCityTables(&write)
+	if err := errors.Join(err, <-ranges); err != nil {
+		return err
+	}
+
+	start = time.Now()
+	if err := s.loadIPRanges(); err != nil {
+		return err
+	}
+	s.progress("load ip ranges", start)
+
+	return nil
+}
+
+// importIPRanges downloads the IP2Location database and imports its
+// ranges, holding write while it inserts them.
+func (s *SQLiteStore) importIPRanges(ip2LocationToken string, write *sync.Mutex) error {
+	start := time.Now()
+	path, err := downloadIP2LocationDB(ip2LocationToken, s.IPDatabase, s.DownloadDir)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(path)
+	s.progress("download ip ranges", start)
+
+	write.Lock()
+	defer write.Unlock()
+
+	start = time.Now()
+	if err := s.importIP2Location("ip2location", path); err != nil {
+		return err
+	}
+	s.progress("ip ranges", start)
+
+	return nil
+}
+
+// importStep is a step of Import, named in its progress.
+type importStep struct {
+	name string
+	run  func() error
+}
+
+// importCityTables imports the world cities if they are missing, then fills
+// in the tables and columns derived from them, holding write during every
+// step.
+func (s *SQLiteStore) importCityTables(write *sync.Mutex) error {
+	hasCities, err := s.hasWorldCities()
+	if err != nil {
+		return err
+	}
+
+	var steps []importStep
+	if !hasCities {
+		// The rows are computed before the lock is taken.
+		start := time.Now()
+		rows, err := readCityRows()
+		if err != nil {
+			return err
+		}
+		s.progress("read cities", start)
+
+		steps = append(steps, importStep{"cities", func() error {
+			return s.importCities(rows)
+		}})
+	}
+	steps = append(steps,
+		importStep{"rtree", s.createRTree},
+		importStep{"timezones", s.addTimezones},
+		importStep{"phonetic keys", s.addPhoneticKeys},
+		importStep{"name tokens", s.addNameTokens},
+		importStep{"regions", s.addRegions},
+	)
+
+	for _, step := range steps {
+		write.Lock()
+		start := time.Now()
+		err := step.run()
+		write.Unlock()
+		if err != nil {
+			return err
+		}
+		s.progress(step.name, start)
+	}
+
+	return nil
+}
+
+// addRegions adds the regions of the cities that are not listed yet.
+func (s *SQLiteStore) addRegions() error {
+	_, err := s.db.Exec(`
+		INSERT OR IGNORE INTO regions (iso2, name)
+		SELECT DISTINCT iso2, admin_name FROM cities WHERE admin_name != '';
+	`)
+	if err != nil {
+		return fmt.Errorf("error populating regions table: %w", err)
+	}
+
+	return nil
+}
+
+// loadIPRanges reads the IP2Location ranges into memory, where LookupIP
+// searches them from then on.
+func (s *SQLiteStore) loadIPRanges() error {
+	r, err := readIPRanges(s.db)
+	if err != nil {
+		return err
+	}
+	s.ipRanges.Store(r)
+
+	return nil
+}
+
+// MigrateUp applies the pending schema migrations in order.
+func (s *SQLiteStore) MigrateUp(ctx context.Context) error {
+	return migrateUp(ctx, s, "sqlite")
+}
+
+// MigrateDown reverts the last applied schema migration.
+func (s *SQLiteStore) MigrateDown(ctx context.Context) error {
+	return migrateDown(ctx, s, "sqlite")
+}
+
+// Migrations returns the schema migrations and whether they have been
+// applied.
+func (s *SQLiteStore) Migrations(ctx context.Context) ([]MigrationStatus, error) {
+	return migrationStatus(ctx, s, "sqlite")
+}
+
+func (s *SQLiteStore) appliedMigrations(ctx context.Context) (map[int]time.Time, error) {
+	_, err := s.db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at INTEGER NOT NULL
+		);
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("error creating schema_migrations table: %w", err)
+	}
+
+	if err := s.adoptLegacyMigrations(ctx); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, `SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("error selecting schema migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var appliedAt int64
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, fmt.Errorf("error scanning: %w", err)
+		}
+		applied[version] = time.Unix(appliedAt, 0)
+	}
+
+	return applied, rows.Err()
+}
+
+func (s *SQLiteStore) runMigration(ctx context.Context, m Migration, up bool) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	script, record, args := m.Up, `INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)`, []any{m.Version, m.Name, time.Now().Unix()}
+	if !up {
+		script, record, args = m.Down, `DELETE FROM schema_migrations WHERE version = ?`, []any{m.Version}
+	}
+
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+		return fmt.Errorf("error recording migration: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// adoptLegacyMigrations records the schema migrations already applied to a
+// database set up before they were versioned, which kept the names of the
+// applied steps in a migrations table, and drops that table.
+func (s *SQLiteStore) adoptLegacyMigrations(ctx context.Context) error {
+	hasLegacy, err := s.hasTable("migrations")
+	if err != nil || !hasLegacy {
+		return err
+	}
+
+	migrations, err := loadMigrations("sqlite")
+	if err != nil {
+		return err
+	}
+
+	applied, err := legacyVersions(migrations, func(m Migration) (bool, error) {
+		switch m.Name {
+		case "create_tables":
+			return s.legacyMigrationApplied("cities_table")
+		case "add_timezone":
+			return s.hasColumn("cities", "timezone")
+		case "add_elevation":
+			return s.hasColumn("cities", "elevation")
+		case "create_regions":
+			return s.hasTable("regions")
+		default:
+			return false, nil
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, m := range applied {
+		_, err := tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)`, m.Version, m.Name, time.Now().Unix())
+		if err != nil {
+			return fmt.Errorf("error recording migration: %w", err)
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, `DROP TABLE migrations`); err != nil {
+		return fmt.Errorf("error dropping migrations table: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+func (s *SQLiteStore) legacyMigrationApplied(name string) (bool, error) {
+	var applied bool
+	err := s.db.QueryRow(`
+		SELECT EXISTS (SELECT 1 from migrations WHERE name = ?)
+	`, name).Scan(&applied)
+	if err != nil {
+		return false, fmt.Errorf("error checking migration status: %w", err)
+	}
+
+	return applied, nil
+}
+
+func (s *SQLiteStore) hasTable(name string) (bool, error) {
+	var exists bool
+	err := s.db.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM sqlite_master WHERE type = 'table' AND name = ?)
+	`, name).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("error checking %s table: %w", name, err)
+	}
+
+	return exists, nil
+}
+
+func (s *SQLiteStore) hasColumn(table, column string) (bool, error) {
+	var exists bool
+	err := s.db.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM pragma_table_info(?) WHERE name = ?)
+	`, table, column).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("error checking %s columns: %w", table, err)
+	}
+
+	return exists, nil
+}
+
+// hasWorldCities reports whether the world cities bundled with the package
+// have been imported, as opposed to places from other sources only.
+func (s *SQLiteStore) hasWorldCities() (bool, error) {
+	var exists bool
+	if err := s.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM cities WHERE source = '')`).Scan(&exists); err != nil {
+		return false, fmt.Errorf("error checking cities rows: %w", err)
+	}
+
+	return exists, nil
+}
+
+func (s *SQLiteStore) hasRows(table string) (bool, error) {
+	var exists bool
+	if err := s.db.QueryRow(fmt.Sprintf(`SELECT EXISTS (SELECT 1 FROM %s)`, table)).Scan(&exists); err != nil {
+		return false, fmt.Errorf("error checking %s rows: %w", table, err)
+	}
+
+	return exists, nil
+}
+
+// createRTree indexes the coordinates of the cities in an R*Tree, each city
+// being a bounding box reduced to a point. The R*Tree is not part of the
+// schema migrations since SQLite may be built without it, in which case
+// nearby queries use the geohash index instead.
+func (s *SQLiteStore) createRTree() error {
+	exists, err := s.hasTable("cities_rtree")
+	if err != nil || exists {
+		return err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		CREATE VIRTUAL TABLE cities_rtree USING rtree(
+			id,
+			min_lat, max_lat,
+			min_lng, max_lng
+		);
+	`)
+	if err != nil {
+		if strings.Contains(err.Error(), "no such module: rtree") {
+			s.noRTree.Store(true)
+			return nil
+		}
+		return fmt.Errorf("error creating cities_rtree table: %w", err)
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO cities_rtree (id, min_lat, max_lat, min_lng, max_lng)
+		SELECT id, lat, lat, lng, lng FROM cities;
+	`)
+	if err != nil {
+		return fmt.Errorf("error populating the virtual table cities_rtree: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	return nil
+}
+
+// addTimezones fills in the timezone of the cities imported before it was
+// stored.
+func (s *SQLiteStore) addTimezones() error {
+	rows, err := s.db.Query(`SELECT id, lat, lng FROM cities WHERE timezone IS NULL`)
+	if err != nil {
+		return fmt.Errorf("error selecting cities without timezone: %w", err)
+	}
+
+	var cities []City
+	for rows.Next() {
+		var c City
+		if err := rows.Scan(&c.ID, &c.Lat, &c.Lng); err != nil {
+			rows.Close()
+			return fmt.Errorf("error scanning: %w", err)
+		}
+		cities = append(cities, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error during iteration: %w", err)
+	}
+
+	if len(cities) == 0 {
+		return nil
+	}
+
+	timezoneOf, err := newTimezoneFinder()
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`UPDATE cities SET timezone = ? WHERE id = ?`)
+	if err != nil {
+		return fmt.Errorf("error preparing timezone update: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, c := range cities {
+		if _, err := stmt.Exec(timezoneOf(c.Lat, c.Lng), c.ID); err != nil {
+			return fmt.Errorf("error updating timezone: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// addPhoneticKeys fills in the phonetic key of the cities that have none
+// yet, e.g. the ones imported before it was stored.
+func (s *SQLiteStore) addPhoneticKeys() error {
+	rows, err := s.db.Query(`SELECT id, city_ascii FROM cities WHERE metaphone IS NULL`)
+	if err != nil {
+		return fmt.Errorf("error selecting cities without phonetic key: %w", err)
+	}
+
+	var cities []City
+	for rows.Next() {
+		var c City
+		if err := rows.Scan(&c.ID, &c.CityAscii); err != nil {
+			rows.Close()
+			return fmt.Errorf("error scanning: %w", err)
+		}
+		cities = append(cities, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error during iteration: %w", err)
+	}
+
+	if len(cities) == 0 {
+		return nil
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`UPDATE cities SET metaphone = ? WHERE id = ?`)
+	if err != nil {
+		return fmt.Errorf("error preparing phonetic key update: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, c := range cities {
+		if _, err := stmt.Exec(phoneticKey(c.CityAscii), c.ID); err != nil {
+			return fmt.Errorf("error updating phonetic key: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// addNameTokens segments the names of the cities written in scripts without
+// spaces whose tokens are not stored yet, e.g. the ones imported before they
+// were, and indexes them.
+func (s *SQLiteStore) addNameTokens() error {
+	rows, err := s.db.Query(`SELECT id, city, admin_name, name_tokens FROM cities`)
+	if err != nil {
+		return fmt.Errorf("error selecting city names: %w", err)
+	}
+
+	var (
+		all    []City
+		tokens []string
+	)
+	for rows.Next() {
+		var (
+			c City
+			t string
+		)
+		if err := rows.Scan(&c.ID, &c.City, &c.AdminName, &t); err != nil {
+			rows.Close()
+			return fmt.Errorf("error scanning: %w", err)
+		}
+		all, tokens = append(all, c), append(tokens, t)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error during iteration: %w", err)
+	}
+
+	// The names of every city are segmented again on every start, to find
+	// the ones whose tokens changed.
+	changed := make([]bool, len(all))
+	parallelize(len(all), func(i int) {
+		changed[i] = nameTokens(all[i]) != tokens[i]
+	})
+	var cities []City
+	for i, c := range all {
+		if changed[i] {
+			cities = append(cities, c)
+		}
+	}
+
+	if len(cities) == 0 {
+		return nil
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// The entries of the external content FTS table are removed with the
+	// tokens they were indexed with, before these are updated.
+	removeFTS, err := tx.Prepare(`
+		INSERT INTO cities_fts(cities_fts, rowid, city, city_ascii, lat, lng, country, iso2, iso3, admin_name, capital, population, id, name_tokens)
+		SELECT 'delete', rowid, city, city_ascii, lat, lng, country, iso2, iso3, admin_name, capital, population, id, name_tokens FROM cities WHERE id = ?
+	`)
+	if err != nil {
+		return fmt.Errorf("error preparing cities_fts deletion: %w", err)
+	}
+	defer removeFTS.Close()
+
+	update, err := tx.Prepare(`UPDATE cities SET name_tokens = ? WHERE id = ?`)
+	if err != nil {
+		return fmt.Errorf("error preparing name tokens update: %w", err)
+	}
+	defer update.Close()
+
+	addFTS, err := tx.Prepare(`
+		INSERT INTO cities_fts(rowid, city, city_ascii, lat, lng, country, iso2, iso3, admin_name, capital, population, id, name_tokens)
+		SELECT rowid, city, city_ascii, lat, lng, country, iso2, iso3, admin_name, capital, population, id, name_tokens FROM cities WHERE id = ?
+	`)
+	if err != nil {
+		return fmt.Errorf("error preparing cities_fts insertion: %w", err)
+	}
+	defer addFTS.Close()
+
+	for _, c := range cities {
+		if _, err := removeFTS.Exec(c.ID); err != nil {
+			return fmt.Errorf("error deleting from cities_fts: %w", err)
+		}
+
+		if _, err := update.Exec(nameTokens(c), c.ID); err != nil {
+			return fmt.Errorf("error updating name tokens: %w", err)
+		}
+
+		if _, err := addFTS.Exec(c.ID); err != nil {
+			return fmt.Errorf("error inserting into cities_fts: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// ImportElevation sets the elevation of the cities that have not been looked
+// up yet from src. The ones src has no data for, e.g. on small islands
+// without a tile, are marked as looked up too, so that they are not read
+// again on every start.
+func (s *SQLiteStore) ImportElevation(src ElevationSource) error {
+	rows, err := s.db.Query(`SELECT id, lat, lng FROM cities WHERE elevation IS NULL AND NOT elevation_checked`)
+	if err != nil {
+		return fmt.Errorf("error selecting cities without elevation: %w", err)
+	}
+
+	var cities []City
+	for rows.Next() {
+		var c City
+		if err := rows.Scan(&c.ID, &c.Lat, &c.Lng); err != nil {
+			rows.Close()
+			return fmt.Errorf("error scanning: %w", err)
+		}
+		cities = append(cities, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error during iteration: %w", err)
+	}
+
+	cities, err = elevationsOf(src, cities)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`UPDATE cities SET elevation = ?, elevation_checked = TRUE WHERE id = ?`)
+	if err != nil {
+		return fmt.Errorf("error preparing elevation update: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, c := range cities {
+		if _, err := stmt.Exec(c.Elevation, c.ID); err != nil {
+			return fmt.Errorf("error updating elevation: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// RefreshIPRanges downloads the IP2Location LITE database again and imports
+// it into a staging table, which then replaces the ip2location table in a
+// single transaction so that lookups never see a partial set of ranges.
+func (s *SQLiteStore) RefreshIPRanges(ip2LocationToken string) error {
+	path, err := downloadIP2LocationDB(ip2LocationToken, s.IPDatabase, s.DownloadDir)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(path)
+
+	if _, err := s.db.Exec(`DROP TABLE IF EXISTS ip2location_staging`); err != nil {
+		return fmt.Errorf("error dropping ip2location_staging table: %w", err)
+	}
+
+	if _, err := s.db.Exec(`CREATE TABLE ip2location_staging AS SELECT * FROM ip2location LIMIT 0`); err != nil {
+		return fmt.Errorf("error creating ip2location_staging table: %w", err)
+	}
+
+	if err := s.importIP2Location("ip2location_staging", path); err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// The staging table is created without the index, which is dropped with
+	// the former table and built again on the new one.
+	for _, stmt := range []string{
+		`DROP TABLE IF EXISTS ip2location`,
+		`ALTER TABLE ip2location_staging RENAME TO ip2location`,
+		`CREATE INDEX ip2location_start_ip_idx ON ip2location (start_ip)`,
+	} {
+		if _, err := tx.Exec(stmt); err != nil {
+			return fmt.Errorf("error swapping ip2location tables: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	return s.loadIPRanges()
+}
+
+// importIP2Location inserts the ranges of the IP2Location CSV file into table
+// in batches within a single transaction.
+func (s *SQLiteStore) importIP2Location(table, path string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	err = readIP2LocationBatches(path, func(rows [][]any) error {
+		return insertBatches(tx, table+" (start_ip, end_ip, iso2, country, region, city, lat, lng, zip, utc_offset)", "(?, ?, ?, ?, ?, ?, ?, ?, ?, ?)", rows)
+	})
+	if err != nil {
+		return fmt.Errorf("error importing CSV data into %s table: %w", table, err)
+	}
+
+	return tx.Commit()
+}
+
+// ImportPostalCodes replaces the postal codes of the countries listed in
+// codes with them, within a single transaction.
+func (s *SQLiteStore) ImportPostalCodes(ctx context.Context, codes []PostalCode) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows := make([][]any, 0, len(codes))
+	countries := make(map[string]bool)
+	for _, p := range codes {
+		if !countries[p.Iso2] {
+			if _, err := tx.ExecContext(ctx, `DELETE FROM postal_codes WHERE iso2 = ?`, p.Iso2); err != nil {
+				return fmt.Errorf("error deleting postal codes of %s: %w", p.Iso2, err)
+			}
+			countries[p.Iso2] = true
+		}
+		rows = append(rows, []any{p.Iso2, postalCodeKey(p.Code), p.Place, p.AdminName, p.Lat, p.Lng})
+	}
+
+	if err := insertBatches(tx, "postal_codes (iso2, code, place, admin_name, lat, lng)", "(?, ?, ?, ?, ?, ?)", rows); err != nil {
+		return fmt.Errorf("error inserting postal codes: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// ImportLocodes replaces the UN/LOCODE entries of the countries listed in
+// locodes with them, within a single transaction.
+func (s *SQLiteStore) ImportLocodes(ctx context.Context, locodes []Locode) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows := make([][]any, 0, len(locodes))
+	countries := make(map[string]bool)
+	for _, l := range locodes {
+		if !countries[l.Iso2] {
+			if _, err := tx.ExecContext(ctx, `DELETE FROM locodes WHERE iso2 = ?`, l.Iso2); err != nil {
+				return fmt.Errorf("error deleting UN/LOCODE entries of %s: %w", l.Iso2, err)
+			}
+			countries[l.Iso2] = true
+		}
+		rows = append(rows, []any{l.Iso2, l.Code, l.Name, l.Subdivision, l.lat(), l.lng()})
+	}
+
+	if err := insertBatches(tx, "locodes (iso2, code, name, subdivision, lat, lng)", "(?, ?, ?, ?, ?, ?)", rows); err != nil {
+		return fmt.Errorf("error inserting UN/LOCODE entries: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// ImportAirports replaces the imported airports with airports, within a
+// single transaction.
+func (s *SQLiteStore) ImportAirports(ctx context.Context, airports []Airport) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM airports`); err != nil {
+		return fmt.Errorf("error deleting airports: %w", err)
+	}
+
+	rows := make([][]any, 0, len(airports))
+	for _, a := range airports {
+		rows = append(rows, []any{a.Ident, a.IATA, a.Name, a.Type, a.Municipality, a.Iso2, a.Lat, a.Lng, a.Elevation, a.Scheduled})
+	}
+
+	if err := insertBatches(tx, "airports (ident, iata, name, type, municipality, iso2, lat, lng, elevation, scheduled)", "(?, ?, ?, ?, ?, ?, ?, ?, ?, ?)", rows); err != nil {
+		return fmt.Errorf("error inserting airports: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// cityRows are the rows of the cities and geospatial_index tables for the
+// embedded world cities.
+type cityRows struct {
+	cities, geohashes [][]any
+}
+
+// readCityRows parses the embedded world cities and computes their rows,
+// split between a worker per CPU.
+func readCityRows() (cityRows, error) {
+	cities, err := readWorldCities()
+	if err != nil {
+		return cityRows{}, err
+	}
+
+	rows := cityRows{
+		cities:    make([][]any, len(cities)),
+		geohashes: make([][]any, len(cities)),
+	}
+	parallelize(len(cities), func(i int) {
+		c := cities[i]
+		rows.cities[i] = []any{c.City, c.CityAscii, c.Lat, c.Lng, c.Country, c.Iso2, c.Iso3, c.AdminName, c.Capital, c.Population, c.ID, c.Timezone, phoneticKey(c.CityAscii), nameTokens(c)}
+		rows.geohashes[i] = []any{geohash.Encode(c.Lat, c.Lng), c.ID}
+	})
+
+	return rows, nil
+}
+
+// importCities inserts the rows of the world cities in batches, along with
+// their full-text and geohash index entries, within a single transaction.
+func (s *SQLiteStore) importCities(rows cityRows) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	err = insertBatches(tx, "cities (city, city_ascii, lat, lng, country, iso2, iso3, admin_name, capital, population, id, timezone, metaphone, name_tokens)", "(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)", rows.cities)
+	if err != nil {
+		return fmt.Errorf("error importing CSV data into cities table: %w", err)
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO cities_fts(city, city_ascii, lat, lng, country, iso2, iso3, admin_name, capital, population, id, name_tokens)
+		SELECT city, city_ascii, lat, lng, country, iso2, iso3, admin_name, capital, population, id, name_tokens FROM cities;
+	`)
+	if err != nil {
+		return fmt.Errorf("error populating the virtual table cities_fts: %w", err)
+	}
+
+	err = insertBatches(tx, "geospatial_index (geohash, city_id)", "(?, ?)", rows.geohashes)
+	if err != nil {
+		return fmt.Errorf("error inserting into geospatial_index: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// UpdateCities applies a new release of the cities of source: the ones it
+// no longer has are deleted, and the new and changed ones are written along
+// with their full-text, geohash and R*Tree entries, all within a single
+// transaction.
+func (s *SQLiteStore) UpdateCities(ctx context.Context, source string, release []City) (CityChanges, error) {
+	d, err := diffCities(ctx, s, source, release)
+	if err != nil {
+		return CityChanges{}, err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return CityChanges{}, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// The entries of an external content FTS table are removed with the
+	// values they were indexed with, which are still in the cities table.
+	removeFTS := func(id string) error {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO cities_fts(cities_fts, rowid, city, city_ascii, lat, lng, country, iso2, iso3, admin_name, capital, population, id, name_tokens)
+			SELECT 'delete', rowid, city, city_ascii, lat, lng, country, iso2, iso3, admin_name, capital, population, id, name_tokens FROM cities WHERE id = ?
+		`, id)
+		if err != nil {
+			return fmt.Errorf("error deleting from cities_fts: %w", err)
+		}
+		return nil
+	}
+
+	addFTS := func(id string) error {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO cities_fts(rowid, city, city_ascii, lat, lng, country, iso2, iso3, admin_name, capital, population, id, name_tokens)
+			SELECT rowid, city, city_ascii, lat, lng, country, iso2, iso3, admin_name, capital, population, id, name_tokens FROM cities WHERE id = ?
+		`, id)
+		if err != nil {
+			return fmt.Errorf("error inserting into cities_fts: %w", err)
+		}
+		return nil
+	}
+
+	type statement struct {
+		query string
+		args  []any
+	}
+
+	execAll := func(stmts []statement) error {
+		for _, stmt := range stmts {
+			if _, err := tx.ExecContext(ctx, stmt.query, stmt.args...); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	hasRTree := !s.noRTree.Load()
+
+	for _, c := range d.deleted {
+		if err := removeFTS(c.ID); err != nil {
+			return CityChanges{}, err
+		}
+
+		stmts := []statement{
+			{`DELETE FROM geospatial_index WHERE city_id = ?`, []any{c.ID}},
+			{`DELETE FROM cities WHERE id = ?`, []any{c.ID}},
+		}
+		if hasRTree {
+			stmts = append(stmts, statement{`DELETE FROM cities_rtree WHERE id = ?`, []any{c.ID}})
+		}
+		if err := execAll(stmts); err != nil {
+			return CityChanges{}, fmt.Errorf("error deleting city %s: %w", c.ID, err)
+		}
+	}
+
+	for _, c := range d.updated {
+		if err := removeFTS(c.ID); err != nil {
+			return CityChanges{}, err
+		}
+
+		stmts := []statement{{`
+			UPDATE cities SET city = ?, city_ascii = ?, lat = ?, lng = ?, country = ?, iso2 = ?, iso3 = ?, admin_name = ?, capital = ?, population = ?, timezone = ?, metaphone = ?, name_tokens = ?
+			WHERE id = ?
+		`, []any{c.City, c.CityAscii, c.Lat, c.Lng, c.Country, c.Iso2, c.Iso3, c.AdminName, c.Capital, c.Population, c.Timezone, phoneticKey(c.CityAscii), nameTokens(c), c.ID}}}
+		if d.moved[c.ID] {
+			stmts = append(stmts,
+				statement{`UPDATE cities SET elevation = NULL, elevation_checked = FALSE WHERE id = ?`, []any{c.ID}},
+				statement{`UPDATE geospatial_index SET geohash = ? WHERE city_id = ?`, []any{geohash.Encode(c.Lat, c.Lng), c.ID}},
+			)
+			if hasRTree {
+				stmts = append(stmts, statement{`UPDATE cities_rtree SET min_lat = ?, max_lat = ?, min_lng = ?, max_lng = ? WHERE id = ?`, []any{c.Lat, c.Lat, c.Lng, c.Lng, c.ID}})
+			}
+		}
+		if err := execAll(stmts); err != nil {
+			return CityChanges{}, fmt.Errorf("error updating city %s: %w", c.ID, err)
+		}
+
+		if err := addFTS(c.ID); err != nil {
+			return CityChanges{}, err
+		}
+	}
+
+	for _, c := range d.inserted {
+		stmts := []statement{
+			{`
+				INSERT INTO cities (city, city_ascii, lat, lng, country, iso2, iso3, admin_name, capital, population, id, timezone, source, metaphone, name_tokens)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			`, []any{c.City, c.CityAscii, c.Lat, c.Lng, c.Country, c.Iso2, c.Iso3, c.AdminName, c.Capital, c.Population, c.ID, c.Timezone, c.Source, phoneticKey(c.CityAscii), nameTokens(c)}},
+			{`INSERT INTO geospatial_index (geohash, city_id) VALUES (?, ?)`, []any{geohash.Encode(c.Lat, c.Lng), c.ID}},
+		}
+		if hasRTree {
+			stmts = append(stmts, statement{`INSERT INTO cities_rtree (id, min_lat, max_lat, min_lng, max_lng) VALUES (?, ?, ?, ?, ?)`, []any{c.ID, c.Lat, c.Lat, c.Lng, c.Lng}})
+		}
+		if err := execAll(stmts); err != nil {
+			return CityChanges{}, fmt.Errorf("error inserting city %s: %w", c.ID, err)
+		}
+
+		if err := addFTS(c.ID); err != nil {
+			return CityChanges{}, err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT OR IGNORE INTO regions (iso2, name)
+		SELECT DISTINCT iso2, admin_name FROM cities WHERE admin_name != '';
+		DELETE FROM regions
+		WHERE NOT EXISTS (SELECT 1 FROM cities WHERE cities.iso2 = regions.iso2 AND cities.admin_name = regions.name);
+	`)
+	if err != nil {
+		return CityChanges{}, fmt.Errorf("error updating regions: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return CityChanges{}, fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	return d.changes(), nil
+}
+
+// downloadIP2LocationDB downloads the CSV file of the product, DB5 by
+// default, to dir and returns its path.
+func downloadIP2LocationDB(token string, db IP2LocationDB, dir string) (string, error) {
+	if db == "" {
+		db = IP2LocationDB5
+	}
+	name := "IP2LOCATION-LITE-" + string(db) + ".CSV"
+	fileName := filepath.Join(dir, name)
+	zipFileName := fileName + ".zip"
+
+	resp, err := http.Get(fmt.Sprintf("https://www.ip2location.com/download/?token=%s&file=%sLITE", token, db))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return "", err
+		}
+	}
+	file, err := os.Create(zipFileName)
+	if err != nil {
+		return "", fmt.Errorf("error creating ip2Location file: %w", err)
+	}
+	defer file.Close()
+
+	_, err = io.Copy(file, resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	r, err := zip.OpenReader(zipFileName)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+
+	for _, file := range r.File {
+		if file.Name != name {
+			continue
+		}
+
+		outFile, err := os.Create(fileName)
+		if err != nil {
+			return "", err
+		}
+		defer outFile.Close()
+
+		rc, err := file.Open()
+		if err != nil {
+			return "", err
+		}
+		defer rc.Close()
+
+		_, err = io.Copy(outFile, rc)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if err := os.Remove(zipFileName); err != nil {
+		return "", err
+	}
+
+	return fileName, nil
+}
@@ -0,0 +1,9 @@
+package nearbycities
+
+import "context"
+
+// SpatialIndex finds the cities around coordinates. Every Storage is a
+// SpatialIndex; KDTree is an in-memory alternative.
+type SpatialIndex interface {
+	NearbyByLatLng(ctx context.Context, lat, lng, radius float64) ([]City, error)
+}
@@ -0,0 +1,61 @@
+package nearbycities
+
+import (
+	"fmt"
+	"net"
+)
+
+// IsPrivateIP reports whether ip belongs to one of the private IPv4 ranges,
+// which cannot be located.
+func IsPrivateIP(ip net.IP) bool {
+	privateIPv4Ranges := []struct {
+		start net.IP
+		end   net.IP
+	}{
+		{
+			net.ParseIP("10.0.0.0"),
+			net.ParseIP("10.255.255.255"),
+		},
+		{
+			net.ParseIP("172.16.0.0"),
+			net.ParseIP("172.31.255.255"),
+		},
+		{
+			net.ParseIP("192.168.0.0"),
+			net.ParseIP("192.168.255.255"),
+		},
+	}
+
+	for _, r := range privateIPv4Ranges {
+		if bytesWithinRange(ip.To4(), r.start.To4(), r.end.To4()) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func bytesWithinRange(b, start, end []byte) bool {
+	for i := 0; i < len(b); i++ {
+		if b[i] < start[i] || b[i] > end[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func ipToInteger(ipAddr string) (uint32, error) {
+	parsedIP := net.ParseIP(ipAddr)
+	if parsedIP == nil {
+		return 0, fmt.Errorf("invalid IP address: %s", ipAddr)
+	}
+
+	ipBytes := parsedIP.To4()
+	if ipBytes == nil {
+		return 0, fmt.Errorf("not an IPv4 address: %s", ipAddr)
+	}
+
+	ipInteger := uint32(ipBytes[0])<<24 | uint32(ipBytes[1])<<16 | uint32(ipBytes[2])<<8 | uint32(ipBytes[3])
+
+	return ipInteger, nil
+}
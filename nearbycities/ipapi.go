@@ -0,0 +1,160 @@
+package nearbycities
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultIPAPIURL = "http://ip-api.com/json/{ip}?fields=status,message,countryCode,country,regionName,city,lat,lon"
+
+// errRemoteRateLimited is returned instead of calling the remote service
+// when the request budget is spent.
+var errRemoteRateLimited = errors.New("remote IP lookup rate limit exceeded")
+
+// RemoteIPLocator locates IP addresses with a remote service speaking the
+// ip-api.com JSON format. Answers are cached and the requests are limited to
+// stay within the quota of the service.
+type RemoteIPLocator struct {
+	// URL is the lookup URL, {ip} being replaced by the address. It defaults
+	// to the free ip-api.com endpoint.
+	URL string
+	// CacheTTL is how long answers are kept, one day by default.
+	CacheTTL time.Duration
+	// RequestsPerMinute caps the calls to the service, 45 by default.
+	RequestsPerMinute int
+	Client            *http.Client
+
+	mu          sync.Mutex
+	cache       map[string]cachedIPLocation
+	windowStart time.Time
+	requests    int
+}
+
+type cachedIPLocation struct {
+	loc     IPLocation
+	err     error
+	expires time.Time
+}
+
+type ipAPIResponse struct {
+	Status      string  `json:"status"`
+	Message     string  `json:"message"`
+	Country     string  `json:"country"`
+	CountryCode string  `json:"countryCode"`
+	RegionName  string  `json:"regionName"`
+	City        string  `json:"city"`
+	Zip         string  `json:"zip"`
+	Lat         float64 `json:"lat"`
+	Lon         float64 `json:"lon"`
+}
+
+// LookupIP returns the location of the address according to the remote
+// service.
+func (l *RemoteIPLocator) LookupIP(ctx context.Context, ip string) (IPLocation, error) {
+	if cached, ok := l.cached(ip); ok {
+		return cached.loc, cached.err
+	}
+
+	if !l.allow() {
+		return IPLocation{}, errRemoteRateLimited
+	}
+
+	rawURL := l.URL
+	if rawURL == "" {
+		rawURL = defaultIPAPIURL
+	}
+
+	var resp ipAPIResponse
+	if err := getJSON(ctx, l.Client, strings.ReplaceAll(rawURL, "{ip}", ip), &resp); err != nil {
+		return IPLocation{}, fmt.Errorf("remote IP lookup: %w", err)
+	}
+
+	var (
+		loc IPLocation
+		err error
+	)
+	if resp.Status == "success" {
+		loc = IPLocation{
+			Iso2:    resp.CountryCode,
+			Country: resp.Country,
+			Region:  resp.RegionName,
+			City:    resp.City,
+			Lat:     resp.Lat,
+			Lng:     resp.Lon,
+			Zip:     resp.Zip,
+		}
+	} else {
+		err = ErrNotFound
+	}
+
+	l.store(ip, loc, err)
+
+	return loc, err
+}
+
+func (l *RemoteIPLocator) cached(ip string) (cachedIPLocation, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	c, ok := l.cache[ip]
+	if !ok || time.Now().After(c.expires) {
+		return cachedIPLocation{}, false
+	}
+
+	return c, true
+}
+
+func (l *RemoteIPLocator) store(ip string, loc IPLocation, err error) {
+	ttl := l.CacheTTL
+	if ttl == 0 {
+		ttl = 24 * time.Hour
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.cache == nil {
+		l.cache = make(map[string]cachedIPLocation)
+	}
+
+	now := time.Now()
+	// Drop the expired answers from time to time so the cache stays bounded
+	// by the number of visitors seen within a TTL.
+	if len(l.cache)%1000 == 999 {
+		for k, c := range l.cache {
+			if now.After(c.expires) {
+				delete(l.cache, k)
+			}
+		}
+	}
+
+	l.cache[ip] = cachedIPLocation{loc: loc, err: err, expires: now.Add(ttl)}
+}
+
+// allow reports whether a request fits in the budget of the current minute.
+func (l *RemoteIPLocator) allow() bool {
+	limit := l.RequestsPerMinute
+	if limit == 0 {
+		limit = 45
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(l.windowStart) >= time.Minute {
+		l.windowStart, l.requests = now, 0
+	}
+
+	if l.requests >= limit {
+		return false
+	}
+
+	l.requests++
+	return true
+}
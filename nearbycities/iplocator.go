@@ -0,0 +1,34 @@
+package nearbycities
+
+import (
+	"context"
+	"errors"
+)
+
+// IPLocator resolves an IPv4 address to a location. It returns ErrNotFound
+// if the address is not in any known range. Every Storage is an IPLocator
+// backed by the imported IP2Location ranges.
+type IPLocator interface {
+	LookupIP(ctx context.Context, ip string) (IPLocation, error)
+}
+
+// ipLocatorChain tries each IPLocator in turn until one locates the address.
+// A failing locator, e.g. a storage whose ranges are not imported yet, is
+// skipped like one that does not know the address.
+type ipLocatorChain []IPLocator
+
+func (c ipLocatorChain) LookupIP(ctx context.Context, ip string) (IPLocation, error) {
+	err := ErrNotFound
+	for _, l := range c {
+		loc, lookupErr := l.LookupIP(ctx, ip)
+		if lookupErr == nil {
+			return loc, nil
+		}
+
+		if !errors.Is(lookupErr, ErrNotFound) {
+			err = lookupErr
+		}
+	}
+
+	return IPLocation{}, err
+}
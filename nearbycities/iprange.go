@@ -0,0 +1,77 @@
+package nearbycities
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+)
+
+// ipRange is an IP2Location range of ipRanges, place indexing the location
+// it shares with the other ranges of the same place.
+type ipRange struct {
+	start, end uint32
+	place      int32
+}
+
+// ipRanges holds the IP2Location ranges in memory, sorted by their end, so
+// that an address is located with a binary search instead of a query.
+type ipRanges struct {
+	ranges []ipRange
+	places []IPLocation
+}
+
+// readIPRanges reads the ranges of the ip2location table. The millions of
+// ranges only have a few hundred thousand distinct locations, which are
+// stored once.
+func readIPRanges(db *sql.DB) (*ipRanges, error) {
+	rows, err := db.Query(`SELECT start_ip, end_ip, iso2, country, region, city, lat, lng, zip, utc_offset FROM ip2location`)
+	if err != nil {
+		return nil, fmt.Errorf("error selecting IP ranges: %w", err)
+	}
+	defer rows.Close()
+
+	r := &ipRanges{}
+	seen := make(map[IPLocation]int32)
+	for rows.Next() {
+		var loc IPLocation
+		if err := rows.Scan(&loc.StartIP, &loc.EndIP, &loc.Iso2, &loc.Country, &loc.Region, &loc.City, &loc.Lat, &loc.Lng, &loc.Zip, &loc.UTCOffset); err != nil {
+			return nil, fmt.Errorf("error scanning: %w", err)
+		}
+
+		start, end := loc.StartIP, loc.EndIP
+		loc.StartIP, loc.EndIP = 0, 0
+		place, ok := seen[loc]
+		if !ok {
+			place = int32(len(r.places))
+			seen[loc] = place
+			r.places = append(r.places, loc)
+		}
+
+		r.ranges = append(r.ranges, ipRange{start: start, end: end, place: place})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error during iteration: %w", err)
+	}
+
+	sort.Slice(r.ranges, func(i, j int) bool {
+		return r.ranges[i].end < r.ranges[j].end
+	})
+
+	return r, nil
+}
+
+// lookup returns the location of the first range ending at or after ip,
+// provided that it starts at or before it.
+func (r *ipRanges) lookup(ip uint32) (IPLocation, bool) {
+	i := sort.Search(len(r.ranges), func(i int) bool {
+		return r.ranges[i].end >= ip
+	})
+	if i == len(r.ranges) || r.ranges[i].start > ip {
+		return IPLocation{}, false
+	}
+
+	loc := r.places[r.ranges[i].place]
+	loc.StartIP, loc.EndIP = r.ranges[i].start, r.ranges[i].end
+
+	return loc, true
+}
@@ -0,0 +1,105 @@
+package nearbycities
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestLookupIP(t *testing.T) {
+	ctx := context.Background()
+	store, err := Open(filepath.Join(t.TempDir(), "nearby_cities.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if err := store.MigrateUp(ctx); err != nil {
+		skipWithoutFTS5(t, err)
+		t.Fatal(err)
+	}
+
+	hanoi := IPLocation{Iso2: "VN", Country: "Vietnam", Region: "Ha Noi", City: "Hanoi", Lat: 21.0245, Lng: 105.8412, UTCOffset: "+07:00"}
+	tokyo := IPLocation{Iso2: "JP", Country: "Japan", Region: "Tokyo", City: "Tokyo", Lat: 35.6895, Lng: 139.6917, Zip: "100-0001", UTCOffset: "+09:00"}
+	// The ranges are inserted out of order, the two of Hanoi around the
+	// one of Tokyo, and leave gaps between them.
+	ranges := []struct {
+		start, end uint32
+		loc        IPLocation
+	}{
+		{ip("14.160.0.0"), ip("14.160.255.255"), hanoi},
+		{ip("1.0.16.0"), ip("1.0.31.255"), tokyo},
+		{ip("1.0.0.0"), ip("1.0.0.255"), hanoi},
+		{ip("255.255.255.255"), ip("255.255.255.255"), tokyo},
+	}
+	for _, r := range ranges {
+		_, err := store.db.Exec(`
+			INSERT INTO ip2location (start_ip, end_ip, iso2, country, region, city, lat, lng, zip, utc_offset)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, r.start, r.end, r.loc.Iso2, r.loc.Country, r.loc.Region, r.loc.City, r.loc.Lat, r.loc.Lng, r.loc.Zip, r.loc.UTCOffset)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		ip         string
+		want       IPLocation
+		start, end string
+	}{
+		{"0.0.0.0", IPLocation{}, "", ""},
+		{"1.0.0.0", hanoi, "1.0.0.0", "1.0.0.255"},
+		{"1.0.0.128", hanoi, "1.0.0.0", "1.0.0.255"},
+		{"1.0.0.255", hanoi, "1.0.0.0", "1.0.0.255"},
+		{"1.0.1.0", IPLocation{}, "", ""},
+		{"1.0.15.255", IPLocation{}, "", ""},
+		{"1.0.16.0", tokyo, "1.0.16.0", "1.0.31.255"},
+		{"1.0.31.255", tokyo, "1.0.16.0", "1.0.31.255"},
+		{"14.160.1.2", hanoi, "14.160.0.0", "14.160.255.255"},
+		{"14.161.0.0", IPLocation{}, "", ""},
+		{"255.255.255.254", IPLocation{}, "", ""},
+		{"255.255.255.255", tokyo, "255.255.255.255", "255.255.255.255"},
+	}
+
+	// The ranges are searched in the database, then in memory once loaded,
+	// which are to give the same locations.
+	for _, where := range []string{"database", "memory"} {
+		if where == "memory" {
+			if err := store.loadIPRanges(); err != nil {
+				t.Fatal(err)
+			}
+			if r := store.ipRanges.Load(); len(r.ranges) != len(ranges) || len(r.places) != 2 {
+				t.Errorf("got %d ranges of %d places, want %d of 2", len(r.ranges), len(r.places), len(ranges))
+			}
+		}
+
+		for _, tt := range tests {
+			got, err := store.LookupIP(ctx, tt.ip)
+			if tt.start == "" {
+				if !errors.Is(err, ErrNotFound) {
+					t.Errorf("%s: %s: got %+v, %v, want ErrNotFound", where, tt.ip, got, err)
+				}
+				continue
+			}
+			if err != nil {
+				t.Errorf("%s: %s: %v", where, tt.ip, err)
+				continue
+			}
+
+			want := tt.want
+			want.StartIP, want.EndIP = ip(tt.start), ip(tt.end)
+			if got != want {
+				t.Errorf("%s: %s: got %+v, want %+v", where, tt.ip, got, want)
+			}
+		}
+	}
+}
+
+// ip returns the integer of the IPv4 address.
+func ip(s string) uint32 {
+	n, err := ipToInteger(s)
+	if err != nil {
+		panic(err)
+	}
+	return n
+}
@@ -0,0 +1,211 @@
+package nearbycities
+
+import (
+	"container/heap"
+	"context"
+	"math"
+	"sort"
+
+	"github.com/quantonganh/geohash"
+)
+
+const earthRadius = 6371.0 // km, the radius used by geohash.Distance
+
+// KDTree is an in-memory k-d tree over the cities, answering radius and
+// k-nearest queries exactly. The cities are placed on the unit sphere so that
+// the straight-line distance between two points only grows with their
+// great-circle distance, which also handles the antimeridian and the poles.
+type KDTree struct {
+	cities []City
+	points []kdPoint
+}
+
+type kdPoint struct {
+	xyz   [3]float64
+	index int
+}
+
+// BuildKDTree loads every city of store into a new tree.
+func BuildKDTree(ctx context.Context, store Storage) (*KDTree, error) {
+	var cities []City
+	err := store.EachCity(ctx, func(c City) error {
+		c.Geohash = geohash.Encode(c.Lat, c.Lng)
+		cities = append(cities, c)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return NewKDTree(cities), nil
+}
+
+// NewKDTree builds a tree over the cities.
+func NewKDTree(cities []City) *KDTree {
+	t := &KDTree{
+		cities: cities,
+		points: make([]kdPoint, len(cities)),
+	}
+
+	for i, c := range cities {
+		t.points[i] = kdPoint{xyz: toUnitVector(c.Lat, c.Lng), index: i}
+	}
+	t.build(0, len(t.points), 0)
+
+	return t
+}
+
+// Len returns the number of cities in the tree.
+func (t *KDTree) Len() int {
+	return len(t.cities)
+}
+
+// build arranges points[lo:hi] so that the median along the axis of depth
+// is in the middle, with the smaller points before it and the larger after.
+func (t *KDTree) build(lo, hi, depth int) {
+	if hi-lo <= 1 {
+		return
+	}
+
+	axis := depth % 3
+	pts := t.points[lo:hi]
+	sort.Slice(pts, func(i, j int) bool {
+		return pts[i].xyz[axis] < pts[j].xyz[axis]
+	})
+
+	mid := (lo + hi) / 2
+	t.build(lo, mid, depth+1)
+	t.build(mid+1, hi, depth+1)
+}
+
+// NearbyByLatLng returns the cities within radius kilometers of the
+// coordinates, sorted by distance.
+func (t *KDTree) NearbyByLatLng(_ context.Context, lat, lng, radius float64) ([]City, error) {
+	target := toUnitVector(lat, lng)
+	// Chord length on the unit sphere for the great-circle distance.
+	chord := 2 * math.Sin(math.Min(radius/earthRadius, math.Pi)/2)
+	maxDist2 := chord * chord
+
+	var found []int
+	var search func(lo, hi, depth int)
+	search = func(lo, hi, depth int) {
+		if lo >= hi {
+			return
+		}
+
+		mid := (lo + hi) / 2
+		p := t.points[mid]
+		if dist2(p.xyz, target) <= maxDist2 {
+			found = append(found, p.index)
+		}
+
+		axis := depth % 3
+		diff := target[axis] - p.xyz[axis]
+		if diff <= 0 || diff*diff <= maxDist2 {
+			search(lo, mid, depth+1)
+		}
+		if diff >= 0 || diff*diff <= maxDist2 {
+			search(mid+1, hi, depth+1)
+		}
+	}
+	search(0, len(t.points), 0)
+
+	return withDistances(t.cities, lat, lng, found), nil
+}
+
+// KNearest returns the k cities closest to the coordinates, nearest first.
+func (t *KDTree) KNearest(lat, lng float64, k int) []City {
+	if k <= 0 {
+		return []City{}
+	}
+
+	target := toUnitVector(lat, lng)
+	h := &kdHeap{}
+
+	var search func(lo, hi, depth int)
+	search = func(lo, hi, depth int) {
+		if lo >= hi {
+			return
+		}
+
+		mid := (lo + hi) / 2
+		p := t.points[mid]
+		d := dist2(p.xyz, target)
+		if h.Len() < k {
+			heap.Push(h, kdCandidate{index: p.index, dist2: d})
+		} else if d < (*h)[0].dist2 {
+			(*h)[0] = kdCandidate{index: p.index, dist2: d}
+			heap.Fix(h, 0)
+		}
+
+		axis := depth % 3
+		diff := target[axis] - p.xyz[axis]
+		near, far := [2]int{lo, mid}, [2]int{mid + 1, hi}
+		if diff > 0 {
+			near, far = far, near
+		}
+
+		search(near[0], near[1], depth+1)
+		if h.Len() < k || diff*diff < (*h)[0].dist2 {
+			search(far[0], far[1], depth+1)
+		}
+	}
+	search(0, len(t.points), 0)
+
+	found := make([]int, 0, h.Len())
+	for _, c := range *h {
+		found = append(found, c.index)
+	}
+
+	return withDistances(t.cities, lat, lng, found)
+}
+
+// withDistances returns the cities at the indexes, with their distance to the
+// coordinates, nearest first.
+func withDistances(all []City, lat, lng float64, indexes []int) []City {
+	cities := make([]City, 0, len(indexes))
+	for _, i := range indexes {
+		c := all[i]
+		c.Distance = math.Round(geohash.Distance(lat, lng, c.Lat, c.Lng)*100) / 100
+		cities = append(cities, c)
+	}
+
+	sort.Slice(cities, func(i, j int) bool {
+		return cities[i].Distance < cities[j].Distance
+	})
+
+	return cities
+}
+
+func toUnitVector(lat, lng float64) [3]float64 {
+	latRad, lngRad := lat*math.Pi/180, lng*math.Pi/180
+	return [3]float64{
+		math.Cos(latRad) * math.Cos(lngRad),
+		math.Cos(latRad) * math.Sin(lngRad),
+		math.Sin(latRad),
+	}
+}
+
+func dist2(a, b [3]float64) float64 {
+	dx, dy, dz := a[0]-b[0], a[1]-b[1], a[2]-b[2]
+	return dx*dx + dy*dy + dz*dz
+}
+
+type kdCandidate struct {
+	index int
+	dist2 float64
+}
+
+// kdHeap is a max-heap of the candidates, the farthest one on top.
+type kdHeap []kdCandidate
+
+func (h kdHeap) Len() int           { return len(h) }
+func (h kdHeap) Less(i, j int) bool { return h[i].dist2 > h[j].dist2 }
+func (h kdHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *kdHeap) Push(x any)        { *h = append(*h, x.(kdCandidate)) }
+func (h *kdHeap) Pop() any {
+	old := *h
+	c := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return c
+}
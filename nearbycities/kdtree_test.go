@@ -0,0 +1,104 @@
+package nearbycities
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"slices"
+	"sort"
+	"strconv"
+	"testing"
+
+	"github.com/quantonganh/geohash"
+)
+
+// randomCities returns n cities spread over the sphere, and more of them
+// around the antimeridian and the poles, where the indexes are easiest to
+// get wrong.
+func randomCities(n int) []City {
+	rnd := rand.New(rand.NewSource(1))
+	cities := make([]City, n)
+	for i := range cities {
+		// Uniform on the sphere.
+		lat := math.Asin(2*rnd.Float64()-1) * 180 / math.Pi
+		lng := 360*rnd.Float64() - 180
+		switch i % 4 {
+		case 1:
+			lng = math.Mod(180+2*rnd.NormFloat64()+540, 360) - 180
+		case 2:
+			lat = math.Copysign(90-math.Abs(3*rnd.NormFloat64()), lat)
+		}
+		cities[i] = City{ID: strconv.Itoa(i), City: "City " + strconv.Itoa(i), Lat: lat, Lng: lng}
+	}
+	return cities
+}
+
+// spatialQueries are the origins and radiuses the indexes are checked
+// against a brute-force search at.
+var spatialQueries = []struct {
+	name     string
+	lat, lng float64
+	radius   float64
+}{
+	{"small", 21.0283, 105.8542, 50},
+	{"medium", 48.8566, 2.3522, 500},
+	{"large", -33.8688, 151.2093, 3000},
+	{"east of the antimeridian", 0, -179.9, 300},
+	{"west of the antimeridian", -10, 179.9, 300},
+	{"north pole", 89.9, 0, 400},
+	{"south pole", -88, 45, 600},
+	{"whole earth", 0, 0, 20100},
+}
+
+func TestKDTreeNearbyByLatLng(t *testing.T) {
+	cities := randomCities(5000)
+	tree := NewKDTree(cities)
+	for _, q := range spatialQueries {
+		t.Run(q.name, func(t *testing.T) {
+			got, err := tree.NearbyByLatLng(context.Background(), q.lat, q.lng, q.radius)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkNearby(t, got, nearbyIDs(cities, q.lat, q.lng, q.radius))
+		})
+	}
+}
+
+func TestKDTreeKNearest(t *testing.T) {
+	cities := randomCities(5000)
+	tree := NewKDTree(cities)
+	for _, q := range spatialQueries {
+		t.Run(q.name, func(t *testing.T) {
+			byDistance := slices.Clone(cities)
+			sort.Slice(byDistance, func(i, j int) bool {
+				return geohash.Distance(q.lat, q.lng, byDistance[i].Lat, byDistance[i].Lng) < geohash.Distance(q.lat, q.lng, byDistance[j].Lat, byDistance[j].Lng)
+			})
+
+			for _, k := range []int{0, 1, 10, 100} {
+				got := tree.KNearest(q.lat, q.lng, k)
+				if len(got) != k {
+					t.Fatalf("KNearest(%d) returned %d cities", k, len(got))
+				}
+				for i, c := range got {
+					if c.ID != byDistance[i].ID {
+						t.Fatalf("KNearest(%d)[%d] = %s, want %s", k, i, c.ID, byDistance[i].ID)
+					}
+				}
+			}
+		})
+	}
+}
+
+// checkNearby fails t unless the cities are the ones with the IDs, sorted by
+// distance.
+func checkNearby(t *testing.T, got []City, want []string) {
+	t.Helper()
+	if ids := cityIDs(got); !slices.Equal(ids, want) {
+		t.Errorf("got %d cities, want %d", len(ids), len(want))
+	}
+	for i := 1; i < len(got); i++ {
+		if got[i].Distance < got[i-1].Distance {
+			t.Fatalf("got %s at %v km after %s at %v km", got[i].ID, got[i].Distance, got[i-1].ID, got[i-1].Distance)
+		}
+	}
+}
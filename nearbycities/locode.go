@@ -0,0 +1,207 @@
+package nearbycities
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Locode is a location of the UN/LOCODE code list, e.g. VN SGN for Ho Chi
+// Minh City. Code is the three characters following the country code, and
+// Subdivision the ISO 3166-2 code of its region without the country. Lat and
+// Lng are only set when Located is, as many entries have no coordinates.
+type Locode struct {
+	Iso2        string
+	Code        string
+	Name        string
+	Subdivision string
+	Lat         float64
+	Lng         float64
+	Located     bool
+}
+
+// City returns the location, named after it.
+func (l Locode) City() City {
+	c := City{
+		City: l.Name,
+		Lat:  l.Lat,
+		Lng:  l.Lng,
+		Iso2: l.Iso2,
+	}
+	if country, ok := LookupCountry(l.Iso2); ok {
+		c.Country = country.Name
+		c.Iso3 = country.Iso3
+	}
+
+	return c
+}
+
+// lat and lng return the coordinates to store, nil when unknown.
+func (l Locode) lat() *float64 {
+	if !l.Located {
+		return nil
+	}
+	return &l.Lat
+}
+
+func (l Locode) lng() *float64 {
+	if !l.Located {
+		return nil
+	}
+	return &l.Lng
+}
+
+// ReadLocodes reads a CSV file of the UN/LOCODE code list, e.g.
+// CodeListPart1.csv, whose columns are: change indicator, country, location,
+// name, name without diacritics, subdivision, status, function, date, IATA
+// code, coordinates and remarks. The rows naming a country and the entries
+// marked for deletion are left out.
+func ReadLocodes(in io.Reader) ([]Locode, error) {
+	r := csv.NewReader(in)
+	r.LazyQuotes = true
+	r.FieldsPerRecord = -1
+
+	var locodes []Locode
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			return locodes, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading UN/LOCODE entries: %w", err)
+		}
+
+		if len(record) < 11 {
+			return nil, fmt.Errorf("unexpected number of UN/LOCODE columns: %d", len(record))
+		}
+		if record[0] == "X" || strings.TrimSpace(record[2]) == "" {
+			continue
+		}
+
+		// The older releases are encoded in ISO 8859-1.
+		name := record[3]
+		if !utf8.ValidString(name) {
+			name = record[4]
+		}
+
+		l := Locode{
+			Iso2:        strings.ToUpper(record[1]),
+			Code:        strings.ToUpper(record[2]),
+			Name:        name,
+			Subdivision: record[5],
+		}
+		if coordinates := strings.TrimSpace(record[10]); coordinates != "" {
+			l.Lat, l.Lng, err = parseLocodeCoordinates(coordinates)
+			if err != nil {
+				return nil, fmt.Errorf("invalid coordinates for %s %s: %w", l.Iso2, l.Code, err)
+			}
+			l.Located = true
+		}
+
+		locodes = append(locodes, l)
+	}
+}
+
+// parseLocodeCoordinates parses the degrees and minutes of the UN/LOCODE
+// coordinates, e.g. 1045N 10640E.
+func parseLocodeCoordinates(s string) (float64, float64, error) {
+	lat, lng, ok := strings.Cut(s, " ")
+	if !ok || len(lat) != 5 || len(lng) != 6 {
+		return 0, 0, fmt.Errorf("unexpected format: %q", s)
+	}
+
+	parse := func(v string, positive, negative byte) (float64, error) {
+		n := len(v) - 1
+		degrees, err := strconv.Atoi(v[:n-2])
+		if err != nil {
+			return 0, err
+		}
+		minutes, err := strconv.Atoi(v[n-2 : n])
+		if err != nil {
+			return 0, err
+		}
+
+		d := float64(degrees) + float64(minutes)/60
+		switch v[n] {
+		case positive:
+			return d, nil
+		case negative:
+			return -d, nil
+		}
+		return 0, fmt.Errorf("unexpected hemisphere: %q", v[n])
+	}
+
+	latitude, err := parse(lat, 'N', 'S')
+	if err != nil {
+		return 0, 0, err
+	}
+	longitude, err := parse(lng, 'E', 'W')
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return latitude, longitude, nil
+}
+
+// splitLocode splits a query like "VN SGN" or "USNYC" into the ISO 3166-1
+// alpha-2 code of the country and the location code. Written without a
+// space, the identifier has to be in capitals, so that five-letter names
+// such as Parus are not taken for one.
+func splitLocode(query string) (string, string, bool) {
+	var s string
+	switch fields := strings.Fields(query); {
+	case len(fields) == 2 && len(fields[0]) == 2 && len(fields[1]) == 3:
+		s = strings.ToUpper(fields[0] + fields[1])
+	case len(fields) == 1 && len(fields[0]) == 5 && strings.ToUpper(fields[0]) == fields[0]:
+		s = fields[0]
+	default:
+		return "", "", false
+	}
+	if _, ok := LookupCountry(s[:2]); !ok {
+		return "", "", false
+	}
+	for _, r := range s[2:] {
+		if (r < 'A' || r > 'Z') && (r < '2' || r > '9') {
+			return "", "", false
+		}
+	}
+
+	return s[:2], s[2:], true
+}
+
+// LocodeGeocoder returns the Geocoder resolving the UN/LOCODE identifiers
+// imported into store, e.g. "VN SGN" or "USNYC", to their location. The
+// entries without coordinates are looked up by name among the cities of
+// their country.
+func LocodeGeocoder(store Storage) Geocoder {
+	return GeocoderFunc(func(ctx context.Context, query string) (City, error) {
+		iso2, code, ok := splitLocode(query)
+		if !ok {
+			return City{}, ErrNotFound
+		}
+
+		l, err := store.SearchLocode(ctx, iso2, code)
+		if err != nil {
+			return City{}, err
+		}
+		if l.Located {
+			return l.City(), nil
+		}
+
+		cities, err := store.SearchCities(ctx, l.Name, maxNamesakes)
+		if err != nil {
+			return City{}, err
+		}
+		for _, c := range cities {
+			if c.Iso2 == l.Iso2 {
+				return c, nil
+			}
+		}
+
+		return City{}, ErrNotFound
+	})
+}
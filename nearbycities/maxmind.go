@@ -0,0 +1,66 @@
+package nearbycities
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"github.com/oschwald/geoip2-golang"
+)
+
+var _ IPLocator = (*MaxMindLocator)(nil)
+
+// MaxMindLocator locates IP addresses with a MaxMind GeoLite2-City or
+// GeoIP2-City database in the MMDB format.
+type MaxMindLocator struct {
+	reader *geoip2.Reader
+}
+
+// OpenMaxMind opens the MMDB file at path.
+func OpenMaxMind(path string) (*MaxMindLocator, error) {
+	reader, err := geoip2.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening maxmind database: %w", err)
+	}
+
+	return &MaxMindLocator{
+		reader: reader,
+	}, nil
+}
+
+// LookupIP returns the city of the address according to MaxMind.
+func (l *MaxMindLocator) LookupIP(_ context.Context, ip string) (IPLocation, error) {
+	parsedIP := net.ParseIP(ip)
+	if parsedIP == nil {
+		return IPLocation{}, fmt.Errorf("invalid IP address: %s", ip)
+	}
+
+	record, err := l.reader.City(parsedIP)
+	if err != nil {
+		return IPLocation{}, err
+	}
+
+	// Addresses missing from the database decode to an empty record.
+	if record.Location.Latitude == 0 && record.Location.Longitude == 0 {
+		return IPLocation{}, ErrNotFound
+	}
+
+	loc := IPLocation{
+		Iso2:    record.Country.IsoCode,
+		Country: record.Country.Names["en"],
+		City:    record.City.Names["en"],
+		Lat:     record.Location.Latitude,
+		Lng:     record.Location.Longitude,
+		Zip:     record.Postal.Code,
+	}
+	if len(record.Subdivisions) > 0 {
+		loc.Region = record.Subdivisions[0].Names["en"]
+	}
+
+	return loc, nil
+}
+
+// Close closes the database.
+func (l *MaxMindLocator) Close() error {
+	return l.reader.Close()
+}
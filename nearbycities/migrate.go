@@ -0,0 +1,188 @@
+package nearbycities
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed migrations
+var migrationsFS embed.FS
+
+// Migration is a numbered schema change, read from the files
+// migrations/<dialect>/<version>_<name>.up.sql and .down.sql embedded in the
+// package.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus is a migration along with the time it was applied, which
+// is zero while it is pending.
+type MigrationStatus struct {
+	Migration
+	AppliedAt time.Time
+}
+
+// Applied reports whether the migration has been applied.
+func (m MigrationStatus) Applied() bool {
+	return !m.AppliedAt.IsZero()
+}
+
+// migrationBackend runs the migrations against one kind of database.
+type migrationBackend interface {
+	// appliedMigrations creates the schema_migrations table if needed and
+	// returns the time each applied version was applied at.
+	appliedMigrations(ctx context.Context) (map[int]time.Time, error)
+
+	// runMigration runs the script, then records the version as applied
+	// when up is true and forgets it otherwise.
+	runMigration(ctx context.Context, m Migration, up bool) error
+}
+
+// loadMigrations returns the migrations of the dialect, sorted by version.
+func loadMigrations(dialect string) ([]Migration, error) {
+	dir := path.Join("migrations", dialect)
+	entries, err := fs.ReadDir(migrationsFS, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		base, direction, ok := strings.Cut(strings.TrimSuffix(entry.Name(), ".sql"), ".")
+		if !ok {
+			return nil, fmt.Errorf("invalid migration file name: %s", entry.Name())
+		}
+
+		v, name, ok := strings.Cut(base, "_")
+		if !ok {
+			return nil, fmt.Errorf("invalid migration file name: %s", entry.Name())
+		}
+
+		version, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version: %s", entry.Name())
+		}
+
+		script, err := fs.ReadFile(migrationsFS, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		}
+
+		switch direction {
+		case "up":
+			m.Up = string(script)
+		case "down":
+			m.Down = string(script)
+		default:
+			return nil, fmt.Errorf("invalid migration direction: %s", entry.Name())
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// migrationStatus returns the migrations of the dialect and whether they
+// have been applied to b.
+func migrationStatus(ctx context.Context, b migrationBackend, dialect string) ([]MigrationStatus, error) {
+	migrations, err := loadMigrations(dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	applied, err := b.appliedMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, len(migrations))
+	for i, m := range migrations {
+		statuses[i] = MigrationStatus{Migration: m, AppliedAt: applied[m.Version]}
+	}
+
+	return statuses, nil
+}
+
+// migrateUp applies the pending migrations of the dialect to b in order.
+func migrateUp(ctx context.Context, b migrationBackend, dialect string) error {
+	statuses, err := migrationStatus(ctx, b, dialect)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range statuses {
+		if m.Applied() {
+			continue
+		}
+
+		if err := b.runMigration(ctx, m.Migration, true); err != nil {
+			return fmt.Errorf("error applying migration %d_%s: %w", m.Version, m.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// migrateDown reverts the last migration applied to b.
+func migrateDown(ctx context.Context, b migrationBackend, dialect string) error {
+	statuses, err := migrationStatus(ctx, b, dialect)
+	if err != nil {
+		return err
+	}
+
+	for i := len(statuses) - 1; i >= 0; i-- {
+		m := statuses[i]
+		if !m.Applied() {
+			continue
+		}
+
+		if err := b.runMigration(ctx, m.Migration, false); err != nil {
+			return fmt.Errorf("error reverting migration %d_%s: %w", m.Version, m.Name, err)
+		}
+		return nil
+	}
+
+	return nil
+}
+
+// legacyVersions returns the versions, among the first ones of migrations,
+// whose schema changes are found in a database set up before the versioned
+// migrations, knowing which of them are present.
+func legacyVersions(migrations []Migration, present func(Migration) (bool, error)) ([]Migration, error) {
+	var found []Migration
+	for _, m := range migrations {
+		ok, err := present(m)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+		found = append(found, m)
+	}
+
+	return found, nil
+}
@@ -0,0 +1,114 @@
+package nearbycities
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSQLiteMigrations(t *testing.T) {
+	ctx := context.Background()
+	store, err := Open(filepath.Join(t.TempDir(), "nearby_cities.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	all, err := loadMigrations("sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The migrations are applied one at a time, keeping the schema after
+	// each, which reverting it is to give back.
+	if _, err := store.Migrations(ctx); err != nil {
+		t.Fatal(err)
+	}
+	schemas := []string{schema(t, store)}
+	for _, m := range all {
+		if err := store.runMigration(ctx, m, true); err != nil {
+			skipWithoutFTS5(t, err)
+			t.Fatalf("applying %d_%s: %v", m.Version, m.Name, err)
+		}
+		schemas = append(schemas, schema(t, store))
+	}
+	checkApplied(t, store, len(all))
+
+	for n := len(all) - 1; n >= 0; n-- {
+		if err := store.MigrateDown(ctx); err != nil {
+			t.Fatalf("reverting %d_%s: %v", all[n].Version, all[n].Name, err)
+		}
+		checkApplied(t, store, n)
+		if got := schema(t, store); got != schemas[n] {
+			t.Fatalf("reverting %d_%s, got the schema\n%s\nwant\n%s", all[n].Version, all[n].Name, got, schemas[n])
+		}
+	}
+
+	// Reverting an empty database does nothing.
+	if err := store.MigrateDown(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// And the scripts down leave a database the scripts up apply to again.
+	if err := store.MigrateUp(ctx); err != nil {
+		t.Fatal(err)
+	}
+	checkApplied(t, store, len(all))
+	if got := schema(t, store); got != schemas[len(all)] {
+		t.Errorf("applying the migrations again, got the schema\n%s\nwant\n%s", got, schemas[len(all)])
+	}
+}
+
+// schema returns the definitions of the tables, indexes and triggers of the
+// database. The tables are told by their columns, since a migration
+// rebuilding one, e.g. to change the type of a column, and its script down
+// give the same table with its CREATE statement spelt differently.
+func schema(t *testing.T, store *SQLiteStore) string {
+	t.Helper()
+	rows, err := store.db.Query(`
+		SELECT m.type, m.name, CASE
+			WHEN m.type = 'table' AND m.sql NOT LIKE 'CREATE VIRTUAL%' THEN (
+				SELECT group_concat(c.name || ' ' || c.type || ' ' || c."notnull" || ' ' || ifnull(c.dflt_value, '') || ' ' || c.pk, ', ')
+				FROM pragma_table_info(m.name) c
+			)
+			ELSE m.sql
+		END
+		FROM sqlite_master m
+		WHERE m.name NOT LIKE 'sqlite_%'
+		ORDER BY m.type, m.name
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	var b strings.Builder
+	for rows.Next() {
+		var typ, name, definition string
+		if err := rows.Scan(&typ, &name, &definition); err != nil {
+			t.Fatal(err)
+		}
+		fmt.Fprintf(&b, "%s %s: %s\n", typ, name, definition)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	return b.String()
+}
+
+// checkApplied checks that exactly the first n migrations are applied.
+func checkApplied(t *testing.T, store *SQLiteStore, n int) {
+	t.Helper()
+	statuses, err := store.Migrations(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, m := range statuses {
+		if m.Applied() != (i < n) {
+			t.Errorf("with %d migrations applied, %d_%s applied: %v", n, m.Version, m.Name, m.Applied())
+		}
+	}
+}
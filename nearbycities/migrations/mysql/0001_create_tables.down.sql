@@ -0,0 +1,2 @@
+DROP TABLE ip2location;
+DROP TABLE cities;
@@ -0,0 +1,30 @@
+CREATE TABLE cities (
+	id BIGINT PRIMARY KEY,
+	city VARCHAR(255) NOT NULL,
+	city_ascii VARCHAR(255) NOT NULL,
+	lat DOUBLE NOT NULL,
+	lng DOUBLE NOT NULL,
+	country VARCHAR(255) NOT NULL,
+	iso2 CHAR(2) NOT NULL,
+	iso3 CHAR(3) NOT NULL,
+	admin_name VARCHAR(255) NOT NULL,
+	capital VARCHAR(16) NOT NULL,
+	population VARCHAR(32) NOT NULL,
+	geohash CHAR(12) NOT NULL,
+	location POINT NOT NULL SRID 4326,
+	SPATIAL INDEX (location),
+	INDEX (city_ascii),
+	FULLTEXT (city, city_ascii, admin_name, country)
+) CHARACTER SET utf8mb4;
+
+CREATE TABLE ip2location (
+	start_ip INT UNSIGNED NOT NULL,
+	end_ip INT UNSIGNED NOT NULL,
+	iso2 CHAR(2) NOT NULL,
+	country VARCHAR(255) NOT NULL,
+	region VARCHAR(255) NOT NULL,
+	city VARCHAR(255) NOT NULL,
+	lat DOUBLE NOT NULL,
+	lng DOUBLE NOT NULL,
+	INDEX (end_ip)
+) CHARACTER SET utf8mb4;
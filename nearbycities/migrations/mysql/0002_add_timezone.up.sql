@@ -0,0 +1 @@
+ALTER TABLE cities ADD COLUMN timezone VARCHAR(64) NOT NULL DEFAULT '' AFTER population;
@@ -0,0 +1,6 @@
+CREATE TABLE regions (
+	id BIGINT AUTO_INCREMENT PRIMARY KEY,
+	iso2 CHAR(2) NOT NULL,
+	name VARCHAR(255) NOT NULL,
+	UNIQUE (iso2, name)
+) CHARACTER SET utf8mb4;
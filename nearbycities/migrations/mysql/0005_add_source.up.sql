@@ -0,0 +1 @@
+ALTER TABLE cities ADD COLUMN source VARCHAR(64) NOT NULL DEFAULT '' AFTER elevation;
@@ -0,0 +1,2 @@
+ALTER TABLE ip2location DROP COLUMN utc_offset;
+ALTER TABLE ip2location DROP COLUMN zip;
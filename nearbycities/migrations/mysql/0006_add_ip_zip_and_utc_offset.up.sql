@@ -0,0 +1,2 @@
+ALTER TABLE ip2location ADD COLUMN zip VARCHAR(32) NOT NULL DEFAULT '' AFTER lng;
+ALTER TABLE ip2location ADD COLUMN utc_offset VARCHAR(8) NOT NULL DEFAULT '' AFTER zip;
@@ -0,0 +1,9 @@
+CREATE TABLE postal_codes (
+	iso2 CHAR(2) NOT NULL,
+	code VARCHAR(20) NOT NULL,
+	place VARCHAR(255) NOT NULL,
+	admin_name VARCHAR(255) NOT NULL,
+	lat DOUBLE NOT NULL,
+	lng DOUBLE NOT NULL,
+	INDEX (code)
+) CHARACTER SET utf8mb4;
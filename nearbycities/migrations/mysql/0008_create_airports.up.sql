@@ -0,0 +1,14 @@
+CREATE TABLE airports (
+	ident VARCHAR(16) PRIMARY KEY,
+	iata CHAR(3) NOT NULL,
+	name VARCHAR(255) NOT NULL,
+	type VARCHAR(32) NOT NULL,
+	municipality VARCHAR(255) NOT NULL,
+	iso2 CHAR(2) NOT NULL,
+	lat DOUBLE NOT NULL,
+	lng DOUBLE NOT NULL,
+	elevation INT,
+	scheduled BOOLEAN NOT NULL,
+	location POINT NOT NULL SRID 4326,
+	SPATIAL INDEX (location)
+) CHARACTER SET utf8mb4;
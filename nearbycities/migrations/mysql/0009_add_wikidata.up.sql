@@ -0,0 +1,3 @@
+ALTER TABLE cities ADD COLUMN wikidata_id VARCHAR(16) NULL AFTER source;
+ALTER TABLE cities ADD COLUMN wikipedia_url VARCHAR(512) NOT NULL DEFAULT '' AFTER wikidata_id;
+ALTER TABLE cities ADD COLUMN thumbnail_url VARCHAR(1024) NOT NULL DEFAULT '' AFTER wikipedia_url;
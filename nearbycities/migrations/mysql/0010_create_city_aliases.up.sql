@@ -0,0 +1,32 @@
+CREATE TABLE city_aliases (
+	alias VARCHAR(255) PRIMARY KEY,
+	city_id BIGINT NOT NULL
+) CHARACTER SET utf8mb4;
+INSERT INTO city_aliases (alias, city_id) VALUES
+	('nyc', 1840034016),
+	('new-york-city', 1840034016),
+	('la', 1840020491),
+	('sf', 1840021543),
+	('dc', 1840006060),
+	('saigon', 1704774326),
+	('hcmc', 1704774326),
+	('bombay', 1356226629),
+	('madras', 1356374944),
+	('calcutta', 1356060520),
+	('bengaluru', 1356410365),
+	('yangon', 1104616656),
+	('peking', 1156228865),
+	('constantinople', 1792756324),
+	('leningrad', 1643616350),
+	('petrograd', 1643616350),
+	('stalingrad', 1643577201),
+	('sverdlovsk', 1643582706),
+	('gorky', 1643012126),
+	('konigsberg', 1643178106),
+	('kiev', 1804382913),
+	('alma-ata', 1398351701),
+	('astana', 1398516045),
+	('danzig', 1616406372),
+	('karl-marx-stadt', 1276519956),
+	('leopoldville', 1180000363),
+	('dacca', 1050529279);
@@ -0,0 +1,2 @@
+DROP INDEX cities_metaphone_idx ON cities;
+ALTER TABLE cities DROP COLUMN metaphone;
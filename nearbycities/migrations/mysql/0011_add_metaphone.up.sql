@@ -0,0 +1,2 @@
+ALTER TABLE cities ADD COLUMN metaphone VARCHAR(255) NOT NULL DEFAULT '' AFTER thumbnail_url;
+CREATE INDEX cities_metaphone_idx ON cities (metaphone);
@@ -0,0 +1 @@
+DROP INDEX airports_iata_idx ON airports;
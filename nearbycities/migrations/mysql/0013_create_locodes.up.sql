@@ -0,0 +1,9 @@
+CREATE TABLE locodes (
+	iso2 CHAR(2) NOT NULL,
+	code CHAR(3) NOT NULL,
+	name VARCHAR(255) NOT NULL,
+	subdivision VARCHAR(3) NOT NULL,
+	lat DOUBLE,
+	lng DOUBLE,
+	INDEX (iso2, code)
+) CHARACTER SET utf8mb4;
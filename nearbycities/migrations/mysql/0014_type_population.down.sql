@@ -0,0 +1,3 @@
+ALTER TABLE cities MODIFY population VARCHAR(32) NULL;
+UPDATE cities SET population = '' WHERE population IS NULL;
+ALTER TABLE cities MODIFY population VARCHAR(32) NOT NULL;
@@ -0,0 +1,4 @@
+ALTER TABLE cities MODIFY population VARCHAR(32) NULL;
+UPDATE cities SET population = NULL WHERE population = '';
+ALTER TABLE cities MODIFY population DECIMAL(14, 2) NULL;
+ALTER TABLE cities MODIFY population BIGINT NULL;
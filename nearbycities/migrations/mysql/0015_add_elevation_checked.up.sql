@@ -0,0 +1 @@
+ALTER TABLE cities ADD COLUMN elevation_checked BOOLEAN NOT NULL DEFAULT FALSE AFTER elevation;
@@ -0,0 +1,34 @@
+CREATE EXTENSION IF NOT EXISTS postgis;
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+CREATE TABLE cities (
+	id BIGINT PRIMARY KEY,
+	city TEXT NOT NULL,
+	city_ascii TEXT NOT NULL,
+	lat DOUBLE PRECISION NOT NULL,
+	lng DOUBLE PRECISION NOT NULL,
+	country TEXT NOT NULL,
+	iso2 TEXT NOT NULL,
+	iso3 TEXT NOT NULL,
+	admin_name TEXT NOT NULL,
+	capital TEXT NOT NULL,
+	population TEXT NOT NULL,
+	geohash TEXT NOT NULL,
+	geog GEOGRAPHY(POINT, 4326) GENERATED ALWAYS AS (ST_SetSRID(ST_MakePoint(lng, lat), 4326)::geography) STORED,
+	search_text TEXT GENERATED ALWAYS AS (city || ' ' || city_ascii || ' ' || admin_name || ' ' || country) STORED
+);
+CREATE INDEX cities_geog_idx ON cities USING GIST (geog);
+CREATE INDEX cities_search_text_trgm_idx ON cities USING GIN (search_text gin_trgm_ops);
+CREATE INDEX cities_city_ascii_trgm_idx ON cities USING GIN (city_ascii gin_trgm_ops);
+
+CREATE TABLE ip2location (
+	start_ip BIGINT NOT NULL,
+	end_ip BIGINT NOT NULL,
+	iso2 TEXT NOT NULL,
+	country TEXT NOT NULL,
+	region TEXT NOT NULL,
+	city TEXT NOT NULL,
+	lat DOUBLE PRECISION NOT NULL,
+	lng DOUBLE PRECISION NOT NULL
+);
+CREATE INDEX ip2location_end_ip_idx ON ip2location (end_ip);
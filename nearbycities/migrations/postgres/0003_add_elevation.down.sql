@@ -0,0 +1 @@
+ALTER TABLE cities DROP COLUMN elevation;
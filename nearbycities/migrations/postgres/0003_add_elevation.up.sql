@@ -0,0 +1 @@
+ALTER TABLE cities ADD COLUMN elevation INTEGER;
@@ -0,0 +1 @@
+ALTER TABLE cities ADD COLUMN source TEXT NOT NULL DEFAULT '';
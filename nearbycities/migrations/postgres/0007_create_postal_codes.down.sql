@@ -0,0 +1 @@
+DROP TABLE postal_codes;
@@ -0,0 +1,9 @@
+CREATE TABLE postal_codes (
+	iso2 TEXT NOT NULL,
+	code TEXT NOT NULL,
+	place TEXT NOT NULL,
+	admin_name TEXT NOT NULL,
+	lat DOUBLE PRECISION NOT NULL,
+	lng DOUBLE PRECISION NOT NULL
+);
+CREATE INDEX postal_codes_code_idx ON postal_codes (code);
@@ -0,0 +1,14 @@
+CREATE TABLE airports (
+	ident TEXT PRIMARY KEY,
+	iata TEXT NOT NULL,
+	name TEXT NOT NULL,
+	type TEXT NOT NULL,
+	municipality TEXT NOT NULL,
+	iso2 TEXT NOT NULL,
+	lat DOUBLE PRECISION NOT NULL,
+	lng DOUBLE PRECISION NOT NULL,
+	elevation INTEGER,
+	scheduled BOOLEAN NOT NULL,
+	geog GEOGRAPHY(POINT, 4326) GENERATED ALWAYS AS (ST_SetSRID(ST_MakePoint(lng, lat), 4326)::geography) STORED
+);
+CREATE INDEX airports_geog_idx ON airports USING GIST (geog);
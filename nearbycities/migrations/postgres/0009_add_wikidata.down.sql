@@ -0,0 +1,3 @@
+ALTER TABLE cities DROP COLUMN thumbnail_url;
+ALTER TABLE cities DROP COLUMN wikipedia_url;
+ALTER TABLE cities DROP COLUMN wikidata_id;
@@ -0,0 +1,3 @@
+ALTER TABLE cities ADD COLUMN wikidata_id TEXT;
+ALTER TABLE cities ADD COLUMN wikipedia_url TEXT NOT NULL DEFAULT '';
+ALTER TABLE cities ADD COLUMN thumbnail_url TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,2 @@
+DROP INDEX cities_metaphone_idx;
+ALTER TABLE cities DROP COLUMN metaphone;
@@ -0,0 +1,2 @@
+ALTER TABLE cities ADD COLUMN metaphone TEXT NOT NULL DEFAULT '';
+CREATE INDEX cities_metaphone_idx ON cities (metaphone);
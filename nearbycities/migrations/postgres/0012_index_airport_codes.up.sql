@@ -0,0 +1 @@
+CREATE INDEX airports_iata_idx ON airports (iata);
@@ -0,0 +1,9 @@
+CREATE TABLE locodes (
+	iso2 TEXT NOT NULL,
+	code TEXT NOT NULL,
+	name TEXT NOT NULL,
+	subdivision TEXT NOT NULL,
+	lat DOUBLE PRECISION,
+	lng DOUBLE PRECISION
+);
+CREATE INDEX locodes_iso2_code_idx ON locodes (iso2, code);
@@ -0,0 +1,2 @@
+ALTER TABLE cities ALTER COLUMN population TYPE TEXT USING COALESCE(population::TEXT, '');
+ALTER TABLE cities ALTER COLUMN population SET NOT NULL;
@@ -0,0 +1,2 @@
+ALTER TABLE cities ALTER COLUMN population DROP NOT NULL;
+ALTER TABLE cities ALTER COLUMN population TYPE BIGINT USING NULLIF(population, '')::NUMERIC::BIGINT;
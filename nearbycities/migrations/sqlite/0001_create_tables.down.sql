@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS cities_rtree;
+DROP TABLE cities_fts;
+DROP TABLE geospatial_index;
+DROP TABLE cities;
+DROP TABLE ip2location;
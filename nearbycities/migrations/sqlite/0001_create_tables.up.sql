@@ -0,0 +1,46 @@
+CREATE TABLE ip2location (
+	start_ip TEXT,
+	end_ip TEXT,
+	iso2 TEXT,
+	country TEXT,
+	region TEXT,
+	city TEXT,
+	lat TEXT,
+	lng TEXT
+);
+
+CREATE TABLE cities (
+	city TEXT,
+	city_ascii TEXT,
+	lat TEXT,
+	lng TEXT,
+	country TEXT,
+	iso2 TEXT,
+	iso3 TEXT,
+	admin_name TEXT,
+	capital TEXT,
+	population TEXT,
+	id TEXT
+);
+
+CREATE TABLE geospatial_index (
+	geohash TEXT,
+	city_id INTEGER UNIQUE,
+	FOREIGN KEY(city_id) REFERENCES cities(id)
+);
+
+CREATE VIRTUAL TABLE cities_fts USING fts5(
+	city,
+	city_ascii,
+	lat,
+	lng,
+	country,
+	iso2,
+	iso3,
+	admin_name,
+	capital,
+	population,
+	id,
+	content='cities',
+	tokenize='unicode61'
+);
@@ -0,0 +1 @@
+ALTER TABLE cities ADD COLUMN timezone TEXT;
@@ -0,0 +1,6 @@
+CREATE TABLE regions (
+	id INTEGER PRIMARY KEY,
+	iso2 TEXT NOT NULL,
+	name TEXT NOT NULL,
+	UNIQUE (iso2, name)
+);
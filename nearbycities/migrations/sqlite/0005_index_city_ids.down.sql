@@ -0,0 +1 @@
+DROP INDEX cities_id_idx;
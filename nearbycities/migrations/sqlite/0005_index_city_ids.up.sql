@@ -0,0 +1 @@
+CREATE UNIQUE INDEX cities_id_idx ON cities (id);
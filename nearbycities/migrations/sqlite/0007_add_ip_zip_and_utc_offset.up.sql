@@ -0,0 +1,2 @@
+ALTER TABLE ip2location ADD COLUMN zip TEXT NOT NULL DEFAULT '';
+ALTER TABLE ip2location ADD COLUMN utc_offset TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,9 @@
+CREATE TABLE postal_codes (
+	iso2 TEXT NOT NULL,
+	code TEXT NOT NULL,
+	place TEXT NOT NULL,
+	admin_name TEXT NOT NULL,
+	lat REAL NOT NULL,
+	lng REAL NOT NULL
+);
+CREATE INDEX postal_codes_code_idx ON postal_codes (code);
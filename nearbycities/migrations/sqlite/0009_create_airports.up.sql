@@ -0,0 +1,13 @@
+CREATE TABLE airports (
+	ident TEXT PRIMARY KEY,
+	iata TEXT NOT NULL,
+	name TEXT NOT NULL,
+	type TEXT NOT NULL,
+	municipality TEXT NOT NULL,
+	iso2 TEXT NOT NULL,
+	lat REAL NOT NULL,
+	lng REAL NOT NULL,
+	elevation INTEGER,
+	scheduled INTEGER NOT NULL
+);
+CREATE INDEX airports_lat_lng_idx ON airports (lat, lng);
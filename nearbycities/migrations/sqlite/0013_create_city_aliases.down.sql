@@ -0,0 +1 @@
+DROP TABLE city_aliases;
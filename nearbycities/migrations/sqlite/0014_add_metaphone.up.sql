@@ -0,0 +1,2 @@
+ALTER TABLE cities ADD COLUMN metaphone TEXT;
+CREATE INDEX cities_metaphone_idx ON cities (metaphone);
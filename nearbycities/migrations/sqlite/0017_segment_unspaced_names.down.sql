@@ -0,0 +1,22 @@
+DROP TABLE cities_fts;
+
+CREATE VIRTUAL TABLE cities_fts USING fts5(
+	city,
+	city_ascii,
+	lat,
+	lng,
+	country,
+	iso2,
+	iso3,
+	admin_name,
+	capital,
+	population,
+	id,
+	content='cities',
+	prefix='2 3',
+	tokenize='unicode61 remove_diacritics 2'
+);
+
+INSERT INTO cities_fts(cities_fts) VALUES ('rebuild');
+
+ALTER TABLE cities DROP COLUMN name_tokens;
@@ -0,0 +1,19 @@
+CREATE TABLE ip2location_text (
+	start_ip TEXT,
+	end_ip TEXT,
+	iso2 TEXT,
+	country TEXT,
+	region TEXT,
+	city TEXT,
+	lat TEXT,
+	lng TEXT,
+	zip TEXT NOT NULL DEFAULT '',
+	utc_offset TEXT NOT NULL DEFAULT ''
+);
+
+INSERT INTO ip2location_text (start_ip, end_ip, iso2, country, region, city, lat, lng, zip, utc_offset)
+SELECT start_ip, end_ip, iso2, country, region, city, lat, lng, zip, utc_offset FROM ip2location;
+
+DROP TABLE ip2location;
+
+ALTER TABLE ip2location_text RENAME TO ip2location;
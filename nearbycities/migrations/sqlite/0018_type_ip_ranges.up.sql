@@ -0,0 +1,21 @@
+CREATE TABLE ip2location_typed (
+	start_ip INTEGER NOT NULL,
+	end_ip INTEGER NOT NULL,
+	iso2 TEXT NOT NULL,
+	country TEXT NOT NULL,
+	region TEXT NOT NULL,
+	city TEXT NOT NULL,
+	lat REAL NOT NULL,
+	lng REAL NOT NULL,
+	zip TEXT NOT NULL DEFAULT '',
+	utc_offset TEXT NOT NULL DEFAULT ''
+);
+
+INSERT INTO ip2location_typed (start_ip, end_ip, iso2, country, region, city, lat, lng, zip, utc_offset)
+SELECT CAST(start_ip AS INTEGER), CAST(end_ip AS INTEGER), iso2, country, region, city, CAST(lat AS REAL), CAST(lng AS REAL), zip, utc_offset FROM ip2location;
+
+DROP TABLE ip2location;
+
+ALTER TABLE ip2location_typed RENAME TO ip2location;
+
+CREATE INDEX ip2location_start_ip_idx ON ip2location (start_ip);
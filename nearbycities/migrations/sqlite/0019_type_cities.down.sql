@@ -0,0 +1,33 @@
+CREATE TABLE cities_text (
+	city TEXT,
+	city_ascii TEXT,
+	lat TEXT,
+	lng TEXT,
+	country TEXT,
+	iso2 TEXT,
+	iso3 TEXT,
+	admin_name TEXT,
+	capital TEXT,
+	population TEXT,
+	id TEXT,
+	timezone TEXT,
+	elevation INTEGER,
+	source TEXT NOT NULL DEFAULT '',
+	wikidata_id TEXT,
+	wikipedia_url TEXT NOT NULL DEFAULT '',
+	thumbnail_url TEXT NOT NULL DEFAULT '',
+	metaphone TEXT,
+	name_tokens TEXT NOT NULL DEFAULT ''
+);
+
+INSERT INTO cities_text (rowid, city, city_ascii, lat, lng, country, iso2, iso3, admin_name, capital, population, id, timezone, elevation, source, wikidata_id, wikipedia_url, thumbnail_url, metaphone, name_tokens)
+SELECT rowid, city, city_ascii, lat, lng, country, iso2, iso3, admin_name, capital, COALESCE(population, ''), id, timezone, elevation, source, wikidata_id, wikipedia_url, thumbnail_url, metaphone, name_tokens FROM cities;
+
+DROP TABLE cities;
+
+ALTER TABLE cities_text RENAME TO cities;
+
+CREATE UNIQUE INDEX cities_id_idx ON cities (id);
+CREATE INDEX cities_metaphone_idx ON cities (metaphone);
+
+INSERT INTO cities_fts(cities_fts) VALUES ('rebuild');
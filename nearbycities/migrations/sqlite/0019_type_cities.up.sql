@@ -0,0 +1,33 @@
+CREATE TABLE cities_typed (
+	city TEXT NOT NULL,
+	city_ascii TEXT NOT NULL,
+	lat REAL NOT NULL,
+	lng REAL NOT NULL,
+	country TEXT NOT NULL,
+	iso2 TEXT NOT NULL,
+	iso3 TEXT NOT NULL,
+	admin_name TEXT NOT NULL,
+	capital TEXT NOT NULL,
+	population INTEGER,
+	id INTEGER NOT NULL,
+	timezone TEXT,
+	elevation INTEGER,
+	source TEXT NOT NULL DEFAULT '',
+	wikidata_id TEXT,
+	wikipedia_url TEXT NOT NULL DEFAULT '',
+	thumbnail_url TEXT NOT NULL DEFAULT '',
+	metaphone TEXT,
+	name_tokens TEXT NOT NULL DEFAULT ''
+);
+
+INSERT INTO cities_typed (rowid, city, city_ascii, lat, lng, country, iso2, iso3, admin_name, capital, population, id, timezone, elevation, source, wikidata_id, wikipedia_url, thumbnail_url, metaphone, name_tokens)
+SELECT rowid, city, city_ascii, CAST(lat AS REAL), CAST(lng AS REAL), country, iso2, iso3, admin_name, capital, CAST(NULLIF(population, '') AS INTEGER), CAST(id AS INTEGER), timezone, elevation, source, wikidata_id, wikipedia_url, thumbnail_url, metaphone, name_tokens FROM cities;
+
+DROP TABLE cities;
+
+ALTER TABLE cities_typed RENAME TO cities;
+
+CREATE UNIQUE INDEX cities_id_idx ON cities (id);
+CREATE INDEX cities_metaphone_idx ON cities (metaphone);
+
+INSERT INTO cities_fts(cities_fts) VALUES ('rebuild');
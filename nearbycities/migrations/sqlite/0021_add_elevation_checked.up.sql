@@ -0,0 +1 @@
+ALTER TABLE cities ADD COLUMN elevation_checked INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,1350 @@
+package nearbycities
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/quantonganh/geohash"
+)
+
+var _ Storage = (*MySQLStore)(nil)
+
+// MySQLStore is the Storage backed by MySQL 8 or MariaDB. Nearby queries use
+// a spatial index and searches use a FULLTEXT index.
+type MySQLStore struct {
+	db *sql.DB
+	// readDB is the read replica the lookups are sent to, if any, the
+	// imports and the other writes going to db.
+	readDB *sql.DB
+
+	// Observe, when set, is called with the name and duration of every
+	// lookup query, e.g. to export them as metrics.
+	Observe func(query string, d time.Duration)
+
+	// ImportProgress, when set, is called with the name and duration of
+	// every step of Import as it completes, e.g. to log them.
+	ImportProgress func(step string, d time.Duration)
+
+	// IPDatabase is the IP2Location product to download, DB5 by default.
+	// Changing it takes effect when the ranges are downloaded again.
+	IPDatabase IP2LocationDB
+
+	// DownloadDir is the directory the IP2Location database is downloaded
+	// to while it is imported, the working directory if empty.
+	DownloadDir string
+
+	// RelevanceOnly ranks the cities matching a search by relevance alone.
+	// By default, the more populated ones rank higher.
+	RelevanceOnly bool
+}
+
+// OpenMySQL connects to the MySQL database at dsn, in the driver format
+// user:password@tcp(localhost:3306)/nearby_cities.
+func OpenMySQL(dsn string) (*MySQLStore, error) {
+	return OpenMySQLWithReplica(dsn, "")
+}
+
+// OpenMySQLWithReplica connects to the primary MySQL database at dsn, which
+// the imports and the other writes go to, and to its read replica at
+// readDSN, which answers the lookups. Without a readDSN, the primary answers
+// them too.
+func OpenMySQLWithReplica(dsn, readDSN string) (*MySQLStore, error) {
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to mysql: %w", err)
+	}
+
+	s := &MySQLStore{
+		db: db,
+	}
+	if readDSN != "" {
+		s.readDB, err = sql.Open("mysql", readDSN)
+		if err != nil {
+			db.Close()
+			return nil, fmt.Errorf("error connecting to the mysql replica: %w", err)
+		}
+	}
+
+	return s, nil
+}
+
+// Close closes the databases.
+func (s *MySQLStore) Close() error {
+	err := s.db.Close()
+	if s.readDB != nil {
+		err = errors.Join(err, s.readDB.Close())
+	}
+	return err
+}
+
+// reader returns the database of the lookups, the replica if there is one.
+func (s *MySQLStore) reader() *sql.DB {
+	if s.readDB != nil {
+		return s.readDB
+	}
+	return s.db
+}
+
+func (s *MySQLStore) observe(query string, start time.Time) {
+	if s.Observe != nil {
+		s.Observe(query, time.Since(start))
+	}
+}
+
+func (s *MySQLStore) progress(step string, start time.Time) {
+	if s.ImportProgress != nil {
+		s.ImportProgress(step, time.Since(start))
+	}
+}
+
+// Import applies the pending schema migrations and inserts the dataset into
+// the tables that are still empty. The ranges are downloaded and inserted
+// while the cities are.
+func (s *MySQLStore) Import(ip2LocationToken string) error {
+	start := time.Now()
+	if err := s.MigrateUp(context.Background()); err != nil {
+		return err
+	}
+	s.progress("migrations", start)
+
+	hasRanges, err := s.hasRows("ip2location")
+	if err != nil {
+		return err
+	}
+
+	ranges := make(chan error, 1)
+	if !hasRanges {
+		go func() {
+			start := time.Now()
+			err := s.importIPRanges(ip2LocationToken)
+			if err == nil {
+				s.progress("ip ranges", start)
+			}
+			ranges <- err
+		}()
+	} else {
+		ranges <- nil
+	}
+
+	// The ranges are waited for even if the cities fail, so that the file
+	// they are read from is removed.
+	err = s.importCityTables()
+	return errors.Join(err, <-ranges)
+}
+
+// importCityTables inserts the world cities if they are missing, then fills
+// in the tables and columns derived from them.
+func (s *MySQLStore) importCityTables() error {
+	var hasCities bool
+	if err := s.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM cities WHERE source = '')`).Scan(&hasCities); err != nil {
+		return fmt.Errorf("error checking cities rows: %w", err)
+	}
+
+	var steps []importStep
+	if !hasCities {
+		steps = append(steps, importStep{"cities", s.importCities})
+	}
+	steps = append(steps,
+		importStep{"timezones", s.addTimezones},
+		importStep{"phonetic keys", s.addPhoneticKeys},
+		importStep{"regions", func() error {
+			_, err := s.db.Exec(`
+				INSERT IGNORE INTO regions (iso2, name)
+				SELECT DISTINCT iso2, admin_name FROM cities WHERE admin_name != ''
+			`)
+			if err != nil {
+				return fmt.Errorf("error populating regions table: %w", err)
+			}
+			return nil
+		}},
+	)
+
+	for _, step := range steps {
+		start := time.Now()
+		if err := step.run(); err != nil {
+			return err
+		}
+		s.progress(step.name, start)
+	}
+
+	return nil
+}
+
+// MigrateUp applies the pending schema migrations in order.
+func (s *MySQLStore) MigrateUp(ctx context.Context) error {
+	return migrateUp(ctx, s, "mysql")
+}
+
+// MigrateDown reverts the last applied schema migration.
+func (s *MySQLStore) MigrateDown(ctx context.Context) error {
+	return migrateDown(ctx, s, "mysql")
+}
+
+// Migrations returns the schema migrations and whether they have been
+// applied.
+func (s *MySQLStore) Migrations(ctx context.Context) ([]MigrationStatus, error) {
+	return migrationStatus(ctx, s, "mysql")
+}
+
+func (s *MySQLStore) appliedMigrations(ctx context.Context) (map[int]time.Time, error) {
+	_, err := s.db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INT PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			applied_at BIGINT NOT NULL
+		)
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("error creating schema_migrations table: %w", err)
+	}
+
+	if err := s.adoptLegacyMigrations(ctx); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, `SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("error selecting schema migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var appliedAt int64
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, fmt.Errorf("error scanning: %w", err)
+		}
+		applied[version] = time.Unix(appliedAt, 0)
+	}
+
+	return applied, rows.Err()
+}
+
+// runMigration runs the statements of the script one by one, since the
+// driver does not accept several at once. DDL statements commit implicitly
+// in MySQL, so a migration failing halfway has to be fixed by hand.
+func (s *MySQLStore) runMigration(ctx context.Context, m Migration, up bool) error {
+	script := m.Up
+	if !up {
+		script = m.Down
+	}
+
+	for _, stmt := range strings.Split(script, ";") {
+		if strings.TrimSpace(stmt) == "" {
+			continue
+		}
+		if _, err := s.db.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+
+	var err error
+	if up {
+		_, err = s.db.ExecContext(ctx, `INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)`, m.Version, m.Name, time.Now().Unix())
+	} else {
+		_, err = s.db.ExecContext(ctx, `DELETE FROM schema_migrations WHERE version = ?`, m.Version)
+	}
+	if err != nil {
+		return fmt.Errorf("error recording migration: %w", err)
+	}
+
+	return nil
+}
+
+// adoptLegacyMigrations records the schema migrations already applied to a
+// database set up before they were versioned, which kept the names of the
+// applied steps in a migrations table, and drops that table.
+func (s *MySQLStore) adoptLegacyMigrations(ctx context.Context) error {
+	hasLegacy, err := s.hasTable("migrations")
+	if err != nil || !hasLegacy {
+		return err
+	}
+
+	migrations, err := loadMigrations("mysql")
+	if err != nil {
+		return err
+	}
+
+	applied, err := legacyVersions(migrations, func(m Migration) (bool, error) {
+		switch m.Name {
+		case "create_tables":
+			var exists bool
+			err := s.db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM migrations WHERE name = 'cities_table')`).Scan(&exists)
+			if err != nil {
+				return false, fmt.Errorf("error checking migration status: %w", err)
+			}
+			return exists, nil
+		case "add_timezone":
+			return s.hasColumn("cities", "timezone")
+		case "add_elevation":
+			return s.hasColumn("cities", "elevation")
+		case "create_regions":
+			return s.hasTable("regions")
+		default:
+			return false, nil
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, m := range applied {
+		_, err := s.db.ExecContext(ctx, `INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)`, m.Version, m.Name, time.Now().Unix())
+		if err != nil {
+			return fmt.Errorf("error recording migration: %w", err)
+		}
+	}
+
+	if _, err := s.db.ExecContext(ctx, `DROP TABLE migrations`); err != nil {
+		return fmt.Errorf("error dropping migrations table: %w", err)
+	}
+
+	return nil
+}
+
+func (s *MySQLStore) hasTable(name string) (bool, error) {
+	var exists bool
+	err := s.db.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM information_schema.tables
+			WHERE table_schema = DATABASE() AND table_name = ?
+		)
+	`, name).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("error checking %s table: %w", name, err)
+	}
+
+	return exists, nil
+}
+
+func (s *MySQLStore) hasColumn(table, column string) (bool, error) {
+	var exists bool
+	err := s.db.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM information_schema.columns
+			WHERE table_schema = DATABASE() AND table_name = ? AND column_name = ?
+		)
+	`, table, column).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("error checking %s columns: %w", table, err)
+	}
+
+	return exists, nil
+}
+
+func (s *MySQLStore) hasRows(table string) (bool, error) {
+	var exists bool
+	if err := s.db.QueryRow(fmt.Sprintf(`SELECT EXISTS (SELECT 1 FROM %s)`, table)).Scan(&exists); err != nil {
+		return false, fmt.Errorf("error checking %s rows: %w", table, err)
+	}
+
+	return exists, nil
+}
+
+// importCities inserts the cities bundled with the package.
+func (s *MySQLStore) importCities() error {
+	cities, err := readWorldCities()
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	cityRows := make([][]any, 0, len(cities))
+	for _, c := range cities {
+		point := fmt.Sprintf("POINT(%v %v)", c.Lng, c.Lat)
+		cityRows = append(cityRows, []any{c.ID, c.City, c.CityAscii, c.Lat, c.Lng, c.Country, c.Iso2, c.Iso3, c.AdminName, c.Capital, c.Population, c.Timezone, geohash.Encode(c.Lat, c.Lng), phoneticKey(c.CityAscii), point})
+	}
+
+	err = insertBatches(tx, "cities (id, city, city_ascii, lat, lng, country, iso2, iso3, admin_name, capital, population, timezone, geohash, metaphone, location)",
+		"(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ST_GeomFromText(?, 4326, 'axis-order=long-lat'))", cityRows)
+	if err != nil {
+		return fmt.Errorf("error inserting cities: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateCities applies a new release of the cities of source: the ones it
+// no longer has are deleted and the new and changed ones are written, within
+// a single transaction. The FULLTEXT and spatial indexes follow.
+func (s *MySQLStore) UpdateCities(ctx context.Context, source string, release []City) (CityChanges, error) {
+	d, err := diffCities(ctx, s, source, release)
+	if err != nil {
+		return CityChanges{}, err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return CityChanges{}, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, c := range d.deleted {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM cities WHERE id = ?`, c.ID); err != nil {
+			return CityChanges{}, fmt.Errorf("error deleting city %s: %w", c.ID, err)
+		}
+	}
+
+	for _, c := range d.updated {
+		_, err := tx.ExecContext(ctx, `
+			UPDATE cities SET city = ?, city_ascii = ?, lat = ?, lng = ?, country = ?, iso2 = ?, iso3 = ?, admin_name = ?, capital = ?, population = ?, timezone = ?, geohash = ?,
+				location = ST_GeomFromText(?, 4326, 'axis-order=long-lat'),
+				elevation = IF(?, NULL, elevation), elevation_checked = elevation_checked AND NOT ?, metaphone = ?
+			WHERE id = ?
+		`, c.City, c.CityAscii, c.Lat, c.Lng, c.Country, c.Iso2, c.Iso3, c.AdminName, c.Capital, c.Population, c.Timezone, geohash.Encode(c.Lat, c.Lng),
+			fmt.Sprintf("POINT(%v %v)", c.Lng, c.Lat), d.moved[c.ID], d.moved[c.ID], phoneticKey(c.CityAscii), c.ID)
+		if err != nil {
+			return CityChanges{}, fmt.Errorf("error updating city %s: %w", c.ID, err)
+		}
+	}
+
+	rows := make([][]any, 0, len(d.inserted))
+	for _, c := range d.inserted {
+		point := fmt.Sprintf("POINT(%v %v)", c.Lng, c.Lat)
+		rows = append(rows, []any{c.ID, c.City, c.CityAscii, c.Lat, c.Lng, c.Country, c.Iso2, c.Iso3, c.AdminName, c.Capital, c.Population, c.Timezone, c.Source, phoneticKey(c.CityAscii), geohash.Encode(c.Lat, c.Lng), point})
+	}
+
+	err = insertBatches(tx, "cities (id, city, city_ascii, lat, lng, country, iso2, iso3, admin_name, capital, population, timezone, source, metaphone, geohash, location)",
+		"(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ST_GeomFromText(?, 4326, 'axis-order=long-lat'))", rows)
+	if err != nil {
+		return CityChanges{}, fmt.Errorf("error inserting cities: %w", err)
+	}
+
+	for _, stmt := range []string{
+		`INSERT IGNORE INTO regions (iso2, name)
+		SELECT DISTINCT iso2, admin_name FROM cities WHERE admin_name != ''`,
+		`DELETE FROM regions
+		WHERE NOT EXISTS (SELECT 1 FROM cities WHERE cities.iso2 = regions.iso2 AND cities.admin_name = regions.name)`,
+	} {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return CityChanges{}, fmt.Errorf("error updating regions: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return CityChanges{}, fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	return d.changes(), nil
+}
+
+// importIPRanges downloads the IP2Location LITE database and inserts its
+// ranges.
+func (s *MySQLStore) importIPRanges(ip2LocationToken string) error {
+	path, err := downloadIP2LocationDB(ip2LocationToken, s.IPDatabase, s.DownloadDir)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(path)
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := insertIPRanges(tx, "ip2location", path); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	return nil
+}
+
+// insertIPRanges inserts the ranges of the IP2Location CSV file at path into
+// table.
+func insertIPRanges(tx *sql.Tx, table, path string) error {
+	err := readIP2LocationBatches(path, func(rows [][]any) error {
+		return insertBatches(tx, table+" (start_ip, end_ip, iso2, country, region, city, lat, lng, zip, utc_offset)",
+			"(?, ?, ?, ?, ?, ?, ?, ?, ?, ?)", rows)
+	})
+	if err != nil {
+		return fmt.Errorf("error inserting %s ranges: %w", table, err)
+	}
+
+	return nil
+}
+
+// ImportPostalCodes replaces the postal codes of the countries listed in
+// codes with them, within a single transaction.
+func (s *MySQLStore) ImportPostalCodes(ctx context.Context, codes []PostalCode) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows := make([][]any, 0, len(codes))
+	countries := make(map[string]bool)
+	for _, p := range codes {
+		if !countries[p.Iso2] {
+			if _, err := tx.ExecContext(ctx, `DELETE FROM postal_codes WHERE iso2 = ?`, p.Iso2); err != nil {
+				return fmt.Errorf("error deleting postal codes of %s: %w", p.Iso2, err)
+			}
+			countries[p.Iso2] = true
+		}
+		rows = append(rows, []any{p.Iso2, postalCodeKey(p.Code), p.Place, p.AdminName, p.Lat, p.Lng})
+	}
+
+	if err := insertBatches(tx, "postal_codes (iso2, code, place, admin_name, lat, lng)", "(?, ?, ?, ?, ?, ?)", rows); err != nil {
+		return fmt.Errorf("error inserting postal codes: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	return nil
+}
+
+// ImportLocodes replaces the UN/LOCODE entries of the countries listed in
+// locodes with them, within a single transaction.
+func (s *MySQLStore) ImportLocodes(ctx context.Context, locodes []Locode) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows := make([][]any, 0, len(locodes))
+	countries := make(map[string]bool)
+	for _, l := range locodes {
+		if !countries[l.Iso2] {
+			if _, err := tx.ExecContext(ctx, `DELETE FROM locodes WHERE iso2 = ?`, l.Iso2); err != nil {
+				return fmt.Errorf("error deleting UN/LOCODE entries of %s: %w", l.Iso2, err)
+			}
+			countries[l.Iso2] = true
+		}
+		rows = append(rows, []any{l.Iso2, l.Code, l.Name, l.Subdivision, l.lat(), l.lng()})
+	}
+
+	if err := insertBatches(tx, "locodes (iso2, code, name, subdivision, lat, lng)", "(?, ?, ?, ?, ?, ?)", rows); err != nil {
+		return fmt.Errorf("error inserting UN/LOCODE entries: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	return nil
+}
+
+// ImportAirports replaces the imported airports with airports, within a
+// single transaction.
+func (s *MySQLStore) ImportAirports(ctx context.Context, airports []Airport) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM airports`); err != nil {
+		return fmt.Errorf("error deleting airports: %w", err)
+	}
+
+	rows := make([][]any, 0, len(airports))
+	for _, a := range airports {
+		point := fmt.Sprintf("POINT(%v %v)", a.Lng, a.Lat)
+		rows = append(rows, []any{a.Ident, a.IATA, a.Name, a.Type, a.Municipality, a.Iso2, a.Lat, a.Lng, a.Elevation, a.Scheduled, point})
+	}
+
+	err = insertBatches(tx, "airports (ident, iata, name, type, municipality, iso2, lat, lng, elevation, scheduled, location)",
+		"(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ST_GeomFromText(?, 4326, 'axis-order=long-lat'))", rows)
+	if err != nil {
+		return fmt.Errorf("error inserting airports: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	return nil
+}
+
+// RefreshIPRanges downloads the IP2Location LITE database again and inserts
+// it into a staging table, which then replaces the ip2location table with a
+// single RENAME TABLE. The rename is atomic, so lookups either see the
+// previous ranges or the new ones.
+func (s *MySQLStore) RefreshIPRanges(ip2LocationToken string) error {
+	path, err := downloadIP2LocationDB(ip2LocationToken, s.IPDatabase, s.DownloadDir)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(path)
+
+	for _, stmt := range []string{
+		`DROP TABLE IF EXISTS ip2location_staging`,
+		`CREATE TABLE ip2location_staging LIKE ip2location`,
+	} {
+		if _, err := s.db.Exec(stmt); err != nil {
+			return fmt.Errorf("error creating ip2location_staging table: %w", err)
+		}
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := insertIPRanges(tx, "ip2location_staging", path); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	for _, stmt := range []string{
+		`RENAME TABLE ip2location TO ip2location_old, ip2location_staging TO ip2location`,
+		`DROP TABLE ip2location_old`,
+	} {
+		if _, err := s.db.Exec(stmt); err != nil {
+			return fmt.Errorf("error swapping ip2location tables: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// addTimezones fills in the timezone of the cities imported before it was
+// stored.
+func (s *MySQLStore) addTimezones() error {
+	rows, err := s.db.Query(`SELECT id, lat, lng FROM cities WHERE timezone = ''`)
+	if err != nil {
+		return fmt.Errorf("error selecting cities without timezone: %w", err)
+	}
+
+	var cities []City
+	for rows.Next() {
+		var c City
+		if err := rows.Scan(&c.ID, &c.Lat, &c.Lng); err != nil {
+			rows.Close()
+			return fmt.Errorf("error scanning: %w", err)
+		}
+		cities = append(cities, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error during iteration: %w", err)
+	}
+
+	if len(cities) == 0 {
+		return nil
+	}
+
+	timezoneOf, err := newTimezoneFinder()
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`UPDATE cities SET timezone = ? WHERE id = ?`)
+	if err != nil {
+		return fmt.Errorf("error preparing timezone update: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, c := range cities {
+		if _, err := stmt.Exec(timezoneOf(c.Lat, c.Lng), c.ID); err != nil {
+			return fmt.Errorf("error updating timezone: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// addPhoneticKeys fills in the phonetic key of the cities that have none
+// yet, e.g. the ones imported before it was stored.
+func (s *MySQLStore) addPhoneticKeys() error {
+	rows, err := s.db.Query(`SELECT id, city_ascii FROM cities WHERE metaphone = ''`)
+	if err != nil {
+		return fmt.Errorf("error selecting cities without phonetic key: %w", err)
+	}
+
+	var cities []City
+	for rows.Next() {
+		var c City
+		if err := rows.Scan(&c.ID, &c.CityAscii); err != nil {
+			rows.Close()
+			return fmt.Errorf("error scanning: %w", err)
+		}
+		cities = append(cities, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error during iteration: %w", err)
+	}
+
+	if len(cities) == 0 {
+		return nil
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`UPDATE cities SET metaphone = ? WHERE id = ?`)
+	if err != nil {
+		return fmt.Errorf("error preparing phonetic key update: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, c := range cities {
+		if _, err := stmt.Exec(phoneticKey(c.CityAscii), c.ID); err != nil {
+			return fmt.Errorf("error updating phonetic key: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// ImportElevation sets the elevation of the cities that have not been looked
+// up yet from src. The ones src has no data for, e.g. on small islands
+// without a tile, are marked as looked up too, so that they are not read
+// again on every start.
+func (s *MySQLStore) ImportElevation(src ElevationSource) error {
+	rows, err := s.db.Query(`SELECT id, lat, lng FROM cities WHERE elevation IS NULL AND NOT elevation_checked`)
+	if err != nil {
+		return fmt.Errorf("error selecting cities without elevation: %w", err)
+	}
+
+	var cities []City
+	for rows.Next() {
+		var c City
+		if err := rows.Scan(&c.ID, &c.Lat, &c.Lng); err != nil {
+			rows.Close()
+			return fmt.Errorf("error scanning: %w", err)
+		}
+		cities = append(cities, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error during iteration: %w", err)
+	}
+
+	cities, err = elevationsOf(src, cities)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`UPDATE cities SET elevation = ?, elevation_checked = TRUE WHERE id = ?`)
+	if err != nil {
+		return fmt.Errorf("error preparing elevation update: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, c := range cities {
+		if _, err := stmt.Exec(c.Elevation, c.ID); err != nil {
+			return fmt.Errorf("error updating elevation: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// SearchCity returns the city with the best FULLTEXT score for the query,
+// weighted by its population unless RelevanceOnly is set.
+func (s *MySQLStore) SearchCity(ctx context.Context, query string) (City, error) {
+	cities, err := s.SearchCities(ctx, query, 1)
+	if err != nil {
+		return City{}, err
+	}
+	if len(cities) == 0 {
+		return City{}, ErrNotFound
+	}
+
+	return cities[0], nil
+}
+
+// SearchCities returns up to limit cities matching the query, the best
+// matches first.
+func (s *MySQLStore) SearchCities(ctx context.Context, query string, limit int) ([]City, error) {
+	defer s.observe("fulltext_match", time.Now())
+
+	rows, err := s.reader().QueryContext(ctx, `
+		SELECT city, city_ascii, lat, lng, admin_name, country, iso2, iso3, capital, population, id,
+			MATCH (city, city_ascii, admin_name, country) AGAINST (? IN NATURAL LANGUAGE MODE) AS relevance
+		FROM cities
+		WHERE MATCH (city, city_ascii, admin_name, country) AGAINST (? IN NATURAL LANGUAGE MODE)
+		ORDER BY relevance DESC
+		LIMIT ?
+	`, normalizeQuery(query), normalizeQuery(query), max(limit, rankedMatches))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cities := make([]City, 0)
+	var relevance []float64
+	for rows.Next() {
+		var (
+			c City
+			r float64
+		)
+		if err := rows.Scan(&c.City, &c.CityAscii, &c.Lat, &c.Lng, &c.AdminName, &c.Country, &c.Iso2, &c.Iso3, &c.Capital, &c.Population, &c.ID, &r); err != nil {
+			return nil, err
+		}
+		cities = append(cities, c)
+		relevance = append(relevance, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if !s.RelevanceOnly {
+		rankByPopulation(cities, relevance)
+	}
+	if len(cities) > limit {
+		cities = cities[:limit]
+	}
+
+	return cities, nil
+}
+
+// SearchPhonetic returns the most populated city whose name sounds like the
+// query, or ErrNotFound.
+func (s *MySQLStore) SearchPhonetic(ctx context.Context, query string) (City, error) {
+	defer s.observe("metaphone", time.Now())
+
+	var c City
+	err := s.reader().QueryRowContext(ctx, `
+		SELECT city, city_ascii, lat, lng, admin_name, country, iso2, iso3, capital, population, id FROM cities
+		WHERE metaphone = ?
+		ORDER BY population DESC, id
+		LIMIT 1
+	`, phoneticKey(query)).Scan(&c.City, &c.CityAscii, &c.Lat, &c.Lng, &c.AdminName, &c.Country, &c.Iso2, &c.Iso3, &c.Capital, &c.Population, &c.ID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return City{}, ErrNotFound
+		}
+		return City{}, err
+	}
+
+	return c, nil
+}
+
+// SearchPostalCode returns the place served by the postal code, in the
+// country with the iso2 code unless it is empty. When several countries use
+// the code, the one with the most cities wins.
+func (s *MySQLStore) SearchPostalCode(ctx context.Context, code, iso2 string) (PostalCode, error) {
+	defer s.observe("postal_code", time.Now())
+
+	var p PostalCode
+	err := s.reader().QueryRowContext(ctx, `
+		SELECT iso2, code, place, admin_name, lat, lng FROM postal_codes
+		WHERE code = ? AND (? = '' OR iso2 = ?)
+		ORDER BY (SELECT COUNT(*) FROM cities WHERE cities.iso2 = postal_codes.iso2) DESC, iso2, place
+		LIMIT 1
+	`, postalCodeKey(code), iso2, iso2).Scan(&p.Iso2, &p.Code, &p.Place, &p.AdminName, &p.Lat, &p.Lng)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return PostalCode{}, ErrNotFound
+		}
+		return PostalCode{}, err
+	}
+
+	return p, nil
+}
+
+// SearchLocode returns the UN/LOCODE entry with the location code in the
+// country with the iso2 code.
+func (s *MySQLStore) SearchLocode(ctx context.Context, iso2, code string) (Locode, error) {
+	defer s.observe("locode", time.Now())
+
+	var (
+		l        Locode
+		lat, lng *float64
+	)
+	err := s.reader().QueryRowContext(ctx, `
+		SELECT iso2, code, name, subdivision, lat, lng FROM locodes WHERE iso2 = ? AND code = ? LIMIT 1
+	`, strings.ToUpper(iso2), strings.ToUpper(code)).Scan(&l.Iso2, &l.Code, &l.Name, &l.Subdivision, &lat, &lng)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return Locode{}, ErrNotFound
+		}
+		return Locode{}, err
+	}
+	if lat != nil && lng != nil {
+		l.Lat, l.Lng, l.Located = *lat, *lng, true
+	}
+
+	return l, nil
+}
+
+// SetWikidata links the city with the dataset ID to its Wikidata item.
+func (s *MySQLStore) SetWikidata(ctx context.Context, id string, link WikidataLink) error {
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE cities SET wikidata_id = ?, wikipedia_url = ?, thumbnail_url = ? WHERE id = ?
+	`, link.QID, link.WikipediaURL, link.ThumbnailURL, id)
+	if err != nil {
+		return fmt.Errorf("error setting the wikidata item of city %s: %w", id, err)
+	}
+
+	return nil
+}
+
+// CityByID returns the city with the dataset ID.
+func (s *MySQLStore) CityByID(ctx context.Context, id string) (City, error) {
+	defer s.observe("city_by_id", time.Now())
+
+	var (
+		c        City
+		wikidata wikidataColumns
+	)
+	err := s.reader().QueryRowContext(ctx, `
+		SELECT city, city_ascii, lat, lng, country, iso2, iso3, admin_name, capital, population, id, timezone, elevation, source, wikidata_id, wikipedia_url, thumbnail_url FROM cities WHERE id = ?
+	`, id).Scan(&c.City, &c.CityAscii, &c.Lat, &c.Lng, &c.Country, &c.Iso2, &c.Iso3, &c.AdminName, &c.Capital, &c.Population, &c.ID, &c.Timezone, &c.Elevation, &c.Source, &wikidata.qid, &wikidata.wikipediaURL, &wikidata.thumbnailURL)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return City{}, ErrNotFound
+		}
+		return City{}, err
+	}
+	c.Wikidata = wikidata.link()
+	c.Geohash = geohash.Encode(c.Lat, c.Lng)
+
+	return c, nil
+}
+
+// CityByAlias returns the city known by the alias, e.g. an abbreviation or a
+// former name, or ErrNotFound.
+func (s *MySQLStore) CityByAlias(ctx context.Context, alias string) (City, error) {
+	defer s.observe("city_by_alias", time.Now())
+
+	var id string
+	err := s.reader().QueryRowContext(ctx, `
+		SELECT city_id FROM city_aliases WHERE alias = ?
+	`, Slugify(alias)).Scan(&id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return City{}, ErrNotFound
+		}
+		return City{}, err
+	}
+
+	return s.CityByID(ctx, id)
+}
+
+// AddAlias makes the city with the dataset ID known by the alias, in place of
+// the city it stood for if any. It returns ErrNotFound if there is no such
+// city.
+func (s *MySQLStore) AddAlias(ctx context.Context, alias, id string) error {
+	if _, err := s.CityByID(ctx, id); err != nil {
+		return err
+	}
+
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO city_aliases (alias, city_id) VALUES (?, ?)
+		ON DUPLICATE KEY UPDATE city_id = VALUES(city_id)
+	`, Slugify(alias), id)
+	if err != nil {
+		return fmt.Errorf("error adding alias %s: %w", alias, err)
+	}
+
+	return nil
+}
+
+// SuggestCities returns up to limit cities whose name starts with the query.
+func (s *MySQLStore) SuggestCities(ctx context.Context, query string, limit int) ([]City, error) {
+	defer s.observe("like_prefix", time.Now())
+
+	prefix := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(normalizeQuery(query)) + "%"
+	rows, err := s.reader().QueryContext(ctx, `
+		SELECT city, admin_name, country, lat, lng FROM cities
+		WHERE city_ascii LIKE ? OR city LIKE ?
+		ORDER BY population DESC
+		LIMIT ?
+	`, prefix, prefix, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var cities []City
+	for rows.Next() {
+		var c City
+		if err := rows.Scan(&c.City, &c.AdminName, &c.Country, &c.Lat, &c.Lng); err != nil {
+			return nil, err
+		}
+		cities = append(cities, c)
+	}
+
+	return cities, rows.Err()
+}
+
+// NearbyByLatLng returns the cities within radius kilometers, nearest first.
+func (s *MySQLStore) NearbyByLatLng(ctx context.Context, lat, lng, radius float64) ([]City, error) {
+	cities := make([]City, 0)
+	err := s.EachNearby(ctx, lat, lng, radius, func(c City) error {
+		cities = append(cities, c)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return cities, nil
+}
+
+// EachNearby calls fn for every city within radius kilometers as it is read,
+// nearest first, stopping at the first error. The spatial index narrows the
+// candidates down to the bounding box of the circle before the exact
+// distance is computed.
+func (s *MySQLStore) EachNearby(ctx context.Context, lat, lng, radius float64, fn func(City) error) error {
+	defer s.observe("spatial_within", time.Now())
+
+	query, args := withinBoxes(`
+		SELECT city, lat, lng, admin_name, country, iso2, iso3, timezone, elevation, capital, population, id, geohash,
+			ST_Distance_Sphere(location, ST_GeomFromText(?, 4326, 'axis-order=long-lat')) / 1000 AS distance
+		FROM cities
+		WHERE MBRContains(ST_GeomFromText(?, 4326, 'axis-order=long-lat'), location)
+		HAVING distance <= ?
+	`, lat, lng, radius)
+	rows, err := s.reader().QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var c City
+		if err := rows.Scan(&c.City, &c.Lat, &c.Lng, &c.AdminName, &c.Country, &c.Iso2, &c.Iso3, &c.Timezone, &c.Elevation, &c.Capital, &c.Population, &c.ID, &c.Geohash, &c.Distance); err != nil {
+			return err
+		}
+		c.Distance = math.Round(c.Distance*100) / 100
+
+		if err := fn(c); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// NearbyAirports returns the airports within radius kilometers of the
+// coordinates, nearest first.
+func (s *MySQLStore) NearbyAirports(ctx context.Context, lat, lng, radius float64) ([]Airport, error) {
+	defer s.observe("airports_within", time.Now())
+
+	query, args := withinBoxes(`
+		SELECT ident, iata, name, type, municipality, iso2, lat, lng, elevation, scheduled,
+			ST_Distance_Sphere(location, ST_GeomFromText(?, 4326, 'axis-order=long-lat')) / 1000 AS distance
+		FROM airports
+		WHERE MBRContains(ST_GeomFromText(?, 4326, 'axis-order=long-lat'), location)
+		HAVING distance <= ?
+	`, lat, lng, radius)
+	rows, err := s.reader().QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	airports := make([]Airport, 0)
+	for rows.Next() {
+		var a Airport
+		if err := rows.Scan(&a.Ident, &a.IATA, &a.Name, &a.Type, &a.Municipality, &a.Iso2, &a.Lat, &a.Lng, &a.Elevation, &a.Scheduled, &a.Distance); err != nil {
+			return nil, err
+		}
+		a.Distance = math.Round(a.Distance*100) / 100
+		airports = append(airports, a)
+	}
+
+	return airports, rows.Err()
+}
+
+// withinBoxes returns the query, whose parameters are the origin, a box and
+// the radius, for the rows within radius kilometers of the coordinates,
+// nearest first, and its arguments. A circle crossing the antimeridian is
+// looked up in a box on each side of it, each of which the spatial index
+// narrows the candidates down to.
+func withinBoxes(query string, lat, lng, radius float64) (string, []any) {
+	origin := fmt.Sprintf("POINT(%v %v)", lng, lat)
+
+	var selects []string
+	var args []any
+	for _, b := range boundingBoxes(lat, lng, radius) {
+		polygon := fmt.Sprintf("POLYGON((%[2]v %[1]v, %[4]v %[1]v, %[4]v %[3]v, %[2]v %[3]v, %[2]v %[1]v))", b.minLat, b.minLng, b.maxLat, b.maxLng)
+		selects = append(selects, "("+query+")")
+		args = append(args, origin, polygon, radius)
+	}
+
+	return strings.Join(selects, " UNION ALL ") + " ORDER BY distance", args
+}
+
+// AirportByCode returns the airport with the IATA or ICAO code. An IATA code
+// shared by several airports goes to the one with scheduled service.
+func (s *MySQLStore) AirportByCode(ctx context.Context, code string) (Airport, error) {
+	defer s.observe("airport_by_code", time.Now())
+
+	var a Airport
+	err := s.reader().QueryRowContext(ctx, `
+		SELECT ident, iata, name, type, municipality, iso2, lat, lng, elevation, scheduled FROM airports
+		WHERE iata = ? OR ident = ?
+		ORDER BY scheduled DESC, ident
+		LIMIT 1
+	`, code, code).Scan(&a.Ident, &a.IATA, &a.Name, &a.Type, &a.Municipality, &a.Iso2, &a.Lat, &a.Lng, &a.Elevation, &a.Scheduled)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return Airport{}, ErrNotFound
+		}
+		return Airport{}, err
+	}
+
+	return a, nil
+}
+
+// Regions returns the regions of the country, sorted by name.
+func (s *MySQLStore) Regions(ctx context.Context, iso2 string) ([]Region, error) {
+	rows, err := s.reader().QueryContext(ctx, `
+		SELECT r.id, r.iso2, r.name, COUNT(*)
+		FROM regions r JOIN cities c ON c.iso2 = r.iso2 AND c.admin_name = r.name
+		WHERE r.iso2 = ?
+		GROUP BY r.id, r.iso2, r.name
+		ORDER BY r.name
+	`, strings.ToUpper(iso2))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	regions := make([]Region, 0)
+	for rows.Next() {
+		var r Region
+		if err := rows.Scan(&r.ID, &r.Iso2, &r.Name, &r.Cities); err != nil {
+			return nil, err
+		}
+		regions = append(regions, r)
+	}
+
+	return regions, rows.Err()
+}
+
+// RegionCities returns the region and its cities, the most populated first.
+func (s *MySQLStore) RegionCities(ctx context.Context, id int64) (Region, []City, error) {
+	var r Region
+	err := s.reader().QueryRowContext(ctx, `SELECT id, iso2, name FROM regions WHERE id = ?`, id).Scan(&r.ID, &r.Iso2, &r.Name)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return Region{}, nil, ErrNotFound
+		}
+		return Region{}, nil, err
+	}
+
+	rows, err := s.reader().QueryContext(ctx, `
+		SELECT city, lat, lng, admin_name, country, iso2, iso3, population, id FROM cities
+		WHERE iso2 = ? AND admin_name = ?
+		ORDER BY population DESC
+	`, r.Iso2, r.Name)
+	if err != nil {
+		return Region{}, nil, err
+	}
+	defer rows.Close()
+
+	cities := make([]City, 0)
+	for rows.Next() {
+		var c City
+		if err := rows.Scan(&c.City, &c.Lat, &c.Lng, &c.AdminName, &c.Country, &c.Iso2, &c.Iso3, &c.Population, &c.ID); err != nil {
+			return Region{}, nil, err
+		}
+		cities = append(cities, c)
+	}
+	if err := rows.Err(); err != nil {
+		return Region{}, nil, err
+	}
+	r.Cities = len(cities)
+
+	return r, cities, nil
+}
+
+// CountryCities returns a page of the cities of the country in the sort
+// order.
+func (s *MySQLStore) CountryCities(ctx context.Context, iso2 string, sort CitySort, offset, limit int) ([]City, int, error) {
+	iso2 = strings.ToUpper(iso2)
+
+	var total int
+	if err := s.reader().QueryRowContext(ctx, `SELECT COUNT(*) FROM cities WHERE iso2 = ?`, iso2).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := s.reader().QueryContext(ctx, `
+		SELECT city, city_ascii, lat, lng, admin_name, country, iso2, iso3, capital, population, id FROM cities
+		WHERE iso2 = ?
+		ORDER BY `+countryOrder(sort)+`
+		LIMIT ? OFFSET ?
+	`, iso2, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	cities := make([]City, 0)
+	err = scanCountryCities(rows, func(c City) error {
+		cities = append(cities, c)
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return cities, total, nil
+}
+
+// EachCountryCity calls fn for every city of the country in the sort order
+// as it is read, stopping at the first error.
+func (s *MySQLStore) EachCountryCity(ctx context.Context, iso2 string, sort CitySort, fn func(City) error) error {
+	rows, err := s.reader().QueryContext(ctx, `
+		SELECT city, city_ascii, lat, lng, admin_name, country, iso2, iso3, capital, population, id FROM cities
+		WHERE iso2 = ?
+		ORDER BY `+countryOrder(sort), strings.ToUpper(iso2))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	return scanCountryCities(rows, fn)
+}
+
+// LookupIP returns the location of an IPv4 address.
+func (s *MySQLStore) LookupIP(ctx context.Context, ip string) (IPLocation, error) {
+	ipInteger, err := ipToInteger(ip)
+	if err != nil {
+		return IPLocation{}, err
+	}
+
+	defer s.observe("ip_lookup", time.Now())
+
+	var loc IPLocation
+	err = s.reader().QueryRowContext(ctx, `
+		SELECT start_ip, end_ip, iso2, country, region, city, lat, lng, zip, utc_offset FROM ip2location
+		WHERE end_ip >= ? ORDER BY end_ip LIMIT 1
+	`, ipInteger).Scan(&loc.StartIP, &loc.EndIP, &loc.Iso2, &loc.Country, &loc.Region, &loc.City, &loc.Lat, &loc.Lng, &loc.Zip, &loc.UTCOffset)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return IPLocation{}, ErrNotFound
+		}
+		return IPLocation{}, err
+	}
+
+	if loc.StartIP > ipInteger {
+		return IPLocation{}, ErrNotFound
+	}
+
+	return loc, nil
+}
+
+// EachCity calls fn for every city, stopping at the first error.
+func (s *MySQLStore) EachCity(ctx context.Context, fn func(City) error) error {
+	rows, err := s.reader().QueryContext(ctx, `
+		SELECT city, city_ascii, lat, lng, country, iso2, iso3, admin_name, capital, population, id, timezone, elevation, source, wikidata_id, wikipedia_url, thumbnail_url FROM cities
+	`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			c        City
+			wikidata wikidataColumns
+		)
+		if err := rows.Scan(&c.City, &c.CityAscii, &c.Lat, &c.Lng, &c.Country, &c.Iso2, &c.Iso3, &c.AdminName, &c.Capital, &c.Population, &c.ID, &c.Timezone, &c.Elevation, &c.Source, &wikidata.qid, &wikidata.wikipediaURL, &wikidata.thumbnailURL); err != nil {
+			return err
+		}
+
+		c.Wikidata = wikidata.link()
+
+		if err := fn(c); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// Optimize rebuilds and analyzes the dataset tables that exist.
+func (s *MySQLStore) Optimize(ctx context.Context) error {
+	for _, table := range []string{"cities", "ip2location", "regions", "postal_codes", "airports", "city_aliases", "locodes"} {
+		hasTable, err := s.hasTable(table)
+		if err != nil {
+			return err
+		}
+		if !hasTable {
+			continue
+		}
+		if _, err := s.db.ExecContext(ctx, "OPTIMIZE TABLE "+table); err != nil {
+			return fmt.Errorf("error optimizing %s table: %w", table, err)
+		}
+	}
+	return nil
+}
+
+// Ping checks that the database and its replica, if any, answer.
+func (s *MySQLStore) Ping(ctx context.Context) error {
+	if err := s.db.PingContext(ctx); err != nil {
+		return err
+	}
+	if s.readDB != nil {
+		if err := s.readDB.PingContext(ctx); err != nil {
+			return fmt.Errorf("error pinging the replica: %w", err)
+		}
+	}
+	return nil
+}
+
+// Populated reports whether the cities have been imported.
+func (s *MySQLStore) Populated(ctx context.Context) (bool, error) {
+	hasCities, err := s.hasTable("cities")
+	if err != nil || !hasCities {
+		return false, err
+	}
+
+	return s.hasRows("cities")
+}
+
+// Counts returns the number of rows of the dataset tables that exist.
+func (s *MySQLStore) Counts(ctx context.Context) (map[string]int64, error) {
+	counts := make(map[string]int64)
+	for _, table := range []string{"cities", "ip2location", "regions", "postal_codes", "airports", "city_aliases", "locodes"} {
+		var n int64
+		if err := s.reader().QueryRowContext(ctx, "SELECT COUNT(*) FROM "+table).Scan(&n); err != nil {
+			continue
+		}
+		counts[table] = n
+	}
+
+	return counts, nil
+}
@@ -0,0 +1,188 @@
+package nearbycities
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultNominatimURL = "https://nominatim.openstreetmap.org"
+
+// errNominatimRateLimited is returned instead of calling Nominatim when the
+// last request was sent less than MinInterval ago.
+var errNominatimRateLimited = errors.New("nominatim rate limit exceeded")
+
+// NominatimGeocoder geocodes with the search endpoint of a Nominatim
+// instance, so that places missing from the dataset, down to villages and
+// landmarks, can still be searched around. Answers are cached, and requests
+// are spaced to follow the usage policy of the public instance.
+type NominatimGeocoder struct {
+	// BaseURL is the URL of the instance, the public OpenStreetMap one by
+	// default.
+	BaseURL string
+	// UserAgent identifies the application, as required by the usage
+	// policy. It defaults to nearby-cities.
+	UserAgent string
+	// CacheTTL is how long answers are kept, one week by default.
+	CacheTTL time.Duration
+	// MinInterval is the least time between two requests, one second by
+	// default.
+	MinInterval time.Duration
+	Client      *http.Client
+
+	mu          sync.Mutex
+	cache       map[string]cachedCity
+	lastRequest time.Time
+}
+
+type cachedCity struct {
+	city    City
+	err     error
+	expires time.Time
+}
+
+type nominatimResult struct {
+	Lat     string `json:"lat"`
+	Lon     string `json:"lon"`
+	Name    string `json:"name"`
+	Address struct {
+		State       string `json:"state"`
+		Country     string `json:"country"`
+		CountryCode string `json:"country_code"`
+	} `json:"address"`
+}
+
+// Geocode returns the best match of Nominatim for the query.
+func (g *NominatimGeocoder) Geocode(ctx context.Context, query string) (City, error) {
+	key := strings.ToLower(strings.TrimSpace(query))
+	if cached, ok := g.cached(key); ok {
+		return cached.city, cached.err
+	}
+
+	if !g.allow() {
+		return City{}, errNominatimRateLimited
+	}
+
+	baseURL := g.BaseURL
+	if baseURL == "" {
+		baseURL = defaultNominatimURL
+	}
+
+	params := url.Values{}
+	params.Set("q", query)
+	params.Set("format", "jsonv2")
+	params.Set("addressdetails", "1")
+	params.Set("limit", "1")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(baseURL, "/")+"/search?"+params.Encode(), nil)
+	if err != nil {
+		return City{}, fmt.Errorf("nominatim: %w", err)
+	}
+	userAgent := g.UserAgent
+	if userAgent == "" {
+		userAgent = "nearby-cities"
+	}
+	req.Header.Set("User-Agent", userAgent)
+
+	var results []nominatimResult
+	if err := doJSON(g.Client, req, &results); err != nil {
+		return City{}, fmt.Errorf("nominatim: %w", err)
+	}
+
+	city, err := nominatimCity(results)
+	g.store(key, city, err)
+
+	return city, err
+}
+
+func nominatimCity(results []nominatimResult) (City, error) {
+	if len(results) == 0 {
+		return City{}, ErrNotFound
+	}
+
+	r := results[0]
+	lat, err := strconv.ParseFloat(r.Lat, 64)
+	if err != nil {
+		return City{}, fmt.Errorf("nominatim: invalid latitude: %w", err)
+	}
+	lng, err := strconv.ParseFloat(r.Lon, 64)
+	if err != nil {
+		return City{}, fmt.Errorf("nominatim: invalid longitude: %w", err)
+	}
+
+	return City{
+		City:      r.Name,
+		Lat:       lat,
+		Lng:       lng,
+		AdminName: r.Address.State,
+		Country:   r.Address.Country,
+		Iso2:      strings.ToUpper(r.Address.CountryCode),
+	}, nil
+}
+
+func (g *NominatimGeocoder) cached(key string) (cachedCity, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	c, ok := g.cache[key]
+	if !ok || time.Now().After(c.expires) {
+		return cachedCity{}, false
+	}
+
+	return c, true
+}
+
+func (g *NominatimGeocoder) store(key string, city City, err error) {
+	// Failures other than an unknown place are worth retrying.
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return
+	}
+
+	ttl := g.CacheTTL
+	if ttl == 0 {
+		ttl = 7 * 24 * time.Hour
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.cache == nil {
+		g.cache = make(map[string]cachedCity)
+	}
+
+	now := time.Now()
+	if len(g.cache)%1000 == 999 {
+		for k, c := range g.cache {
+			if now.After(c.expires) {
+				delete(g.cache, k)
+			}
+		}
+	}
+
+	g.cache[key] = cachedCity{city: city, err: err, expires: now.Add(ttl)}
+}
+
+// allow reports whether MinInterval has passed since the last request.
+func (g *NominatimGeocoder) allow() bool {
+	interval := g.MinInterval
+	if interval == 0 {
+		interval = time.Second
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(g.lastRequest) < interval {
+		return false
+	}
+
+	g.lastRequest = now
+	return true
+}
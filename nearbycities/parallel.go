@@ -0,0 +1,31 @@
+package nearbycities
+
+import (
+	"runtime"
+	"sync"
+)
+
+// parallelize calls fn with every index below n, split in contiguous chunks
+// between a worker per CPU, and returns once they are all done.
+func parallelize(n int, fn func(i int)) {
+	workers := min(runtime.GOMAXPROCS(0), n)
+	if workers <= 1 {
+		for i := 0; i < n; i++ {
+			fn(i)
+		}
+		return
+	}
+
+	var wg sync.WaitGroup
+	chunk := (n + workers - 1) / workers
+	for start := 0; start < n; start += chunk {
+		wg.Add(1)
+		go func(start, end int) {
+			defer wg.Done()
+			for i := start; i < end; i++ {
+				fn(i)
+			}
+		}(start, min(start+chunk, n))
+	}
+	wg.Wait()
+}
@@ -0,0 +1,91 @@
+package nearbycities
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// PeliasGeocoder geocodes with the search endpoint of a Pelias instance.
+type PeliasGeocoder struct {
+	// BaseURL is the URL of the instance, e.g. https://api.geocode.earth.
+	BaseURL string
+	// APIKey is sent as the api_key parameter when set.
+	APIKey string
+	Client *http.Client
+}
+
+type peliasResponse struct {
+	Features []struct {
+		Geometry struct {
+			Coordinates []float64 `json:"coordinates"`
+		} `json:"geometry"`
+		Properties struct {
+			Name    string `json:"name"`
+			Region  string `json:"region"`
+			Country string `json:"country"`
+			Iso2    string `json:"country_code"`
+		} `json:"properties"`
+	} `json:"features"`
+}
+
+// Geocode returns the best match of Pelias for the query.
+func (g *PeliasGeocoder) Geocode(ctx context.Context, query string) (City, error) {
+	params := url.Values{}
+	params.Set("text", query)
+	params.Set("size", "1")
+	if g.APIKey != "" {
+		params.Set("api_key", g.APIKey)
+	}
+
+	var resp peliasResponse
+	if err := getJSON(ctx, g.Client, strings.TrimSuffix(g.BaseURL, "/")+"/v1/search?"+params.Encode(), &resp); err != nil {
+		return City{}, fmt.Errorf("pelias: %w", err)
+	}
+
+	if len(resp.Features) == 0 || len(resp.Features[0].Geometry.Coordinates) != 2 {
+		return City{}, ErrNotFound
+	}
+
+	f := resp.Features[0]
+	return City{
+		City:      f.Properties.Name,
+		Lat:       f.Geometry.Coordinates[1],
+		Lng:       f.Geometry.Coordinates[0],
+		AdminName: f.Properties.Region,
+		Country:   f.Properties.Country,
+		Iso2:      f.Properties.Iso2,
+	}, nil
+}
+
+// getJSON decodes the JSON body of a GET request to rawURL into v.
+func getJSON(ctx context.Context, client *http.Client, rawURL string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return err
+	}
+
+	return doJSON(client, req, v)
+}
+
+// doJSON sends the request and decodes the JSON body of the response into v.
+func doJSON(client *http.Client, req *http.Request, v any) error {
+	if client == nil {
+		client = defaultHTTPClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
@@ -0,0 +1,167 @@
+package nearbycities
+
+import "strings"
+
+// minPhoneticKey is the length below which a phonetic key sounds like too
+// many names to pick one, e.g. RM for Rome, Ramu and Rimah.
+const minPhoneticKey = 3
+
+// phoneticKey returns the Metaphone codes of the words of the name, e.g.
+// FLTLF for both Philadelphia and Filadelfia, so that names spelt as they
+// sound share their key.
+func phoneticKey(name string) string {
+	words := strings.Split(Slugify(name), "-")
+	codes := make([]string, 0, len(words))
+	for _, w := range words {
+		if code := metaphone(w); code != "" {
+			codes = append(codes, code)
+		}
+	}
+
+	return strings.Join(codes, " ")
+}
+
+// metaphone encodes the word with Lawrence Philips' original Metaphone
+// algorithm, keeping the sounds of its consonants and its initial vowel. 0
+// stands for th and X for sh. Letters other than a to z are ignored.
+func metaphone(word string) string {
+	w := []byte(strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z':
+			return r
+		}
+		return -1
+	}, word))
+	if len(w) == 0 {
+		return ""
+	}
+
+	// The initial letters that are not pronounced, or not as spelt.
+	switch string(w[:min(len(w), 2)]) {
+	case "AE", "GN", "KN", "PN", "WR":
+		w = w[1:]
+	case "WH":
+		w = append(w[:1], w[2:]...)
+	}
+	if w[0] == 'X' {
+		w[0] = 'S'
+	}
+
+	at := func(i int) byte {
+		if i < 0 || i >= len(w) {
+			return 0
+		}
+		return w[i]
+	}
+	isVowel := func(c byte) bool {
+		return c != 0 && strings.IndexByte("AEIOU", c) >= 0
+	}
+	isFrontVowel := func(c byte) bool {
+		return c == 'E' || c == 'I' || c == 'Y'
+	}
+
+	var code strings.Builder
+	for i, c := range w {
+		prev, next := at(i-1), at(i+1)
+		// Doubled letters sound once, but for the cc of accident.
+		if c == prev && c != 'C' {
+			continue
+		}
+
+		switch c {
+		case 'A', 'E', 'I', 'O', 'U':
+			if i == 0 {
+				code.WriteByte(c)
+			}
+		case 'B':
+			// The b of dumb is silent.
+			if !(prev == 'M' && i == len(w)-1) {
+				code.WriteByte('B')
+			}
+		case 'C':
+			switch {
+			case next == 'I' && at(i+2) == 'A', next == 'H' && prev != 'S':
+				code.WriteByte('X')
+			case isFrontVowel(next):
+				if prev != 'S' {
+					code.WriteByte('S')
+				}
+			default:
+				code.WriteByte('K')
+			}
+		case 'D':
+			if next == 'G' && isFrontVowel(at(i+2)) {
+				code.WriteByte('J')
+			} else {
+				code.WriteByte('T')
+			}
+		case 'G':
+			switch {
+			case next == 'H' && !isVowel(at(i+2)):
+				// The gh of night is silent.
+			case next == 'N' && (i+2 == len(w) || string(w[i+1:]) == "NED"):
+				// So is the g of sign and signed.
+			case isFrontVowel(next) && prev == 'D':
+				// And the g of bridge, which sounds with its d.
+			case isFrontVowel(next) && prev != 'G':
+				code.WriteByte('J')
+			default:
+				code.WriteByte('K')
+			}
+		case 'H':
+			if prev != 0 && strings.IndexByte("CSPTG", prev) >= 0 {
+				// Part of ch, sh, ph, th or gh.
+				continue
+			}
+			if isVowel(prev) && !isVowel(next) {
+				continue
+			}
+			code.WriteByte('H')
+		case 'K':
+			if prev != 'C' {
+				code.WriteByte('K')
+			}
+		case 'P':
+			if next == 'H' {
+				code.WriteByte('F')
+			} else {
+				code.WriteByte('P')
+			}
+		case 'Q':
+			code.WriteByte('K')
+		case 'S':
+			if next == 'H' || (next == 'I' && (at(i+2) == 'O' || at(i+2) == 'A')) {
+				code.WriteByte('X')
+			} else {
+				code.WriteByte('S')
+			}
+		case 'T':
+			switch {
+			case next == 'I' && (at(i+2) == 'O' || at(i+2) == 'A'):
+				code.WriteByte('X')
+			case next == 'H':
+				code.WriteByte('0')
+			case next == 'C' && at(i+2) == 'H':
+				// The t of match is silent.
+			default:
+				code.WriteByte('T')
+			}
+		case 'V':
+			code.WriteByte('F')
+		case 'W', 'Y':
+			if isVowel(next) {
+				code.WriteByte(c)
+			}
+		case 'X':
+			code.WriteString("KS")
+		case 'Z':
+			code.WriteByte('S')
+		default:
+			code.WriteByte(c)
+		}
+	}
+
+	return code.String()
+}
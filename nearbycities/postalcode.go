@@ -0,0 +1,103 @@
+package nearbycities
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"unicode"
+)
+
+// PostalCode is a postal code of a country and the place it serves, as listed
+// by the GeoNames postal code dataset.
+type PostalCode struct {
+	Iso2      string
+	Code      string
+	Place     string
+	AdminName string
+	Lat       float64
+	Lng       float64
+}
+
+// City returns the place served by the postal code.
+func (p PostalCode) City() City {
+	c := City{
+		City:      p.Place,
+		Lat:       p.Lat,
+		Lng:       p.Lng,
+		Iso2:      p.Iso2,
+		AdminName: p.AdminName,
+	}
+	if country, ok := LookupCountry(p.Iso2); ok {
+		c.Country = country.Name
+		c.Iso3 = country.Iso3
+	}
+
+	return c
+}
+
+// postalCodeKey normalizes a postal code for lookups, so that e.g.
+// "sw1a 1aa" matches "SW1A 1AA" and "1000001" matches "100-0001".
+func postalCodeKey(code string) string {
+	return strings.Map(func(r rune) rune {
+		if r == ' ' || r == '-' {
+			return -1
+		}
+		return unicode.ToUpper(r)
+	}, code)
+}
+
+// PostalCodeGeocoder returns the Geocoder resolving the postal codes imported
+// into store, e.g. "10001", to the place they serve. The country can be given
+// before or after the code, e.g. "10001 US", when several countries use it.
+// Queries without a digit are not postal codes and are left to the other
+// geocoders.
+func PostalCodeGeocoder(store Storage) Geocoder {
+	return GeocoderFunc(func(ctx context.Context, query string) (City, error) {
+		if !strings.ContainsAny(query, "0123456789") {
+			return City{}, ErrNotFound
+		}
+
+		if code, iso2, ok := splitPostalCodeCountry(query); ok {
+			p, err := store.SearchPostalCode(ctx, code, iso2)
+			if err == nil {
+				return p.City(), nil
+			}
+			if !errors.Is(err, ErrNotFound) {
+				return City{}, err
+			}
+		}
+
+		p, err := store.SearchPostalCode(ctx, query, "")
+		if err != nil {
+			return City{}, err
+		}
+
+		return p.City(), nil
+	})
+}
+
+// splitPostalCodeCountry splits a query like "10001 US" or "VN, 700000" into
+// the postal code and the ISO 3166-1 alpha-2 code of the country.
+func splitPostalCodeCountry(query string) (string, string, bool) {
+	fields := strings.Fields(strings.ReplaceAll(query, ",", " "))
+	if len(fields) < 2 {
+		return "", "", false
+	}
+
+	isCountry := func(s string) bool {
+		if len(s) != 2 {
+			return false
+		}
+		_, ok := LookupCountry(s)
+		return ok
+	}
+
+	if first := fields[0]; isCountry(first) {
+		return strings.Join(fields[1:], " "), strings.ToUpper(first), true
+	}
+	if last := fields[len(fields)-1]; isCountry(last) {
+		return strings.Join(fields[:len(fields)-1], " "), strings.ToUpper(last), true
+	}
+
+	return "", "", false
+}
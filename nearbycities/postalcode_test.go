@@ -0,0 +1,101 @@
+package nearbycities
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestPostalCodeKey(t *testing.T) {
+	tests := []struct {
+		code, want string
+	}{
+		{"10001", "10001"},
+		{"sw1a 1aa", "SW1A1AA"},
+		{"SW1A 1AA", "SW1A1AA"},
+		{"100-0001", "1000001"},
+		{"1000001", "1000001"},
+		{"k1a 0b1", "K1A0B1"},
+	}
+	for _, tt := range tests {
+		if got := postalCodeKey(tt.code); got != tt.want {
+			t.Errorf("postalCodeKey(%q) = %q, want %q", tt.code, got, tt.want)
+		}
+	}
+}
+
+func TestSplitPostalCodeCountry(t *testing.T) {
+	tests := []struct {
+		query      string
+		code, iso2 string
+		ok         bool
+	}{
+		{"10001 US", "10001", "US", true},
+		{"VN, 700000", "700000", "VN", true},
+		{"gb SW1A 1AA", "SW1A 1AA", "GB", true},
+		{"SW1A 1AA", "", "", false},
+		{"10001", "", "", false},
+		{"10001 XX", "", "", false},
+	}
+	for _, tt := range tests {
+		code, iso2, ok := splitPostalCodeCountry(tt.query)
+		if code != tt.code || iso2 != tt.iso2 || ok != tt.ok {
+			t.Errorf("splitPostalCodeCountry(%q) = %q, %q, %v, want %q, %q, %v", tt.query, code, iso2, ok, tt.code, tt.iso2, tt.ok)
+		}
+	}
+}
+
+func TestPostalCodeGeocoder(t *testing.T) {
+	ctx := context.Background()
+	store, err := Open(filepath.Join(t.TempDir(), "nearby_cities.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if err := store.MigrateUp(ctx); err != nil {
+		skipWithoutFTS5(t, err)
+		t.Fatal(err)
+	}
+
+	err = store.ImportPostalCodes(ctx, []PostalCode{
+		{Iso2: "US", Code: "10001", Place: "New York", AdminName: "New York", Lat: 40.7484, Lng: -73.9967},
+		{Iso2: "GB", Code: "SW1A 1AA", Place: "London", AdminName: "England", Lat: 51.501, Lng: -0.1416},
+		{Iso2: "JP", Code: "100-0001", Place: "Chiyoda", AdminName: "Tokyo", Lat: 35.6841, Lng: 139.7536},
+		{Iso2: "FR", Code: "75001", Place: "Paris", AdminName: "Île-de-France", Lat: 48.8592, Lng: 2.3417},
+		{Iso2: "US", Code: "75001", Place: "Addison", AdminName: "Texas", Lat: 32.9601, Lng: -96.8384},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		query, city, iso2 string
+	}{
+		{"10001", "New York", "US"},
+		{"sw1a 1aa", "London", "GB"},
+		{"1000001", "Chiyoda", "JP"},
+		{"100-0001", "Chiyoda", "JP"},
+		// Neither country having cities, the first one wins.
+		{"75001", "Paris", "FR"},
+		{"75001 US", "Addison", "US"},
+		{"US, 75001", "Addison", "US"},
+	}
+	geocoder := PostalCodeGeocoder(store)
+	for _, tt := range tests {
+		c, err := geocoder.Geocode(ctx, tt.query)
+		if err != nil {
+			t.Errorf("%q: %v", tt.query, err)
+			continue
+		}
+		if c.City != tt.city || c.Iso2 != tt.iso2 {
+			t.Errorf("%q: got %s, %s, want %s, %s", tt.query, c.City, c.Iso2, tt.city, tt.iso2)
+		}
+	}
+
+	for _, query := range []string{"Hanoi", "99999"} {
+		if c, err := geocoder.Geocode(ctx, query); !errors.Is(err, ErrNotFound) {
+			t.Errorf("%q: got %+v, %v, want ErrNotFound", query, c, err)
+		}
+	}
+}
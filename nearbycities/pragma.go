@@ -0,0 +1,124 @@
+package nearbycities
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// SQLitePragmas tunes the connections to an on-disk SQLite database.
+type SQLitePragmas struct {
+	// JournalMode is WAL by default, which lets the lookups read while an
+	// import or a refresh writes.
+	JournalMode string
+
+	// Synchronous is NORMAL by default, which is safe in WAL mode.
+	Synchronous string
+
+	// BusyTimeout is how long a connection waits for a lock before failing
+	// with "database is locked".
+	BusyTimeout time.Duration
+
+	// CacheSize is the size of the page cache of each connection, in bytes.
+	CacheSize int64
+
+	// MmapSize is how much of the database file is memory-mapped, in
+	// bytes, 0 to read it with system calls only.
+	MmapSize int64
+
+	// WALAutocheckpoint is the number of pages of the write-ahead log past
+	// which a commit checkpoints it into the database, 1000 by default as
+	// in SQLite, 0 to leave the checkpoints to another process, such as
+	// Litestream.
+	WALAutocheckpoint int
+}
+
+// DefaultSQLitePragmas are the pragmas of the databases opened with Open.
+var DefaultSQLitePragmas = SQLitePragmas{
+	JournalMode: "WAL",
+	Synchronous: "NORMAL",
+	BusyTimeout: 5 * time.Second,
+	CacheSize:   32 << 20,
+	MmapSize:    256 << 20,
+
+	WALAutocheckpoint: 1000,
+}
+
+// statements returns the PRAGMA statements setting p, which are checked
+// since they cannot be given as parameters.
+func (p SQLitePragmas) statements() ([]string, error) {
+	journalMode := strings.ToUpper(p.JournalMode)
+	if !slices.Contains([]string{"DELETE", "TRUNCATE", "PERSIST", "MEMORY", "WAL", "OFF"}, journalMode) {
+		return nil, fmt.Errorf("unknown SQLite journal mode: %s", p.JournalMode)
+	}
+	synchronous := strings.ToUpper(p.Synchronous)
+	if !slices.Contains([]string{"OFF", "NORMAL", "FULL", "EXTRA"}, synchronous) {
+		return nil, fmt.Errorf("unknown SQLite synchronous setting: %s", p.Synchronous)
+	}
+
+	return []string{
+		"PRAGMA journal_mode = " + journalMode,
+		"PRAGMA synchronous = " + synchronous,
+		fmt.Sprintf("PRAGMA busy_timeout = %d", p.BusyTimeout.Milliseconds()),
+		// A negative cache size is in KiB rather than in pages.
+		fmt.Sprintf("PRAGMA cache_size = %d", -p.CacheSize/1024),
+		fmt.Sprintf("PRAGMA mmap_size = %d", p.MmapSize),
+		fmt.Sprintf("PRAGMA wal_autocheckpoint = %d", p.WALAutocheckpoint),
+	}, nil
+}
+
+// pragmaConnector opens the connections of the pool with the driver and
+// runs the pragmas on each, as most of them only apply to one connection.
+type pragmaConnector struct {
+	driver  driver.Driver
+	dsn     string
+	pragmas []string
+}
+
+func (c *pragmaConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.driver.Open(c.dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	execer, ok := conn.(driver.ExecerContext)
+	if !ok {
+		conn.Close()
+		return nil, fmt.Errorf("SQLite driver cannot execute statements on a connection")
+	}
+	for _, pragma := range c.pragmas {
+		if _, err := execer.ExecContext(ctx, pragma, nil); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("error running %s: %w", pragma, err)
+		}
+	}
+
+	return conn, nil
+}
+
+func (c *pragmaConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+// openSQLite opens the database at dsn with the pragmas.
+func openSQLite(dsn string, pragmas SQLitePragmas) (*sql.DB, error) {
+	stmts, err := pragmas.statements()
+	if err != nil {
+		return nil, err
+	}
+
+	// The driver is only reachable through a handle, which is not
+	// connected yet.
+	db, err := sql.Open(sqliteDriver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	drv := db.Driver()
+	db.Close()
+
+	return sql.OpenDB(&pragmaConnector{driver: drv, dsn: dsn, pragmas: stmts}), nil
+}
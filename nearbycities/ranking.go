@@ -0,0 +1,38 @@
+package nearbycities
+
+import (
+	"math"
+	"sort"
+)
+
+const (
+	// populationWeight is how much more relevant a match gets for each
+	// tenfold of its population, so that London, United Kingdom ranks
+	// before London, Kentucky.
+	populationWeight = 0.1
+
+	// rankedMatches is how many of the most relevant matches of a search
+	// are ranked again with their population.
+	rankedMatches = 50
+)
+
+// rankByPopulation sorts the cities matching a search, whose relevance is
+// higher the better they match, by their relevance weighted by their
+// population.
+func rankByPopulation(cities []City, relevance []float64) {
+	type match struct {
+		city  City
+		score float64
+	}
+	matches := make([]match, len(cities))
+	for i, c := range cities {
+		matches[i] = match{city: c, score: relevance[i] * (1 + populationWeight*math.Log10(1+population(c)))}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].score > matches[j].score
+	})
+	for i, m := range matches {
+		cities[i] = m.city
+	}
+}
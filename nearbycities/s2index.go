@@ -0,0 +1,93 @@
+package nearbycities
+
+import (
+	"context"
+	"sort"
+
+	"github.com/golang/geo/s1"
+	"github.com/golang/geo/s2"
+	"github.com/quantonganh/geohash"
+)
+
+// s2MaxCoverCells bounds the number of cells covering the search circle.
+// More cells fit the circle more tightly but cost more range scans.
+const s2MaxCoverCells = 16
+
+// S2Index is an in-memory index of the cities by S2 cell, answering radius
+// queries exactly. S2 cells keep a similar shape and size all over the
+// sphere, so the search circle is covered equally well near the poles and
+// across the antimeridian.
+type S2Index struct {
+	cities []City
+	// cells holds the leaf cell of every city, sorted, along with its index
+	// in cities.
+	cells []s2Entry
+}
+
+type s2Entry struct {
+	id    s2.CellID
+	index int
+}
+
+// BuildS2Index loads every city of store into a new index.
+func BuildS2Index(ctx context.Context, store Storage) (*S2Index, error) {
+	var cities []City
+	err := store.EachCity(ctx, func(c City) error {
+		c.Geohash = geohash.Encode(c.Lat, c.Lng)
+		cities = append(cities, c)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return NewS2Index(cities), nil
+}
+
+// NewS2Index builds an index over the cities.
+func NewS2Index(cities []City) *S2Index {
+	idx := &S2Index{
+		cities: cities,
+		cells:  make([]s2Entry, len(cities)),
+	}
+
+	for i, c := range cities {
+		idx.cells[i] = s2Entry{id: s2.CellIDFromLatLng(s2.LatLngFromDegrees(c.Lat, c.Lng)), index: i}
+	}
+	sort.Slice(idx.cells, func(i, j int) bool {
+		return idx.cells[i].id < idx.cells[j].id
+	})
+
+	return idx
+}
+
+// Len returns the number of cities in the index.
+func (idx *S2Index) Len() int {
+	return len(idx.cities)
+}
+
+// NearbyByLatLng returns the cities within radius kilometers of the
+// coordinates, sorted by distance. The circle is covered with cells whose
+// cities are then checked against it.
+func (idx *S2Index) NearbyByLatLng(_ context.Context, lat, lng, radius float64) ([]City, error) {
+	center := s2.PointFromLatLng(s2.LatLngFromDegrees(lat, lng))
+	circle := s2.CapFromCenterAngle(center, s1.Angle(radius/earthRadius))
+	coverer := &s2.RegionCoverer{MinLevel: 0, MaxLevel: s2.MaxLevel, MaxCells: s2MaxCoverCells}
+
+	var found []int
+	for _, cell := range coverer.Covering(circle) {
+		lo, hi := cell.RangeMin(), cell.RangeMax()
+		i := sort.Search(len(idx.cells), func(i int) bool {
+			return idx.cells[i].id >= lo
+		})
+		for ; i < len(idx.cells) && idx.cells[i].id <= hi; i++ {
+			e := idx.cells[i]
+			c := idx.cities[e.index]
+			if circle.ContainsPoint(s2.PointFromLatLng(s2.LatLngFromDegrees(c.Lat, c.Lng))) {
+				found = append(found, e.index)
+			}
+		}
+	}
+
+	return withDistances(idx.cities, lat, lng, found), nil
+}
@@ -0,0 +1,20 @@
+package nearbycities
+
+import (
+	"context"
+	"testing"
+)
+
+func TestS2IndexNearbyByLatLng(t *testing.T) {
+	cities := randomCities(5000)
+	idx := NewS2Index(cities)
+	for _, q := range spatialQueries {
+		t.Run(q.name, func(t *testing.T) {
+			got, err := idx.NearbyByLatLng(context.Background(), q.lat, q.lng, q.radius)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkNearby(t, got, nearbyIDs(cities, q.lat, q.lng, q.radius))
+		})
+	}
+}
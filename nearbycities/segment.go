@@ -0,0 +1,82 @@
+package nearbycities
+
+import (
+	"strings"
+	"unicode"
+)
+
+// unspacedScripts are the scripts written without spaces between words,
+// whose names the unicode61 tokenizer of SQLite would index as one token.
+var unspacedScripts = []*unicode.RangeTable{
+	unicode.Han,
+	unicode.Hiragana,
+	unicode.Katakana,
+	unicode.Thai,
+	unicode.Lao,
+	unicode.Khmer,
+	unicode.Myanmar,
+}
+
+func isUnspaced(r rune) bool {
+	return unicode.IsOneOf(unspacedScripts, r)
+}
+
+// segment splits the runs of unspaced scripts of s into single characters,
+// e.g. 東 京 都 for 東京都, so that a search for a part of the name matches.
+// It returns an empty string if s has none.
+func segment(s string) string {
+	if strings.IndexFunc(s, isUnspaced) < 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	for _, r := range s {
+		if isUnspaced(r) {
+			b.WriteRune(' ')
+			b.WriteRune(r)
+			b.WriteRune(' ')
+			continue
+		}
+		b.WriteRune(r)
+	}
+
+	return strings.Join(strings.Fields(b.String()), " ")
+}
+
+// nameTokens returns the segmented names of the city and of its region,
+// indexed alongside them. Their marks are removed as they are from the
+// queries, e.g. the vowel signs of Thai.
+func nameTokens(c City) string {
+	return strings.TrimSpace(segment(removeDiacritics(c.City)) + " " + segment(removeDiacritics(c.AdminName)))
+}
+
+// segmentQuery turns the runs of unspaced scripts of a full-text query into
+// phrases of their characters, e.g. "東 京" for 東京, which match the
+// segmented names.
+func segmentQuery(query string) string {
+	if strings.IndexFunc(query, isUnspaced) < 0 {
+		return query
+	}
+
+	var (
+		b   strings.Builder
+		run []string
+	)
+	flush := func() {
+		if len(run) > 0 {
+			b.WriteString(` "` + strings.Join(run, " ") + `" `)
+			run = run[:0]
+		}
+	}
+	for _, r := range query {
+		if isUnspaced(r) {
+			run = append(run, string(r))
+			continue
+		}
+		flush()
+		b.WriteRune(r)
+	}
+	flush()
+
+	return strings.Join(strings.Fields(b.String()), " ")
+}
@@ -0,0 +1,605 @@
+package nearbycities
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/quantonganh/geohash"
+)
+
+// Service answers the nearby-cities lookups on top of a Storage.
+type Service struct {
+	store     Storage
+	geocoder  geocoderChain
+	ipLocator ipLocatorChain
+
+	distance DistanceMethod
+
+	mu    sync.RWMutex
+	index SpatialIndex
+	fuzzy *FuzzyIndex
+
+	resolved     *lruCache[resolution]
+	nearbyCities *lruCache[[]City]
+}
+
+// resolution is the cached answer to a query: its city, or the error telling
+// that there is none or that several are alike.
+type resolution struct {
+	city City
+	err  error
+}
+
+// Option configures a Service.
+type Option func(*Service)
+
+// WithFallbackGeocoders makes the Service ask the geocoders, in order, for
+// the places that are not in the dataset.
+func WithFallbackGeocoders(geocoders ...Geocoder) Option {
+	return func(s *Service) {
+		s.geocoder = append(s.geocoder, geocoders...)
+	}
+}
+
+// WithIPLocator makes the Service locate IP addresses with l instead of the
+// IP2Location ranges of the storage.
+func WithIPLocator(l IPLocator) Option {
+	return func(s *Service) {
+		s.ipLocator[0] = l
+	}
+}
+
+// WithFallbackIPLocators makes the Service ask the locators, in order, for
+// the addresses that the main one cannot locate.
+func WithFallbackIPLocators(locators ...IPLocator) Option {
+	return func(s *Service) {
+		s.ipLocator = append(s.ipLocator, locators...)
+	}
+}
+
+// WithDistanceMethod makes the Service compute the distances to the nearby
+// cities with m. Distances are Haversine by default.
+func WithDistanceMethod(m DistanceMethod) Option {
+	return func(s *Service) {
+		s.distance = m
+	}
+}
+
+// WithResultCache makes the Service keep up to size cities resolved from a
+// query, and as many lists of nearby cities, for ttl, so that the popular
+// searches are answered without querying the storage.
+func WithResultCache(size int, ttl time.Duration) Option {
+	return func(s *Service) {
+		s.resolved = newLRUCache[resolution]("resolve", size, ttl)
+		s.nearbyCities = newLRUCache[[]City]("nearby", size, ttl)
+	}
+}
+
+// NewService returns a Service backed by store.
+func NewService(store Storage, opts ...Option) *Service {
+	s := &Service{
+		store:     store,
+		ipLocator: ipLocatorChain{store},
+		distance:  Haversine,
+		index:     store,
+	}
+	// The airport codes, UN/LOCODEs, partial names, geohashes, misspelt
+	// names and names spelt as they sound are looked up before asking the
+	// fallbacks.
+	s.geocoder = geocoderChain{
+		PostalCodeGeocoder(store),
+		StorageGeocoder(store),
+		AirportGeocoder(store),
+		LocodeGeocoder(store),
+		PrefixGeocoder(store),
+		GeohashGeocoder(),
+		GeocoderFunc(s.geocodeFuzzy),
+		PhoneticGeocoder(store),
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+// UseSpatialIndex makes the Service answer nearby queries with idx instead
+// of the storage. It can be called while the Service is in use, e.g. once an
+// in-memory index has been built.
+func (s *Service) UseSpatialIndex(idx SpatialIndex) {
+	s.mu.Lock()
+	s.index = idx
+	s.mu.Unlock()
+
+	if s.nearbyCities != nil {
+		s.nearbyCities.purge()
+	}
+}
+
+// UseFuzzyIndex makes the Service look the queries matching no city up in
+// idx, so that a typo still finds the city. It can be called while the
+// Service is in use, e.g. once the index has been built.
+func (s *Service) UseFuzzyIndex(idx *FuzzyIndex) {
+	s.mu.Lock()
+	s.fuzzy = idx
+	s.mu.Unlock()
+
+	// The misspelt queries that found nothing may find a city now.
+	if s.resolved != nil {
+		s.resolved.purge()
+	}
+}
+
+// PurgeCache drops the results cached, e.g. once the cities of the storage
+// have changed.
+func (s *Service) PurgeCache() {
+	if s.resolved != nil {
+		s.resolved.purge()
+	}
+	if s.nearbyCities != nil {
+		s.nearbyCities.purge()
+	}
+}
+
+// CacheStats reports the use of the result caches, none unless the Service
+// has been given WithResultCache.
+func (s *Service) CacheStats() []CacheStats {
+	if s.resolved == nil {
+		return nil
+	}
+
+	return []CacheStats{s.resolved.snapshot(), s.nearbyCities.snapshot()}
+}
+
+// DidYouMean returns up to limit names of cities spelt close to the query,
+// e.g. Kraków for Krakaw, to suggest when it matches none. It returns none
+// until a FuzzyIndex is in use.
+func (s *Service) DidYouMean(query string, limit int) []string {
+	s.mu.RLock()
+	idx := s.fuzzy
+	s.mu.RUnlock()
+
+	if idx == nil {
+		return nil
+	}
+
+	return idx.Suggest(query, limit)
+}
+
+func (s *Service) geocodeFuzzy(ctx context.Context, query string) (City, error) {
+	s.mu.RLock()
+	idx := s.fuzzy
+	s.mu.RUnlock()
+
+	if idx == nil {
+		return City{}, ErrNotFound
+	}
+
+	return idx.Geocode(ctx, query)
+}
+
+// nearby returns the cities within radius kilometers of the coordinates,
+// cached by their geohash and the radius.
+func (s *Service) nearby(ctx context.Context, lat, lng, radius float64) ([]City, error) {
+	if s.nearbyCities == nil {
+		return s.nearbyUncached(ctx, lat, lng, radius)
+	}
+
+	key := geohash.Encode(lat, lng) + "/" + strconv.FormatFloat(radius, 'g', -1, 64)
+	if cities, ok := s.nearbyCities.get(key); ok {
+		return slices.Clone(cities), nil
+	}
+
+	cities, err := s.nearbyUncached(ctx, lat, lng, radius)
+	if err != nil {
+		return nil, err
+	}
+	s.nearbyCities.add(key, slices.Clone(cities))
+
+	return cities, nil
+}
+
+func (s *Service) nearbyUncached(ctx context.Context, lat, lng, radius float64) ([]City, error) {
+	s.mu.RLock()
+	idx := s.index
+	s.mu.RUnlock()
+
+	if s.distance != Geodesic {
+		cities, err := idx.NearbyByLatLng(ctx, lat, lng, radius)
+		for i := range cities {
+			cities[i].Bearing = roundBearing(Bearing(lat, lng, cities[i].Lat, cities[i].Lng))
+			cities[i].DistanceMethod = Haversine
+		}
+		return cities, err
+	}
+
+	// The indexes select the cities by their Haversine distance, which can
+	// be shorter than the geodesic one by up to 0.5%.
+	candidates, err := idx.NearbyByLatLng(ctx, lat, lng, radius*1.01)
+	if err != nil {
+		return nil, err
+	}
+
+	cities := make([]City, 0, len(candidates))
+	for _, c := range candidates {
+		distance := GeodesicDistance(lat, lng, c.Lat, c.Lng)
+		if distance > radius {
+			continue
+		}
+		c.Distance = math.Round(distance*100) / 100
+		c.Bearing = roundBearing(Bearing(lat, lng, c.Lat, c.Lng))
+		c.DistanceMethod = Geodesic
+		cities = append(cities, c)
+	}
+
+	sort.SliceStable(cities, func(i, j int) bool {
+		return cities[i].Distance < cities[j].Distance
+	})
+
+	return cities, nil
+}
+
+const (
+	// maxNamesakes bounds the cities offered to pick from when several
+	// bear the name searched for.
+	maxNamesakes = 10
+
+	// dominantPopulation is how many times more populated than its
+	// namesakes a city must be to be picked without asking, e.g. Paris,
+	// France over Paris, Texas.
+	dominantPopulation = 10
+)
+
+// NearbyCity finds the city matching the query and the cities within radius
+// kilometers of it. When several cities bear the name and none is far more
+// populated than the others, it returns an *AmbiguousError listing them.
+func (s *Service) NearbyCity(ctx context.Context, query string, radius float64) (City, []City, error) {
+	from, err := s.resolve(ctx, query)
+	if err != nil {
+		return City{}, nil, err
+	}
+
+	cities, err := s.nearby(ctx, from.Lat, from.Lng, radius)
+	if err != nil {
+		return City{}, nil, err
+	}
+
+	return from, cities, nil
+}
+
+// NearbyCityByID returns the city with the dataset ID and the cities within
+// radius kilometers of it, e.g. once the user picked one of the cities of an
+// *AmbiguousError.
+func (s *Service) NearbyCityByID(ctx context.Context, id string, radius float64) (City, []City, error) {
+	from, err := s.store.CityByID(ctx, id)
+	if err != nil {
+		return City{}, nil, err
+	}
+
+	cities, err := s.nearby(ctx, from.Lat, from.Lng, radius)
+	if err != nil {
+		return City{}, nil, err
+	}
+
+	return from, cities, nil
+}
+
+// resolve returns the city the query stands for, cached by the query with
+// its spaces collapsed. Failures other than finding no city or several are
+// not cached, e.g. those of a fallback geocoder that is down.
+func (s *Service) resolve(ctx context.Context, query string) (City, error) {
+	if s.resolved == nil {
+		return s.lookup(ctx, query)
+	}
+
+	key := strings.Join(strings.Fields(query), " ")
+	if r, ok := s.resolved.get(key); ok {
+		return r.city, r.err
+	}
+
+	city, err := s.lookup(ctx, query)
+	var ambiguous *AmbiguousError
+	if err == nil || errors.Is(err, ErrNotFound) || errors.As(err, &ambiguous) {
+		s.resolved.add(key, resolution{city: city, err: err})
+	}
+
+	return city, err
+}
+
+// lookup returns the city the query stands for: the most populated of the
+// cities named so, unless they are too alike to pick one, or else the
+// answer of the geocoders. The name can be followed by the places the city
+// lies in, e.g. Paris, TX or Springfield, Illinois, United States.
+func (s *Service) lookup(ctx context.Context, query string) (City, error) {
+	name, places, _ := strings.Cut(query, ",")
+	namesakes, err := s.namesakes(ctx, name, strings.Split(places, ","))
+	if err != nil {
+		return City{}, err
+	}
+
+	switch {
+	case len(namesakes) == 0:
+		return s.geocoder.Geocode(ctx, query)
+	case len(namesakes) == 1 || population(namesakes[0]) >= dominantPopulation*population(namesakes[1]):
+		return namesakes[0], nil
+	default:
+		return City{}, &AmbiguousError{Query: query, Cities: namesakes[:min(len(namesakes), maxNamesakes)]}
+	}
+}
+
+// namesakes returns the cities of the dataset named so, or known by the name
+// as an alias, and lying in all the places, the most populated first.
+func (s *Service) namesakes(ctx context.Context, name string, places []string) ([]City, error) {
+	key := Slugify(name)
+	if key == "" {
+		return nil, nil
+	}
+	places = slices.DeleteFunc(places, func(p string) bool {
+		return strings.TrimSpace(p) == ""
+	})
+
+	// The cities named so are usually among the best matches, ahead of
+	// the ones whose region or country bears the name.
+	matches, err := s.store.SearchCities(ctx, name, 10*maxNamesakes)
+	if err != nil {
+		return nil, err
+	}
+
+	matches = slices.DeleteFunc(matches, func(c City) bool {
+		return Slugify(c.CityAscii) != key && Slugify(c.City) != key
+	})
+
+	// An alias stands for its city alongside the cities bearing the name,
+	// e.g. Kiev for Kyiv, and the most populated is picked as usual.
+	alias, err := s.store.CityByAlias(ctx, name)
+	switch {
+	case errors.Is(err, ErrNotFound):
+	case err != nil:
+		return nil, err
+	case !slices.ContainsFunc(matches, func(c City) bool { return c.ID == alias.ID }):
+		matches = append(matches, alias)
+	}
+
+	namesakes := slices.DeleteFunc(matches, func(c City) bool {
+		for _, p := range places {
+			if !c.isIn(p) {
+				return true
+			}
+		}
+		return false
+	})
+	sort.SliceStable(namesakes, func(i, j int) bool {
+		return population(namesakes[i]) > population(namesakes[j])
+	})
+	for i := range namesakes {
+		namesakes[i].Geohash = geohash.Encode(namesakes[i].Lat, namesakes[i].Lng)
+	}
+
+	return namesakes, nil
+}
+
+// population returns the population of the city, 0 if it is unknown.
+func population(c City) float64 {
+	if c.Population == nil {
+		return 0
+	}
+	return float64(*c.Population)
+}
+
+// Distance returns the distance in kilometers between two coordinates,
+// computed and rounded as the distances of the nearby cities are.
+func (s *Service) Distance(lat1, lng1, lat2, lng2 float64) float64 {
+	return math.Round(s.distance.Distance(lat1, lng1, lat2, lng2)*100) / 100
+}
+
+// roundBearing rounds the bearing to a whole degree, 360 being the north
+// again.
+func roundBearing(bearing float64) float64 {
+	return math.Mod(math.Round(bearing), 360)
+}
+
+// NearbyLatLng returns the cities within radius kilometers of the
+// coordinates.
+func (s *Service) NearbyLatLng(ctx context.Context, lat, lng, radius float64) ([]City, error) {
+	return s.nearby(ctx, lat, lng, radius)
+}
+
+// EachNearbyLatLng calls fn for every city within radius kilometers of the
+// coordinates as the storage reads it, in no particular order, so that a
+// large area is written out without holding all its cities. When an
+// in-memory spatial index is in use, it is asked instead and the cities come
+// nearest first.
+func (s *Service) EachNearbyLatLng(ctx context.Context, lat, lng, radius float64, fn func(City) error) error {
+	s.mu.RLock()
+	idx := s.index
+	s.mu.RUnlock()
+
+	if idx != SpatialIndex(s.store) {
+		cities, err := s.nearbyUncached(ctx, lat, lng, radius)
+		if err != nil {
+			return err
+		}
+		for _, c := range cities {
+			if err := fn(c); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if s.distance != Geodesic {
+		return s.store.EachNearby(ctx, lat, lng, radius, func(c City) error {
+			c.Bearing = roundBearing(Bearing(lat, lng, c.Lat, c.Lng))
+			c.DistanceMethod = Haversine
+			return fn(c)
+		})
+	}
+
+	// The storage selects the cities by their Haversine distance, which can
+	// be shorter than the geodesic one by up to 0.5%.
+	return s.store.EachNearby(ctx, lat, lng, radius*1.01, func(c City) error {
+		distance := GeodesicDistance(lat, lng, c.Lat, c.Lng)
+		if distance > radius {
+			return nil
+		}
+		c.Distance = math.Round(distance*100) / 100
+		c.Bearing = roundBearing(Bearing(lat, lng, c.Lat, c.Lng))
+		c.DistanceMethod = Geodesic
+		return fn(c)
+	})
+}
+
+// LocateIP returns the location of the IP address. Private addresses cannot
+// be located and return ErrNotFound.
+func (s *Service) LocateIP(ctx context.Context, ip string) (IPLocation, error) {
+	if IsPrivateIP(net.ParseIP(ip)) {
+		return IPLocation{}, ErrNotFound
+	}
+
+	return s.ipLocator.LookupIP(ctx, ip)
+}
+
+// NearbyAirports returns the airports within radius kilometers of the
+// coordinates, nearest first. When scheduled is set, only the airports with
+// scheduled airline service are returned.
+func (s *Service) NearbyAirports(ctx context.Context, lat, lng, radius float64, scheduled bool) ([]Airport, error) {
+	airports, err := s.store.NearbyAirports(ctx, lat, lng, radius)
+	if err != nil || !scheduled {
+		return airports, err
+	}
+
+	return slices.DeleteFunc(airports, func(a Airport) bool {
+		return !a.Scheduled
+	}), nil
+}
+
+// NearestAirport returns the nearest airport with scheduled airline service
+// within 500 kilometers of the coordinates, or ErrNotFound.
+func (s *Service) NearestAirport(ctx context.Context, lat, lng float64) (Airport, error) {
+	// Most places have one close by, so the search starts small to keep
+	// the small airfields around out of the candidates.
+	for _, radius := range []float64{50, 150, 500} {
+		airports, err := s.NearbyAirports(ctx, lat, lng, radius, true)
+		if err != nil {
+			return Airport{}, err
+		}
+		if len(airports) > 0 {
+			return airports[0], nil
+		}
+	}
+
+	return Airport{}, ErrNotFound
+}
+
+// maxDistance is the longest great-circle distance between two places, in
+// kilometers, half the circumference of the Earth.
+const maxDistance = 20038
+
+// NearestLatLng returns the k cities closest to the coordinates, nearest
+// first, however far they are. When keep is not nil, only the cities it
+// keeps are counted, e.g. the capitals.
+func (s *Service) NearestLatLng(ctx context.Context, lat, lng float64, k int, keep func(City) bool) ([]City, error) {
+	// The circle grows until it holds k cities, which are then the nearest
+	// ones, as the closer ones are in it too.
+	for radius := 50.0; ; radius = min(2*radius, maxDistance) {
+		cities, err := s.nearby(ctx, lat, lng, radius)
+		if err != nil {
+			return nil, err
+		}
+		if keep != nil {
+			cities = slices.DeleteFunc(cities, func(c City) bool {
+				return !keep(c)
+			})
+		}
+		if len(cities) >= k || radius == maxDistance {
+			return cities[:min(k, len(cities))], nil
+		}
+	}
+}
+
+// NearestCity finds the city matching the query, like NearbyCity, and the k
+// cities closest to it as NearestLatLng does.
+func (s *Service) NearestCity(ctx context.Context, query string, k int, keep func(City) bool) (City, []City, error) {
+	from, err := s.resolve(ctx, query)
+	if err != nil {
+		return City{}, nil, err
+	}
+
+	cities, err := s.NearestLatLng(ctx, from.Lat, from.Lng, k, keep)
+	if err != nil {
+		return City{}, nil, err
+	}
+
+	return from, cities, nil
+}
+
+// NearestCityByID returns the city with the dataset ID and the k cities
+// closest to it.
+func (s *Service) NearestCityByID(ctx context.Context, id string, k int, keep func(City) bool) (City, []City, error) {
+	from, err := s.store.CityByID(ctx, id)
+	if err != nil {
+		return City{}, nil, err
+	}
+
+	cities, err := s.NearestLatLng(ctx, from.Lat, from.Lng, k, keep)
+	if err != nil {
+		return City{}, nil, err
+	}
+
+	return from, cities, nil
+}
+
+// NearbyIP locates the IP address and returns the cities within radius
+// kilometers of it. Private addresses cannot be located and return
+// ErrNotFound.
+func (s *Service) NearbyIP(ctx context.Context, ip string, radius float64) (IPLocation, []City, error) {
+	loc, err := s.LocateIP(ctx, ip)
+	if err != nil {
+		return IPLocation{}, nil, err
+	}
+
+	cities, err := s.nearby(ctx, loc.Lat, loc.Lng, radius)
+	if err != nil {
+		return IPLocation{}, nil, err
+	}
+
+	return loc, cities, nil
+}
+
+// CountryCities returns up to limit cities of the country in the sort order,
+// skipping the first offset ones, and the number of cities of the country.
+func (s *Service) CountryCities(ctx context.Context, iso2 string, sort CitySort, offset, limit int) ([]City, int, error) {
+	cities, total, err := s.store.CountryCities(ctx, iso2, sort, offset, limit)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	for i := range cities {
+		cities[i].Geohash = geohash.Encode(cities[i].Lat, cities[i].Lng)
+	}
+
+	return cities, total, nil
+}
+
+// EachCountryCity calls fn for every city of the country in the sort order
+// as the storage reads it.
+func (s *Service) EachCountryCity(ctx context.Context, iso2 string, sort CitySort, fn func(City) error) error {
+	return s.store.EachCountryCity(ctx, iso2, sort, func(c City) error {
+		c.Geohash = geohash.Encode(c.Lat, c.Lng)
+		return fn(c)
+	})
+}
+
+// Suggest returns up to limit cities whose name starts with the query.
+func (s *Service) Suggest(ctx context.Context, query string, limit int) ([]City, error) {
+	return s.store.SuggestCities(ctx, query, limit)
+}
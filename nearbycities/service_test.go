@@ -0,0 +1,50 @@
+package nearbycities
+
+import (
+	"context"
+	"testing"
+)
+
+func TestRoundBearing(t *testing.T) {
+	tests := []struct {
+		bearing, want float64
+	}{
+		{0, 0},
+		{44.4, 44},
+		{44.5, 45},
+		{359.4, 359},
+		{359.5, 0},
+		{359.99, 0},
+	}
+	for _, tt := range tests {
+		if got := roundBearing(tt.bearing); got != tt.want {
+			t.Errorf("roundBearing(%v) = %v, want %v", tt.bearing, got, tt.want)
+		}
+	}
+}
+
+func TestServiceNearbyBearing(t *testing.T) {
+	store, _ := openTestStore(t)
+
+	for _, m := range []DistanceMethod{Haversine, Geodesic} {
+		t.Run(string(m), func(t *testing.T) {
+			svc := NewService(store, WithDistanceMethod(m))
+			cities, err := svc.NearbyLatLng(context.Background(), 21.0283, 105.8542, 100)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(cities) == 0 {
+				t.Fatal("no city within 100 km of Hanoi")
+			}
+			for _, c := range cities {
+				want := roundBearing(Bearing(21.0283, 105.8542, c.Lat, c.Lng))
+				if c.Bearing != want {
+					t.Errorf("%s: bearing %v, want %v", c.City, c.Bearing, want)
+				}
+				if c.DistanceMethod != m {
+					t.Errorf("%s: distance method %q, want %q", c.City, c.DistanceMethod, m)
+				}
+			}
+		})
+	}
+}
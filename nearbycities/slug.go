@@ -0,0 +1,89 @@
+package nearbycities
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Slugify returns s as a URL path segment made of lowercase ASCII letters
+// and digits separated by dashes, e.g. cote-d-ivoire for Côte d'Ivoire.
+func Slugify(s string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range removeDiacritics(s) {
+		switch {
+		case r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(unicode.ToLower(r))
+			dash = false
+		default:
+			dash = true
+		}
+	}
+
+	return b.String()
+}
+
+// foldedLetters maps the letters that Unicode does not decompose into a base
+// letter and a diacritic to their usual ASCII spelling.
+var foldedLetters = strings.NewReplacer(
+	"Đ", "D", "đ", "d", "Ð", "D", "ð", "d",
+	"Ø", "O", "ø", "o", "Ł", "L", "ł", "l",
+	"Ħ", "H", "ħ", "h", "ı", "i", "ß", "ss",
+	"Æ", "AE", "æ", "ae", "Œ", "OE", "œ", "oe",
+	"Þ", "Th", "þ", "th",
+)
+
+// removeDiacritics returns s with the diacritics of its letters dropped and
+// the base letters kept, e.g. Ha Noi for Hà Nội.
+func removeDiacritics(s string) string {
+	var b strings.Builder
+	for _, r := range norm.NFD.String(s) {
+		if !unicode.Is(unicode.Mn, r) {
+			b.WriteRune(r)
+		}
+	}
+
+	return foldedLetters.Replace(b.String())
+}
+
+// CitySlugs returns the slugs of the cities by ID, made of the name of the
+// city and of its country, e.g. hanoi-vietnam. The cities sharing one are
+// told apart by their region, then by their ID, the most populated keeping
+// the shorter slug.
+func CitySlugs(cities []City) map[string]string {
+	sorted := make([]City, len(cities))
+	copy(sorted, cities)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return population(sorted[i]) > population(sorted[j])
+	})
+
+	slugs := make(map[string]string, len(sorted))
+	taken := make(map[string]bool, len(sorted))
+	for _, c := range sorted {
+		name := c.CityAscii
+		if name == "" {
+			name = c.City
+		}
+
+		candidates := []string{
+			Slugify(name + " " + c.Country),
+			Slugify(name + " " + c.AdminName + " " + c.Country),
+			Slugify(name + " " + c.AdminName + " " + c.Country + " " + c.ID),
+		}
+		for _, slug := range candidates {
+			if !taken[slug] {
+				taken[slug] = true
+				slugs[c.ID] = slug
+				break
+			}
+		}
+	}
+
+	return slugs
+}
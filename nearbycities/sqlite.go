@@ -0,0 +1,817 @@
+package nearbycities
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/quantonganh/geohash"
+)
+
+var _ Storage = (*SQLiteStore)(nil)
+
+// SQLiteStore is the Storage backed by a SQLite database.
+type SQLiteStore struct {
+	db      *sql.DB
+	memory  bool
+	noRTree atomic.Bool
+
+	// ipRanges holds the IP2Location ranges once they are loaded by Import.
+	ipRanges atomic.Pointer[ipRanges]
+
+	// stmts holds the prepared statements of the lookup queries by SQL.
+	stmts sync.Map
+
+	// Observe, when set, is called with the name and duration of every
+	// lookup query, e.g. to export them as metrics.
+	Observe func(query string, d time.Duration)
+
+	// ImportProgress, when set, is called with the name and duration of
+	// every step of Import as it completes, e.g. to log them.
+	ImportProgress func(step string, d time.Duration)
+
+	// IPDatabase is the IP2Location product to download, DB5 by default.
+	// Changing it takes effect when the ranges are downloaded again.
+	IPDatabase IP2LocationDB
+
+	// DownloadDir is the directory the IP2Location database is downloaded
+	// to while it is imported, the working directory if empty.
+	DownloadDir string
+
+	// RelevanceOnly ranks the cities matching a search by relevance alone.
+	// By default, the more populated ones rank higher.
+	RelevanceOnly bool
+}
+
+// Open opens the SQLite database at path with DefaultSQLitePragmas, creating
+// its directory if needed.
+func Open(path string) (*SQLiteStore, error) {
+	return OpenWithPragmas(path, DefaultSQLitePragmas)
+}
+
+// OpenWithPragmas opens the SQLite database at path, creating its directory
+// if needed, and sets the pragmas on every connection.
+func OpenWithPragmas(path string, pragmas SQLitePragmas) (*SQLiteStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("error creating directories: %w", err)
+	}
+
+	db, err := openSQLite(path, pragmas)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SQLiteStore{
+		db: db,
+	}, nil
+}
+
+// OpenMemory opens an in-memory SQLite database. It starts empty and lives
+// until the store is closed, so Import builds the dataset from the bundled
+// CSV on every start; the IP2Location ranges are skipped when no token is
+// given.
+func OpenMemory() (*SQLiteStore, error) {
+	// Every connection of the pool shares the same in-memory database,
+	// which is dropped when the last connection is closed.
+	db, err := sql.Open(sqliteDriver, "file:nearby_cities?mode=memory&cache=shared")
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxIdleConns(1)
+	db.SetConnMaxIdleTime(0)
+	db.SetConnMaxLifetime(0)
+
+	return &SQLiteStore{
+		db:     db,
+		memory: true,
+	}, nil
+}
+
+// Close closes the prepared statements and the database.
+func (s *SQLiteStore) Close() error {
+	s.stmts.Range(func(_, stmt any) bool {
+		stmt.(*sql.Stmt).Close()
+		return true
+	})
+
+	return s.db.Close()
+}
+
+// stmt returns the statement of query, prepared on its first use and reused
+// by the following lookups so that SQLite does not parse it every time. It
+// is prepared again by SQLite when the schema changes, e.g. when the
+// ip2location table is swapped.
+func (s *SQLiteStore) stmt(ctx context.Context, query string) (*sql.Stmt, error) {
+	if stmt, ok := s.stmts.Load(query); ok {
+		return stmt.(*sql.Stmt), nil
+	}
+
+	stmt, err := s.db.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	if prepared, loaded := s.stmts.LoadOrStore(query, stmt); loaded {
+		stmt.Close()
+		return prepared.(*sql.Stmt), nil
+	}
+
+	return stmt, nil
+}
+
+func (s *SQLiteStore) observe(query string, start time.Time) {
+	if s.Observe != nil {
+		s.Observe(query, time.Since(start))
+	}
+}
+
+func (s *SQLiteStore) progress(step string, start time.Time) {
+	if s.ImportProgress != nil {
+		s.ImportProgress(step, time.Since(start))
+	}
+}
+
+// SearchCity returns the city matching the query best, weighted by its
+// population unless RelevanceOnly is set. It returns ErrNotFound if there is
+// none.
+func (s *SQLiteStore) SearchCity(ctx context.Context, query string) (City, error) {
+	cities, err := s.SearchCities(ctx, query, 1)
+	if err != nil {
+		return City{}, err
+	}
+	if len(cities) == 0 {
+		return City{}, ErrNotFound
+	}
+
+	return cities[0], nil
+}
+
+// SearchCities returns up to limit cities matching the query, the best
+// matches first.
+func (s *SQLiteStore) SearchCities(ctx context.Context, query string, limit int) ([]City, error) {
+	match := segmentQuery(normalizeQuery(query))
+	if strings.TrimSpace(match) == "" {
+		return []City{}, nil
+	}
+
+	defer s.observe("fts_match", time.Now())
+	stmt, err := s.stmt(ctx, `
+		SELECT city, city_ascii, lat, lng, admin_name, country, iso2, iso3, capital, population, id, -rank FROM cities_fts
+		WHERE cities_fts MATCH ?
+		ORDER BY rank
+		LIMIT ?
+	`)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := stmt.QueryContext(ctx, match, max(limit, rankedMatches))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cities := make([]City, 0)
+	var relevance []float64
+	for rows.Next() {
+		var (
+			c City
+			r float64
+		)
+		if err := rows.Scan(&c.City, &c.CityAscii, &c.Lat, &c.Lng, &c.AdminName, &c.Country, &c.Iso2, &c.Iso3, &c.Capital, &c.Population, &c.ID, &r); err != nil {
+			return nil, err
+		}
+		cities = append(cities, c)
+		relevance = append(relevance, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if !s.RelevanceOnly {
+		rankByPopulation(cities, relevance)
+	}
+	if len(cities) > limit {
+		cities = cities[:limit]
+	}
+
+	return cities, nil
+}
+
+// SearchPhonetic returns the most populated city whose name sounds like the
+// query, or ErrNotFound.
+func (s *SQLiteStore) SearchPhonetic(ctx context.Context, query string) (City, error) {
+	defer s.observe("metaphone", time.Now())
+
+	var c City
+	err := s.db.QueryRowContext(ctx, `
+		SELECT city, city_ascii, lat, lng, admin_name, country, iso2, iso3, capital, population, id FROM cities
+		WHERE metaphone = ?
+		ORDER BY population DESC, id
+		LIMIT 1
+	`, phoneticKey(query)).Scan(&c.City, &c.CityAscii, &c.Lat, &c.Lng, &c.AdminName, &c.Country, &c.Iso2, &c.Iso3, &c.Capital, &c.Population, &c.ID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return City{}, ErrNotFound
+		}
+		return City{}, err
+	}
+
+	return c, nil
+}
+
+// SearchPostalCode returns the place served by the postal code, in the
+// country with the iso2 code unless it is empty. When several countries use
+// the code, the one with the most cities wins.
+func (s *SQLiteStore) SearchPostalCode(ctx context.Context, code, iso2 string) (PostalCode, error) {
+	defer s.observe("postal_code", time.Now())
+
+	var p PostalCode
+	err := s.db.QueryRowContext(ctx, `
+		SELECT iso2, code, place, admin_name, lat, lng FROM postal_codes
+		WHERE code = ? AND (? = '' OR iso2 = ?)
+		ORDER BY (SELECT COUNT(*) FROM cities WHERE cities.iso2 = postal_codes.iso2) DESC, iso2, place
+		LIMIT 1
+	`, postalCodeKey(code), iso2, iso2).Scan(&p.Iso2, &p.Code, &p.Place, &p.AdminName, &p.Lat, &p.Lng)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return PostalCode{}, ErrNotFound
+		}
+		return PostalCode{}, err
+	}
+
+	return p, nil
+}
+
+// SearchLocode returns the UN/LOCODE entry with the location code in the
+// country with the iso2 code.
+func (s *SQLiteStore) SearchLocode(ctx context.Context, iso2, code string) (Locode, error) {
+	defer s.observe("locode", time.Now())
+
+	var (
+		l        Locode
+		lat, lng *float64
+	)
+	err := s.db.QueryRowContext(ctx, `
+		SELECT iso2, code, name, subdivision, lat, lng FROM locodes WHERE iso2 = ? AND code = ? LIMIT 1
+	`, strings.ToUpper(iso2), strings.ToUpper(code)).Scan(&l.Iso2, &l.Code, &l.Name, &l.Subdivision, &lat, &lng)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return Locode{}, ErrNotFound
+		}
+		return Locode{}, err
+	}
+	if lat != nil && lng != nil {
+		l.Lat, l.Lng, l.Located = *lat, *lng, true
+	}
+
+	return l, nil
+}
+
+// SetWikidata links the city with the dataset ID to its Wikidata item.
+func (s *SQLiteStore) SetWikidata(ctx context.Context, id string, link WikidataLink) error {
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE cities SET wikidata_id = ?, wikipedia_url = ?, thumbnail_url = ? WHERE id = ?
+	`, link.QID, link.WikipediaURL, link.ThumbnailURL, id)
+	if err != nil {
+		return fmt.Errorf("error setting the wikidata item of city %s: %w", id, err)
+	}
+
+	return nil
+}
+
+// CityByID returns the city with the dataset ID.
+func (s *SQLiteStore) CityByID(ctx context.Context, id string) (City, error) {
+	defer s.observe("city_by_id", time.Now())
+
+	var (
+		c        City
+		wikidata wikidataColumns
+	)
+	err := s.db.QueryRowContext(ctx, `
+		SELECT city, city_ascii, lat, lng, country, iso2, iso3, admin_name, capital, population, id, timezone, elevation, source, wikidata_id, wikipedia_url, thumbnail_url FROM cities WHERE id = ?
+	`, id).Scan(&c.City, &c.CityAscii, &c.Lat, &c.Lng, &c.Country, &c.Iso2, &c.Iso3, &c.AdminName, &c.Capital, &c.Population, &c.ID, &c.Timezone, &c.Elevation, &c.Source, &wikidata.qid, &wikidata.wikipediaURL, &wikidata.thumbnailURL)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return City{}, ErrNotFound
+		}
+		return City{}, err
+	}
+	c.Wikidata = wikidata.link()
+	c.Geohash = geohash.Encode(c.Lat, c.Lng)
+
+	return c, nil
+}
+
+// CityByAlias returns the city known by the alias, e.g. an abbreviation or a
+// former name, or ErrNotFound.
+func (s *SQLiteStore) CityByAlias(ctx context.Context, alias string) (City, error) {
+	defer s.observe("city_by_alias", time.Now())
+
+	var id string
+	err := s.db.QueryRowContext(ctx, `
+		SELECT city_id FROM city_aliases WHERE alias = ?
+	`, Slugify(alias)).Scan(&id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return City{}, ErrNotFound
+		}
+		return City{}, err
+	}
+
+	return s.CityByID(ctx, id)
+}
+
+// AddAlias makes the city with the dataset ID known by the alias, in place of
+// the city it stood for if any. It returns ErrNotFound if there is no such
+// city.
+func (s *SQLiteStore) AddAlias(ctx context.Context, alias, id string) error {
+	if _, err := s.CityByID(ctx, id); err != nil {
+		return err
+	}
+
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO city_aliases (alias, city_id) VALUES (?, ?)
+		ON CONFLICT (alias) DO UPDATE SET city_id = excluded.city_id
+	`, Slugify(alias), id)
+	if err != nil {
+		return fmt.Errorf("error adding alias %s: %w", alias, err)
+	}
+
+	return nil
+}
+
+// SuggestCities returns up to limit cities whose name starts with the query.
+func (s *SQLiteStore) SuggestCities(ctx context.Context, query string, limit int) ([]City, error) {
+	words := strings.Fields(normalizeQuery(query))
+	if len(words) == 0 {
+		return nil, nil
+	}
+
+	for i, word := range words {
+		words[i] = `"` + strings.ReplaceAll(word, `"`, `""`) + `"`
+	}
+	match := strings.Join(words, " ") + "*"
+
+	defer s.observe("fts_prefix", time.Now())
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT city, admin_name, country, lat, lng FROM cities_fts WHERE cities_fts MATCH ? ORDER BY rank LIMIT ?
+	`, match, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var cities []City
+	for rows.Next() {
+		var c City
+		if err := rows.Scan(&c.City, &c.AdminName, &c.Country, &c.Lat, &c.Lng); err != nil {
+			return nil, err
+		}
+		cities = append(cities, c)
+	}
+
+	return cities, rows.Err()
+}
+
+// NearbyByLatLng returns the cities within radius kilometers, nearest first.
+func (s *SQLiteStore) NearbyByLatLng(ctx context.Context, lat, lng, radius float64) ([]City, error) {
+	cities := make([]City, 0)
+	err := s.EachNearby(ctx, lat, lng, radius, func(c City) error {
+		cities = append(cities, c)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(cities, func(i, j int) bool {
+		return cities[i].Distance < cities[j].Distance
+	})
+
+	return cities, nil
+}
+
+// EachNearby calls fn for every city within radius kilometers as it is read,
+// in no particular order, stopping at the first error. The R*Tree narrows
+// the candidates down to the bounding box of the circle before the exact
+// distance is computed.
+func (s *SQLiteStore) EachNearby(ctx context.Context, lat, lng, radius float64, fn func(City) error) error {
+	if s.noRTree.Load() {
+		return s.eachNearbyByGeohash(ctx, lat, lng, radius, fn)
+	}
+
+	defer s.observe("rtree_range", time.Now())
+	stmt, err := s.stmt(ctx, `
+			SELECT c.city, c.lat, c.lng, c.admin_name, c.country, c.iso2, c.iso3, c.timezone, c.elevation, c.capital, c.population, c.id, g.geohash
+			FROM cities_rtree r
+			JOIN cities c ON c.id = r.id
+			JOIN geospatial_index g ON g.city_id = c.id
+			WHERE r.max_lat >= ? AND r.min_lat <= ? AND r.max_lng >= ? AND r.min_lng <= ?;
+		`)
+	if err != nil {
+		return err
+	}
+	// A circle crossing the antimeridian is looked up on each side of it.
+	for _, b := range boundingBoxes(lat, lng, radius) {
+		rows, err := stmt.QueryContext(ctx, b.minLat, b.maxLat, b.minLng, b.maxLng)
+		if err != nil {
+			return err
+		}
+		err = scanNearby(rows, lat, lng, radius, fn)
+		rows.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// eachNearbyByGeohash calls fn for every city within radius kilometers when
+// the R*Tree is not available. The radius sets the precision of the geohash
+// cells around the coordinates that the candidates must be in.
+func (s *SQLiteStore) eachNearbyByGeohash(ctx context.Context, lat, lng, radius float64, fn func(City) error) error {
+	cells := geohashCells(lat, lng, geohash.EstimateLengthRequired(radius))
+	conditions := make([]string, len(cells))
+	args := make([]any, len(cells))
+	for i, cell := range cells {
+		conditions[i] = "g.geohash LIKE ?"
+		args[i] = cell + "%"
+	}
+
+	// There are as many statements as numbers of cells, nine at most.
+	defer s.observe("geohash_prefix", time.Now())
+	stmt, err := s.stmt(ctx, `
+			SELECT c.city, c.lat, c.lng, c.admin_name, c.country, c.iso2, c.iso3, c.timezone, c.elevation, c.capital, c.population, c.id, g.geohash
+			FROM cities c JOIN geospatial_index g ON g.city_id = c.id
+			WHERE `+strings.Join(conditions, " OR ")+`;
+		`)
+	if err != nil {
+		return err
+	}
+	rows, err := stmt.QueryContext(ctx, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	return scanNearby(rows, lat, lng, radius, fn)
+}
+
+// scanNearby reads the candidate cities of a nearby query and calls fn for
+// the ones within radius kilometers of the coordinates.
+func scanNearby(rows *sql.Rows, lat, lng, radius float64, fn func(City) error) error {
+	for rows.Next() {
+		var toCity City
+		if err := rows.Scan(&toCity.City, &toCity.Lat, &toCity.Lng, &toCity.AdminName, &toCity.Country, &toCity.Iso2, &toCity.Iso3, &toCity.Timezone, &toCity.Elevation, &toCity.Capital, &toCity.Population, &toCity.ID, &toCity.Geohash); err != nil {
+			return err
+		}
+
+		distance := geohash.Distance(lat, lng, toCity.Lat, toCity.Lng)
+		if distance > radius {
+			continue
+		}
+		toCity.Distance = math.Round(distance*100) / 100
+
+		if err := fn(toCity); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// NearbyAirports returns the airports within radius kilometers of the
+// coordinates, nearest first.
+func (s *SQLiteStore) NearbyAirports(ctx context.Context, lat, lng, radius float64) ([]Airport, error) {
+	boxes := boundingBoxes(lat, lng, radius)
+	if len(boxes) == 1 {
+		// Both ranges of longitudes are the same unless the circle crosses
+		// the antimeridian.
+		boxes = append(boxes, boxes[0])
+	}
+
+	defer s.observe("airports_range", time.Now())
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT ident, iata, name, type, municipality, iso2, lat, lng, elevation, scheduled FROM airports
+		WHERE lat BETWEEN ? AND ? AND (lng BETWEEN ? AND ? OR lng BETWEEN ? AND ?)
+	`, boxes[0].minLat, boxes[0].maxLat, boxes[0].minLng, boxes[0].maxLng, boxes[1].minLng, boxes[1].maxLng)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	airports := make([]Airport, 0)
+	for rows.Next() {
+		var a Airport
+		if err := rows.Scan(&a.Ident, &a.IATA, &a.Name, &a.Type, &a.Municipality, &a.Iso2, &a.Lat, &a.Lng, &a.Elevation, &a.Scheduled); err != nil {
+			return nil, err
+		}
+
+		distance := geohash.Distance(lat, lng, a.Lat, a.Lng)
+		if distance > radius {
+			continue
+		}
+		a.Distance = math.Round(distance*100) / 100
+		airports = append(airports, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(airports, func(i, j int) bool {
+		return airports[i].Distance < airports[j].Distance
+	})
+
+	return airports, nil
+}
+
+// AirportByCode returns the airport with the IATA or ICAO code. An IATA code
+// shared by several airports goes to the one with scheduled service.
+func (s *SQLiteStore) AirportByCode(ctx context.Context, code string) (Airport, error) {
+	defer s.observe("airport_by_code", time.Now())
+
+	var a Airport
+	err := s.db.QueryRowContext(ctx, `
+		SELECT ident, iata, name, type, municipality, iso2, lat, lng, elevation, scheduled FROM airports
+		WHERE iata = ? OR ident = ?
+		ORDER BY scheduled DESC, ident
+		LIMIT 1
+	`, code, code).Scan(&a.Ident, &a.IATA, &a.Name, &a.Type, &a.Municipality, &a.Iso2, &a.Lat, &a.Lng, &a.Elevation, &a.Scheduled)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return Airport{}, ErrNotFound
+		}
+		return Airport{}, err
+	}
+
+	return a, nil
+}
+
+// Regions returns the regions of the country, sorted by name.
+func (s *SQLiteStore) Regions(ctx context.Context, iso2 string) ([]Region, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT r.id, r.iso2, r.name, COUNT(*)
+		FROM regions r JOIN cities c ON c.iso2 = r.iso2 AND c.admin_name = r.name
+		WHERE r.iso2 = ?
+		GROUP BY r.id
+		ORDER BY r.name
+	`, strings.ToUpper(iso2))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	regions := make([]Region, 0)
+	for rows.Next() {
+		var r Region
+		if err := rows.Scan(&r.ID, &r.Iso2, &r.Name, &r.Cities); err != nil {
+			return nil, err
+		}
+		regions = append(regions, r)
+	}
+
+	return regions, rows.Err()
+}
+
+// RegionCities returns the region and its cities, the most populated first.
+func (s *SQLiteStore) RegionCities(ctx context.Context, id int64) (Region, []City, error) {
+	var r Region
+	err := s.db.QueryRowContext(ctx, `SELECT id, iso2, name FROM regions WHERE id = ?`, id).Scan(&r.ID, &r.Iso2, &r.Name)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return Region{}, nil, ErrNotFound
+		}
+		return Region{}, nil, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT city, lat, lng, admin_name, country, iso2, iso3, population, id FROM cities
+		WHERE iso2 = ? AND admin_name = ?
+		ORDER BY population DESC
+	`, r.Iso2, r.Name)
+	if err != nil {
+		return Region{}, nil, err
+	}
+	defer rows.Close()
+
+	cities := make([]City, 0)
+	for rows.Next() {
+		var c City
+		if err := rows.Scan(&c.City, &c.Lat, &c.Lng, &c.AdminName, &c.Country, &c.Iso2, &c.Iso3, &c.Population, &c.ID); err != nil {
+			return Region{}, nil, err
+		}
+		cities = append(cities, c)
+	}
+	if err := rows.Err(); err != nil {
+		return Region{}, nil, err
+	}
+	r.Cities = len(cities)
+
+	return r, cities, nil
+}
+
+// CountryCities returns a page of the cities of the country in the sort
+// order.
+func (s *SQLiteStore) CountryCities(ctx context.Context, iso2 string, sort CitySort, offset, limit int) ([]City, int, error) {
+	iso2 = strings.ToUpper(iso2)
+
+	var total int
+	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM cities WHERE iso2 = ?`, iso2).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT city, city_ascii, lat, lng, admin_name, country, iso2, iso3, capital, population, id FROM cities
+		WHERE iso2 = ?
+		ORDER BY `+countryOrder(sort)+`
+		LIMIT ? OFFSET ?
+	`, iso2, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	cities := make([]City, 0)
+	err = scanCountryCities(rows, func(c City) error {
+		cities = append(cities, c)
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return cities, total, nil
+}
+
+// EachCountryCity calls fn for every city of the country in the sort order
+// as it is read, stopping at the first error.
+func (s *SQLiteStore) EachCountryCity(ctx context.Context, iso2 string, sort CitySort, fn func(City) error) error {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT city, city_ascii, lat, lng, admin_name, country, iso2, iso3, capital, population, id FROM cities
+		WHERE iso2 = ?
+		ORDER BY `+countryOrder(sort), strings.ToUpper(iso2))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	return scanCountryCities(rows, fn)
+}
+
+// countryOrder returns the ORDER BY clause listing the cities of a country in
+// the sort order. Ties are broken by ID so that the pages do not overlap.
+func countryOrder(sort CitySort) string {
+	if sort == ByName {
+		return "city_ascii, id"
+	}
+	return "population DESC, id"
+}
+
+// scanCountryCities reads the cities of a country query and calls fn for
+// each of them.
+func scanCountryCities(rows *sql.Rows, fn func(City) error) error {
+	for rows.Next() {
+		var c City
+		if err := rows.Scan(&c.City, &c.CityAscii, &c.Lat, &c.Lng, &c.AdminName, &c.Country, &c.Iso2, &c.Iso3, &c.Capital, &c.Population, &c.ID); err != nil {
+			return err
+		}
+
+		if err := fn(c); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// LookupIP returns the location of an IPv4 address. It returns ErrNotFound if
+// the address is not in any known range. The ranges are searched in memory
+// once Import has loaded them, and in the database until then.
+func (s *SQLiteStore) LookupIP(ctx context.Context, ip string) (IPLocation, error) {
+	ipInteger, err := ipToInteger(ip)
+	if err != nil {
+		return IPLocation{}, err
+	}
+
+	start := time.Now()
+	if r := s.ipRanges.Load(); r != nil {
+		loc, ok := r.lookup(ipInteger)
+		s.observe("ip_lookup", start)
+		if !ok {
+			return IPLocation{}, ErrNotFound
+		}
+		return loc, nil
+	}
+
+	// The ranges do not overlap, so the one starting last at or before the
+	// address is the only one that can hold it.
+	stmt, err := s.stmt(ctx, `
+		SELECT start_ip, end_ip, iso2, country, region, city, lat, lng, zip, utc_offset FROM ip2location
+		WHERE start_ip <= ? ORDER BY start_ip DESC LIMIT 1
+	`)
+	if err != nil {
+		return IPLocation{}, err
+	}
+	var loc IPLocation
+	err = stmt.QueryRowContext(ctx, ipInteger).Scan(&loc.StartIP, &loc.EndIP, &loc.Iso2, &loc.Country, &loc.Region, &loc.City, &loc.Lat, &loc.Lng, &loc.Zip, &loc.UTCOffset)
+	s.observe("ip_lookup", start)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return IPLocation{}, ErrNotFound
+		}
+		return IPLocation{}, err
+	}
+
+	if loc.EndIP < ipInteger {
+		return IPLocation{}, ErrNotFound
+	}
+
+	return loc, nil
+}
+
+// EachCity calls fn for every city, stopping at the first error.
+func (s *SQLiteStore) EachCity(ctx context.Context, fn func(City) error) error {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT city, city_ascii, lat, lng, country, iso2, iso3, admin_name, capital, population, id, timezone, elevation, source, wikidata_id, wikipedia_url, thumbnail_url FROM cities
+	`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			c        City
+			wikidata wikidataColumns
+		)
+		if err := rows.Scan(&c.City, &c.CityAscii, &c.Lat, &c.Lng, &c.Country, &c.Iso2, &c.Iso3, &c.AdminName, &c.Capital, &c.Population, &c.ID, &c.Timezone, &c.Elevation, &c.Source, &wikidata.qid, &wikidata.wikipediaURL, &wikidata.thumbnailURL); err != nil {
+			return err
+		}
+
+		c.Wikidata = wikidata.link()
+
+		if err := fn(c); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// Optimize rebuilds the database file without the pages freed by the
+// deletes, such as those of the ranges replaced by a refresh, and runs
+// PRAGMA optimize. The writes wait for it meanwhile.
+func (s *SQLiteStore) Optimize(ctx context.Context) error {
+	if _, err := s.db.ExecContext(ctx, `VACUUM`); err != nil {
+		return fmt.Errorf("error vacuuming the database: %w", err)
+	}
+	if _, err := s.db.ExecContext(ctx, `PRAGMA optimize`); err != nil {
+		return fmt.Errorf("error optimizing the database: %w", err)
+	}
+	return nil
+}
+
+// Ping checks that the database answers.
+func (s *SQLiteStore) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+// Populated reports whether the full-text and spatial indexes hold data.
+func (s *SQLiteStore) Populated(ctx context.Context) (bool, error) {
+	var populated bool
+	err := s.db.QueryRowContext(ctx, `
+		SELECT EXISTS (SELECT 1 FROM cities_fts) AND EXISTS (SELECT 1 FROM geospatial_index)
+	`).Scan(&populated)
+	return populated, err
+}
+
+// Counts returns the number of rows of the dataset tables that exist.
+func (s *SQLiteStore) Counts(ctx context.Context) (map[string]int64, error) {
+	counts := make(map[string]int64)
+	for _, table := range []string{"cities", "ip2location", "geospatial_index", "cities_rtree", "regions", "postal_codes", "airports", "city_aliases", "locodes"} {
+		var n int64
+		// Tables do not exist until the first import is done.
+		if err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+table).Scan(&n); err != nil {
+			continue
+		}
+		counts[table] = n
+	}
+
+	return counts, nil
+}
+
+// normalizeQuery drops the punctuation and the diacritics of the query, so
+// that it matches the names however they are accented.
+func normalizeQuery(query string) string {
+	re := regexp.MustCompile(`[\p{P}]`)
+	return removeDiacritics(re.ReplaceAllString(query, ""))
+}
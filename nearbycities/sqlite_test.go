@@ -0,0 +1,139 @@
+package nearbycities
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/quantonganh/geohash"
+)
+
+var (
+	testStoreOnce sync.Once
+	testStore     *SQLiteStore
+	testCities    []City
+	testStoreErr  error
+)
+
+// openTestStore returns an in-memory store holding the bundled dataset,
+// imported once for all the tests, and its cities.
+func openTestStore(t *testing.T) (*SQLiteStore, []City) {
+	t.Helper()
+	testStoreOnce.Do(func() {
+		testStore, testStoreErr = OpenMemory()
+		if testStoreErr != nil {
+			return
+		}
+		if testStoreErr = testStore.Import(""); testStoreErr != nil {
+			return
+		}
+		testStoreErr = testStore.EachCity(context.Background(), func(c City) error {
+			testCities = append(testCities, c)
+			return nil
+		})
+	})
+	if testStoreErr != nil {
+		skipWithoutFTS5(t, testStoreErr)
+		t.Fatal(testStoreErr)
+	}
+
+	return testStore, testCities
+}
+
+// skipWithoutFTS5 skips the test if err comes from the migrations creating
+// the full-text index, the driver being built without FTS5.
+func skipWithoutFTS5(t *testing.T, err error) {
+	t.Helper()
+	if strings.Contains(err.Error(), "no such module: fts5") {
+		t.Skip("SQLite is built without FTS5, run the tests with -tags fts5")
+	}
+}
+
+// nearbyIDs returns the sorted IDs of the cities within radius kilometers of
+// the coordinates, computed by brute force.
+func nearbyIDs(cities []City, lat, lng, radius float64) []string {
+	ids := make([]string, 0)
+	for _, c := range cities {
+		if geohash.Distance(lat, lng, c.Lat, c.Lng) <= radius {
+			ids = append(ids, c.ID)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func cityIDs(cities []City) []string {
+	ids := make([]string, 0, len(cities))
+	for _, c := range cities {
+		ids = append(ids, c.ID)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func TestNearbyByLatLng(t *testing.T) {
+	store, cities := openTestStore(t)
+
+	tests := []struct {
+		name     string
+		lat, lng float64
+		radius   float64
+	}{
+		{"Hanoi", 21.0283, 105.8542, 50},
+		{"no city", 0, -150, 200},
+		// The cities of Fiji are on both sides of the antimeridian.
+		{"east of the antimeridian", -17, -179.9, 500},
+		{"west of the antimeridian", -17, 179.9, 500},
+		{"Chukotka", 65, -179.9, 400},
+		{"north pole", 85, 0, 1000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := store.NearbyByLatLng(context.Background(), tt.lat, tt.lng, tt.radius)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := nearbyIDs(cities, tt.lat, tt.lng, tt.radius); !slices.Equal(cityIDs(got), want) {
+				t.Errorf("got %d cities, want %d", len(got), len(want))
+			}
+			for i := 1; i < len(got); i++ {
+				if got[i].Distance < got[i-1].Distance {
+					t.Fatalf("got %s at %v km after %s at %v km", got[i].City, got[i].Distance, got[i-1].City, got[i-1].Distance)
+				}
+			}
+		})
+	}
+}
+
+func TestEachNearbyWithoutRTree(t *testing.T) {
+	store, cities := openTestStore(t)
+	store.noRTree.Store(true)
+	defer store.noRTree.Store(false)
+
+	tests := []struct {
+		name     string
+		lat, lng float64
+		radius   float64
+	}{
+		{"Hanoi", 21.0283, 105.8542, 50},
+		{"Paris", 48.8566, 2.3522, 100},
+		// On the edge between the geohash cells u0 and spb.
+		{"cell edge", 45, 0, 30},
+		{"large radius", 35.6897, 139.6922, 500},
+		{"ocean", 0, -150, 200},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := store.NearbyByLatLng(context.Background(), tt.lat, tt.lng, tt.radius)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := nearbyIDs(cities, tt.lat, tt.lng, tt.radius); !slices.Equal(cityIDs(got), want) {
+				t.Errorf("got %d cities, want %d", len(got), len(want))
+			}
+		})
+	}
+}
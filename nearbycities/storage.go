@@ -0,0 +1,141 @@
+package nearbycities
+
+import "context"
+
+// Storage is a backend holding the dataset. SQLiteStore is the default
+// implementation.
+type Storage interface {
+	// Import applies the pending schema migrations and loads the dataset on
+	// first use. It does nothing if the dataset has already been imported.
+	Import(ip2LocationToken string) error
+
+	// MigrateUp applies the pending schema migrations in order.
+	MigrateUp(ctx context.Context) error
+
+	// MigrateDown reverts the last applied schema migration.
+	MigrateDown(ctx context.Context) error
+
+	// Migrations returns the schema migrations and whether they have been
+	// applied.
+	Migrations(ctx context.Context) ([]MigrationStatus, error)
+
+	// UpdateCities applies a new release of the cities of source, matched by
+	// ID, to the imported ones: the world cities when source is empty, or
+	// places imported from elsewhere.
+	UpdateCities(ctx context.Context, source string, release []City) (CityChanges, error)
+
+	// RefreshIPRanges downloads the IP2Location database again and replaces
+	// the imported ranges with it in one step.
+	RefreshIPRanges(ip2LocationToken string) error
+
+	// ImportElevation sets the elevation of the cities that have none yet
+	// from src.
+	ImportElevation(src ElevationSource) error
+
+	// SetWikidata links the city with the dataset ID to its Wikidata item.
+	SetWikidata(ctx context.Context, id string, link WikidataLink) error
+
+	// SearchCity returns the city matching the query best, or ErrNotFound.
+	SearchCity(ctx context.Context, query string) (City, error)
+
+	// SearchCities returns up to limit cities matching the query, the best
+	// matches first.
+	SearchCities(ctx context.Context, query string, limit int) ([]City, error)
+
+	// SearchPhonetic returns the most populated city whose name sounds like
+	// the query, e.g. Philadelphia for Filadelfia, or ErrNotFound.
+	SearchPhonetic(ctx context.Context, query string) (City, error)
+
+	// CityByID returns the city with the dataset ID, or ErrNotFound.
+	CityByID(ctx context.Context, id string) (City, error)
+
+	// CityByAlias returns the city known by the alias, e.g. NYC or Saigon,
+	// or ErrNotFound.
+	CityByAlias(ctx context.Context, alias string) (City, error)
+
+	// AddAlias makes the city with the dataset ID known by the alias. It
+	// returns ErrNotFound if there is no such city.
+	AddAlias(ctx context.Context, alias, id string) error
+
+	// SuggestCities returns up to limit cities whose name starts with the
+	// query.
+	SuggestCities(ctx context.Context, query string, limit int) ([]City, error)
+
+	// NearbyByLatLng returns the cities within radius kilometers of the
+	// coordinates, sorted by distance.
+	NearbyByLatLng(ctx context.Context, lat, lng, radius float64) ([]City, error)
+
+	// EachNearby calls fn for every city within radius kilometers of the
+	// coordinates as it is read, in no particular order, stopping at the
+	// first error.
+	EachNearby(ctx context.Context, lat, lng, radius float64, fn func(City) error) error
+
+	// Regions returns the regions of the country with the ISO 3166-1
+	// alpha-2 code, sorted by name.
+	Regions(ctx context.Context, iso2 string) ([]Region, error)
+
+	// RegionCities returns the region with the id and its cities, the most
+	// populated first, or ErrNotFound.
+	RegionCities(ctx context.Context, id int64) (Region, []City, error)
+
+	// CountryCities returns up to limit cities of the country with the ISO
+	// 3166-1 alpha-2 code in the sort order, skipping the first offset ones,
+	// and the number of cities of the country.
+	CountryCities(ctx context.Context, iso2 string, sort CitySort, offset, limit int) ([]City, int, error)
+
+	// EachCountryCity calls fn for every city of the country in the sort
+	// order as it is read, stopping at the first error.
+	EachCountryCity(ctx context.Context, iso2 string, sort CitySort, fn func(City) error) error
+
+	// LookupIP returns the location of an IPv4 address, or ErrNotFound.
+	LookupIP(ctx context.Context, ip string) (IPLocation, error)
+
+	// ImportPostalCodes replaces the postal codes of the countries listed in
+	// codes with them.
+	ImportPostalCodes(ctx context.Context, codes []PostalCode) error
+
+	// SearchPostalCode returns the place served by the postal code, in the
+	// country with the ISO 3166-1 alpha-2 code unless it is empty, or
+	// ErrNotFound.
+	SearchPostalCode(ctx context.Context, code, iso2 string) (PostalCode, error)
+
+	// ImportLocodes replaces the UN/LOCODE entries of the countries listed
+	// in locodes with them.
+	ImportLocodes(ctx context.Context, locodes []Locode) error
+
+	// SearchLocode returns the UN/LOCODE entry with the location code in
+	// the country with the ISO 3166-1 alpha-2 code, or ErrNotFound.
+	SearchLocode(ctx context.Context, iso2, code string) (Locode, error)
+
+	// ImportAirports replaces the imported airports with airports.
+	ImportAirports(ctx context.Context, airports []Airport) error
+
+	// NearbyAirports returns the airports within radius kilometers of the
+	// coordinates, sorted by distance.
+	NearbyAirports(ctx context.Context, lat, lng, radius float64) ([]Airport, error)
+
+	// AirportByCode returns the airport with the IATA or ICAO code, or
+	// ErrNotFound.
+	AirportByCode(ctx context.Context, code string) (Airport, error)
+
+	// EachCity calls fn for every city of the dataset, stopping at the first
+	// error.
+	EachCity(ctx context.Context, fn func(City) error) error
+
+	// Optimize reclaims the space left by the deleted rows and refreshes
+	// the statistics of the query planner, e.g. after a refresh.
+	Optimize(ctx context.Context) error
+
+	// Ping checks that the backend is reachable.
+	Ping(ctx context.Context) error
+
+	// Populated reports whether the search and geospatial indexes hold data.
+	Populated(ctx context.Context) (bool, error)
+
+	// Counts returns the number of rows of each dataset table. Tables that
+	// do not exist yet are left out.
+	Counts(ctx context.Context) (map[string]int64, error)
+
+	// Close releases the backend.
+	Close() error
+}
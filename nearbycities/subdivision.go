@@ -0,0 +1,99 @@
+package nearbycities
+
+import "strings"
+
+// isIn reports whether the city lies in the place, which names its country
+// or region, or gives their code, e.g. France, FR, FRA, Texas or TX.
+func (c City) isIn(place string) bool {
+	key := Slugify(place)
+	code := strings.ToUpper(strings.ReplaceAll(key, "-", ""))
+	switch {
+	case key == "":
+		return false
+	case key == Slugify(c.Country) || key == Slugify(c.AdminName):
+		return true
+	case code == c.Iso2 || code == c.Iso3 || code == "UK" && c.Iso2 == "GB":
+		return true
+	}
+
+	name, ok := subdivisionNames[c.Iso2+"-"+code]
+	return ok && name == c.AdminName
+}
+
+// subdivisionNames maps the postal abbreviations of the states and provinces
+// of the countries where they are written after the city name, e.g. Paris,
+// TX, to their name in the admin_name column of the dataset.
+var subdivisionNames = map[string]string{
+	"AU-ACT": "Australian Capital Territory",
+	"AU-NSW": "New South Wales",
+	"AU-NT":  "Northern Territory",
+	"AU-QLD": "Queensland",
+	"AU-SA":  "South Australia",
+	"AU-TAS": "Tasmania",
+	"AU-VIC": "Victoria",
+	"AU-WA":  "Western Australia",
+	"CA-AB":  "Alberta",
+	"CA-BC":  "British Columbia",
+	"CA-MB":  "Manitoba",
+	"CA-NB":  "New Brunswick",
+	"CA-NL":  "Newfoundland and Labrador",
+	"CA-NS":  "Nova Scotia",
+	"CA-NT":  "Northwest Territories",
+	"CA-NU":  "Nunavut",
+	"CA-ON":  "Ontario",
+	"CA-PE":  "Prince Edward Island",
+	"CA-QC":  "Quebec",
+	"CA-SK":  "Saskatchewan",
+	"CA-YT":  "Yukon",
+	"US-AK":  "Alaska",
+	"US-AL":  "Alabama",
+	"US-AR":  "Arkansas",
+	"US-AZ":  "Arizona",
+	"US-CA":  "California",
+	"US-CO":  "Colorado",
+	"US-CT":  "Connecticut",
+	"US-DC":  "District of Columbia",
+	"US-DE":  "Delaware",
+	"US-FL":  "Florida",
+	"US-GA":  "Georgia",
+	"US-HI":  "Hawaii",
+	"US-IA":  "Iowa",
+	"US-ID":  "Idaho",
+	"US-IL":  "Illinois",
+	"US-IN":  "Indiana",
+	"US-KS":  "Kansas",
+	"US-KY":  "Kentucky",
+	"US-LA":  "Louisiana",
+	"US-MA":  "Massachusetts",
+	"US-MD":  "Maryland",
+	"US-ME":  "Maine",
+	"US-MI":  "Michigan",
+	"US-MN":  "Minnesota",
+	"US-MO":  "Missouri",
+	"US-MS":  "Mississippi",
+	"US-MT":  "Montana",
+	"US-NC":  "North Carolina",
+	"US-ND":  "North Dakota",
+	"US-NE":  "Nebraska",
+	"US-NH":  "New Hampshire",
+	"US-NJ":  "New Jersey",
+	"US-NM":  "New Mexico",
+	"US-NV":  "Nevada",
+	"US-NY":  "New York",
+	"US-OH":  "Ohio",
+	"US-OK":  "Oklahoma",
+	"US-OR":  "Oregon",
+	"US-PA":  "Pennsylvania",
+	"US-RI":  "Rhode Island",
+	"US-SC":  "South Carolina",
+	"US-SD":  "South Dakota",
+	"US-TN":  "Tennessee",
+	"US-TX":  "Texas",
+	"US-UT":  "Utah",
+	"US-VA":  "Virginia",
+	"US-VT":  "Vermont",
+	"US-WA":  "Washington",
+	"US-WI":  "Wisconsin",
+	"US-WV":  "West Virginia",
+	"US-WY":  "Wyoming",
+}
@@ -0,0 +1,23 @@
+package nearbycities
+
+import (
+	"fmt"
+
+	"github.com/ringsaturn/tzf"
+)
+
+// timezoneFinder returns the IANA timezone ID of coordinates.
+type timezoneFinder func(lat, lng float64) string
+
+// newTimezoneFinder loads the timezone boundaries. They take tens of
+// megabytes, so the finder is only kept for the duration of an import.
+func newTimezoneFinder() (timezoneFinder, error) {
+	f, err := tzf.NewDefaultFinder()
+	if err != nil {
+		return nil, fmt.Errorf("error loading timezones: %w", err)
+	}
+
+	return func(lat, lng float64) string {
+		return f.GetTimezoneName(lng, lat)
+	}, nil
+}
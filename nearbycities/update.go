@@ -0,0 +1,107 @@
+package nearbycities
+
+import (
+	"context"
+	"fmt"
+)
+
+// CityChanges counts the cities changed by an update of the dataset.
+type CityChanges struct {
+	Inserted int
+	Updated  int
+	Deleted  int
+}
+
+func (c CityChanges) String() string {
+	return fmt.Sprintf("%d inserted, %d updated, %d deleted", c.Inserted, c.Updated, c.Deleted)
+}
+
+// cityDiff is what changes between the cities of a source in a store and a
+// new release of them, the cities being matched by ID.
+type cityDiff struct {
+	inserted []City
+	updated  []City
+	deleted  []City
+
+	// moved are the IDs of the updated cities whose coordinates changed,
+	// and whose elevation has to be looked up again.
+	moved map[string]bool
+}
+
+func (d cityDiff) changes() CityChanges {
+	return CityChanges{Inserted: len(d.inserted), Updated: len(d.updated), Deleted: len(d.deleted)}
+}
+
+// diffCities compares the cities of source in store with those of release.
+// It fails when a city of the release has the ID of a city of another
+// source.
+func diffCities(ctx context.Context, store Storage, source string, release []City) (cityDiff, error) {
+	next := make(map[string]City, len(release))
+	for _, c := range release {
+		c.Source = source
+		next[c.ID] = c
+	}
+
+	d := cityDiff{moved: make(map[string]bool)}
+	seen := make(map[string]bool, len(release))
+	err := store.EachCity(ctx, func(old City) error {
+		c, ok := next[old.ID]
+		if old.Source != source {
+			if ok {
+				return fmt.Errorf("city %s is already imported from another source", old.ID)
+			}
+			return nil
+		}
+
+		seen[old.ID] = true
+		if !ok {
+			d.deleted = append(d.deleted, old)
+			return nil
+		}
+
+		if !sameCity(old, c) {
+			d.updated = append(d.updated, c)
+			if old.Lat != c.Lat || old.Lng != c.Lng {
+				d.moved[c.ID] = true
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return cityDiff{}, err
+	}
+
+	for _, c := range release {
+		if !seen[c.ID] {
+			c.Source = source
+			d.inserted = append(d.inserted, c)
+		}
+	}
+
+	return d, nil
+}
+
+// sameCity reports whether the columns of the dataset are the same for a and
+// b, leaving out the ones computed by the store such as the elevation.
+func sameCity(a, b City) bool {
+	return a.City == b.City &&
+		a.CityAscii == b.CityAscii &&
+		a.Lat == b.Lat &&
+		a.Lng == b.Lng &&
+		a.Country == b.Country &&
+		a.Iso2 == b.Iso2 &&
+		a.Iso3 == b.Iso3 &&
+		a.AdminName == b.AdminName &&
+		a.Capital == b.Capital &&
+		samePopulation(a.Population, b.Population) &&
+		a.Timezone == b.Timezone
+}
+
+// samePopulation reports whether a and b are both unknown or both the same.
+func samePopulation(a, b *int64) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
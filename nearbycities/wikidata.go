@@ -0,0 +1,169 @@
+package nearbycities
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultWikidataSPARQLURL = "https://query.wikidata.org/sparql"
+
+// WikidataLink is the Wikidata item of a city, e.g. Q1858 for Hanoi, with
+// its English Wikipedia article and a thumbnail of its image when it has
+// them. QID is empty for the cities that no item was found for.
+type WikidataLink struct {
+	QID          string
+	WikipediaURL string
+	ThumbnailURL string
+}
+
+// wikidataColumns receives the Wikidata columns of a city row, whose
+// wikidata_id is NULL until the city is enriched.
+type wikidataColumns struct {
+	qid          *string
+	wikipediaURL string
+	thumbnailURL string
+}
+
+func (w wikidataColumns) link() *WikidataLink {
+	if w.qid == nil {
+		return nil
+	}
+
+	return &WikidataLink{
+		QID:          *w.qid,
+		WikipediaURL: w.wikipediaURL,
+		ThumbnailURL: w.thumbnailURL,
+	}
+}
+
+// WikidataMatcher finds the Wikidata items of cities with the SPARQL
+// endpoint of the Wikidata Query Service: the nearest item within
+// MaxDistance of the coordinates labelled with the name of the city.
+type WikidataMatcher struct {
+	// URL is the SPARQL endpoint, the public one by default.
+	URL string
+	// UserAgent identifies the application, as required by the usage
+	// policy. It defaults to nearby-cities.
+	UserAgent string
+	// MaxDistance is in kilometers, 20 by default.
+	MaxDistance float64
+	// MinInterval is the least time between two requests, one second by
+	// default.
+	MinInterval time.Duration
+	// ThumbnailWidth is the width of the thumbnails in pixels, 320 by
+	// default.
+	ThumbnailWidth int
+	Client         *http.Client
+
+	mu          sync.Mutex
+	lastRequest time.Time
+}
+
+type sparqlResponse struct {
+	Results struct {
+		Bindings []map[string]struct {
+			Value string `json:"value"`
+		} `json:"bindings"`
+	} `json:"results"`
+}
+
+// Match returns the Wikidata item of the city, with an empty QID if there
+// is none.
+func (m *WikidataMatcher) Match(c City) (WikidataLink, error) {
+	names := []string{sparqlString(c.City)}
+	if c.CityAscii != "" && c.CityAscii != c.City {
+		names = append(names, sparqlString(c.CityAscii))
+	}
+
+	maxDistance := m.MaxDistance
+	if maxDistance == 0 {
+		maxDistance = 20
+	}
+
+	query := fmt.Sprintf(`SELECT ?item ?article ?image WHERE {
+  SERVICE wikibase:around {
+    ?item wdt:P625 ?location .
+    bd:serviceParam wikibase:center "Point(%v %v)"^^geo:wktLiteral .
+    bd:serviceParam wikibase:radius "%v" .
+    bd:serviceParam wikibase:distance ?distance .
+  }
+  ?item rdfs:label ?label .
+  FILTER(STR(?label) IN (%s))
+  OPTIONAL { ?article schema:about ?item ; schema:isPartOf <https://en.wikipedia.org/> . }
+  OPTIONAL { ?item wdt:P18 ?image . }
+} ORDER BY ?distance LIMIT 1`, c.Lng, c.Lat, maxDistance, strings.Join(names, ", "))
+
+	endpoint := m.URL
+	if endpoint == "" {
+		endpoint = defaultWikidataSPARQLURL
+	}
+
+	req, err := http.NewRequest(http.MethodGet, endpoint+"?"+url.Values{"query": {query}, "format": {"json"}}.Encode(), nil)
+	if err != nil {
+		return WikidataLink{}, err
+	}
+	userAgent := m.UserAgent
+	if userAgent == "" {
+		userAgent = "nearby-cities"
+	}
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Accept", "application/sparql-results+json")
+
+	m.wait()
+
+	var resp sparqlResponse
+	if err := doJSON(m.Client, req, &resp); err != nil {
+		return WikidataLink{}, fmt.Errorf("wikidata: %w", err)
+	}
+
+	if len(resp.Results.Bindings) == 0 {
+		return WikidataLink{}, nil
+	}
+
+	b := resp.Results.Bindings[0]
+	item := b["item"].Value
+	qid := item[strings.LastIndex(item, "/")+1:]
+	if !strings.HasPrefix(qid, "Q") {
+		return WikidataLink{}, fmt.Errorf("wikidata: unexpected item %s", item)
+	}
+
+	link := WikidataLink{
+		QID:          qid,
+		WikipediaURL: b["article"].Value,
+	}
+	if image := b["image"].Value; image != "" {
+		width := m.ThumbnailWidth
+		if width == 0 {
+			width = 320
+		}
+		// The images are Special:FilePath URLs, which scale them.
+		link.ThumbnailURL = fmt.Sprintf("%s?width=%d", strings.Replace(image, "http://", "https://", 1), width)
+	}
+
+	return link, nil
+}
+
+// wait blocks until MinInterval has passed since the last request.
+func (m *WikidataMatcher) wait() {
+	interval := m.MinInterval
+	if interval == 0 {
+		interval = time.Second
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if d := time.Until(m.lastRequest.Add(interval)); d > 0 {
+		time.Sleep(d)
+	}
+	m.lastRequest = time.Now()
+}
+
+// sparqlString quotes s as a SPARQL string literal.
+func sparqlString(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`).Replace(s) + `"`
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"os"
+	"sync"
+	"time"
+)
+
+// page is the template of a page along with the layout and the fragments it
+// shares with the other pages.
+type page struct {
+	name   string
+	layout string
+	fsys   fs.FS
+
+	// reload is set in development mode, where the templates are read from
+	// the disk and parsed again once one of them changes.
+	reload bool
+
+	mu       sync.Mutex
+	tmpl     *template.Template
+	modified time.Time
+}
+
+// parsePage parses the template of a page from the embedded templates, or
+// from the templates directory in development mode.
+func parsePage(name string, dev bool) *page {
+	return parsePageLayout("base.html", name, dev)
+}
+
+// parsePageLayout is parsePage with another layout than base.html, which
+// defines the base template the content of the page goes in.
+func parsePageLayout(layout, name string, dev bool) *page {
+	p := &page{name: name, layout: layout, fsys: htmlFS, reload: dev}
+	if dev {
+		p.fsys = os.DirFS(".")
+	}
+
+	tmpl, modified, err := p.parse()
+	if err != nil {
+		panic(err)
+	}
+	p.tmpl, p.modified = tmpl, modified
+	return p
+}
+
+func (p *page) files() []string {
+	return []string{"templates/" + p.layout, "templates/results.html", "templates/" + p.name}
+}
+
+// parse parses the files of the page and returns the time the last of them
+// was modified.
+func (p *page) parse() (*template.Template, time.Time, error) {
+	var modified time.Time
+	for _, name := range p.files() {
+		fi, err := fs.Stat(p.fsys, name)
+		if err != nil {
+			return nil, time.Time{}, err
+		}
+		if fi.ModTime().After(modified) {
+			modified = fi.ModTime()
+		}
+	}
+
+	tmpl, err := template.New(p.name).Funcs(templateFuncs).ParseFS(p.fsys, p.files()...)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	return tmpl, modified, nil
+}
+
+// ExecuteTemplate applies the template of the page with the given name to
+// data, after parsing the page again if it is reloaded and has changed.
+func (p *page) ExecuteTemplate(w io.Writer, name string, data any) error {
+	tmpl, err := p.current()
+	if err != nil {
+		return err
+	}
+	return tmpl.ExecuteTemplate(w, name, data)
+}
+
+func (p *page) current() (*template.Template, error) {
+	if !p.reload {
+		return p.tmpl, nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, name := range p.files() {
+		fi, err := fs.Stat(p.fsys, name)
+		if err != nil {
+			return nil, fmt.Errorf("error reloading %s: %w", p.name, err)
+		}
+		if fi.ModTime().After(p.modified) {
+			tmpl, modified, err := p.parse()
+			if err != nil {
+				return nil, fmt.Errorf("error reloading %s: %w", p.name, err)
+			}
+			p.tmpl, p.modified = tmpl, modified
+			break
+		}
+	}
+
+	return p.tmpl, nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/quantonganh/httperror"
+	"github.com/quantonganh/nearby-cities/nearbycities"
+)
+
+const (
+	// resultsPerPage is how many rows the results table shows at first and
+	// loads at a time after, so that a dense region, e.g. Java or the Ruhr,
+	// renders as fast as the others.
+	resultsPerPage = 50
+
+	// maxNearbyLimit bounds the cities of a page of the nearby endpoints.
+	maxNearbyLimit = 1000
+)
+
+// paginate returns the page of the cities asked for by the limit and offset
+// parameters, all of them when neither is given. The response staying the
+// array of the cities, a page tells the total in the X-Total-Count header and
+// links to the next one, while there are more, in the Link header.
+func paginate(w http.ResponseWriter, r *http.Request, cities []nearbycities.City) ([]nearbycities.City, error) {
+	if r.FormValue("limit") == "" && r.FormValue("offset") == "" {
+		return cities, nil
+	}
+
+	limit, err := parseCount(r, "limit", maxNearbyLimit)
+	if err != nil {
+		return nil, err
+	}
+	if limit == 0 || limit > maxNearbyLimit {
+		return nil, httperror.New(http.StatusBadRequest, fmt.Sprintf("limit must be in the range [1, %d]", maxNearbyLimit))
+	}
+
+	offset, err := parseCount(r, "offset", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	total := len(cities)
+	start := min(offset, total)
+	end := min(start+limit, total)
+
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	if end < total {
+		q := r.URL.Query()
+		q.Set("offset", strconv.Itoa(end))
+		w.Header().Set("Link", fmt.Sprintf(`<%s?%s>; rel="next"`, r.URL.Path, q.Encode()))
+	}
+
+	return cities[start:end], nil
+}
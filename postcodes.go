@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/quantonganh/nearby-cities/nearbycities"
+	"github.com/rs/zerolog"
+)
+
+// runPostcodes runs the postcodes subcommand, which loads the GeoNames postal
+// code file at the path given in args into the configured database.
+// The postal codes of the countries in the file replace the imported ones.
+func runPostcodes(cfg config, logger zerolog.Logger, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: %s postcodes allCountries.txt", os.Args[0])
+	}
+
+	f, err := os.Open(args[0])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	codes, err := nearbycities.ReadPostalCodes(f)
+	if err != nil {
+		return err
+	}
+
+	store, err := openStorage(cfg, logger)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	if err := store.MigrateUp(ctx); err != nil {
+		return err
+	}
+
+	if err := store.ImportPostalCodes(ctx, codes); err != nil {
+		return err
+	}
+
+	fmt.Printf("%d postal codes imported\n", len(codes))
+	return nil
+}
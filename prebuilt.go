@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// fetchPrebuilt downloads the prebuilt database of cfg to its path when
+// there is one to download and no SQLite database there yet. The download
+// is checked against its SHA-256 before taking the place of the database,
+// so that a failed or tampered one is never opened.
+func fetchPrebuilt(ctx context.Context, cfg databaseConfig, logger zerolog.Logger) error {
+	if cfg.PrebuiltURL == "" || cfg.URL != "" {
+		return nil
+	}
+	if _, err := os.Stat(cfg.Path); err == nil {
+		return nil
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	start := time.Now()
+	want := strings.ToLower(strings.TrimSpace(cfg.PrebuiltSHA256))
+	if want == "" {
+		sum, err := fetchChecksum(ctx, cfg.PrebuiltURL+".sha256")
+		if err != nil {
+			return fmt.Errorf("error downloading the checksum of the prebuilt database: %w", err)
+		}
+		want = sum
+	}
+
+	if err := os.MkdirAll(filepath.Dir(cfg.Path), 0755); err != nil {
+		return err
+	}
+	tmp := cfg.Path + ".download"
+	defer os.Remove(tmp)
+
+	got, err := downloadPrebuilt(ctx, cfg.PrebuiltURL, tmp)
+	if err != nil {
+		return fmt.Errorf("error downloading the prebuilt database: %w", err)
+	}
+	if got != want {
+		return fmt.Errorf("the prebuilt database at %s has the SHA-256 %s, expected %s", cfg.PrebuiltURL, got, want)
+	}
+	if err := os.Rename(tmp, cfg.Path); err != nil {
+		return err
+	}
+
+	logger.Info().Str("url", cfg.PrebuiltURL).Dur("duration", time.Since(start)).Msg("downloaded prebuilt database")
+	return nil
+}
+
+// downloadPrebuilt writes the file at rawURL to path and returns its
+// SHA-256.
+func downloadPrebuilt(ctx context.Context, rawURL, path string) (string, error) {
+	body, err := openURL(ctx, rawURL)
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+
+	f, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(f, h), body); err != nil {
+		f.Close()
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// fetchChecksum returns the SHA-256 published at rawURL, either alone or as
+// sha256sum prints it, followed by the name of the file.
+func fetchChecksum(ctx context.Context, rawURL string) (string, error) {
+	body, err := openURL(ctx, rawURL)
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+
+	b, err := io.ReadAll(io.LimitReader(body, 1<<10))
+	if err != nil {
+		return "", err
+	}
+	fields := strings.Fields(string(b))
+	if len(fields) == 0 || len(fields[0]) != hex.EncodedLen(sha256.Size) {
+		return "", fmt.Errorf("no SHA-256 at %s", rawURL)
+	}
+
+	return strings.ToLower(fields[0]), nil
+}
+
+// openURL returns the content at an http(s):// or s3:// URL, which the
+// caller closes.
+func openURL(ctx context.Context, rawURL string) (io.ReadCloser, error) {
+	obj, isS3, err := parseS3URL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if isS3 {
+		client, err := s3ClientFromEnv()
+		if err != nil {
+			return nil, err
+		}
+		return client.get(ctx, obj)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s answered %s", rawURL, resp.Status)
+	}
+
+	return resp.Body, nil
+}
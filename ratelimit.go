@@ -0,0 +1,245 @@
+package main
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/quantonganh/httperror"
+)
+
+// rateLimit is a token-bucket limit: rate tokens are added per second, up to
+// burst tokens.
+type rateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+type rateLimitOptions struct {
+	PerIP     rateLimit
+	PerAPIKey rateLimit
+	APIKeys   []string
+
+	// TrustedProxies are the networks of the reverse proxies whose
+	// X-Forwarded-For and X-Real-IP headers tell the IP of the client.
+	TrustedProxies []*net.IPNet
+}
+
+// newRateLimitOptions returns the limits of c. The clients are told apart
+// by the address they connect from, unless it is one of trustedProxies,
+// which tell the address of the clients they forward.
+func newRateLimitOptions(c rateLimitConfig, trustedProxies []string) rateLimitOptions {
+	opts := rateLimitOptions{
+		PerIP:          rateLimit{Rate: c.RPS, Burst: c.Burst},
+		APIKeys:        c.APIKeys,
+		TrustedProxies: parseNetworks(trustedProxies),
+	}
+	opts.PerAPIKey = opts.PerIP
+	if c.APIKeyRPS != nil {
+		opts.PerAPIKey.Rate = *c.APIKeyRPS
+	}
+	if c.APIKeyBurst != nil {
+		opts.PerAPIKey.Burst = *c.APIKeyBurst
+	}
+
+	return opts
+}
+
+// parseNetworks parses CIDR networks, e.g. 10.0.0.0/8, and single IPs,
+// skipping the invalid ones.
+func parseNetworks(list []string) []*net.IPNet {
+	var networks []*net.IPNet
+	for _, s := range list {
+		if !strings.Contains(s, "/") {
+			if ip := net.ParseIP(s); ip != nil {
+				bits := 8 * len(ip.To16())
+				if ip.To4() != nil {
+					ip, bits = ip.To4(), 32
+				}
+				networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			}
+			continue
+		}
+		if _, network, err := net.ParseCIDR(s); err == nil {
+			networks = append(networks, network)
+		}
+	}
+
+	return networks
+}
+
+type bucket struct {
+	tokens   float64
+	lastSeen time.Time
+}
+
+type rateLimiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{
+		buckets:   make(map[string]*bucket),
+		lastSweep: time.Now(),
+	}
+}
+
+// take removes a token from the bucket identified by key. It reports whether
+// the request is allowed, the tokens left and when the bucket is full again.
+func (rl *rateLimiter) take(key string, limit rateLimit, now time.Time) (bool, int, time.Duration) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	if now.Sub(rl.lastSweep) > time.Minute {
+		rl.sweep(now)
+	}
+
+	b, ok := rl.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Burst), lastSeen: now}
+		rl.buckets[key] = b
+	}
+
+	b.tokens = math.Min(float64(limit.Burst), b.tokens+now.Sub(b.lastSeen).Seconds()*limit.Rate)
+	b.lastSeen = now
+
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+
+	reset := time.Duration((float64(limit.Burst) - b.tokens) / limit.Rate * float64(time.Second))
+
+	return allowed, int(b.tokens), reset
+}
+
+// sweep drops the buckets that have not been used for a while, since they
+// would be full again anyway.
+func (rl *rateLimiter) sweep(now time.Time) {
+	for key, b := range rl.buckets {
+		if now.Sub(b.lastSeen) > 10*time.Minute {
+			delete(rl.buckets, key)
+		}
+	}
+	rl.lastSweep = now
+}
+
+// rateLimitHandler rejects clients that exceed their limit with 429 and
+// reports the state of their bucket in X-RateLimit-* headers. The clients
+// without an API key are not limited when they have no rate, nor those with
+// one when the API keys have none, and it does nothing when neither has.
+func rateLimitHandler(opts rateLimitOptions) func(next http.Handler) http.Handler {
+	rl := newRateLimiter()
+
+	return func(next http.Handler) http.Handler {
+		if opts.PerIP.Rate <= 0 && (opts.PerAPIKey.Rate <= 0 || len(opts.APIKeys) == 0) {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if strings.HasPrefix(r.URL.Path, "/static") || isProbePath(r.URL.Path) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			key, limit := "", opts.PerIP
+			if apiKey := requestAPIKey(r); apiKey != "" && opts.isAPIKey(apiKey) {
+				if opts.PerAPIKey.Rate <= 0 {
+					next.ServeHTTP(w, r)
+					return
+				}
+				key, limit = "key:"+apiKey, opts.PerAPIKey
+			} else {
+				if opts.PerIP.Rate <= 0 {
+					next.ServeHTTP(w, r)
+					return
+				}
+				key = "ip:" + opts.clientIP(r)
+			}
+
+			allowed, remaining, reset := rl.take(key, limit, time.Now())
+
+			w.Header().Set("X-RateLimit-Limit", strconv.Itoa(limit.Burst))
+			w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+			w.Header().Set("X-RateLimit-Reset", strconv.Itoa(int(math.Ceil(reset.Seconds()))))
+
+			if !allowed {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(1/limit.Rate))))
+				httperror.Handler(func(w http.ResponseWriter, r *http.Request) error {
+					return httperror.New(http.StatusTooManyRequests, "rate limit exceeded")
+				}).ServeHTTP(w, r)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func (o rateLimitOptions) isAPIKey(key string) bool {
+	for _, k := range o.APIKeys {
+		if k == key {
+			return true
+		}
+	}
+
+	return false
+}
+
+// clientIP returns the IP the request comes from. Behind one of the trusted
+// proxies, it is the last address of X-Forwarded-For that is not a trusted
+// proxy, or else X-Real-IP; the headers of other clients are ignored, since
+// they could send a new one on each request to get a new bucket.
+func (o rateLimitOptions) clientIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	if !o.isTrustedProxy(ip) {
+		return ip
+	}
+
+	forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(forwarded[i])
+		if net.ParseIP(hop) == nil {
+			break
+		}
+		if !o.isTrustedProxy(hop) {
+			return hop
+		}
+	}
+	if realIP := strings.TrimSpace(r.Header.Get("X-Real-IP")); net.ParseIP(realIP) != nil {
+		return realIP
+	}
+
+	return ip
+}
+
+func (o rateLimitOptions) isTrustedProxy(ip string) bool {
+	netIP := net.ParseIP(ip)
+	if netIP == nil {
+		return false
+	}
+	for _, network := range o.TrustedProxies {
+		if network.Contains(netIP) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func requestAPIKey(r *http.Request) string {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+
+	return r.URL.Query().Get("api_key")
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterTake(t *testing.T) {
+	rl := newRateLimiter()
+	limit := rateLimit{Rate: 2, Burst: 3}
+	start := time.Now()
+
+	steps := []struct {
+		after     time.Duration
+		allowed   bool
+		remaining int
+	}{
+		{0, true, 2},
+		{0, true, 1},
+		{0, true, 0},
+		{0, false, 0},
+		// Half a second adds a token at 2 per second.
+		{500 * time.Millisecond, true, 0},
+		{500 * time.Millisecond, false, 0},
+		// The bucket holds no more than the burst.
+		{time.Hour, true, 2},
+	}
+	for i, step := range steps {
+		allowed, remaining, _ := rl.take("ip:192.0.2.1", limit, start.Add(step.after))
+		if allowed != step.allowed || remaining != step.remaining {
+			t.Errorf("take %d = %v, %d, want %v, %d", i, allowed, remaining, step.allowed, step.remaining)
+		}
+	}
+
+	if allowed, _, _ := rl.take("ip:192.0.2.2", limit, start); !allowed {
+		t.Error("the bucket of another client is empty, want it full")
+	}
+}
+
+func TestRateLimiterReset(t *testing.T) {
+	rl := newRateLimiter()
+	now := time.Now()
+	_, _, reset := rl.take("ip:192.0.2.1", rateLimit{Rate: 2, Burst: 3}, now)
+	if reset != 500*time.Millisecond {
+		t.Errorf("reset = %v, want 500ms for the token taken to come back", reset)
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	opts := rateLimitOptions{TrustedProxies: parseNetworks([]string{"10.0.0.0/8", "192.0.2.1"})}
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor string
+		realIP       string
+		want         string
+	}{
+		{"direct", "203.0.113.7:4321", "", "", "203.0.113.7"},
+		{"spoofed by a client", "203.0.113.7:4321", "198.51.100.1", "198.51.100.2", "203.0.113.7"},
+		{"behind a proxy", "10.1.2.3:4321", "198.51.100.1", "", "198.51.100.1"},
+		{"behind a single trusted IP", "192.0.2.1:4321", "198.51.100.1", "", "198.51.100.1"},
+		{"spoofed behind a proxy", "10.1.2.3:4321", "198.51.100.9, 198.51.100.1, 10.4.5.6", "", "198.51.100.1"},
+		{"real IP behind a proxy", "10.1.2.3:4321", "", "198.51.100.2", "198.51.100.2"},
+		{"proxy without header", "10.1.2.3:4321", "", "", "10.1.2.3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/api/v1/search", nil)
+			r.RemoteAddr = tt.remoteAddr
+			if tt.forwardedFor != "" {
+				r.Header.Set("X-Forwarded-For", tt.forwardedFor)
+			}
+			if tt.realIP != "" {
+				r.Header.Set("X-Real-IP", tt.realIP)
+			}
+			if got := opts.clientIP(r); got != tt.want {
+				t.Errorf("clientIP = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRateLimitHandler(t *testing.T) {
+	opts := newRateLimitOptions(rateLimitConfig{RPS: 1, Burst: 2, APIKeys: []string{"secret"}, APIKeyRPS: new(float64)}, nil)
+	handler := rateLimitHandler(opts)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	get := func(path, forwardedFor, apiKey string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", path, nil)
+		r.RemoteAddr = "203.0.113.7:4321"
+		r.Header.Set("X-Forwarded-For", forwardedFor)
+		if apiKey != "" {
+			r.Header.Set("X-API-Key", apiKey)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	for i := 0; i < 2; i++ {
+		if w := get("/api/v1/search", strconv.Itoa(i), ""); w.Code != http.StatusOK {
+			t.Fatalf("request %d answered %d, want 200", i, w.Code)
+		}
+	}
+	w := get("/api/v1/search", "198.51.100.1", "")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("request over the limit answered %d, want 429 whatever its X-Forwarded-For", w.Code)
+	}
+	if got := w.Header().Get("Retry-After"); got != "1" {
+		t.Errorf("Retry-After = %q, want 1", got)
+	}
+	if w := get("/static/style.css", "", ""); w.Code != http.StatusOK {
+		t.Errorf("static asset answered %d, want 200", w.Code)
+	}
+	for i := 0; i < 5; i++ {
+		if w := get("/api/v1/search", "", "secret"); w.Code != http.StatusOK || w.Header().Get("X-RateLimit-Limit") != "" {
+			t.Fatalf("request %d of the unlimited API key answered %d with X-RateLimit-Limit %q, want 200 without", i, w.Code, w.Header().Get("X-RateLimit-Limit"))
+		}
+	}
+}
+
+func TestRateLimitHandlerAPIKeysOnly(t *testing.T) {
+	rps := 1.0
+	opts := newRateLimitOptions(rateLimitConfig{Burst: 2, APIKeys: []string{"secret"}, APIKeyRPS: &rps}, nil)
+	handler := rateLimitHandler(opts)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	get := func(apiKey string) int {
+		r := httptest.NewRequest("GET", "/api/v1/search?api_key="+apiKey, nil)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	for i := 0; i < 5; i++ {
+		if code := get(""); code != http.StatusOK {
+			t.Fatalf("request %d without an API key answered %d, want 200 without a rate", i, code)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		if code := get("secret"); code != http.StatusOK {
+			t.Fatalf("request %d of the API key answered %d, want 200", i, code)
+		}
+	}
+	if code := get("secret"); code != http.StatusTooManyRequests {
+		t.Errorf("request of the API key over its limit answered %d, want 429", code)
+	}
+}
+
+func TestNewRateLimitOptions(t *testing.T) {
+	rps, burst := 10.0, 50
+	tests := []struct {
+		name string
+		c    rateLimitConfig
+		want rateLimit
+	}{
+		{"inherited", rateLimitConfig{RPS: 1, Burst: 20}, rateLimit{1, 20}},
+		{"own", rateLimitConfig{RPS: 1, Burst: 20, APIKeyRPS: &rps, APIKeyBurst: &burst}, rateLimit{10, 50}},
+	}
+	for _, tt := range tests {
+		if got := newRateLimitOptions(tt.c, nil).PerAPIKey; got != tt.want {
+			t.Errorf("%s: the API key limit = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
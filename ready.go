@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/quantonganh/httperror"
+	"github.com/quantonganh/nearby-cities/nearbycities"
+)
+
+// readiness tracks whether the dataset has been imported and indexed, which
+// can take minutes on the first boot.
+type readiness struct {
+	ready atomic.Bool
+}
+
+func (rd *readiness) markReady() {
+	rd.ready.Store(true)
+}
+
+// readyzHandler returns 503 until the migrations have completed and the
+// search and geospatial indexes are populated.
+func (rd *readiness) readyzHandler(store nearbycities.Storage) httperror.Handler {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		if !rd.ready.Load() {
+			return httperror.New(http.StatusServiceUnavailable, "dataset is being imported")
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+		defer cancel()
+
+		populated, err := store.Populated(ctx)
+		if err != nil || !populated {
+			return httperror.New(http.StatusServiceUnavailable, "indexes are not populated")
+		}
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		_, err = w.Write([]byte("ok\n"))
+		return err
+	}
+}
+
+// handler answers 503 to requests that need the dataset until it is ready.
+// Probes, metrics, static assets and the admin endpoints, which follow the
+// import, are always served.
+func (rd *readiness) handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if rd.ready.Load() || isProbePath(r.URL.Path) || r.URL.Path == "/metrics" || strings.HasPrefix(r.URL.Path, "/static") || strings.HasPrefix(r.URL.Path, "/admin/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Retry-After", "30")
+		httperror.Handler(func(w http.ResponseWriter, r *http.Request) error {
+			return httperror.New(http.StatusServiceUnavailable, "dataset is being imported, please try again later")
+		}).ServeHTTP(w, r)
+	})
+}
+
+func isProbePath(path string) bool {
+	return path == "/healthz" || path == "/readyz"
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// s3Object is an object of an S3 bucket, given as s3://bucket/key.
+type s3Object struct {
+	Bucket string
+	Key    string
+}
+
+// parseS3URL parses an s3://bucket/key URL, reporting false if s is not one.
+func parseS3URL(s string) (s3Object, bool, error) {
+	rest, ok := strings.CutPrefix(s, "s3://")
+	if !ok {
+		return s3Object{}, false, nil
+	}
+
+	bucket, key, _ := strings.Cut(rest, "/")
+	if bucket == "" || key == "" {
+		return s3Object{}, true, fmt.Errorf("invalid S3 URL, expected s3://bucket/key: %s", s)
+	}
+
+	return s3Object{Bucket: bucket, Key: key}, true, nil
+}
+
+// s3Client sends the requests to S3, or to a compatible service such as
+// MinIO, signed with AWS Signature Version 4.
+type s3Client struct {
+	endpoint     string
+	region       string
+	accessKey    string
+	secretKey    string
+	sessionToken string
+	client       *http.Client
+}
+
+// s3ClientFromEnv reads the credentials from the usual AWS variables:
+// AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY, AWS_SESSION_TOKEN and
+// AWS_REGION, us-east-1 by default. AWS_ENDPOINT_URL_S3 points to another
+// service than AWS.
+func s3ClientFromEnv() (*s3Client, error) {
+	c := &s3Client{
+		endpoint:     os.Getenv("AWS_ENDPOINT_URL_S3"),
+		region:       os.Getenv("AWS_REGION"),
+		accessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		sessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+		client:       &http.Client{},
+	}
+	if c.accessKey == "" || c.secretKey == "" {
+		return nil, errors.New("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY are required for S3")
+	}
+	if c.region == "" {
+		c.region = "us-east-1"
+	}
+	if c.endpoint == "" {
+		c.endpoint = "https://s3." + c.region + ".amazonaws.com"
+	}
+	c.endpoint = strings.TrimSuffix(c.endpoint, "/")
+
+	return c, nil
+}
+
+// upload puts the file at path as the object.
+func (c *s3Client) upload(ctx context.Context, obj s3Object, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	req, err := c.newRequest(ctx, http.MethodPut, obj, f, hex.EncodeToString(h.Sum(nil)))
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return s3Error(resp)
+	}
+	return nil
+}
+
+// download writes the object to the file at path.
+func (c *s3Client) download(ctx context.Context, obj s3Object, path string) error {
+	body, err := c.get(ctx, obj)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, body); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// get returns the content of the object, which the caller closes.
+func (c *s3Client) get(ctx context.Context, obj s3Object) (io.ReadCloser, error) {
+	emptySum := sha256.Sum256(nil)
+	req, err := c.newRequest(ctx, http.MethodGet, obj, nil, hex.EncodeToString(emptySum[:]))
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, s3Error(resp)
+	}
+
+	return resp.Body, nil
+}
+
+// newRequest returns the request for the object, addressed by path as the
+// compatible services expect, and signed with the SHA-256 of its body.
+func (c *s3Client) newRequest(ctx context.Context, method string, obj s3Object, body io.Reader, payloadHash string) (*http.Request, error) {
+	u, err := url.Parse(c.endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid S3 endpoint: %w", err)
+	}
+	// The signature covers the path encoded as AWS does, which is sent as
+	// is.
+	base := strings.TrimSuffix(u.Path, "/")
+	u.Path = base + "/" + obj.Bucket + "/" + obj.Key
+	u.RawPath = base + "/" + awsURIEncode(obj.Bucket, false) + "/" + awsURIEncode(obj.Key, true)
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	c.sign(req, payloadHash, time.Now())
+
+	return req, nil
+}
+
+// sign signs the request as sent at t, with the SHA-256 of its body.
+func (c *s3Client) sign(req *http.Request, payloadHash string, t time.Time) {
+	now := t.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	signed := []string{"host", "x-amz-content-sha256", "x-amz-date"}
+	if c.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", c.sessionToken)
+		signed = append(signed, "x-amz-security-token")
+	}
+
+	var headers strings.Builder
+	for _, name := range signed {
+		value := req.Header.Get(name)
+		if name == "host" {
+			value = req.URL.Host
+		}
+		headers.WriteString(name + ":" + strings.TrimSpace(value) + "\n")
+	}
+	signedHeaders := strings.Join(signed, ";")
+
+	canonical := strings.Join([]string{req.Method, req.URL.EscapedPath(), "", headers.String(), signedHeaders, payloadHash}, "\n")
+	scope := date + "/" + c.region + "/s3/aws4_request"
+	canonicalSum := sha256.Sum256([]byte(canonical))
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(canonicalSum[:])
+
+	key := hmacSHA256([]byte("AWS4"+c.secretKey), date)
+	for _, part := range []string{c.region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, toSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+c.accessKey+"/"+scope+", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// awsURIEncode percent-encodes s as AWS signatures expect: everything but
+// the unreserved characters, and the slashes unless keepSlash is set.
+func awsURIEncode(s string, keepSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '.', c == '_', c == '~':
+			b.WriteByte(c)
+		case c == '/' && keepSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// s3Error returns the error of a failed request, with the message S3 sent.
+func s3Error(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<10))
+	return fmt.Errorf("S3 answered %s: %s", resp.Status, strings.TrimSpace(string(body)))
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCronScheduleNext(t *testing.T) {
+	// 2024-05-15 is a Wednesday.
+	at := func(s string) time.Time {
+		t, err := time.Parse("2006-01-02 15:04", s)
+		if err != nil {
+			panic(err)
+		}
+		return t
+	}
+	tests := []struct {
+		schedule string
+		from     string
+		want     []string
+	}{
+		// Steps and ranges.
+		{"*/15 * * * *", "2024-05-15 10:07", []string{"2024-05-15 10:15", "2024-05-15 10:30", "2024-05-15 10:45", "2024-05-15 11:00"}},
+		{"5/20 * * * *", "2024-05-15 10:50", []string{"2024-05-15 11:05", "2024-05-15 11:25", "2024-05-15 11:45", "2024-05-15 12:05"}},
+		{"0 9-17/4 * * 1-5", "2024-05-17 18:00", []string{"2024-05-20 09:00", "2024-05-20 13:00", "2024-05-20 17:00", "2024-05-21 09:00"}},
+		{"30 8,12 * * *", "2024-05-15 08:30", []string{"2024-05-15 12:30", "2024-05-16 08:30"}},
+		// The next minute, never the time given.
+		{"* * * * *", "2024-05-15 10:07", []string{"2024-05-15 10:08", "2024-05-15 10:09"}},
+		// 7 is Sunday, as 0 is.
+		{"0 0 * * 7", "2024-05-15 10:00", []string{"2024-05-19 00:00", "2024-05-26 00:00"}},
+		{"0 0 * * 0", "2024-05-15 10:00", []string{"2024-05-19 00:00", "2024-05-26 00:00"}},
+		{"0 0 * * 5-7", "2024-05-15 10:00", []string{"2024-05-17 00:00", "2024-05-18 00:00", "2024-05-19 00:00", "2024-05-24 00:00"}},
+		// Restricted by both days, a job runs on the 13th and on Fridays.
+		{"0 0 13 * 5", "2024-05-01 00:00", []string{"2024-05-03 00:00", "2024-05-10 00:00", "2024-05-13 00:00", "2024-05-17 00:00"}},
+		// A day starting with * only restricts as the other one allows,
+		// here the Mondays of the odd days.
+		{"0 0 */2 * 1", "2024-05-01 00:00", []string{"2024-05-13 00:00", "2024-05-27 00:00", "2024-06-03 00:00"}},
+		{"0 0 1 * */2", "2024-05-01 00:00", []string{"2024-06-01 00:00", "2024-08-01 00:00"}},
+		// The months of fewer days are skipped, and so are the years.
+		{"0 0 31 * *", "2024-04-15 00:00", []string{"2024-05-31 00:00", "2024-07-31 00:00", "2024-08-31 00:00", "2024-10-31 00:00"}},
+		{"0 0 1 1 *", "2024-05-15 00:00", []string{"2025-01-01 00:00", "2026-01-01 00:00"}},
+		{"59 23 31 12 *", "2024-12-31 23:59", []string{"2025-12-31 23:59"}},
+		{"0 0 29 2 *", "2024-03-01 00:00", []string{"2028-02-29 00:00"}},
+		// The shorthands.
+		{"@hourly", "2024-05-15 10:07", []string{"2024-05-15 11:00"}},
+		{"@daily", "2024-05-15 10:07", []string{"2024-05-16 00:00"}},
+		{"@weekly", "2024-05-15 10:07", []string{"2024-05-19 00:00"}},
+		{"@monthly", "2024-05-15 10:07", []string{"2024-06-01 00:00"}},
+		{"@every 90m", "2024-05-15 10:07", []string{"2024-05-15 11:37", "2024-05-15 13:07"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.schedule, func(t *testing.T) {
+			sched, err := parseSchedule(tt.schedule)
+			if err != nil {
+				t.Fatal(err)
+			}
+			next := at(tt.from)
+			for _, want := range tt.want {
+				next = sched.next(next)
+				if !next.Equal(at(want)) {
+					t.Fatalf("got %s, want %s", next.Format("2006-01-02 15:04 Mon"), want)
+				}
+			}
+		})
+	}
+}
+
+func TestCronScheduleLocation(t *testing.T) {
+	sched, err := parseSchedule("30 4 * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hanoi := time.FixedZone("ICT", 7*60*60)
+	got := sched.next(time.Date(2024, 5, 15, 12, 0, 0, 0, hanoi))
+	if want := time.Date(2024, 5, 16, 4, 30, 0, 0, hanoi); !got.Equal(want) || got.Location() != hanoi {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestParseScheduleInvalid(t *testing.T) {
+	for _, s := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * 32 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"*/x * * * *",
+		"a * * * *",
+		"1-x * * * *",
+		"@yearly",
+		"@every",
+		"@every soon",
+		"@every -1h",
+		"@every 0s",
+		// February 30 and 31 never come.
+		"0 0 30 2 *",
+		"0 0 31 2,4,6,9,11 *",
+	} {
+		if _, err := parseSchedule(s); err == nil {
+			t.Errorf("parseSchedule(%q) succeeded, want an error", s)
+		}
+	}
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/quantonganh/httperror"
+	"github.com/quantonganh/nearby-cities/nearbycities"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/hlog"
+)
+
+// runServe runs the serve command, the default one, which downloads the
+// prebuilt database or imports the dataset if needed, and serves the pages
+// and the API until it is interrupted.
+func runServe(cfg config, logger zerolog.Logger) error {
+	if cfg.Litestream.ReplicaURL != "" && cfg.Database.URL != "" {
+		return errors.New("litestream replicates the SQLite database at the database path only")
+	}
+	if err := restoreLitestream(context.Background(), cfg, logger); err != nil {
+		return err
+	}
+	if err := fetchPrebuilt(context.Background(), cfg.Database, logger); err != nil {
+		return err
+	}
+	store, err := openStorage(cfg, logger)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	replicateCtx, stopReplication := context.WithCancel(context.Background())
+	defer stopReplication()
+	var replicated <-chan struct{}
+	if cfg.Litestream.ReplicaURL != "" {
+		// litestream replicates an existing database, which the migrations
+		// create.
+		if err := store.MigrateUp(replicateCtx); err != nil {
+			return err
+		}
+		replicated = superviseLitestream(replicateCtx, cfg, logger)
+	}
+	svc, closeService, err := newService(cfg, store)
+	if err != nil {
+		return err
+	}
+	defer closeService()
+	rows := newDatasetCollector(store)
+	hub := newWSHub()
+	dataset := &datasetVersion{}
+	jobs, err := scheduledJobs(cfg, store, svc, rows, func(changes nearbycities.CityChanges) {
+		logger.Info().Stringer("changes", changes).Msg("refreshed cities")
+		dataset.touch()
+		hub.broadcast(wsMessage{Type: "dataset_refreshed"})
+	})
+	if err != nil {
+		return err
+	}
+
+	r := httperror.NewRouter()
+	r.Use(hlog.NewHandler(logger))
+	r.Use(hlog.AccessHandler(func(r *http.Request, status, size int, duration time.Duration) {
+		if isLogged(r.URL.Path, cfg.Log.SkipPaths) {
+			hlog.FromRequest(r).Info().
+				Str("method", r.Method).
+				Stringer("url", r.URL).
+				Int("status", status).
+				Int("size", size).
+				Dur("duration", duration).
+				Msg("")
+		}
+	}))
+	r.Use(httperror.RealIPHandler("ip"))
+	r.Use(hlog.UserAgentHandler("user_agent"))
+	r.Use(hlog.RefererHandler("referer"))
+	r.Use(hlog.RequestIDHandler("req_id", "Request-Id"))
+	static := http.FileServer(http.FS(staticFS))
+	if cfg.Dev {
+		static = http.FileServer(http.Dir("."))
+	}
+	r.Add("/static/", func(w http.ResponseWriter, r *http.Request) error {
+		static.ServeHTTP(w, r)
+		return nil
+	})
+
+	tmpl := parsePage("index.html", cfg.Dev)
+	sess, err := newSessions(cfg.Session.Secret)
+	if err != nil {
+		return err
+	}
+
+	r.Add("/", sitemapHandler(store, indexHandler(svc, tmpl, sess)))
+	r.Add("/search", searchHandler(svc, tmpl, sess))
+	r.Add("/search/stream", streamHandler(svc))
+	r.Add("/search/map", mapHandler(svc))
+	r.Add("/nearby", nearbyHandler(svc, tmpl))
+	r.Add("/compare", compareHandler(svc, store, parsePage("compare.html", cfg.Dev)))
+	r.Add("/theme", themeHandler())
+	r.Add("/embed", embedHandler(svc, parsePageLayout("embed.html", "index.html", cfg.Dev), sess))
+	timeout := cfg.HTTP.RequestTimeout
+	corsOpts := newCORSOptions(cfg.CORS)
+	r.Add("/ws", wsHandler(svc, hub, corsOpts, timeout))
+	registerAPI(r, svc, apiVersions...)
+	r.Add("/country/", countryRegionsHandler(store, parsePage("regions.html", cfg.Dev)))
+	r.Add("/region/", regionCitiesHandler(store, parsePage("region.html", cfg.Dev)))
+	cityPage := parsePage("city.html", cfg.Dev)
+	r.Add("/city/", cityHandler(svc, store, cityPage))
+	r.Add("/nearby/", slugCityHandler(svc, store, cityPage))
+	tracker := newJobTracker()
+	r.Add("/admin/jobs", adminJobsHandler(tracker, cfg.Admin.Token))
+	r.Add("/robots.txt", robotsHandler())
+	r.Add("/sitemap.xml", sitemapIndexHandler(store))
+
+	// Probes are mounted on the mux directly to keep them out of the access log.
+	ready := &readiness{}
+	cacheOpts := newHTTPCacheOptions(cfg.HTTP)
+	if cfg.Dev {
+		// The assets being edited are revalidated on every load.
+		cacheOpts.StaticMaxAge = 0
+	}
+	r.Mux.Handle("/healthz", healthzHandler(store))
+	r.Mux.Handle("/readyz", ready.readyzHandler(store))
+	prometheus.MustRegister(rows, newCacheCollector(svc))
+	r.Mux.Handle("/metrics", adminOnly(cfg.Admin.Token, promhttp.Handler()))
+
+	// The router re-applies its middlewares on every request, so handlers
+	// that keep state across requests wrap the mux once instead.
+	handler := corsHandler(corsOpts)(rateLimitHandler(newRateLimitOptions(cfg.RateLimit, cfg.HTTP.TrustedProxies))(ready.handler(metricsHandler(r.Mux)(cacheHandler(cacheOpts, dataset)(timeoutHandler(timeout)(varyAccept(r.Mux)))))))
+	listeners, err := listen(cfg.Addr, cfg.Socket)
+	if err != nil {
+		return err
+	}
+	server := httperror.NewServer(handler, "")
+	serve(server, listeners)
+
+	var pprofServer *http.Server
+	if addr := cfg.Pprof.Addr; addr != "" {
+		pprofServer = newPprofServer(addr)
+		go func() {
+			fmt.Printf("pprof is listening on %s...\n", pprofServer.Addr)
+			if err := pprofServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Fatal(err)
+			}
+		}()
+	}
+
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+
+	go func() {
+		run := tracker.start("import")
+		err := importDataset(cfg, store, logger)
+		run.finish(err)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		run = tracker.start("build_indexes")
+		err = buildIndexes(cfg, store, svc, run)
+		run.finish(err)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := rows.refresh(context.Background()); err != nil {
+			logger.Error().Err(err).Msg("failed to count the dataset rows")
+		}
+		dataset.touch()
+		ready.markReady()
+		hub.broadcast(wsMessage{Type: "dataset_refreshed"})
+		runJobs(jobsCtx, jobs, tracker, logger)
+	}()
+
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	<-c
+
+	fmt.Println("\nShutting down server...")
+	stopJobs()
+	if err := server.Shutdown(context.Background()); err != nil {
+		return err
+	}
+
+	if pprofServer != nil {
+		if err := pprofServer.Shutdown(context.Background()); err != nil {
+			return err
+		}
+	}
+
+	if replicated != nil {
+		stopReplication()
+		<-replicated
+	}
+
+	fmt.Println("Server has stopped.")
+	return nil
+}
+
+// newService returns the service answering the searches from store with the
+// geocoders, IP locators and options of cfg, and a function closing the
+// locators it opened.
+func newService(cfg config, store nearbycities.Storage) (*nearbycities.Service, func(), error) {
+	geocoders, err := fallbackGeocoders(cfg.Geocoders)
+	if err != nil {
+		return nil, nil, err
+	}
+	opts := []nearbycities.Option{
+		nearbycities.WithFallbackGeocoders(geocoders...),
+	}
+	closeLocators := func() {}
+	if cfg.IPLocator.Kind == "maxmind" {
+		locator, err := nearbycities.OpenMaxMind(cfg.IPLocator.MaxMindDBPath)
+		if err != nil {
+			return nil, nil, err
+		}
+		closeLocators = func() { locator.Close() }
+		opts = append(opts, nearbycities.WithIPLocator(locator))
+	}
+	if cfg.IPLocator.Fallback == "remote" {
+		opts = append(opts, nearbycities.WithFallbackIPLocators(&nearbycities.RemoteIPLocator{
+			URL: cfg.IPLocator.RemoteURL,
+		}))
+	}
+	switch method := nearbycities.DistanceMethod(cfg.Search.DistanceMethod); method {
+	case "", nearbycities.Haversine:
+	case nearbycities.Geodesic:
+		opts = append(opts, nearbycities.WithDistanceMethod(method))
+	default:
+		closeLocators()
+		return nil, nil, fmt.Errorf("unknown distance method: %s", method)
+	}
+	if size := cfg.Search.ResultCacheSize; size > 0 {
+		opts = append(opts, nearbycities.WithResultCache(size, cfg.Search.ResultCacheTTL))
+	}
+
+	return nearbycities.NewService(store, opts...), closeLocators, nil
+}
+
+// buildIndexes builds the in-memory indexes of the cities of store, the
+// spatial index of cfg if any, the slugs and the fuzzy index, and makes svc
+// use them, reporting its progress to run.
+func buildIndexes(cfg config, store nearbycities.Storage, svc *nearbycities.Service, run *jobRun) error {
+	const steps = 3
+	idx, err := buildSpatialIndex(cfg.Search, store)
+	if err != nil {
+		return err
+	}
+	if idx != nil {
+		svc.UseSpatialIndex(idx)
+	}
+	run.setProgress(1, steps)
+
+	if err := citySlugs.build(context.Background(), store); err != nil {
+		return err
+	}
+	run.setProgress(2, steps)
+
+	fuzzy, err := nearbycities.BuildFuzzyIndex(context.Background(), store)
+	if err != nil {
+		return err
+	}
+	svc.UseFuzzyIndex(fuzzy)
+	run.setProgress(3, steps)
+
+	return nil
+}
+
+// importDataset imports the dataset into store if it is missing, along with
+// the elevations of the cities if there are SRTM tiles.
+func importDataset(cfg config, store nearbycities.Storage, logger zerolog.Logger) error {
+	start := time.Now()
+	if err := store.Import(cfg.IP2Location.Token); err != nil {
+		return err
+	}
+	logger.Info().Dur("duration", time.Since(start)).Msg("imported dataset")
+
+	if dir := cfg.Elevation.SRTMDir; dir != "" {
+		tiles := &nearbycities.SRTMTiles{Dir: dir}
+		defer tiles.Close()
+		if err := store.ImportElevation(tiles); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	recentCookie = "recent_searches"
+
+	// maxRecentSearches bounds the searches remembered per visitor.
+	maxRecentSearches = 5
+
+	// maxRecentQuery is the length beyond which a query is not remembered,
+	// to keep the cookie small.
+	maxRecentQuery = 100
+
+	recentSearchesAge = 30 * 24 * time.Hour
+)
+
+// sessions keeps the recent searches of the visitors in a cookie signed with
+// key, so that they cannot be forged.
+type sessions struct {
+	key []byte
+}
+
+// newSessions returns the sessions signed with the secret, or with a random
+// key if it is empty, which forgets the recent searches on restart.
+func newSessions(secret string) (*sessions, error) {
+	if secret != "" {
+		return &sessions{key: []byte(secret)}, nil
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+
+	return &sessions{key: key}, nil
+}
+
+func (s *sessions) sign(payload string) string {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// recent returns the last searches of the visitor, the latest first. A
+// missing or tampered cookie holds none.
+func (s *sessions) recent(r *http.Request) []string {
+	c, err := r.Cookie(recentCookie)
+	if err != nil {
+		return nil
+	}
+
+	payload, sig, ok := strings.Cut(c.Value, ".")
+	if !ok || !hmac.Equal([]byte(sig), []byte(s.sign(payload))) {
+		return nil
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return nil
+	}
+
+	var queries []string
+	if err := json.Unmarshal(data, &queries); err != nil {
+		return nil
+	}
+
+	return queries
+}
+
+// remember puts the query first in the recent searches of the visitor,
+// dropping the oldest one beyond maxRecentSearches.
+func (s *sessions) remember(w http.ResponseWriter, r *http.Request, query string) {
+	query = strings.TrimSpace(query)
+	if query == "" || len(query) > maxRecentQuery {
+		return
+	}
+
+	queries := []string{query}
+	for _, q := range s.recent(r) {
+		if len(queries) == maxRecentSearches {
+			break
+		}
+		if !strings.EqualFold(q, query) {
+			queries = append(queries, q)
+		}
+	}
+
+	data, err := json.Marshal(queries)
+	if err != nil {
+		return
+	}
+	payload := base64.RawURLEncoding.EncodeToString(data)
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     recentCookie,
+		Value:    payload + "." + s.sign(payload),
+		Path:     "/",
+		MaxAge:   int(recentSearchesAge.Seconds()),
+		Secure:   r.TLS != nil,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/quantonganh/httperror"
+	"github.com/quantonganh/nearby-cities/nearbycities"
+)
+
+// baseURL returns the public URL of the site, from BASE_URL or else from
+// the request.
+func baseURL(r *http.Request) string {
+	if u := os.Getenv("BASE_URL"); u != "" {
+		return strings.TrimSuffix(u, "/")
+	}
+
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+
+	return fmt.Sprintf("%s://%s", scheme, r.Host)
+}
+
+func robotsHandler() httperror.Handler {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		_, err := fmt.Fprintf(w, "User-agent: *\nDisallow: /api/\n\nSitemap: %s/sitemap.xml\n", baseURL(r))
+		return err
+	}
+}
+
+// sitemapCities is the number of cities listed by a sitemap, below the
+// 50,000 URLs and 50 MB a sitemap may hold.
+const sitemapCities = 45000
+
+// sitemapPath matches the paths of the sitemaps listed by the index.
+var sitemapPath = regexp.MustCompile(`^/sitemap-([1-9][0-9]*)\.xml$`)
+
+// errSitemapFull stops listing the cities once a sitemap holds its share.
+var errSitemapFull = errors.New("sitemap full")
+
+type sitemapURL struct {
+	XMLName xml.Name `xml:"url"`
+	Loc     string   `xml:"loc"`
+}
+
+type sitemapEntry struct {
+	XMLName xml.Name `xml:"sitemap"`
+	Loc     string   `xml:"loc"`
+}
+
+// sitemapCount returns the number of sitemaps listing the cities, at least
+// one for the home page.
+func sitemapCount(ctx context.Context, store nearbycities.Storage) (int, error) {
+	counts, err := store.Counts(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	return max(1, (int(counts["cities"])+sitemapCities-1)/sitemapCities), nil
+}
+
+// sitemapIndexHandler lists the sitemaps, /sitemap-1.xml and on, which
+// share the cities between them.
+func sitemapIndexHandler(store nearbycities.Storage) httperror.Handler {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		n, err := sitemapCount(r.Context(), store)
+		if err != nil {
+			return err
+		}
+
+		base := baseURL(r)
+		w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+		if _, err := fmt.Fprintf(w, "%s<sitemapindex xmlns=\"http://www.sitemaps.org/schemas/sitemap/0.9\">\n", xml.Header); err != nil {
+			return err
+		}
+
+		enc := xml.NewEncoder(w)
+		for i := 1; i <= n; i++ {
+			if err := enc.Encode(sitemapEntry{Loc: fmt.Sprintf("%s/sitemap-%d.xml", base, i)}); err != nil {
+				return err
+			}
+		}
+
+		_, err = w.Write([]byte("\n</sitemapindex>\n"))
+		return err
+	}
+}
+
+// sitemapHandler serves the sitemaps of the index, the first one listing
+// the home page too, and the other paths with next, which the sitemaps
+// share "/" with.
+func sitemapHandler(store nearbycities.Storage, next httperror.Handler) httperror.Handler {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		m := sitemapPath.FindStringSubmatch(r.URL.Path)
+		if m == nil {
+			return next(w, r)
+		}
+
+		page, err := strconv.Atoi(m[1])
+		if err != nil {
+			return httperror.New(http.StatusNotFound, "no such sitemap")
+		}
+		n, err := sitemapCount(r.Context(), store)
+		if err != nil {
+			return err
+		}
+		if page > n {
+			return httperror.New(http.StatusNotFound, "no such sitemap")
+		}
+
+		base := baseURL(r)
+		w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+		if _, err := fmt.Fprintf(w, "%s<urlset xmlns=\"http://www.sitemaps.org/schemas/sitemap/0.9\">\n", xml.Header); err != nil {
+			return err
+		}
+
+		enc := xml.NewEncoder(w)
+		if page == 1 {
+			if err := enc.Encode(sitemapURL{Loc: base + "/"}); err != nil {
+				return err
+			}
+		}
+
+		first, i := (page-1)*sitemapCities, 0
+		err = store.EachCity(r.Context(), func(c nearbycities.City) error {
+			defer func() { i++ }()
+			if i < first {
+				return nil
+			}
+			if i >= first+sitemapCities {
+				return errSitemapFull
+			}
+			return enc.Encode(sitemapURL{Loc: base + cityURL(c.ID)})
+		})
+		if err != nil && !errors.Is(err, errSitemapFull) {
+			return err
+		}
+
+		_, err = w.Write([]byte("\n</urlset>\n"))
+		return err
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/quantonganh/nearby-cities/nearbycities"
+)
+
+// citySlugs resolves the slugs of the city pages once the dataset has been
+// imported. The templates link to the pages through it, so it is shared.
+var citySlugs slugIndex
+
+type slugIndex struct {
+	table atomic.Pointer[slugTable]
+}
+
+type slugTable struct {
+	byID   map[string]string
+	bySlug map[string]string
+}
+
+// build computes the slugs of the cities of store.
+func (idx *slugIndex) build(ctx context.Context, store nearbycities.Storage) error {
+	var cities []nearbycities.City
+	err := store.EachCity(ctx, func(c nearbycities.City) error {
+		cities = append(cities, c)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	t := &slugTable{
+		byID:   nearbycities.CitySlugs(cities),
+		bySlug: make(map[string]string, len(cities)),
+	}
+	for id, slug := range t.byID {
+		t.bySlug[slug] = id
+	}
+	idx.table.Store(t)
+
+	return nil
+}
+
+// slug returns the slug of the city with the ID, if it is known.
+func (idx *slugIndex) slug(id string) (string, bool) {
+	t := idx.table.Load()
+	if t == nil {
+		return "", false
+	}
+
+	slug, ok := t.byID[id]
+	return slug, ok
+}
+
+// id returns the ID of the city with the slug, if it is known.
+func (idx *slugIndex) id(slug string) (string, bool) {
+	t := idx.table.Load()
+	if t == nil {
+		return "", false
+	}
+
+	id, ok := t.bySlug[slug]
+	return id, ok
+}
+
+// cityURL returns the path of the page of the city with the ID: its slug
+// once known, or else its ID.
+func cityURL(id string) string {
+	if slug, ok := citySlugs.slug(id); ok {
+		return "/nearby/" + slug
+	}
+
+	return "/city/" + id
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/quantonganh/httperror"
+	"github.com/quantonganh/nearby-cities/nearbycities"
+)
+
+const maxSuggestions = 10
+
+// streamHandler streams the search results as server-sent events while the
+// user is typing: a "match" event per city whose name starts with the query,
+// then a "nearby" event with the cities near the best match and a final
+// "done" event. Clients open a new stream each time the query changes.
+func streamHandler(svc *nearbycities.Service) httperror.Handler {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		query := strings.TrimSpace(r.FormValue("city"))
+		if query == "" {
+			return httperror.New(http.StatusBadRequest, "city is required")
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+
+		rc := http.NewResponseController(w)
+		send := func(event string, v any) error {
+			data, err := json.Marshal(v)
+			if err != nil {
+				return err
+			}
+
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data); err != nil {
+				return err
+			}
+
+			return rc.Flush()
+		}
+
+		matches, err := svc.Suggest(r.Context(), query, maxSuggestions)
+		if err != nil {
+			return send("error", map[string]string{"message": "search failed"})
+		}
+
+		for _, m := range matches {
+			if r.Context().Err() != nil {
+				return nil
+			}
+
+			if err := send("match", newCityResponse(m, unitKm)); err != nil {
+				return nil
+			}
+		}
+
+		if len(matches) > 0 {
+			nearby, err := svc.NearbyLatLng(r.Context(), matches[0].Lat, matches[0].Lng, defaultRadius)
+			if err != nil {
+				return send("error", map[string]string{"message": "search failed"})
+			}
+
+			if err := send("nearby", apiV1.cities(nearby, unitKm)); err != nil {
+				return nil
+			}
+		}
+
+		return send("done", map[string]int{"matches": len(matches)})
+	}
+}
@@ -0,0 +1,30 @@
+// Tells the page embedding the widget its height whenever it changes, for
+// the iframe to fit it:
+//
+//     window.addEventListener("message", function (e) {
+//         if (e.data && e.data.type === "nearby-cities:resize") {
+//             iframe.style.height = e.data.height + "px";
+//         }
+//     });
+(function () {
+    // The searches stay in the widget rather than in the history of the
+    // embedding page.
+    if (window.htmx) {
+        htmx.config.historyEnabled = false;
+    }
+    if (window.parent === window) {
+        return;
+    }
+
+    let height = 0;
+    function post() {
+        const h = document.documentElement.scrollHeight;
+        if (h !== height) {
+            height = h;
+            window.parent.postMessage({ type: "nearby-cities:resize", height: h }, "*");
+        }
+    }
+
+    new ResizeObserver(post).observe(document.body);
+    post();
+})();
@@ -0,0 +1,35 @@
+// Searches around the location of the browser, with the radius and unit of
+// the search form, when the "Use my location" button is clicked.
+(function () {
+    const button = document.getElementById("locate");
+    const error = document.getElementById("locate-error");
+    if (!button || !error || !navigator.geolocation) {
+        return;
+    }
+    button.hidden = false;
+
+    button.addEventListener("click", function () {
+        button.disabled = true;
+        error.hidden = true;
+
+        navigator.geolocation.getCurrentPosition(function (pos) {
+            // 4 decimals are about 10 m, as close as the cities need.
+            const params = new URLSearchParams({
+                lat: pos.coords.latitude.toFixed(4),
+                lng: pos.coords.longitude.toFixed(4),
+            });
+            for (const name of ["radius", "unit"]) {
+                const input = button.form.elements[name];
+                if (input && input.value) {
+                    params.set(name, input.value);
+                }
+            }
+            // The widget searches in place.
+            const path = window.location.pathname === "/embed" ? "/embed" : "/nearby";
+            window.location.assign(path + "?" + params);
+        }, function () {
+            button.disabled = false;
+            error.hidden = false;
+        }, { enableHighAccuracy: true, timeout: 10000, maximumAge: 60000 });
+    });
+})();
@@ -0,0 +1,68 @@
+// Shows the results on a map, the searched city and the cities around it
+// being read from the GeoJSON at the data-geojson URL of the map element.
+(function () {
+    function label(p) {
+        return [p.city, p.admin_name !== p.city && p.admin_name, p.country].filter(Boolean).join(", ");
+    }
+
+    function popup(p) {
+        const el = document.createElement(p.url ? "a" : "span");
+        if (p.url) {
+            el.href = p.url;
+        }
+        el.textContent = (p.flag ? p.flag + " " : "") + label(p);
+        if (p.origin) {
+            return el;
+        }
+
+        const div = document.createElement("div");
+        div.append(el, document.createElement("br"), p.distance_mi !== undefined ? p.distance_mi + " mi" : p.distance_km + " km");
+        return div;
+    }
+
+    function show(el) {
+        if (!window.L || el.dataset.loaded) {
+            return;
+        }
+        el.dataset.loaded = "true";
+
+        const map = L.map(el);
+        L.tileLayer("https://tile.openstreetmap.org/{z}/{x}/{y}.png", {
+            maxZoom: 19,
+            attribution: '&copy; <a href="https://www.openstreetmap.org/copyright">OpenStreetMap</a> contributors',
+        }).addTo(map);
+
+        fetch(el.dataset.geojson, { headers: { "Accept": "application/geo+json" } })
+            .then(function (res) {
+                if (!res.ok) {
+                    throw new Error(res.statusText);
+                }
+                return res.json();
+            })
+            .then(function (fc) {
+                const layer = L.geoJSON(fc, {
+                    pointToLayer: function (f, latlng) {
+                        if (f.properties.origin) {
+                            return L.marker(latlng, { zIndexOffset: 1000 });
+                        }
+                        return L.circleMarker(latlng, { radius: 6, weight: 1, fillOpacity: 0.7 });
+                    },
+                    onEachFeature: function (f, marker) {
+                        marker.bindPopup(popup(f.properties));
+                    },
+                }).addTo(map);
+                map.fitBounds(layer.getBounds(), { padding: [20, 20], maxZoom: 12 });
+            })
+            .catch(function () {
+                el.remove();
+            });
+    }
+
+    function showAll() {
+        document.querySelectorAll(".results-map[data-geojson]").forEach(show);
+    }
+
+    showAll();
+    // htmx swaps the results in place.
+    document.body.addEventListener("htmx:afterSwap", showAll);
+})();
@@ -0,0 +1,44 @@
+// Suggests city names while typing, fed by the /search/stream event stream.
+(function () {
+    const input = document.getElementById("city");
+    const list = document.getElementById("city-suggestions");
+    if (!input || !list) {
+        return;
+    }
+
+    let source = null;
+    let timer = null;
+
+    input.addEventListener("input", function () {
+        clearTimeout(timer);
+        timer = setTimeout(function () {
+            if (source) {
+                source.close();
+            }
+
+            const query = input.value.trim();
+            if (query.length < 2) {
+                list.replaceChildren();
+                return;
+            }
+
+            const options = [];
+            source = new EventSource("/search/stream?city=" + encodeURIComponent(query));
+            source.addEventListener("match", function (e) {
+                const c = JSON.parse(e.data);
+                const option = document.createElement("option");
+                option.value = c.admin_name && c.admin_name !== c.name
+                    ? c.name + ", " + c.admin_name + ", " + c.country
+                    : c.name + ", " + c.country;
+                options.push(option);
+                list.replaceChildren(...options);
+            });
+            source.addEventListener("done", function () {
+                source.close();
+            });
+            source.onerror = function () {
+                source.close();
+            };
+        }, 150);
+    });
+})();
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/quantonganh/nearby-cities/nearbycities"
+	"github.com/rs/zerolog/hlog"
+)
+
+// flushEvery is how many lines are written to a JSON lines stream between
+// flushes, so that the client gets the first rows without waiting for the
+// last ones.
+const flushEvery = 100
+
+// jsonLines writes a response as JSON lines, one value per line, as the
+// values come.
+type jsonLines struct {
+	w     http.ResponseWriter
+	rc    *http.ResponseController
+	enc   *json.Encoder
+	lines int
+}
+
+func newJSONLines(w http.ResponseWriter) *jsonLines {
+	return &jsonLines{w: w, rc: http.NewResponseController(w), enc: json.NewEncoder(w)}
+}
+
+// write writes v on a line of its own.
+func (l *jsonLines) write(v any) error {
+	if l.lines == 0 {
+		l.w.Header().Set("Content-Type", "application/x-ndjson")
+		l.w.WriteHeader(http.StatusOK)
+	}
+
+	if err := l.enc.Encode(v); err != nil {
+		return err
+	}
+
+	l.lines++
+	if l.lines%flushEvery == 0 {
+		return l.flush()
+	}
+	return nil
+}
+
+func (l *jsonLines) flush() error {
+	if err := l.rc.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return err
+	}
+	return nil
+}
+
+// streamCities writes the cities that each calls back with as JSON lines,
+// in the format of the API version, with their distance in the unit as
+// well. An error before the first line is
+// returned to be answered as usual; after it, the status has been sent, so
+// the error ends the stream with a last line holding its message.
+func streamCities(w http.ResponseWriter, r *http.Request, v apiVersion, u distanceUnit, each func(fn func(nearbycities.City) error) error) error {
+	lines := newJSONLines(w)
+	err := each(func(c nearbycities.City) error {
+		return lines.write(v.City(c, u))
+	})
+	if err == nil {
+		if lines.lines == 0 {
+			w.Header().Set("Content-Type", "application/x-ndjson")
+		}
+		return lines.flush()
+	}
+	if lines.lines == 0 {
+		return err
+	}
+
+	// A client that left cannot be told why the stream ended.
+	if errors.Is(err, context.Canceled) {
+		return nil
+	}
+	hlog.FromRequest(r).Err(err).Msg("streaming cities")
+	return lines.write(map[string]string{"message": "the stream failed"})
+}
+
+// eachCity calls fn for every city of the slice, stopping at the first error.
+func eachCity(cities []nearbycities.City, fn func(nearbycities.City) error) error {
+	for _, c := range cities {
+		if err := fn(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isStreamed reports whether the response to the request is written as the
+// rows are read, so that it must not be held back whole by a middleware.
+func isStreamed(r *http.Request) bool {
+	return responseFormat(r) == formatNDJSON
+}
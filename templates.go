@@ -0,0 +1,15 @@
+package main
+
+import (
+	"html/template"
+
+	"github.com/quantonganh/nearby-cities/nearbycities"
+)
+
+// templateFuncs are the helpers available to the HTML templates.
+var templateFuncs = template.FuncMap{
+	"flag":      nearbycities.FlagEmoji,
+	"cityURL":   cityURL,
+	"compass":   nearbycities.CompassPoint,
+	"localTime": localTime,
+}
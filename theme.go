@@ -0,0 +1,68 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/quantonganh/httperror"
+)
+
+// theme is the color theme of the pages.
+type theme string
+
+const (
+	themeLight theme = "light"
+	themeDark  theme = "dark"
+
+	themeCookie    = "theme"
+	themeCookieAge = 365 * 24 * time.Hour
+)
+
+// requestTheme returns the theme of the pages of the visitor: the one asked
+// for by the theme parameter, e.g. by a site embedding the search, or else
+// the one remembered in a cookie, or else the light one.
+func requestTheme(r *http.Request) theme {
+	if t := theme(r.FormValue("theme")); t == themeLight || t == themeDark {
+		return t
+	}
+	if c, err := r.Cookie(themeCookie); err == nil && theme(c.Value) == themeDark {
+		return themeDark
+	}
+	return themeLight
+}
+
+// Dark reports whether the page is rendered in the dark theme, which the
+// body of the page is then classed with, so that it is shown in it from the
+// first paint.
+func (t theme) Dark() bool {
+	return t == themeDark
+}
+
+// themeHandler serves /theme?theme=dark, the toggle of the pages, which
+// remembers the theme in a cookie and sends the visitor back to the page
+// they came from.
+func themeHandler() httperror.Handler {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		t := theme(r.FormValue("theme"))
+		if t != themeLight && t != themeDark {
+			return httperror.New(http.StatusBadRequest, "theme must be light or dark")
+		}
+		http.SetCookie(w, &http.Cookie{
+			Name:     themeCookie,
+			Value:    string(t),
+			Path:     "/",
+			MaxAge:   int(themeCookieAge.Seconds()),
+			Secure:   r.TLS != nil,
+			SameSite: http.SameSiteLaxMode,
+		})
+
+		// Only a page of the site is gone back to.
+		back := "/"
+		if ref, err := url.Parse(r.Referer()); err == nil && ref.Host == r.Host && ref.Path != "/theme" {
+			back = ref.RequestURI()
+		}
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return nil
+	}
+}
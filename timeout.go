@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// withTimeout is context.WithTimeout, without a deadline when timeout is 0.
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// timeoutHandler gives every request timeout to complete, after which its
+// context is done, cancelling its queries, and it is answered 503 Service
+// Unavailable. The streams of the search box and the websocket last as long
+// as their client stays, and are left alone, as are the JSON lines streams,
+// which http.TimeoutHandler would hold whole.
+func timeoutHandler(timeout time.Duration) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if timeout <= 0 {
+			return next
+		}
+
+		limited := http.TimeoutHandler(next, timeout, "message: the request timed out")
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/search/stream" || r.URL.Path == "/ws" || isStreamed(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			limited.ServeHTTP(w, r)
+		})
+	}
+}
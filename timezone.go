@@ -0,0 +1,30 @@
+package main
+
+import (
+	"time"
+	_ "time/tzdata" // the timezones are not installed in the container image
+)
+
+// localTime returns the current time in the IANA timezone, with its offset,
+// or an empty string if the timezone is not known.
+func localTime(timezone string) string {
+	t, ok := cityTime(timezone)
+	if !ok {
+		return ""
+	}
+	return t.Format("15:04 (UTC-07:00)")
+}
+
+// cityTime returns the current time in the IANA timezone, if it is known.
+func cityTime(timezone string) (time.Time, bool) {
+	if timezone == "" {
+		return time.Time{}, false
+	}
+
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return time.Now().In(loc), true
+}
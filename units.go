@@ -0,0 +1,89 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/quantonganh/httperror"
+)
+
+// distanceUnit is the unit the distances are shown in.
+type distanceUnit string
+
+const (
+	unitKm distanceUnit = "km"
+	unitMi distanceUnit = "mi"
+
+	kmPerMile = 1.609344
+
+	unitCookie    = "unit"
+	unitCookieAge = 365 * 24 * time.Hour
+)
+
+// parseUnit returns the unit asked for by the unit parameter, kilometers
+// when it is missing.
+func parseUnit(r *http.Request) (distanceUnit, error) {
+	switch u := distanceUnit(r.FormValue("unit")); u {
+	case "":
+		return unitKm, nil
+	case unitKm, unitMi:
+		return u, nil
+	default:
+		return "", httperror.New(http.StatusBadRequest, "unit must be km or mi")
+	}
+}
+
+// preferredUnit returns the unit of the pages of the visitor: the one asked
+// for by the unit parameter, which is remembered in a cookie for the next
+// pages, or else the one remembered. The API only follows the parameter, as
+// its responses are cached by URL.
+func preferredUnit(w http.ResponseWriter, r *http.Request) (distanceUnit, error) {
+	if r.FormValue("unit") != "" {
+		u, err := parseUnit(r)
+		if err != nil {
+			return "", err
+		}
+		http.SetCookie(w, &http.Cookie{
+			Name:     unitCookie,
+			Value:    string(u),
+			Path:     "/",
+			MaxAge:   int(unitCookieAge.Seconds()),
+			Secure:   r.TLS != nil,
+			SameSite: http.SameSiteLaxMode,
+		})
+		return u, nil
+	}
+
+	if c, err := r.Cookie(unitCookie); err == nil && distanceUnit(c.Value) == unitMi {
+		return unitMi, nil
+	}
+	return unitKm, nil
+}
+
+// fromKm converts the kilometers to the unit, to the same hundredths of a
+// unit the distances are rounded to.
+func (u distanceUnit) fromKm(km float64) float64 {
+	if u != unitMi {
+		return km
+	}
+	return math.Round(km/kmPerMile*100) / 100
+}
+
+// toKm converts the distance in the unit to kilometers.
+func (u distanceUnit) toKm(d float64) float64 {
+	if u != unitMi {
+		return d
+	}
+	return d * kmPerMile
+}
+
+// miles returns the kilometers in miles when the unit is miles, for the
+// distance_mi fields of the JSON responses.
+func (u distanceUnit) miles(km float64) *float64 {
+	if u != unitMi {
+		return nil
+	}
+	mi := u.fromKm(km)
+	return &mi
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/quantonganh/nearby-cities/nearbycities"
+	"github.com/rs/zerolog"
+)
+
+// runUpdate runs the update subcommand, which applies the world cities CSV
+// release at the path given in args to the configured database.
+func runUpdate(cfg config, logger zerolog.Logger, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: %s update worldcities.csv", os.Args[0])
+	}
+
+	f, err := os.Open(args[0])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	release, err := nearbycities.ReadWorldCities(f)
+	if err != nil {
+		return err
+	}
+
+	store, err := openStorage(cfg, logger)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	if err := store.MigrateUp(ctx); err != nil {
+		return err
+	}
+
+	changes, err := store.UpdateCities(ctx, "", release)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(changes)
+	return nil
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/quantonganh/httperror"
+	"github.com/quantonganh/nearby-cities/nearbycities"
+	"github.com/rs/zerolog/hlog"
+)
+
+const (
+	wsWriteWait  = 10 * time.Second
+	wsPongWait   = 60 * time.Second
+	wsPingPeriod = wsPongWait * 9 / 10
+	wsSendBuffer = 16
+)
+
+// wsCommand is a message sent by a client. Type is either "search", which
+// uses City, or CityID to pick one of the cities of an "ambiguous" reply, or
+// "nearby", which uses Lat and Lng. ID is echoed back in the matching reply.
+type wsCommand struct {
+	ID     string  `json:"id,omitempty"`
+	Type   string  `json:"type"`
+	City   string  `json:"city,omitempty"`
+	CityID string  `json:"city_id,omitempty"`
+	Lat    float64 `json:"lat,omitempty"`
+	Lng    float64 `json:"lng,omitempty"`
+	Radius float64 `json:"radius,omitempty"`
+}
+
+// wsMessage is a message sent to clients, either a reply to a command or a
+// server push such as "dataset_refreshed". An "ambiguous" reply lists the
+// cities bearing the name searched for in Namesakes, and the error of a
+// search matching none the names spelt close to it in Suggestions.
+type wsMessage struct {
+	ID          string             `json:"id,omitempty"`
+	Type        string             `json:"type"`
+	Cities      []any              `json:"cities,omitempty"`
+	Namesakes   []namesakeResponse `json:"namesakes,omitempty"`
+	Suggestions []string           `json:"suggestions,omitempty"`
+	Message     string             `json:"message,omitempty"`
+}
+
+// wsHub keeps track of the connected clients so that events can be pushed to
+// all of them.
+type wsHub struct {
+	mu      sync.Mutex
+	clients map[chan wsMessage]struct{}
+}
+
+func newWSHub() *wsHub {
+	return &wsHub{
+		clients: make(map[chan wsMessage]struct{}),
+	}
+}
+
+func (h *wsHub) register() chan wsMessage {
+	ch := make(chan wsMessage, wsSendBuffer)
+	h.mu.Lock()
+	h.clients[ch] = struct{}{}
+	h.mu.Unlock()
+	return ch
+}
+
+func (h *wsHub) unregister(ch chan wsMessage) {
+	h.mu.Lock()
+	delete(h.clients, ch)
+	h.mu.Unlock()
+}
+
+// broadcast sends the message to every client, skipping those too slow to
+// keep up.
+func (h *wsHub) broadcast(msg wsMessage) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for ch := range h.clients {
+		select {
+		case ch <- msg:
+		default:
+		}
+	}
+}
+
+func wsHandler(svc *nearbycities.Service, hub *wsHub, cors corsOptions, timeout time.Duration) httperror.Handler {
+	upgrader := websocket.Upgrader{
+		CheckOrigin: func(r *http.Request) bool {
+			origin := r.Header.Get("Origin")
+			if origin == "" {
+				return true
+			}
+
+			u, err := url.Parse(origin)
+			if err != nil {
+				return false
+			}
+
+			return strings.EqualFold(u.Host, r.Host) || cors.isOriginAllowed(origin)
+		},
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) error {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			// The upgrader has already replied to the client.
+			return nil
+		}
+		defer conn.Close()
+
+		send := hub.register()
+		defer hub.unregister(send)
+
+		done := make(chan struct{})
+		stopped := make(chan struct{})
+		go func() {
+			wsWritePump(conn, send, done)
+			close(stopped)
+		}()
+		defer close(done)
+
+		conn.SetReadDeadline(time.Now().Add(wsPongWait))
+		conn.SetPongHandler(func(string) error {
+			return conn.SetReadDeadline(time.Now().Add(wsPongWait))
+		})
+
+		for {
+			var cmd wsCommand
+			if err := conn.ReadJSON(&cmd); err != nil {
+				if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+					hlog.FromRequest(r).Err(err).Msg("websocket read")
+				}
+				return nil
+			}
+
+			// The upgraded request lasts as long as the connection, so each
+			// command gets the time of a request.
+			ctx, cancel := withTimeout(r.Context(), timeout)
+			reply := handleWSCommand(ctx, svc, cmd)
+			cancel()
+			select {
+			case send <- reply:
+			case <-stopped:
+				return nil
+			case <-r.Context().Done():
+				return nil
+			}
+		}
+	}
+}
+
+func handleWSCommand(ctx context.Context, svc *nearbycities.Service, cmd wsCommand) wsMessage {
+	radius := cmd.Radius
+	if radius <= 0 {
+		radius = defaultRadius
+	}
+	if radius > maxRadius {
+		return wsMessage{ID: cmd.ID, Type: "error", Message: fmt.Sprintf("radius must be a positive number of kilometers up to %.0f", maxRadius)}
+	}
+
+	var (
+		cities []nearbycities.City
+		err    error
+	)
+	switch cmd.Type {
+	case "search":
+		_, cities, err = searchCity(ctx, svc, cmd.City, cmd.CityID, radius)
+		var ambiguous *nearbycities.AmbiguousError
+		if errors.As(err, &ambiguous) {
+			resp := newAmbiguousResponse(ambiguous)
+			return wsMessage{ID: cmd.ID, Type: "ambiguous", Namesakes: resp.Cities, Message: resp.Message}
+		}
+		if errors.Is(err, nearbycities.ErrNotFound) {
+			resp := newNoMatchResponse(svc.DidYouMean(cmd.City, maxDidYouMean))
+			return wsMessage{ID: cmd.ID, Type: "error", Suggestions: resp.Suggestions, Message: resp.Message}
+		}
+	case "nearby":
+		// JSON has no NaN or infinity, so the ranges are all to check.
+		if cmd.Lat < -90 || cmd.Lat > 90 {
+			return wsMessage{ID: cmd.ID, Type: "error", Message: "lat must be a number in the range [-90, 90]"}
+		}
+		if cmd.Lng < -180 || cmd.Lng > 180 {
+			return wsMessage{ID: cmd.ID, Type: "error", Message: "lng must be a number in the range [-180, 180]"}
+		}
+		cities, err = svc.NearbyLatLng(ctx, cmd.Lat, cmd.Lng, radius)
+	default:
+		return wsMessage{ID: cmd.ID, Type: "error", Message: "unknown command type: " + cmd.Type}
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return wsMessage{ID: cmd.ID, Type: "error", Message: "the search timed out"}
+	}
+	if err != nil {
+		return wsMessage{ID: cmd.ID, Type: "error", Message: "search failed"}
+	}
+
+	return wsMessage{ID: cmd.ID, Type: "results", Cities: apiV1.cities(cities, unitKm)}
+}
+
+// wsWritePump is the only goroutine writing to the connection: it sends the
+// queued messages and keeps the connection alive with pings. A failed write
+// closes the connection, which ends the read loop too.
+func wsWritePump(conn *websocket.Conn, send <-chan wsMessage, done <-chan struct{}) {
+	ticker := time.NewTicker(wsPingPeriod)
+	defer ticker.Stop()
+	defer conn.Close()
+
+	for {
+		select {
+		case msg := <-send:
+			conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := conn.WriteJSON(msg); err != nil {
+				return
+			}
+		case <-ticker.C:
+			conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		case <-done:
+			return
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestHandleWSCommandInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		cmd     wsCommand
+		message string
+	}{
+		{"latitude", wsCommand{ID: "1", Type: "nearby", Lat: 91, Lng: 105.8542}, "lat must be a number in the range [-90, 90]"},
+		{"longitude", wsCommand{ID: "2", Type: "nearby", Lat: 21.0283, Lng: -180.5}, "lng must be a number in the range [-180, 180]"},
+		{"radius", wsCommand{ID: "3", Type: "nearby", Lat: 21.0283, Lng: 105.8542, Radius: 40000}, "radius must be a positive number of kilometers up to 20038"},
+		{"search radius", wsCommand{ID: "4", Type: "search", City: "Hanoi", Radius: 40000}, "radius must be a positive number of kilometers up to 20038"},
+		{"type", wsCommand{ID: "5", Type: "route"}, "unknown command type: route"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The commands are rejected before the service is asked.
+			got := handleWSCommand(context.Background(), nil, tt.cmd)
+			if got.ID != tt.cmd.ID || got.Type != "error" || got.Message != tt.message {
+				t.Errorf("got %+v, want the error %q", got, tt.message)
+			}
+		})
+	}
+}